@@ -0,0 +1,623 @@
+package tinydom
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeType 是结构化差异中一个变化的类型
+type ChangeType int
+
+const (
+	ChangeInsert    ChangeType = iota // 插入节点
+	ChangeDelete                      // 删除节点
+	ChangeMove                        // 节点(连同后代)被原样移动到了其它位置
+	ChangeRename                      // 元素改名,属性和子节点都没有变化
+	ChangeAttribute                   // 属性增加、删除、修改或者属性的顺序变化
+	ChangeText                        // 文本、注释、处理指令或者指令的内容变化
+)
+
+var changeTypeNames = []string{"insert", "delete", "move", "rename", "attribute", "text"}
+
+// String 返回变化类型的名字
+func (t ChangeType) String() string {
+	if (t < 0) || (int(t) >= len(changeTypeNames)) {
+		return "unknown"
+	}
+	return changeTypeNames[t]
+}
+
+// Change 是Diff计算出的一个变化,Path是节点在a中的路径,NewPath是节点在b中的路径,路径都可以当作XPath使用.
+//
+// ChangeInsert的Node是新节点在a中的父节点,Path是这个父节点的路径;ChangeDelete的NewNode为nil,NewPath为空.
+// ChangeAttribute的Node和NewNode是属性所在的元素,属性被增加或者删除时可以通过FindAttribute区分;
+// Attribute为空时表示属性的顺序变化,OldValue和NewValue是a和b中用空格分开的完整的属性名列表,这个变化排在同一个元素的其它属性变化之后.
+// ChangeRename、ChangeAttribute和ChangeText的OldValue、NewValue分别是旧的和新的名字或者值.
+type Change struct {
+	Type      ChangeType
+	Path      string
+	NewPath   string
+	Node      XMLNode // a中的节点
+	NewNode   XMLNode // b中的节点
+	Attribute string
+	OldValue  string
+	NewValue  string
+
+	hash uint64 // 插入和删除的子树的签名,用于识别跨父节点的移动
+}
+
+// DiffOptions 是Diff的比较选项
+type DiffOptions struct {
+	IgnoreWhitespace     bool // 忽略全空白的文本,其它文本比较之前把连续的空白规范化成一个空格
+	IgnoreComments       bool // 忽略注释
+	IgnoreAttributeOrder bool // 不报告属性顺序的变化
+}
+
+// Diff 计算把a变成b的结构化编辑脚本,a和b相同时返回空列表.
+//
+// 子节点先按照最长公共子序列对齐完全相同的子树,剩下的子树中完全相同的、同名(有id属性时还要求id相同)的元素、
+// 文本、注释和同一目标的处理指令、内容相同只是名字不同的元素依次被对应起来递归比较,其余的是插入和删除.
+// 对应起来的节点的相对顺序发生变化时报告移动.最后,整个文档中被删除又被原样插入到其它父节点之下的元素也被识别为移动.
+func Diff(a XMLNode, b XMLNode, opts DiffOptions) []Change {
+	d := newDiffer(opts)
+	d.diffNode(a, b)
+	return d.moves()
+}
+
+func newDiffer(opts DiffOptions) *differ {
+	return &differ{
+		opts:     opts,
+		hashes:   make(map[XMLNode]uint64),
+		contents: make(map[XMLNode]uint64),
+		pairs:    make(map[XMLNode]XMLNode),
+		sames:    make(map[[2]XMLNode]bool),
+	}
+}
+
+type differ struct {
+	opts     DiffOptions
+	changes  []Change
+	hashes   map[XMLNode]uint64  // 子树的签名
+	contents map[XMLNode]uint64  // 元素除了名字之外的内容的签名
+	pairs    map[XMLNode]XMLNode // a中的子节点与b中对应的子节点
+	sames    map[[2]XMLNode]bool // 签名相同的两棵子树是否真的相同
+}
+
+// children 返回参与比较的子节点,被选项忽略的节点不参与比较
+func (d *differ) children(node XMLNode) []XMLNode {
+	var result []XMLNode
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		if d.ignored(child) {
+			continue
+		}
+		result = append(result, child)
+	}
+	return result
+}
+
+func (d *differ) ignored(node XMLNode) bool {
+	switch {
+	case nil != node.ToComment():
+		return d.opts.IgnoreComments
+	case nil != node.ToText():
+		return d.opts.IgnoreWhitespace && ("" == strings.TrimSpace(node.Value()))
+	}
+	return false
+}
+
+// text 返回节点参与比较的值
+func (d *differ) text(node XMLNode) string {
+	value := node.Value()
+	if pi := node.ToProcInst(); nil != pi {
+		value = pi.Target() + " " + pi.Instruction()
+	}
+
+	if d.opts.IgnoreWhitespace && (nil != node.ToText()) {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value
+}
+
+// attributes 返回参与比较的属性,忽略属性顺序时按照名字排序
+func (d *differ) attributes(elem XMLElement) []XMLAttribute {
+	var attrs []XMLAttribute
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		attrs = append(attrs, attribute)
+		return 0
+	})
+
+	if d.opts.IgnoreAttributeOrder {
+		sort.Sort(attributesByName(attrs))
+	}
+	return attrs
+}
+
+// attributesByName 按照属性名排序
+type attributesByName []XMLAttribute
+
+func (a attributesByName) Len() int           { return len(a) }
+func (a attributesByName) Less(i, j int) bool { return a[i].Name() < a[j].Name() }
+func (a attributesByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// hash 返回子树的签名,两棵子树按照选项比较相等时签名相同
+func (d *differ) hash(node XMLNode) uint64 {
+	if h, ok := d.hashes[node]; ok {
+		return h
+	}
+
+	h := fnv.New64a()
+	switch {
+	case nil != node.ToElement():
+		h.Write([]byte("e" + node.ToElement().Name() + "\x00"))
+		writeUint64(h, d.content(node.ToElement()))
+	case nil != node.ToDocument():
+		h.Write([]byte("D"))
+		for _, child := range d.children(node) {
+			writeUint64(h, d.hash(child))
+		}
+	default:
+		h.Write([]byte(nodeKind(node) + d.text(node)))
+	}
+
+	d.hashes[node] = h.Sum64()
+	return d.hashes[node]
+}
+
+// content 返回元素的属性和子节点的签名
+func (d *differ) content(elem XMLElement) uint64 {
+	if h, ok := d.contents[elem]; ok {
+		return h
+	}
+
+	h := fnv.New64a()
+	for _, attr := range d.attributes(elem) {
+		h.Write([]byte(attr.Name() + "\x00" + attr.Value() + "\x00"))
+	}
+	h.Write([]byte{0xff})
+	for _, child := range d.children(elem) {
+		writeUint64(h, d.hash(child))
+	}
+
+	d.contents[elem] = h.Sum64()
+	return d.contents[elem]
+}
+
+// same 判断两棵子树按照选项比较是否相同.签名只用来快速排除不同的子树,签名相同时再比较结构,签名冲突不会丢掉变化
+func (d *differ) same(a XMLNode, b XMLNode) bool {
+	if d.hash(a) != d.hash(b) {
+		return false
+	}
+
+	key := [2]XMLNode{a, b}
+	if result, ok := d.sames[key]; ok {
+		return result
+	}
+
+	result := false
+	switch {
+	case nodeKind(a) != nodeKind(b):
+	case nil != a.ToElement():
+		result = (a.ToElement().Name() == b.ToElement().Name()) && d.sameContent(a.ToElement(), b.ToElement())
+	case nil != a.ToDocument():
+		result = d.sameChildren(a, b)
+	default:
+		result = d.text(a) == d.text(b)
+	}
+
+	d.sames[key] = result
+	return result
+}
+
+// sameContent 判断两个元素除了名字之外的属性和子节点是否相同
+func (d *differ) sameContent(a XMLElement, b XMLElement) bool {
+	if d.content(a) != d.content(b) {
+		return false
+	}
+
+	la, lb := d.attributes(a), d.attributes(b)
+	if len(la) != len(lb) {
+		return false
+	}
+	for i := range la {
+		if (la[i].Name() != lb[i].Name()) || (la[i].Value() != lb[i].Value()) {
+			return false
+		}
+	}
+
+	return d.sameChildren(a, b)
+}
+
+func (d *differ) sameChildren(a XMLNode, b XMLNode) bool {
+	la, lb := d.children(a), d.children(b)
+	if len(la) != len(lb) {
+		return false
+	}
+	for i := range la {
+		if !d.same(la[i], lb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeUint64(h hash.Hash64, v uint64) {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = byte(v >> (8 * uint(i)))
+	}
+	h.Write(buf[:])
+}
+
+// nodeKind 返回节点类型的标记,只有同一类型的节点才会被对应起来比较
+func nodeKind(node XMLNode) string {
+	switch {
+	case nil != node.ToElement():
+		return "e"
+	case nil != node.ToText():
+		return "t"
+	case nil != node.ToComment():
+		return "c"
+	case nil != node.ToProcInst():
+		return "p" + node.ToProcInst().Target() + "\x00"
+	case nil != node.ToDirective():
+		return "d"
+	}
+	return "D"
+}
+
+func (d *differ) add(change Change) {
+	d.changes = append(d.changes, change)
+}
+
+// diffNode 比较两个已经对应起来的节点
+func (d *differ) diffNode(a XMLNode, b XMLNode) {
+	if nodeKind(a) != nodeKind(b) {
+		d.add(Change{Type: ChangeDelete, Path: NodePath(a), Node: a, hash: d.hash(a)})
+		d.add(Change{Type: ChangeInsert, Path: NodePath(a.Parent()), NewPath: NodePath(b), Node: a.Parent(), NewNode: b, hash: d.hash(b)})
+		return
+	}
+
+	if d.same(a, b) {
+		return
+	}
+
+	ea, eb := a.ToElement(), b.ToElement()
+	switch {
+	case (nil != ea) && (nil != eb):
+		if ea.Name() != eb.Name() {
+			d.add(Change{Type: ChangeRename, Path: NodePath(a), NewPath: NodePath(b), Node: a, NewNode: b, OldValue: ea.Name(), NewValue: eb.Name()})
+		}
+		d.diffAttributes(ea, eb)
+		d.diffChildren(a, b)
+	case nil != a.ToDocument():
+		d.diffChildren(a, b)
+	case nil != a.ToProcInst():
+		d.add(Change{Type: ChangeText, Path: NodePath(a), NewPath: NodePath(b), Node: a, NewNode: b, OldValue: a.ToProcInst().Instruction(), NewValue: b.ToProcInst().Instruction()})
+	default:
+		d.add(Change{Type: ChangeText, Path: NodePath(a), NewPath: NodePath(b), Node: a, NewNode: b, OldValue: a.Value(), NewValue: b.Value()})
+	}
+}
+
+func (d *differ) diffAttributes(a XMLElement, b XMLElement) {
+	change := func(name string, oldValue string, newValue string) {
+		d.add(Change{Type: ChangeAttribute, Path: NodePath(a), NewPath: NodePath(b), Node: a, NewNode: b, Attribute: name, OldValue: oldValue, NewValue: newValue})
+	}
+
+	// edited是删除、修改和增加属性之后的顺序:保留下来的属性按照a中的顺序,增加的属性按照b中的顺序排在最后
+	var oldOrder, newOrder, edited []string
+	for _, attr := range d.attributes(a) {
+		oldOrder = append(oldOrder, attr.Name())
+		other := b.FindAttribute(attr.Name())
+		if nil == other {
+			change(attr.Name(), attr.Value(), "")
+			continue
+		}
+
+		edited = append(edited, attr.Name())
+		if attr.Value() != other.Value() {
+			change(attr.Name(), attr.Value(), other.Value())
+		}
+	}
+
+	for _, attr := range d.attributes(b) {
+		newOrder = append(newOrder, attr.Name())
+		if nil == a.FindAttribute(attr.Name()) {
+			change(attr.Name(), "", attr.Value())
+			edited = append(edited, attr.Name())
+		}
+	}
+
+	// 编辑之后的顺序与b不同时报告完整的属性顺序,例如在已有的属性之前增加属性
+	if !d.opts.IgnoreAttributeOrder && (strings.Join(edited, " ") != strings.Join(newOrder, " ")) {
+		change("", strings.Join(oldOrder, " "), strings.Join(newOrder, " "))
+	}
+}
+
+// diffChildren 对齐两个节点的子节点并比较
+func (d *differ) diffChildren(a XMLNode, b XMLNode) {
+	la, lb := d.children(a), d.children(b)
+	pairA := make([]int, len(la)) // la[i]对应的lb中的下标,-1表示没有对应的节点
+	pairB := make([]int, len(lb))
+	for i := range pairA {
+		pairA[i] = -1
+	}
+	for i := range pairB {
+		pairB[i] = -1
+	}
+
+	// 完全相同的子树按照最长公共子序列对齐,它们没有变化
+	for _, pair := range d.lcs(la, lb) {
+		pairA[pair[0]], pairB[pair[1]] = pair[1], pair[0]
+	}
+
+	// 剩下的节点依次尝试对应起来:先是完全相同的子树,然后是同一类型的节点(元素还要求名字相同,有id属性时id也要相同),
+	// 最后是内容相同只是名字不同的元素.文档只有一个根元素,两个根元素总是对应起来比较
+	matchers := []func(x XMLNode, y XMLNode) bool{
+		d.same,
+		d.similar,
+		func(x XMLNode, y XMLNode) bool {
+			return (nil != x.ToElement()) && (nil != y.ToElement()) && d.sameContent(x.ToElement(), y.ToElement())
+		},
+		func(x XMLNode, y XMLNode) bool {
+			return (nil != a.ToDocument()) && (nil != x.ToElement()) && (nil != y.ToElement())
+		},
+	}
+	for _, match := range matchers {
+		for i, x := range la {
+			for j, y := range lb {
+				if (pairA[i] < 0) && (pairB[j] < 0) && match(x, y) {
+					pairA[i], pairB[j] = j, i
+				}
+			}
+		}
+	}
+
+	// 对应的节点中,不在最长递增子序列中的节点是在同一个父节点之下的移动
+	inOrder := longestIncreasing(pairA)
+	for i, x := range la {
+		j := pairA[i]
+		if j < 0 {
+			d.add(Change{Type: ChangeDelete, Path: NodePath(x), Node: x, hash: d.hash(x)})
+			continue
+		}
+
+		d.pairs[x] = lb[j]
+		if !inOrder[i] {
+			d.add(Change{Type: ChangeMove, Path: NodePath(x), NewPath: NodePath(lb[j]), Node: x, NewNode: lb[j]})
+		}
+		d.diffNode(x, lb[j])
+	}
+
+	for j, y := range lb {
+		if pairB[j] < 0 {
+			d.add(Change{Type: ChangeInsert, Path: NodePath(a), NewPath: NodePath(y), Node: a, NewNode: y, hash: d.hash(y)})
+		}
+	}
+}
+
+// longestIncreasing 标记出seq中组成最长递增子序列的元素,值为负数的元素被忽略
+func longestIncreasing(seq []int) []bool {
+	var tails []int // tails[k]是长度为k+1的递增子序列的最后一个元素在seq中的下标
+	prev := make([]int, len(seq))
+	for i, v := range seq {
+		prev[i] = -1
+		if v < 0 {
+			continue
+		}
+
+		k := sort.Search(len(tails), func(k int) bool {
+			return seq[tails[k]] >= v
+		})
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	result := make([]bool, len(seq))
+	if 0 != len(tails) {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			result[i] = true
+		}
+	}
+	return result
+}
+
+// similar 判断两个不完全相同的节点是否应该对应起来比较
+func (d *differ) similar(a XMLNode, b XMLNode) bool {
+	if nodeKind(a) != nodeKind(b) {
+		return false
+	}
+
+	ea, eb := a.ToElement(), b.ToElement()
+	if nil == ea {
+		return true
+	}
+
+	if ea.Name() != eb.Name() {
+		return false
+	}
+
+	ida, idb := ea.FindAttribute("id"), eb.FindAttribute("id")
+	return ((nil == ida) && (nil == idb)) || ((nil != ida) && (nil != idb) && (ida.Value() == idb.Value()))
+}
+
+// lcs 返回按照签名计算的最长公共子序列,结果是对应的下标对,相同的前缀和后缀不参与动态规划
+func (d *differ) lcs(la []XMLNode, lb []XMLNode) [][2]int {
+	var pairs [][2]int
+	start := 0
+	for (start < len(la)) && (start < len(lb)) && d.same(la[start], lb[start]) {
+		pairs = append(pairs, [2]int{start, start})
+		start++
+	}
+
+	endA, endB := len(la), len(lb)
+	var suffix [][2]int
+	for (endA > start) && (endB > start) && d.same(la[endA-1], lb[endB-1]) {
+		endA--
+		endB--
+		suffix = append(suffix, [2]int{endA, endB})
+	}
+
+	n, m := endA-start, endB-start
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if d.same(la[start+i], lb[start+j]) {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] >= table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+
+	for i, j := 0, 0; (i < n) && (j < m); {
+		switch {
+		case d.same(la[start+i], lb[start+j]):
+			pairs = append(pairs, [2]int{start + i, start + j})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	for i := len(suffix) - 1; i >= 0; i-- {
+		pairs = append(pairs, suffix[i])
+	}
+	return pairs
+}
+
+// moves 把被删除又被原样插入到其它父节点之下的元素合并成移动,移动出现在删除的位置
+func (d *differ) moves() []Change {
+	inserted := make(map[uint64][]int)
+	for i, change := range d.changes {
+		if (ChangeInsert == change.Type) && (nil != change.NewNode.ToElement()) {
+			inserted[change.hash] = append(inserted[change.hash], i)
+		}
+	}
+
+	merged := make(map[int]bool)
+	for i := range d.changes {
+		change := &d.changes[i]
+		if (ChangeDelete != change.Type) || (nil == change.Node.ToElement()) {
+			continue
+		}
+
+		// 签名相同的插入中找出与被删除的子树真正相同的一个
+		candidates := inserted[change.hash]
+		k := 0
+		for (k < len(candidates)) && !d.same(change.Node, d.changes[candidates[k]].NewNode) {
+			k++
+		}
+		if k == len(candidates) {
+			continue
+		}
+
+		j := candidates[k]
+		inserted[change.hash] = append(candidates[:k:k], candidates[k+1:]...)
+		change.Type = ChangeMove
+		change.NewPath = d.changes[j].NewPath
+		change.NewNode = d.changes[j].NewNode
+		merged[j] = true
+	}
+
+	var result []Change
+	for i, change := range d.changes {
+		if !merged[i] {
+			change.hash = 0
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// ------------------------------------------------------------------
+
+// String 返回变化的可读形式,例如:attribute /config/server/@port: "80" -> "8080"
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeInsert:
+		return "insert " + c.NewPath + ": " + describeNode(c.NewNode)
+	case ChangeDelete:
+		return "delete " + c.Path + ": " + describeNode(c.Node)
+	case ChangeMove, ChangeRename:
+		return c.Type.String() + " " + c.Path + " -> " + c.NewPath
+	case ChangeAttribute:
+		if "" == c.Attribute {
+			return "attribute order " + c.Path + ": " + strconv.Quote(c.OldValue) + " -> " + strconv.Quote(c.NewValue)
+		}
+		return "attribute " + c.Path + "/@" + c.Attribute + ": " + c.attributeValue(c.Node, c.OldValue) + " -> " + c.attributeValue(c.NewNode, c.NewValue)
+	}
+
+	return c.Type.String() + " " + c.Path + ": " + strconv.Quote(c.OldValue) + " -> " + strconv.Quote(c.NewValue)
+}
+
+// attributeValue 返回属性值的可读形式,属性不存在时返回(none)
+func (c Change) attributeValue(node XMLNode, value string) string {
+	if elem := node.ToElement(); (nil == elem) || (nil == elem.FindAttribute(c.Attribute)) {
+		return "(none)"
+	}
+	return strconv.Quote(value)
+}
+
+// describeNode 返回节点的简短描述,元素只有开始标签
+func describeNode(node XMLNode) string {
+	switch {
+	case nil != node.ToElement():
+		var text bytes.Buffer
+		text.WriteString("<" + node.ToElement().Name())
+		node.ToElement().ForeachAttribute(func(attribute XMLAttribute) int {
+			text.WriteString(" " + attribute.Name() + "=" + strconv.Quote(attribute.Value()))
+			return 0
+		})
+		text.WriteString(">")
+		return text.String()
+	case nil != node.ToComment():
+		return "<!--" + node.Value() + "-->"
+	case nil != node.ToProcInst():
+		return "<?" + node.ToProcInst().Target() + " " + node.ToProcInst().Instruction() + "?>"
+	case nil != node.ToDirective():
+		return "<!" + node.Value() + ">"
+	}
+
+	return strconv.Quote(node.Value())
+}
+
+// FormatDiff 返回变化列表的可读形式,每个变化一行
+func FormatDiff(changes []Change) string {
+	var text bytes.Buffer
+	for _, change := range changes {
+		text.WriteString(change.String())
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// MarshalJSON 返回变化的机器可读形式,例如:{"type":"attribute","path":"/a","newPath":"/a","attribute":"x","old":"1","new":"2"}
+func (c Change) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type      string `json:"type"`
+		Path      string `json:"path,omitempty"`
+		NewPath   string `json:"newPath,omitempty"`
+		Attribute string `json:"attribute,omitempty"`
+		OldValue  string `json:"old,omitempty"`
+		NewValue  string `json:"new,omitempty"`
+	}{c.Type.String(), c.Path, c.NewPath, c.Attribute, c.OldValue, c.NewValue})
+}
@@ -0,0 +1,121 @@
+package tinydom
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func diffStrings(t *testing.T, a string, b string, opts DiffOptions) []Change {
+	docA, err := LoadDocument(strings.NewReader(a))
+	expect(t, "加载文档a", nil == err)
+
+	docB, err := LoadDocument(strings.NewReader(b))
+	expect(t, "加载文档b", nil == err)
+
+	return Diff(docA, docB, opts)
+}
+
+func Test_Diff_相同的文档(t *testing.T) {
+	changes := diffStrings(t, `<config><server port="80"><name>a</name></server></config>`,
+		`<config>
+			<server port="80">
+				<name>a</name>
+			</server>
+		</config>`, DiffOptions{})
+	expect(t, "格式化的差异不影响比较", 0 == len(changes))
+
+	changes = diffStrings(t, `<a x="1" y="2"><!--c--><b> x  y </b></a>`, `<a y="2" x="1"><b>x y</b></a>`,
+		DiffOptions{IgnoreWhitespace: true, IgnoreComments: true, IgnoreAttributeOrder: true})
+	expect(t, "忽略空白、注释和属性顺序", 0 == len(changes))
+}
+
+func Test_Diff_各种变化(t *testing.T) {
+	changes := diffStrings(t, `<config>
+		<server id="s1" port="80"><name>web</name></server>
+		<server id="s2"><name>db</name></server>
+		<cache size="1"/>
+		<log level="info"/>
+		<!--old-->
+	</config>`, `<config>
+		<server id="s1" port="8080" tls="on"><name>web1</name></server>
+		<store size="1"/>
+		<log level="info"/>
+		<server id="s3"><name>mq</name></server>
+		<!--new-->
+	</config>`, DiffOptions{})
+
+	exp := []string{
+		`attribute /config/server[1]/@port: "80" -> "8080"`,
+		`attribute /config/server[1]/@tls: (none) -> "on"`,
+		`text /config/server[1]/name/text(): "web" -> "web1"`,
+		`delete /config/server[2]: <server id="s2">`,
+		`rename /config/cache -> /config/store`,
+		`text /config/comment(): "old" -> "new"`,
+		`insert /config/server[2]: <server id="s3">`,
+	}
+	expect(t, "变化的个数", len(exp) == len(changes))
+	for i := 0; (i < len(exp)) && (i < len(changes)); i++ {
+		expect(t, "变化:"+exp[i], exp[i] == changes[i].String())
+	}
+
+	expect(t, "插入的父节点", ("/config" == changes[6].Path) && ("/config/server[2]" == changes[6].NewPath))
+	expect(t, "节点引用", "s2" == changes[3].Node.ToElement().Attribute("id", ""))
+}
+
+func Test_Diff_移动(t *testing.T) {
+	changes := diffStrings(t, `<a><x><k>1</k></x><y/><z/></a>`, `<a><y/><z/><x><k>1</k></x></a>`, DiffOptions{})
+	expect(t, "同一个父节点之下的移动", (1 == len(changes)) && ("move /a/x -> /a/x" == changes[0].String()))
+
+	changes = diffStrings(t, `<a><p><item v="1"/></p><q/></a>`, `<a><p/><q><item v="1"/></q></a>`, DiffOptions{})
+	expect(t, "移动到其它父节点", (1 == len(changes)) && (ChangeMove == changes[0].Type) && ("/a/p/item" == changes[0].Path) && ("/a/q/item" == changes[0].NewPath))
+}
+
+func Test_Diff_属性顺序和根节点(t *testing.T) {
+	changes := diffStrings(t, `<a x="1" y="2"/>`, `<a y="2" x="1"/>`, DiffOptions{})
+	expect(t, "属性顺序", (1 == len(changes)) && (`attribute order /a: "x y" -> "y x"` == changes[0].String()))
+
+	changes = diffStrings(t, `<a id="1"/>`, `<a x="2" id="1"/>`, DiffOptions{})
+	expect(t, "在已有的属性之前增加属性", (2 == len(changes)) && (`attribute order /a: "id" -> "x id"` == changes[1].String()))
+
+	changes = diffStrings(t, `<a x="1" y="2" z="3"/>`, `<a z="3" x="1"/>`, DiffOptions{})
+	expect(t, "删除属性之后顺序变化", (2 == len(changes)) && (`attribute order /a: "x y z" -> "z x"` == changes[1].String()))
+
+	changes = diffStrings(t, `<a x="1"/>`, `<a x="1" y="2"/>`, DiffOptions{})
+	expect(t, "在最后增加属性不是顺序变化", 1 == len(changes))
+
+	changes = diffStrings(t, `<a id="1"/>`, `<a x="2" id="1"/>`, DiffOptions{IgnoreAttributeOrder: true})
+	expect(t, "忽略属性顺序", 1 == len(changes))
+
+	changes = diffStrings(t, `<a x="1"><b/></a>`, `<c x="2"><b/></c>`, DiffOptions{})
+	expect(t, "根元素改名", (2 == len(changes)) && (ChangeRename == changes[0].Type) && ("a" == changes[0].OldValue) && ("c" == changes[0].NewValue))
+
+	changes = Diff(NewText("a"), NewComment("a"), DiffOptions{})
+	expect(t, "类型不同的节点", (2 == len(changes)) && (ChangeDelete == changes[0].Type) && (ChangeInsert == changes[1].Type))
+}
+
+func Test_Diff_输出格式(t *testing.T) {
+	changes := diffStrings(t, `<a x="1"><b>t</b></a>`, `<a><b>u</b><c/></a>`, DiffOptions{})
+	text := FormatDiff(changes)
+	expect(t, "可读格式", "attribute /a/@x: \"1\" -> (none)\ntext /a/b/text(): \"t\" -> \"u\"\ninsert /a/c: <c>\n" == text)
+
+	data, err := json.Marshal(changes)
+	expect(t, "返回值检测", nil == err)
+	exp := `[{"type":"attribute","path":"/a","newPath":"/a","attribute":"x","old":"1"},` +
+		`{"type":"text","path":"/a/b/text()","newPath":"/a/b/text()","old":"t","new":"u"},` +
+		`{"type":"insert","path":"/a","newPath":"/a/c"}]`
+	expect(t, "机器可读格式", exp == string(data))
+}
+
+func Test_Diff_签名冲突(t *testing.T) {
+	a, _ := LoadDocument(strings.NewReader(`<a><b>1</b><c/></a>`))
+	b, _ := LoadDocument(strings.NewReader(`<a><b>2</b><c/></a>`))
+
+	// 让两个不同的文本的签名相同,模拟签名冲突
+	d := newDiffer(DiffOptions{})
+	textA, textB := a.RootElement().FirstChild().FirstChild(), b.RootElement().FirstChild().FirstChild()
+	d.hashes[textA], d.hashes[textB] = 1, 1
+	d.diffNode(a, b)
+	changes := d.moves()
+	expect(t, "签名相同但是内容不同的文本", (1 == len(changes)) && (`text /a/b/text(): "1" -> "2"` == changes[0].String()))
+}
@@ -0,0 +1,831 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// DocType 是对文档类型声明<!DOCTYPE ...>解析之后的结构化表示.
+//
+// Name是文档类型声明中指定的根元素名,PublicID和SystemID是外部DTD的标识.
+// InternalSubset是'['与']'之间的内部子集的原始文本,其中的声明被解析到了Elements、Attlists、Entities和Notations中.
+type DocType struct {
+	Name           string
+	PublicID       string
+	SystemID       string
+	InternalSubset string
+
+	Elements  []*ElementDecl
+	Attlists  []*AttlistDecl
+	Entities  []*EntityDecl
+	Notations []*NotationDecl
+}
+
+// ElementDecl 对应<!ELEMENT name content>声明
+type ElementDecl struct {
+	Name    string
+	Content *ContentModel
+}
+
+// ContentType 元素的内容类型
+type ContentType int
+
+const (
+	ContentEmpty    ContentType = iota // EMPTY
+	ContentAny                         // ANY
+	ContentMixed                       // (#PCDATA|a|b)*
+	ContentChildren                    // 只能包含子元素,例如(a,(b|c)*)
+)
+
+// ContentModel 元素的内容模型.
+// Type为ContentMixed时Names为允许出现的子元素,Type为ContentChildren时Particle为子元素的内容模型.
+type ContentModel struct {
+	Type     ContentType
+	Names    []string
+	Particle *ContentParticle
+}
+
+// ParticleKind 内容模型中的粒子类型
+type ParticleKind int
+
+const (
+	ParticleName     ParticleKind = iota // 单个元素名
+	ParticleSequence                     // (a,b,c)
+	ParticleChoice                       // (a|b|c)
+)
+
+// ContentParticle 内容模型中的一个粒子.
+// Kind为ParticleName时Name为元素名,否则Children为序列或者选择中的各个粒子.
+// Occurs为出现次数的修饰符:0表示恰好一次,'?'、'*'、'+'与DTD中的含义相同.
+type ContentParticle struct {
+	Kind     ParticleKind
+	Name     string
+	Children []*ContentParticle
+	Occurs   byte
+}
+
+// AttlistDecl 对应<!ATTLIST element attdef*>声明
+type AttlistDecl struct {
+	Element    string
+	Attributes []*AttributeDecl
+}
+
+// AttributeDecl 一个属性的定义.
+//
+// Type为CDATA、ID、IDREF、IDREFS、ENTITY、ENTITIES、NMTOKEN、NMTOKENS、NOTATION或者ENUMERATION,
+// 后两种情况下Enum为允许的取值.
+// Default为#REQUIRED、#IMPLIED、#FIXED或者空字符串,Value为缺省值或者固定值.
+type AttributeDecl struct {
+	Name    string
+	Type    string
+	Enum    []string
+	Default string
+	Value   string
+}
+
+// EntityDecl 对应<!ENTITY ...>声明,Parameter表示是否为参数实体(<!ENTITY % name ...>).
+// 内部实体的Value为实体的值,外部实体由PublicID、SystemID指定,NData为非解析实体的记号名.
+type EntityDecl struct {
+	Name      string
+	Parameter bool
+	Value     string
+	PublicID  string
+	SystemID  string
+	NData     string
+}
+
+// NotationDecl 对应<!NOTATION name ExternalID>声明
+type NotationDecl struct {
+	Name     string
+	PublicID string
+	SystemID string
+}
+
+// ParseDocType 解析文档类型声明,directive为XMLDirective的值,即"<!"与">"之间的部分,例如"DOCTYPE poem SYSTEM "poem.dtd"".
+func ParseDocType(directive string) (*DocType, error) {
+	s := newDTDScanner(directive)
+	s.skipSpace()
+	if !s.consume("DOCTYPE") {
+		return nil, errors.New("Directive is not a DOCTYPE:" + directive)
+	}
+
+	doctype := new(DocType)
+	if !s.skipSpace() {
+		return nil, s.error("Missing space after DOCTYPE")
+	}
+
+	doctype.Name = s.name()
+	if "" == doctype.Name {
+		return nil, s.error("Missing root element name in DOCTYPE")
+	}
+
+	s.skipSpace()
+	var err error
+	if doctype.PublicID, doctype.SystemID, err = s.externalID(false); nil != err {
+		return nil, err
+	}
+
+	s.skipSpace()
+	if s.consume("[") {
+		end := strings.LastIndex(s.s, "]")
+		if end < s.pos {
+			return nil, s.error("Missing ']' in DOCTYPE")
+		}
+
+		doctype.InternalSubset = s.s[s.pos:end]
+		s.pos = end + 1
+		if err := parseDTDDecls(doctype, doctype.InternalSubset); nil != err {
+			return nil, err
+		}
+	}
+
+	s.skipSpace()
+	if !s.eof() {
+		return nil, s.error("Unexpected content in DOCTYPE")
+	}
+
+	return doctype, nil
+}
+
+// String 将DocType还原成XMLDirective的值,内部子集按照原始文本输出
+func (d *DocType) String() string {
+	s := "DOCTYPE " + d.Name
+	if "" != d.PublicID {
+		s += ` PUBLIC "` + d.PublicID + `"`
+		if "" != d.SystemID {
+			s += ` "` + d.SystemID + `"`
+		}
+	} else if "" != d.SystemID {
+		s += ` SYSTEM "` + d.SystemID + `"`
+	}
+
+	if "" != d.InternalSubset {
+		s += " [" + d.InternalSubset + "]"
+	}
+
+	return s
+}
+
+// Element 查找指定名字的元素声明
+func (d *DocType) Element(name string) *ElementDecl {
+	for _, decl := range d.Elements {
+		if decl.Name == name {
+			return decl
+		}
+	}
+
+	return nil
+}
+
+// Entity 查找指定名字的通用实体声明
+func (d *DocType) Entity(name string) *EntityDecl {
+	for _, decl := range d.Entities {
+		if !decl.Parameter && (decl.Name == name) {
+			return decl
+		}
+	}
+
+	return nil
+}
+
+// String 将内容模型还原成DTD中的写法
+func (m *ContentModel) String() string {
+	switch m.Type {
+	case ContentEmpty:
+		return "EMPTY"
+	case ContentAny:
+		return "ANY"
+	case ContentMixed:
+		if 0 == len(m.Names) {
+			return "(#PCDATA)"
+		}
+		return "(#PCDATA|" + strings.Join(m.Names, "|") + ")*"
+	}
+
+	return m.Particle.String()
+}
+
+// String 将粒子还原成DTD中的写法
+func (p *ContentParticle) String() string {
+	s := p.Name
+	if ParticleName != p.Kind {
+		sep := ","
+		if ParticleChoice == p.Kind {
+			sep = "|"
+		}
+
+		items := make([]string, 0, len(p.Children))
+		for _, child := range p.Children {
+			items = append(items, child.String())
+		}
+		s = "(" + strings.Join(items, sep) + ")"
+	}
+
+	if 0 != p.Occurs {
+		s += string(p.Occurs)
+	}
+
+	return s
+}
+
+// ------------------------------------------------------------------
+
+// parseDTDDecls 解析一系列的DTD声明,内部子集和外部DTD文件都是这种格式
+func parseDTDDecls(doctype *DocType, text string) error {
+	return parseDTDDeclsDepth(doctype, text, 0)
+}
+
+func parseDTDDeclsDepth(doctype *DocType, text string, depth int) error {
+	if depth > 16 {
+		return errors.New("Parameter entities are nested too deeply")
+	}
+
+	s := newDTDScanner(text)
+	for {
+		s.skipSpace()
+		if s.eof() {
+			return nil
+		}
+
+		switch {
+		case s.consume("<!--"):
+			if !s.skipTo("-->") {
+				return s.error("Comment not closed")
+			}
+		case s.consume("<?"):
+			if !s.skipTo("?>") {
+				return s.error("ProcInst not closed")
+			}
+		case s.consume("<!["):
+			if err := parseConditionalSection(doctype, s, depth); nil != err {
+				return err
+			}
+		case s.peek("<!"):
+			decl, err := s.markupDecl()
+			if nil != err {
+				return err
+			}
+
+			decl = expandParameterEntities(doctype, decl)
+			if err := parseMarkupDecl(doctype, decl); nil != err {
+				return err
+			}
+		case s.consume("%"):
+			name := s.name()
+			if ("" == name) || !s.consume(";") {
+				return s.error("Invalid parameter entity reference")
+			}
+
+			// 只展开内部的参数实体,外部参数实体需要额外加载,这里直接忽略
+			if entity := findParameterEntity(doctype, name); (nil != entity) && ("" == entity.SystemID) {
+				if err := parseDTDDeclsDepth(doctype, entity.Value, depth+1); nil != err {
+					return err
+				}
+			}
+		default:
+			return s.error("Unexpected content in DTD")
+		}
+	}
+}
+
+// parseConditionalSection 解析<![INCLUDE[...]]>和<![IGNORE[...]]>,"<!["已经被读取
+func parseConditionalSection(doctype *DocType, s *dtdScanner, depth int) error {
+	s.skipSpace()
+	keyword := s.name()
+	if ("" == keyword) && s.consume("%") {
+		name := s.name()
+		if !s.consume(";") {
+			return s.error("Invalid parameter entity reference")
+		}
+
+		if entity := findParameterEntity(doctype, name); nil != entity {
+			keyword = strings.TrimSpace(entity.Value)
+		}
+	}
+
+	s.skipSpace()
+	if !s.consume("[") {
+		return s.error("Invalid conditional section")
+	}
+
+	// 找到配对的"]]>",条件段是可以嵌套的
+	start := s.pos
+	level := 1
+	for level > 0 {
+		switch {
+		case s.eof():
+			return s.error("Conditional section not closed")
+		case s.consume("<!["):
+			level++
+		case s.consume("]]>"):
+			level--
+		default:
+			s.pos++
+		}
+	}
+
+	switch keyword {
+	case "INCLUDE":
+		return parseDTDDeclsDepth(doctype, s.s[start:s.pos-3], depth+1)
+	case "IGNORE":
+		return nil
+	}
+
+	return s.error("Unknown conditional section:" + keyword)
+}
+
+func findParameterEntity(doctype *DocType, name string) *EntityDecl {
+	for _, decl := range doctype.Entities {
+		if decl.Parameter && (decl.Name == name) {
+			return decl
+		}
+	}
+
+	return nil
+}
+
+// expandParameterEntities 展开声明中引号之外的参数实体引用
+func expandParameterEntities(doctype *DocType, decl string) string {
+	if !strings.Contains(decl, "%") {
+		return decl
+	}
+
+	var buf bytes.Buffer
+	inquote := byte(0)
+	for i := 0; i < len(decl); i++ {
+		b := decl[i]
+		switch {
+		case b == inquote:
+			inquote = 0
+		case 0 != inquote:
+		case ('"' == b) || ('\'' == b):
+			inquote = b
+		case '%' == b:
+			end := strings.IndexByte(decl[i:], ';')
+			if end > 1 {
+				if entity := findParameterEntity(doctype, decl[i+1:i+end]); (nil != entity) && ("" == entity.SystemID) {
+					buf.WriteString(" " + entity.Value + " ")
+					i += end
+					continue
+				}
+			}
+		}
+		buf.WriteByte(b)
+	}
+
+	return buf.String()
+}
+
+func parseMarkupDecl(doctype *DocType, decl string) error {
+	s := newDTDScanner(decl)
+	switch {
+	case s.consume("<!ELEMENT"):
+		return parseElementDecl(doctype, s)
+	case s.consume("<!ATTLIST"):
+		return parseAttlistDecl(doctype, s)
+	case s.consume("<!ENTITY"):
+		return parseEntityDecl(doctype, s)
+	case s.consume("<!NOTATION"):
+		return parseNotationDecl(doctype, s)
+	}
+
+	return s.error("Unknown markup declaration")
+}
+
+func parseElementDecl(doctype *DocType, s *dtdScanner) error {
+	decl := new(ElementDecl)
+	s.skipSpace()
+	if decl.Name = s.name(); "" == decl.Name {
+		return s.error("Missing element name")
+	}
+
+	s.skipSpace()
+	decl.Content = new(ContentModel)
+	switch {
+	case s.consume("EMPTY"):
+		decl.Content.Type = ContentEmpty
+	case s.consume("ANY"):
+		decl.Content.Type = ContentAny
+	case s.peek("("):
+		mark := s.pos
+		s.consume("(")
+		s.skipSpace()
+		if s.consume("#PCDATA") {
+			if err := parseMixedContent(decl.Content, s); nil != err {
+				return err
+			}
+			break
+		}
+
+		s.pos = mark
+		particle, err := parseContentParticle(s)
+		if nil != err {
+			return err
+		}
+		decl.Content.Type = ContentChildren
+		decl.Content.Particle = particle
+	default:
+		return s.error("Invalid content model of element:" + decl.Name)
+	}
+
+	if err := s.endDecl(); nil != err {
+		return err
+	}
+
+	doctype.Elements = append(doctype.Elements, decl)
+	return nil
+}
+
+// parseMixedContent 解析(#PCDATA|a|b)*,"(#PCDATA"已经被读取
+func parseMixedContent(content *ContentModel, s *dtdScanner) error {
+	content.Type = ContentMixed
+	for {
+		s.skipSpace()
+		if s.consume(")") {
+			break
+		}
+
+		if !s.consume("|") {
+			return s.error("Invalid mixed content model")
+		}
+
+		s.skipSpace()
+		name := s.name()
+		if "" == name {
+			return s.error("Invalid mixed content model")
+		}
+		content.Names = append(content.Names, name)
+	}
+
+	if s.consume("*") {
+		return nil
+	}
+
+	if 0 != len(content.Names) {
+		return s.error("Mixed content model with elements should end with ')*'")
+	}
+
+	return nil
+}
+
+func parseContentParticle(s *dtdScanner) (*ContentParticle, error) {
+	particle := new(ContentParticle)
+	s.skipSpace()
+	if !s.consume("(") {
+		particle.Kind = ParticleName
+		if particle.Name = s.name(); "" == particle.Name {
+			return nil, s.error("Invalid content particle")
+		}
+		particle.Occurs = s.occurs()
+		return particle, nil
+	}
+
+	particle.Kind = ParticleSequence
+	sep := byte(0)
+	for {
+		child, err := parseContentParticle(s)
+		if nil != err {
+			return nil, err
+		}
+		particle.Children = append(particle.Children, child)
+
+		s.skipSpace()
+		if s.consume(")") {
+			break
+		}
+
+		if s.eof() || (('|' != s.s[s.pos]) && (',' != s.s[s.pos])) {
+			return nil, s.error("Invalid content particle")
+		}
+
+		// 序列和选择不能混用
+		if (0 != sep) && (sep != s.s[s.pos]) {
+			return nil, s.error("Mixed '|' and ',' in content particle")
+		}
+		sep = s.s[s.pos]
+		s.pos++
+	}
+
+	if '|' == sep {
+		particle.Kind = ParticleChoice
+	}
+
+	particle.Occurs = s.occurs()
+	return particle, nil
+}
+
+func parseAttlistDecl(doctype *DocType, s *dtdScanner) error {
+	decl := new(AttlistDecl)
+	s.skipSpace()
+	if decl.Element = s.name(); "" == decl.Element {
+		return s.error("Missing element name")
+	}
+
+	for {
+		s.skipSpace()
+		if s.consume(">") {
+			break
+		}
+
+		attr := new(AttributeDecl)
+		if attr.Name = s.name(); "" == attr.Name {
+			return s.error("Invalid attribute definition")
+		}
+
+		s.skipSpace()
+		if s.peek("(") {
+			attr.Type = "ENUMERATION"
+		} else if attr.Type = s.name(); "NOTATION" == attr.Type {
+			s.skipSpace()
+		}
+
+		switch attr.Type {
+		case "CDATA", "ID", "IDREF", "IDREFS", "ENTITY", "ENTITIES", "NMTOKEN", "NMTOKENS":
+		case "NOTATION", "ENUMERATION":
+			values, err := s.enumeration()
+			if nil != err {
+				return err
+			}
+			attr.Enum = values
+		default:
+			return s.error("Invalid attribute type:" + attr.Type)
+		}
+
+		s.skipSpace()
+		switch {
+		case s.consume("#REQUIRED"):
+			attr.Default = "#REQUIRED"
+		case s.consume("#IMPLIED"):
+			attr.Default = "#IMPLIED"
+		default:
+			if s.consume("#FIXED") {
+				attr.Default = "#FIXED"
+				s.skipSpace()
+			}
+
+			value, ok := s.quoted()
+			if !ok {
+				return s.error("Invalid default value of attribute:" + attr.Name)
+			}
+			attr.Value = value
+		}
+
+		decl.Attributes = append(decl.Attributes, attr)
+	}
+
+	doctype.Attlists = append(doctype.Attlists, decl)
+	return nil
+}
+
+func parseEntityDecl(doctype *DocType, s *dtdScanner) error {
+	decl := new(EntityDecl)
+	s.skipSpace()
+	if s.consume("%") {
+		decl.Parameter = true
+		s.skipSpace()
+	}
+
+	if decl.Name = s.name(); "" == decl.Name {
+		return s.error("Missing entity name")
+	}
+
+	s.skipSpace()
+	if value, ok := s.quoted(); ok {
+		decl.Value = value
+	} else {
+		var err error
+		if decl.PublicID, decl.SystemID, err = s.externalID(false); nil != err {
+			return err
+		}
+
+		if "" == decl.SystemID {
+			return s.error("Invalid entity declaration:" + decl.Name)
+		}
+
+		s.skipSpace()
+		if s.consume("NDATA") {
+			s.skipSpace()
+			if decl.NData = s.name(); "" == decl.NData {
+				return s.error("Missing notation name")
+			}
+		}
+	}
+
+	if err := s.endDecl(); nil != err {
+		return err
+	}
+
+	doctype.Entities = append(doctype.Entities, decl)
+	return nil
+}
+
+func parseNotationDecl(doctype *DocType, s *dtdScanner) error {
+	decl := new(NotationDecl)
+	s.skipSpace()
+	if decl.Name = s.name(); "" == decl.Name {
+		return s.error("Missing notation name")
+	}
+
+	s.skipSpace()
+	var err error
+	if decl.PublicID, decl.SystemID, err = s.externalID(true); nil != err {
+		return err
+	}
+
+	if ("" == decl.PublicID) && ("" == decl.SystemID) {
+		return s.error("Invalid notation declaration:" + decl.Name)
+	}
+
+	if err := s.endDecl(); nil != err {
+		return err
+	}
+
+	doctype.Notations = append(doctype.Notations, decl)
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// dtdScanner 是一个简单的DTD文本扫描器
+type dtdScanner struct {
+	s   string
+	pos int
+}
+
+func newDTDScanner(s string) *dtdScanner {
+	return &dtdScanner{s: s}
+}
+
+func (s *dtdScanner) eof() bool {
+	return s.pos >= len(s.s)
+}
+
+func (s *dtdScanner) error(message string) error {
+	end := s.pos + 32
+	if end > len(s.s) {
+		end = len(s.s)
+	}
+
+	return errors.New(message + " at:" + strings.TrimSpace(s.s[s.pos:end]))
+}
+
+func isSpaceByte(b byte) bool {
+	return (' ' == b) || ('\t' == b) || ('\n' == b) || ('\r' == b)
+}
+
+// skipSpace 跳过空白,返回是否跳过了至少一个空白
+func (s *dtdScanner) skipSpace() bool {
+	start := s.pos
+	for !s.eof() && isSpaceByte(s.s[s.pos]) {
+		s.pos++
+	}
+
+	return s.pos > start
+}
+
+func (s *dtdScanner) peek(prefix string) bool {
+	return strings.HasPrefix(s.s[s.pos:], prefix)
+}
+
+func (s *dtdScanner) consume(prefix string) bool {
+	if !s.peek(prefix) {
+		return false
+	}
+
+	s.pos += len(prefix)
+	return true
+}
+
+// skipTo 跳过直到end之后,找不到end时返回false
+func (s *dtdScanner) skipTo(end string) bool {
+	i := strings.Index(s.s[s.pos:], end)
+	if i < 0 {
+		return false
+	}
+
+	s.pos += i + len(end)
+	return true
+}
+
+// name 读取一个名字,名字一直延续到空白或者DTD中的分隔符为止
+func (s *dtdScanner) name() string {
+	start := s.pos
+	for !s.eof() {
+		b := s.s[s.pos]
+		if isSpaceByte(b) || strings.IndexByte("()|,?*+<>[]%;\"'", b) >= 0 {
+			break
+		}
+		s.pos++
+	}
+
+	return s.s[start:s.pos]
+}
+
+func (s *dtdScanner) quoted() (string, bool) {
+	if s.eof() || (('"' != s.s[s.pos]) && ('\'' != s.s[s.pos])) {
+		return "", false
+	}
+
+	end := strings.IndexByte(s.s[s.pos+1:], s.s[s.pos])
+	if end < 0 {
+		return "", false
+	}
+
+	value := s.s[s.pos+1 : s.pos+1+end]
+	s.pos += end + 2
+	return value, true
+}
+
+func (s *dtdScanner) occurs() byte {
+	if !s.eof() && (strings.IndexByte("?*+", s.s[s.pos]) >= 0) {
+		s.pos++
+		return s.s[s.pos-1]
+	}
+
+	return 0
+}
+
+// externalID 读取SYSTEM "sys"或者PUBLIC "pub" "sys",publicOnly表示是否允许只有公共标识(用于NOTATION)
+func (s *dtdScanner) externalID(publicOnly bool) (string, string, error) {
+	switch {
+	case s.consume("SYSTEM"):
+		s.skipSpace()
+		systemID, ok := s.quoted()
+		if !ok {
+			return "", "", s.error("Invalid system literal")
+		}
+		return "", systemID, nil
+	case s.consume("PUBLIC"):
+		s.skipSpace()
+		publicID, ok := s.quoted()
+		if !ok {
+			return "", "", s.error("Invalid public literal")
+		}
+
+		s.skipSpace()
+		systemID, ok := s.quoted()
+		if !ok && !publicOnly {
+			return "", "", s.error("Invalid system literal")
+		}
+		return publicID, systemID, nil
+	}
+
+	return "", "", nil
+}
+
+// enumeration 读取(a|b|c)
+func (s *dtdScanner) enumeration() ([]string, error) {
+	if !s.consume("(") {
+		return nil, s.error("Invalid enumeration")
+	}
+
+	var values []string
+	for {
+		s.skipSpace()
+		value := s.name()
+		if "" == value {
+			return nil, s.error("Invalid enumeration")
+		}
+		values = append(values, value)
+
+		s.skipSpace()
+		if s.consume(")") {
+			return values, nil
+		}
+
+		if !s.consume("|") {
+			return nil, s.error("Invalid enumeration")
+		}
+	}
+}
+
+// markupDecl 读取一个完整的"<!...>"声明,引号中的'>'不算
+func (s *dtdScanner) markupDecl() (string, error) {
+	start := s.pos
+	inquote := byte(0)
+	for i := s.pos; i < len(s.s); i++ {
+		b := s.s[i]
+		switch {
+		case b == inquote:
+			inquote = 0
+		case 0 != inquote:
+		case ('"' == b) || ('\'' == b):
+			inquote = b
+		case '>' == b:
+			s.pos = i + 1
+			return s.s[start:s.pos], nil
+		}
+	}
+
+	return "", s.error("Markup declaration not closed")
+}
+
+func (s *dtdScanner) endDecl() error {
+	s.skipSpace()
+	if !s.consume(">") {
+		return s.error("Markup declaration should end with '>'")
+	}
+
+	return nil
+}
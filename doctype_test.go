@@ -0,0 +1,149 @@
+package tinydom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_DocType_外部标识(t *testing.T) {
+	doctype, err := ParseDocType(`DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd"`)
+	expect(t, "返回值检测", nil == err)
+	expect(t, "根元素名", "html" == doctype.Name)
+	expect(t, "公共标识", "-//W3C//DTD XHTML 1.0 Strict//EN" == doctype.PublicID)
+	expect(t, "系统标识", "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd" == doctype.SystemID)
+	expect(t, "没有内部子集", ("" == doctype.InternalSubset) && (0 == len(doctype.Elements)))
+
+	doctype, err = ParseDocType(`DOCTYPE poem SYSTEM 'poem.dtd'`)
+	expect(t, "返回值检测", nil == err)
+	expect(t, "系统标识", ("poem.dtd" == doctype.SystemID) && ("" == doctype.PublicID))
+	expect(t, "还原", `DOCTYPE poem SYSTEM "poem.dtd"` == doctype.String())
+
+	doctype, err = ParseDocType(`DOCTYPE poem`)
+	expect(t, "只有根元素名", (nil == err) && ("poem" == doctype.Name))
+
+	doctype = &DocType{Name: "html", PublicID: "-//W3C//DTD HTML 4.01//EN"}
+	expect(t, "没有系统标识时不输出空的系统标识", `DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN"` == doctype.String())
+}
+
+func Test_DocType_文档的结构化文档类型声明(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<!DOCTYPE poem SYSTEM "poem.dtd"><poem/>`))
+	doctype, err := doc.ParsedDocType()
+	expect(t, "解析文档类型声明", (nil == err) && ("poem" == doctype.Name) && ("poem.dtd" == doctype.SystemID))
+
+	doc, _ = LoadDocument(strings.NewReader(`<poem/>`))
+	doctype, err = doc.ParsedDocType()
+	expect(t, "没有文档类型声明", (nil == err) && (nil == doctype))
+}
+
+func Test_DocType_内部子集(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+	<!DOCTYPE catalog [
+		<!-- 注释中可以有 <tag> -->
+		<!ELEMENT catalog (book+, (magazine | paper)*, note?)>
+		<!ELEMENT book (#PCDATA | em | strong)*>
+		<!ELEMENT magazine (#PCDATA)>
+		<!ELEMENT paper ANY>
+		<!ELEMENT note EMPTY>
+		<!ATTLIST book
+			id     ID              #REQUIRED
+			lang   (en | zh)       "en"
+			ref    IDREFS          #IMPLIED
+			format NOTATION (gif)  #IMPLIED
+			ver    CDATA           #FIXED "1.0">
+		<!ENTITY copy "&#169; <b>tinydom</b>">
+		<!ENTITY % common "id ID #IMPLIED">
+		<!ATTLIST note %common;>
+		<!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+		<!NOTATION gif PUBLIC "image/gif">
+		<?pi inside?>
+	]>
+	<catalog><book id="b1">text</book></catalog>`
+
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "返回值检测", nil == err)
+
+	doctype, err := doc.ParsedDocType()
+	expect(t, "返回值检测", nil == err)
+	expect(t, "根元素名", "catalog" == doctype.Name)
+	expect(t, "元素声明个数", 5 == len(doctype.Elements))
+	expect(t, "属性声明个数", 2 == len(doctype.Attlists))
+	expect(t, "实体声明个数", 3 == len(doctype.Entities))
+	expect(t, "记号声明个数", 1 == len(doctype.Notations))
+
+	catalog := doctype.Element("catalog").Content
+	expect(t, "子元素内容模型", ContentChildren == catalog.Type)
+	expect(t, "子元素内容模型", "(book+,(magazine|paper)*,note?)" == catalog.String())
+	expect(t, "子元素内容模型", ParticleSequence == catalog.Particle.Kind)
+	expect(t, "子元素内容模型", ParticleChoice == catalog.Particle.Children[1].Kind)
+	expect(t, "子元素内容模型", '+' == catalog.Particle.Children[0].Occurs)
+
+	book := doctype.Element("book").Content
+	expect(t, "混合内容模型", (ContentMixed == book.Type) && (2 == len(book.Names)))
+	expect(t, "混合内容模型", "(#PCDATA|em|strong)*" == book.String())
+	expect(t, "混合内容模型", "(#PCDATA)" == doctype.Element("magazine").Content.String())
+	expect(t, "ANY", ContentAny == doctype.Element("paper").Content.Type)
+	expect(t, "EMPTY", ContentEmpty == doctype.Element("note").Content.Type)
+
+	attrs := doctype.Attlists[0].Attributes
+	expect(t, "属性声明", ("book" == doctype.Attlists[0].Element) && (5 == len(attrs)))
+	expect(t, "ID属性", ("id" == attrs[0].Name) && ("ID" == attrs[0].Type) && ("#REQUIRED" == attrs[0].Default))
+	expect(t, "枚举属性", ("ENUMERATION" == attrs[1].Type) && (2 == len(attrs[1].Enum)) && ("en" == attrs[1].Value))
+	expect(t, "IDREFS属性", ("IDREFS" == attrs[2].Type) && ("#IMPLIED" == attrs[2].Default))
+	expect(t, "NOTATION属性", ("NOTATION" == attrs[3].Type) && ("gif" == attrs[3].Enum[0]))
+	expect(t, "固定属性", ("#FIXED" == attrs[4].Default) && ("1.0" == attrs[4].Value))
+
+	note := doctype.Attlists[1].Attributes
+	expect(t, "参数实体被展开", (1 == len(note)) && ("id" == note[0].Name) && ("ID" == note[0].Type))
+
+	expect(t, "内部实体", "&#169; <b>tinydom</b>" == doctype.Entity("copy").Value)
+	expect(t, "非解析实体", ("logo.gif" == doctype.Entity("logo").SystemID) && ("gif" == doctype.Entity("logo").NData))
+	expect(t, "参数实体不是通用实体", nil == doctype.Entity("common"))
+	expect(t, "记号", ("gif" == doctype.Notations[0].Name) && ("image/gif" == doctype.Notations[0].PublicID))
+}
+
+func Test_DocType_条件段(t *testing.T) {
+	doctype := new(DocType)
+	err := parseDTDDecls(doctype, `
+		<!ENTITY % draft "INCLUDE">
+		<![%draft;[ <!ELEMENT a EMPTY> <![IGNORE[ <!ELEMENT b EMPTY> ]]> ]]>
+		<![IGNORE[ <!ELEMENT c EMPTY> ]]>`)
+	expect(t, "返回值检测", nil == err)
+	expect(t, "只包含INCLUDE中的声明", (1 == len(doctype.Elements)) && ("a" == doctype.Elements[0].Name))
+}
+
+func Test_DocType_格式错误(t *testing.T) {
+	for _, directive := range []string{
+		`ELEMENT a EMPTY`,
+		`DOCTYPE`,
+		`DOCTYPE a SYSTEM`,
+		`DOCTYPE a PUBLIC "pub"`,
+		`DOCTYPE a [ <!ELEMENT a (b|c,d)> ]`,
+		`DOCTYPE a [ <!ELEMENT a (#PCDATA|b)> ]`,
+		`DOCTYPE a [ <!ELEMENT a FOO> ]`,
+		`DOCTYPE a [ <!ATTLIST a x BAD #IMPLIED> ]`,
+		`DOCTYPE a [ <!ATTLIST a x CDATA> ]`,
+		`DOCTYPE a [ <!ENTITY a> ]`,
+		`DOCTYPE a [ <!FOO a> ]`,
+		`DOCTYPE a [ <!ELEMENT a EMPTY ]`,
+		`DOCTYPE a [ text ]`,
+		`DOCTYPE a [ <!ELEMENT a EMPTY> ] garbage`,
+	} {
+		_, err := ParseDocType(directive)
+		expect(t, "格式错误:"+directive, nil != err)
+	}
+}
+
+func Test_DocType_指令原样输出(t *testing.T) {
+	xml := `<!DOCTYPE a [<!ELEMENT a (#PCDATA)><!ENTITY e "x &amp; y">]><a/>`
+	doc, _ := LoadDocument(strings.NewReader(xml))
+
+	buf := bytes.NewBufferString("")
+	doc.Accept(NewSimplePrinter(buf, PrintStream))
+	expect(t, "SimplePrinter不转义指令", xml == buf.String())
+
+	buf = bytes.NewBufferString("")
+	w := NewXMLWriter(buf, PrintStream)
+	w.WriteNode(doc)
+	expect(t, "XMLWriter不转义指令", (nil == w.Close()) && (xml == buf.String()))
+}
@@ -0,0 +1,537 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Resolver 用于加载外部资源,例如外部DTD文件、XML Schema的import和include等.
+// 顶层文档中书写的location原样传给Resolver,被加载的资源中书写的相对位置先相对于该资源自己的位置解析,
+// 例如main.xsd包含common/types.xsd,types.xsd又包含base.xsd时,第二次加载的location是common/base.xsd.
+// 调用者负责关闭返回的io.ReadCloser.
+type Resolver func(location string) (io.ReadCloser, error)
+
+// DirResolver 返回一个从本地目录dir中加载外部资源的Resolver,location为相对路径时相对于dir查找
+func DirResolver(dir string) Resolver {
+	return func(location string) (io.ReadCloser, error) {
+		if !filepath.IsAbs(location) {
+			location = filepath.Join(dir, filepath.FromSlash(location))
+		}
+
+		return os.Open(location)
+	}
+}
+
+// resolveLocation 把base中书写的location解析成相对于顶层文档的位置,base为空表示location来自顶层文档.
+// 解析之后的位置也用于识别同一个资源是否已经加载过
+func resolveLocation(base string, location string) string {
+	if ("" == base) || filepath.IsAbs(location) || path.IsAbs(location) {
+		return location
+	}
+
+	if ref, err := url.Parse(location); (nil != err) || ref.IsAbs() {
+		return location
+	}
+
+	if baseURL, err := url.Parse(base); (nil == err) && baseURL.IsAbs() {
+		ref, _ := url.Parse(location)
+		return baseURL.ResolveReference(ref).String()
+	}
+
+	return path.Join(path.Dir(filepath.ToSlash(base)), location)
+}
+
+// treeRoot 返回节点所在的树的根,用于找到节点来自哪一个被加载的资源
+func treeRoot(node XMLNode) XMLNode {
+	for nil != node.Parent() {
+		node = node.Parent()
+	}
+	return node
+}
+
+// DTD 是一个可以用来校验文档的文档类型定义,可以来自文档的内部子集,也可以来自外部的DTD文件.
+//
+// 同一个元素的属性被多次声明时,以第一次声明为准,这与XML规范一致,因此内部子集中的声明优先于外部DTD.
+type DTD struct {
+	DocType *DocType // 原始的声明
+
+	elements   map[string]*ElementDecl
+	attributes map[string][]*AttributeDecl
+	entities   map[string]*EntityDecl
+	automata   map[string]*contentAutomaton
+}
+
+// NewDTD 根据已经解析好的文档类型声明创建DTD
+func NewDTD(doctype *DocType) *DTD {
+	dtd := new(DTD)
+	dtd.DocType = doctype
+	dtd.elements = make(map[string]*ElementDecl)
+	dtd.attributes = make(map[string][]*AttributeDecl)
+	dtd.entities = make(map[string]*EntityDecl)
+	dtd.automata = make(map[string]*contentAutomaton)
+
+	for _, decl := range doctype.Elements {
+		if _, ok := dtd.elements[decl.Name]; ok {
+			continue
+		}
+
+		dtd.elements[decl.Name] = decl
+		if ContentChildren == decl.Content.Type {
+			dtd.automata[decl.Name] = newContentAutomaton(decl.Content.Particle)
+		}
+	}
+
+	for _, attlist := range doctype.Attlists {
+		for _, attr := range attlist.Attributes {
+			if nil == dtd.attribute(attlist.Element, attr.Name) {
+				dtd.attributes[attlist.Element] = append(dtd.attributes[attlist.Element], attr)
+			}
+		}
+	}
+
+	for _, decl := range doctype.Entities {
+		if _, ok := dtd.entities[decl.Name]; !ok && !decl.Parameter {
+			dtd.entities[decl.Name] = decl
+		}
+	}
+
+	return dtd
+}
+
+// ParseDTD 解析一个外部DTD文件,得到的DTD不限定根元素的名字
+func ParseDTD(rd io.Reader) (*DTD, error) {
+	text, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	doctype := new(DocType)
+	if err := parseDTDDecls(doctype, string(text)); nil != err {
+		return nil, err
+	}
+
+	return NewDTD(doctype), nil
+}
+
+// LoadDTD 从文档的DOCTYPE中加载DTD.内部子集直接解析,外部DTD通过resolver加载.
+// 文档引用了外部DTD但是resolver为nil时返回错误.
+func LoadDTD(doc XMLDocument, resolver Resolver) (*DTD, error) {
+	doctype, err := doc.ParsedDocType()
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == doctype {
+		return nil, errors.New("Document has no DOCTYPE")
+	}
+
+	if "" != doctype.SystemID {
+		if nil == resolver {
+			return nil, errors.New("Missing resolver for external DTD:" + doctype.SystemID)
+		}
+
+		rd, err := resolver(doctype.SystemID)
+		if nil != err {
+			return nil, err
+		}
+		defer rd.Close()
+
+		text, err := ioutil.ReadAll(rd)
+		if nil != err {
+			return nil, err
+		}
+
+		// 外部DTD的声明排在内部子集之后,因此内部子集中的声明优先
+		if err := parseDTDDecls(doctype, string(text)); nil != err {
+			return nil, err
+		}
+	}
+
+	return NewDTD(doctype), nil
+}
+
+func (d *DTD) attribute(element string, name string) *AttributeDecl {
+	for _, attr := range d.attributes[element] {
+		if attr.Name == name {
+			return attr
+		}
+	}
+
+	return nil
+}
+
+// idAttribute 返回element声明为ID类型的属性名,没有时返回空串
+func (d *DTD) idAttribute(element string) string {
+	for _, attr := range d.attributes[element] {
+		if "ID" == attr.Type {
+			return attr.Name
+		}
+	}
+
+	return ""
+}
+
+// ValidationError 描述一个校验错误,Node为出错的节点,Path为该节点在文档中的路径
+type ValidationError struct {
+	Node    XMLNode
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate 使用dtd校验文档,返回所有的校验错误,文档有效时返回空列表.
+//
+// 校验的内容包括:根元素的名字,元素是否声明,元素内容是否符合内容模型,属性是否声明,
+// 必选属性、固定属性、枚举属性的取值,ID的唯一性以及IDREF和IDREFS引用的ID是否存在等.
+func Validate(doc XMLDocument, dtd *DTD) []ValidationError {
+	v := &dtdValidator{dtd: dtd, ids: make(map[string]bool)}
+
+	root := doc.RootElement()
+	if nil == root {
+		v.report(doc, "XML document missing the root element")
+		return v.errors
+	}
+
+	if ("" != dtd.DocType.Name) && (root.Name() != dtd.DocType.Name) {
+		v.report(root, "Root element does not match DOCTYPE:"+dtd.DocType.Name)
+	}
+
+	v.validateElement(root)
+
+	// 所有的ID都收集完毕之后才能检查引用
+	for _, ref := range v.refs {
+		if !v.ids[ref.id] {
+			v.report(ref.elem, "IDREF does not match any ID:"+ref.id)
+		}
+	}
+
+	return v.errors
+}
+
+type dtdReference struct {
+	elem XMLElement
+	id   string
+}
+
+type dtdValidator struct {
+	dtd    *DTD
+	ids    map[string]bool
+	refs   []dtdReference
+	errors []ValidationError
+}
+
+func (v *dtdValidator) report(node XMLNode, message string) {
+	v.errors = append(v.errors, ValidationError{Node: node, Path: NodePath(node), Message: message})
+}
+
+func (v *dtdValidator) validateElement(elem XMLElement) {
+	decl := v.dtd.elements[elem.Name()]
+	if nil == decl {
+		v.report(elem, "Element is not declared:"+elem.Name())
+	} else {
+		v.validateContent(elem, decl)
+	}
+
+	v.validateAttributes(elem)
+
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		v.validateElement(child)
+	}
+}
+
+func (v *dtdValidator) validateContent(elem XMLElement, decl *ElementDecl) {
+	var names []string
+	var elems []XMLElement
+	for child := elem.FirstChild(); nil != child; child = child.Next() {
+		if text := child.ToText(); nil != text {
+			switch decl.Content.Type {
+			case ContentEmpty:
+				v.report(elem, "Element declared EMPTY must not have content:"+elem.Name())
+				return
+			case ContentChildren:
+				if "" != strings.Trim(text.Value(), " \t\r\n") {
+					v.report(child, "Text is not allowed in element:"+elem.Name())
+				}
+			}
+			continue
+		}
+
+		if child := child.ToElement(); nil != child {
+			names = append(names, child.Name())
+			elems = append(elems, child)
+		}
+	}
+
+	switch decl.Content.Type {
+	case ContentEmpty:
+		if len(elems) > 0 {
+			v.report(elem, "Element declared EMPTY must not have content:"+elem.Name())
+		}
+	case ContentMixed:
+		for i, child := range elems {
+			if !containsString(decl.Content.Names, names[i]) {
+				v.report(child, "Element is not allowed in mixed content of "+elem.Name()+":"+names[i])
+			}
+		}
+	case ContentChildren:
+		index, expected := v.dtd.automata[elem.Name()].match(names)
+		switch {
+		case index < 0:
+		case index < len(elems):
+			v.report(elems[index], "Element is not expected here:"+names[index]+", expected "+describeExpected(expected))
+		default:
+			v.report(elem, "Content of element is incomplete:"+elem.Name()+", expected "+describeExpected(expected))
+		}
+	}
+}
+
+func describeExpected(names []string) string {
+	if 0 == len(names) {
+		return "no more elements"
+	}
+
+	return strings.Join(names, "|")
+}
+
+func (v *dtdValidator) validateAttributes(elem XMLElement) {
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		decl := v.dtd.attribute(elem.Name(), attribute.Name())
+		if nil == decl {
+			v.report(elem, "Attribute is not declared:"+attribute.Name())
+			return 0
+		}
+
+		v.validateAttribute(elem, decl, attribute.Value())
+		return 0
+	})
+
+	for _, decl := range v.dtd.attributes[elem.Name()] {
+		if ("#REQUIRED" == decl.Default) && (nil == elem.FindAttribute(decl.Name)) {
+			v.report(elem, "Required attribute is missing:"+decl.Name)
+		}
+	}
+}
+
+func (v *dtdValidator) validateAttribute(elem XMLElement, decl *AttributeDecl, value string) {
+	// 除CDATA之外的属性值需要先规范化空白再比较
+	fixed := decl.Value
+	if "CDATA" != decl.Type {
+		value = strings.Join(strings.Fields(value), " ")
+		fixed = strings.Join(strings.Fields(fixed), " ")
+	}
+
+	if ("#FIXED" == decl.Default) && (value != fixed) {
+		v.report(elem, "Attribute must have the fixed value \""+fixed+"\":"+decl.Name)
+	}
+
+	invalid := func() {
+		v.report(elem, "Invalid "+decl.Type+" value of attribute "+decl.Name+":"+value)
+	}
+
+	switch decl.Type {
+	case "ID":
+		if !isName(value) {
+			invalid()
+		} else if v.ids[value] {
+			v.report(elem, "Duplicate ID:"+value)
+		} else {
+			v.ids[value] = true
+		}
+	case "IDREF", "IDREFS":
+		values := strings.Fields(value)
+		if (0 == len(values)) || (("IDREF" == decl.Type) && (len(values) > 1)) {
+			invalid()
+			return
+		}
+
+		for _, id := range values {
+			if !isName(id) {
+				invalid()
+				return
+			}
+			v.refs = append(v.refs, dtdReference{elem: elem, id: id})
+		}
+	case "ENTITY", "ENTITIES":
+		values := strings.Fields(value)
+		if (0 == len(values)) || (("ENTITY" == decl.Type) && (len(values) > 1)) {
+			invalid()
+			return
+		}
+
+		for _, name := range values {
+			if entity := v.dtd.entities[name]; (nil == entity) || ("" == entity.NData) {
+				v.report(elem, "Attribute does not refer to an unparsed entity:"+name)
+			}
+		}
+	case "NMTOKEN":
+		if !isNmtoken(value) {
+			invalid()
+		}
+	case "NMTOKENS":
+		values := strings.Fields(value)
+		if 0 == len(values) {
+			invalid()
+		}
+
+		for _, token := range values {
+			if !isNmtoken(token) {
+				invalid()
+				return
+			}
+		}
+	case "NOTATION", "ENUMERATION":
+		if !containsString(decl.Enum, value) {
+			v.report(elem, "Attribute value must be one of ("+strings.Join(decl.Enum, "|")+"):"+decl.Name)
+		}
+	}
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ------------------------------------------------------------------
+
+// contentAutomaton 是由内容模型编译而来的非确定有限自动机
+type contentAutomaton struct {
+	states []contentState
+	start  int
+	final  int
+}
+
+// contentState 是自动机的一个状态:name非空时,读入name之后转移到next[0];否则next中都是空转移
+type contentState struct {
+	name string
+	next []int
+}
+
+func newContentAutomaton(particle *ContentParticle) *contentAutomaton {
+	a := new(contentAutomaton)
+	a.start, a.final = a.compile(particle)
+	return a
+}
+
+func (a *contentAutomaton) newState() int {
+	a.states = append(a.states, contentState{})
+	return len(a.states) - 1
+}
+
+func (a *contentAutomaton) link(from int, to int) {
+	a.states[from].next = append(a.states[from].next, to)
+}
+
+// compile 将粒子编译成自动机的一个片段,返回片段的起始状态和结束状态
+func (a *contentAutomaton) compile(p *ContentParticle) (int, int) {
+	var start, end int
+	switch p.Kind {
+	case ParticleName:
+		start, end = a.newState(), a.newState()
+		a.states[start].name = p.Name
+		a.link(start, end)
+	case ParticleSequence:
+		start = a.newState()
+		end = start
+		for _, child := range p.Children {
+			s, e := a.compile(child)
+			a.link(end, s)
+			end = e
+		}
+	case ParticleChoice:
+		start, end = a.newState(), a.newState()
+		for _, child := range p.Children {
+			s, e := a.compile(child)
+			a.link(start, s)
+			a.link(e, end)
+		}
+	}
+
+	if 0 == p.Occurs {
+		return start, end
+	}
+
+	outerStart, outerEnd := a.newState(), a.newState()
+	a.link(outerStart, start)
+	a.link(end, outerEnd)
+	if '+' != p.Occurs {
+		a.link(outerStart, outerEnd)
+	}
+	if '?' != p.Occurs {
+		a.link(end, start)
+	}
+
+	return outerStart, outerEnd
+}
+
+// closure 计算状态集合经过空转移能够到达的所有状态
+func (a *contentAutomaton) closure(states []int) map[int]bool {
+	set := make(map[int]bool)
+	for len(states) > 0 {
+		state := states[len(states)-1]
+		states = states[:len(states)-1]
+		if set[state] {
+			continue
+		}
+
+		set[state] = true
+		if "" == a.states[state].name {
+			states = append(states, a.states[state].next...)
+		}
+	}
+
+	return set
+}
+
+// expected 返回状态集合可以接受的所有元素名
+func (a *contentAutomaton) expected(set map[int]bool) []string {
+	var names []string
+	for state := range set {
+		if name := a.states[state].name; ("" != name) && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// match 使用自动机匹配子元素的名字序列.匹配成功时返回-1;
+// 否则返回第一个不能接受的子元素的序号(子元素不够时为len(names)),以及该位置上可以接受的元素名.
+func (a *contentAutomaton) match(names []string) (int, []string) {
+	set := a.closure([]int{a.start})
+	for i, name := range names {
+		var next []int
+		for state := range set {
+			if name == a.states[state].name {
+				next = append(next, a.states[state].next[0])
+			}
+		}
+
+		if 0 == len(next) {
+			return i, a.expected(set)
+		}
+
+		set = a.closure(next)
+	}
+
+	if !set[a.final] {
+		return len(names), a.expected(set)
+	}
+
+	return -1, nil
+}
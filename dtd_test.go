@@ -0,0 +1,140 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const dtdTestSubset = `
+	<!ELEMENT catalog (book+, (magazine | paper)*, note?)>
+	<!ELEMENT book (#PCDATA | em)*>
+	<!ELEMENT em (#PCDATA)>
+	<!ELEMENT magazine (#PCDATA)>
+	<!ELEMENT paper ANY>
+	<!ELEMENT note EMPTY>
+	<!ATTLIST book
+		id   ID        #REQUIRED
+		lang (en | zh) "en"
+		ref  IDREFS    #IMPLIED
+		ver  CDATA     #FIXED "1.0">
+	<!ATTLIST note
+		code NMTOKEN   #IMPLIED
+		logo ENTITY    #IMPLIED>
+	<!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+	<!NOTATION gif PUBLIC "image/gif">`
+
+func validateString(t *testing.T, body string) []ValidationError {
+	doc, err := LoadDocument(strings.NewReader("<!DOCTYPE catalog [" + dtdTestSubset + "]>" + body))
+	expect(t, "返回值检测", nil == err)
+
+	dtd, err := LoadDTD(doc, nil)
+	expect(t, "加载DTD", nil == err)
+	return Validate(doc, dtd)
+}
+
+func Test_DTD_有效文档(t *testing.T) {
+	errs := validateString(t, `<catalog>
+		<book id="b1" ver="1.0">Hello <em>world</em></book>
+		<book id="b2" ref=" b1  b2 " lang="zh"/>
+		<paper><magazine/></paper><magazine>text</magazine>
+		<note code="x-1" logo="logo"><!--comment--></note>
+	</catalog>`)
+	expect(t, "没有校验错误", 0 == len(errs))
+}
+
+func Test_DTD_内容模型(t *testing.T) {
+	errs := validateString(t, `<catalog><magazine/></catalog>`)
+	expect(t, "缺少必须的book", (1 == len(errs)) && ("/catalog/magazine" == errs[0].Path))
+	expect(t, "错误信息", strings.Contains(errs[0].Message, "expected book"))
+
+	errs = validateString(t, `<catalog><book id="a"/><note/><paper/></catalog>`)
+	expect(t, "note之后不能再有元素", (1 == len(errs)) && ("paper" == errs[0].Node.ToElement().Name()))
+
+	errs = validateString(t, `<catalog><book id="a"><magazine/></book></catalog>`)
+	expect(t, "混合内容中不允许的元素", (1 == len(errs)) && ("/catalog/book/magazine" == errs[0].Path))
+
+	errs = validateString(t, `<catalog><book id="a"/>text</catalog>`)
+	expect(t, "子元素内容中不允许文本", (1 == len(errs)) && ("/catalog/text()" == errs[0].Path))
+
+	errs = validateString(t, `<catalog><book id="a"/><note>text</note></catalog>`)
+	expect(t, "EMPTY元素不能有内容", 1 == len(errs))
+
+	errs = validateString(t, `<catalog><book id="a"/><paper><unknown/></paper></catalog>`)
+	expect(t, "未声明的元素", (1 == len(errs)) && ("/catalog/paper/unknown" == errs[0].Path))
+
+	errs = validateString(t, `<book id="a"/>`)
+	expect(t, "根元素与DOCTYPE不一致", 1 == len(errs))
+}
+
+func Test_DTD_属性(t *testing.T) {
+	errs := validateString(t, `<catalog><book/><book id="b2" lang="fr" ver="2.0" other="x"/></catalog>`)
+	expect(t, "错误个数", 4 == len(errs))
+	expect(t, "缺少必选属性", "/catalog/book[1]" == errs[0].Path)
+	expect(t, "枚举值不正确", strings.HasSuffix(errs[1].Message, ":lang"))
+	expect(t, "固定值不正确", strings.HasSuffix(errs[2].Message, ":ver"))
+	expect(t, "属性未声明", strings.HasSuffix(errs[3].Message, ":other"))
+
+	errs = validateString(t, `<catalog><book id="1a"/><note code="a b" logo="unknown"/></catalog>`)
+	expect(t, "ID、NMTOKEN、ENTITY的取值不正确", 3 == len(errs))
+}
+
+func Test_DTD_ID和IDREF(t *testing.T) {
+	errs := validateString(t, `<catalog><book id="b1" ref="b2"/><book id="b1" ref="b1 b3"/><book id="b2"/></catalog>`)
+	expect(t, "错误个数", 2 == len(errs))
+	expect(t, "ID重复", ("/catalog/book[2]" == errs[0].Path) && strings.Contains(errs[0].Message, "Duplicate ID"))
+	expect(t, "引用的ID不存在", ("/catalog/book[2]" == errs[1].Path) && strings.HasSuffix(errs[1].Message, ":b3"))
+	expect(t, "错误描述", "/catalog/book[2]: "+errs[1].Message == errs[1].Error())
+}
+
+func Test_DTD_外部DTD(t *testing.T) {
+	resolver := func(location string) (io.ReadCloser, error) {
+		if "catalog.dtd" != location {
+			return nil, errors.New("not found:" + location)
+		}
+		return ioutil.NopCloser(strings.NewReader(dtdTestSubset)), nil
+	}
+
+	// 内部子集中的属性声明优先于外部DTD
+	doc, _ := LoadDocument(strings.NewReader(`<!DOCTYPE catalog SYSTEM "catalog.dtd" [<!ATTLIST book id CDATA #IMPLIED>]><catalog><book/></catalog>`))
+	dtd, err := LoadDTD(doc, resolver)
+	expect(t, "加载外部DTD", nil == err)
+	expect(t, "内部子集优先", 0 == len(Validate(doc, dtd)))
+
+	_, err = LoadDTD(doc, nil)
+	expect(t, "没有resolver", nil != err)
+
+	doc, _ = LoadDocument(strings.NewReader(`<!DOCTYPE catalog SYSTEM "other.dtd"><catalog/>`))
+	_, err = LoadDTD(doc, resolver)
+	expect(t, "resolver的错误原样返回", (nil != err) && ("not found:other.dtd" == err.Error()))
+
+	doc, _ = LoadDocument(strings.NewReader(`<catalog><book id="b"/></catalog>`))
+	_, err = LoadDTD(doc, resolver)
+	expect(t, "没有DOCTYPE", nil != err)
+
+	dtd, err = ParseDTD(strings.NewReader(dtdTestSubset))
+	expect(t, "直接解析DTD文件", nil == err)
+	expect(t, "不限定根元素", 0 == len(Validate(doc, dtd)))
+}
+
+// fileResolver 从files中加载资源,没有的位置返回错误,用于测试被加载的资源中相对位置的解析
+func fileResolver(files map[string]string) Resolver {
+	return func(location string) (io.ReadCloser, error) {
+		text, ok := files[location]
+		if !ok {
+			return nil, errors.New("not found:" + location)
+		}
+		return ioutil.NopCloser(strings.NewReader(text)), nil
+	}
+}
+
+func Test_Resolver_相对位置(t *testing.T) {
+	expect(t, "顶层文档中的位置不变", "common/types.xsd" == resolveLocation("", "common/types.xsd"))
+	expect(t, "相对于引用它的资源", "common/base.xsd" == resolveLocation("common/types.xsd", "base.xsd"))
+	expect(t, "上级目录", "base.xsd" == resolveLocation("common/types.xsd", "../base.xsd"))
+	expect(t, "绝对路径", "/schemas/base.xsd" == resolveLocation("common/types.xsd", "/schemas/base.xsd"))
+	expect(t, "相对于URL", "http://example.com/s/base.xsd" == resolveLocation("http://example.com/s/types.xsd", "base.xsd"))
+	expect(t, "绝对URL", "http://example.com/base.xsd" == resolveLocation("common/types.xsd", "http://example.com/base.xsd"))
+}
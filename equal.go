@@ -0,0 +1,168 @@
+package tinydom
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EqualOptions 是Equal的比较选项,缺省情况下节点的类型、名字、属性及其顺序、全部子节点和CDATA标记都要相同
+type EqualOptions struct {
+	IgnoreAttributeOrder bool // 忽略属性的顺序
+	IgnoreComments       bool // 忽略注释
+	IgnoreWhitespace     bool // 忽略全空白的文本
+	IgnoreCDATA          bool // 不区分CDATA和普通文本,相邻的文本合并之后再比较
+	IgnoreProcInsts      bool // 忽略处理指令
+}
+
+// Equal 按照XML的语义比较两个节点,格式和转义方式的差异不影响比较结果
+func Equal(a XMLNode, b XMLNode, opts EqualOptions) bool {
+	equal, _ := EqualExplain(a, b, opts)
+	return equal
+}
+
+// EqualExplain 与Equal相同,不相等时同时返回第一个差异的说明,例如:/config/server/@port: "80" != "8080"
+func EqualExplain(a XMLNode, b XMLNode, opts EqualOptions) (bool, string) {
+	c := &comparer{opts: opts, origins: make(map[XMLNode]XMLNode)}
+	if !c.node(a, b) {
+		return false, c.reason
+	}
+	return true, ""
+}
+
+type comparer struct {
+	opts    EqualOptions
+	reason  string
+	origins map[XMLNode]XMLNode // 合并相邻文本得到的临时节点与第一个被合并的文本
+}
+
+// differ 记录差异,总是返回false
+func (c *comparer) differ(path string, a string, b string) bool {
+	c.reason = path + ": " + a + " != " + b
+	return false
+}
+
+func (c *comparer) node(a XMLNode, b XMLNode) bool {
+	if nodeKind(a)[:1] != nodeKind(b)[:1] {
+		return c.differ(c.path(a), describeNode(a), describeNode(b))
+	}
+
+	switch {
+	case nil != a.ToElement():
+		return c.element(a.ToElement(), b.ToElement())
+	case nil != a.ToDocument():
+		return c.children(a, b)
+	case nil != a.ToProcInst():
+		if nodeKind(a) != nodeKind(b) || (a.ToProcInst().Instruction() != b.ToProcInst().Instruction()) {
+			return c.differ(c.path(a), describeNode(a), describeNode(b))
+		}
+		return true
+	case (nil != a.ToText()) && !c.opts.IgnoreCDATA && (a.ToText().CDATA() != b.ToText().CDATA()):
+		return c.differ(c.path(a), "CDATA "+strconv.FormatBool(a.ToText().CDATA()), "CDATA "+strconv.FormatBool(b.ToText().CDATA()))
+	}
+
+	if a.Value() != b.Value() {
+		return c.differ(c.path(a), describeNode(a), describeNode(b))
+	}
+	return true
+}
+
+// path 返回节点在原来的文档中的路径
+func (c *comparer) path(node XMLNode) string {
+	if origin, ok := c.origins[node]; ok {
+		return NodePath(origin)
+	}
+	return NodePath(node)
+}
+
+func (c *comparer) element(a XMLElement, b XMLElement) bool {
+	if a.Name() != b.Name() {
+		return c.differ(c.path(a), "<"+a.Name()+">", "<"+b.Name()+">")
+	}
+
+	var names []string
+	a.ForeachAttribute(func(attribute XMLAttribute) int {
+		names = append(names, attribute.Name())
+		return 0
+	})
+
+	var bNames []string
+	result := true
+	b.ForeachAttribute(func(attribute XMLAttribute) int {
+		bNames = append(bNames, attribute.Name())
+		if result && (nil == a.FindAttribute(attribute.Name())) {
+			result = c.differ(c.path(a)+"/@"+attribute.Name(), "missing", strconv.Quote(attribute.Value()))
+		}
+		return 0
+	})
+
+	if !result {
+		return false
+	}
+
+	for _, name := range names {
+		value := a.Attribute(name, "")
+		switch {
+		case nil == b.FindAttribute(name):
+			return c.differ(c.path(a)+"/@"+name, strconv.Quote(value), "missing")
+		case value != b.Attribute(name, ""):
+			return c.differ(c.path(a)+"/@"+name, strconv.Quote(value), strconv.Quote(b.Attribute(name, "")))
+		}
+	}
+
+	if !c.opts.IgnoreAttributeOrder && (strings.Join(names, " ") != strings.Join(bNames, " ")) {
+		return c.differ(c.path(a)+"/@*", strconv.Quote(strings.Join(names, " ")), strconv.Quote(strings.Join(bNames, " ")))
+	}
+
+	return c.children(a, b)
+}
+
+func (c *comparer) children(a XMLNode, b XMLNode) bool {
+	la, lb := c.significant(a), c.significant(b)
+	for i := 0; (i < len(la)) && (i < len(lb)); i++ {
+		if !c.node(la[i], lb[i]) {
+			return false
+		}
+	}
+
+	switch {
+	case len(la) < len(lb):
+		return c.differ(c.path(a), "missing", describeNode(lb[len(la)]))
+	case len(la) > len(lb):
+		return c.differ(c.path(la[len(lb)]), describeNode(la[len(lb)]), "missing")
+	}
+	return true
+}
+
+// significant 返回参与比较的子节点,相邻的文本被合并成一个文本节点
+func (c *comparer) significant(node XMLNode) []XMLNode {
+	var result []XMLNode
+	var text XMLText
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		switch {
+		case (nil != child.ToComment()) && c.opts.IgnoreComments:
+			continue
+		case (nil != child.ToProcInst()) && c.opts.IgnoreProcInsts:
+			continue
+		case (nil != child.ToText()) && c.opts.IgnoreWhitespace && ("" == strings.TrimSpace(child.Value())):
+			continue
+		}
+
+		t := child.ToText()
+		if (nil != t) && (nil != text) && (c.opts.IgnoreCDATA || (t.CDATA() == text.CDATA())) {
+			if _, ok := c.origins[text]; !ok {
+				// 合并的结果使用临时节点,不修改原来的文档
+				merged := NewText(text.Value())
+				merged.SetCDATA(text.CDATA())
+				result[len(result)-1] = merged
+				c.origins[merged] = text
+				text = merged
+			}
+			text.SetValue(text.Value() + t.Value())
+			continue
+		}
+
+		text = t
+		result = append(result, child)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package tinydom
+
+import (
+	"strings"
+	"testing"
+)
+
+func equalStrings(t *testing.T, a string, b string, opts EqualOptions) (bool, string) {
+	docA, err := LoadDocument(strings.NewReader(a))
+	expect(t, "加载文档a", nil == err)
+
+	docB, err := LoadDocument(strings.NewReader(b))
+	expect(t, "加载文档b", nil == err)
+
+	return EqualExplain(docA, docB, opts)
+}
+
+func Test_Equal_格式和转义(t *testing.T) {
+	equal, _ := equalStrings(t, `<config><server port="80">a&amp;b</server></config>`,
+		`<config>
+			<server port='80'>a&#38;b</server>
+		</config>`, EqualOptions{})
+	expect(t, "格式和转义方式的差异不影响比较", equal)
+
+	equal, reason := equalStrings(t, `<a x="1" y="2"/>`, `<a y="2" x="1"/>`, EqualOptions{})
+	expect(t, "属性顺序不同", !equal && (`/a/@*: "x y" != "y x"` == reason))
+
+	equal, _ = equalStrings(t, `<a x="1" y="2"/>`, `<a y="2" x="1"/>`, EqualOptions{IgnoreAttributeOrder: true})
+	expect(t, "忽略属性顺序", equal)
+}
+
+func Test_Equal_忽略选项(t *testing.T) {
+	equal, reason := equalStrings(t, `<a><!--c--><?pi x?><b/></a>`, `<a><b/></a>`, EqualOptions{})
+	expect(t, "注释和处理指令参与比较", !equal && (`/a/comment(): <!--c--> != <b>` == reason))
+
+	equal, _ = equalStrings(t, `<a><!--c--><?pi x?><b/></a>`, `<a><b/></a>`, EqualOptions{IgnoreComments: true, IgnoreProcInsts: true})
+	expect(t, "忽略注释和处理指令", equal)
+
+	equal, _ = equalStrings(t, `<a>x<!--c-->y</a>`, `<a>xy</a>`, EqualOptions{IgnoreComments: true})
+	expect(t, "忽略注释之后相邻的文本被合并", equal)
+
+	a := NewDocument()
+	a.InsertElementEndChild("a").InsertEndChild(NewText(" "))
+	b := NewDocument()
+	b.InsertElementEndChild("a")
+	equal, reason = EqualExplain(a, b, EqualOptions{})
+	expect(t, "空白文本参与比较", !equal && (`/a/text(): " " != missing` == reason))
+	expect(t, "忽略空白文本", Equal(a, b, EqualOptions{IgnoreWhitespace: true}))
+}
+
+func Test_Equal_CDATA(t *testing.T) {
+	a := NewElement("a")
+	a.InsertEndChild(NewText("x<"))
+	a.InsertEndChild(NewText("y"))
+
+	b := NewElement("a")
+	cdata := NewText("x<y")
+	cdata.SetCDATA(true)
+	b.InsertEndChild(cdata)
+
+	equal, reason := EqualExplain(a, b, EqualOptions{})
+	expect(t, "CDATA参与比较", !equal && ("a/text()[1]: CDATA false != CDATA true" == reason))
+	expect(t, "忽略CDATA", Equal(a, b, EqualOptions{IgnoreCDATA: true}))
+	expect(t, "比较没有修改原来的节点", "x<" == a.FirstChild().Value())
+}
+
+func Test_Equal_差异说明(t *testing.T) {
+	cases := [][3]string{
+		{`<a><b x="1"/></a>`, `<a><b x="2"/></a>`, `/a/b/@x: "1" != "2"`},
+		{`<a><b/></a>`, `<a><b x="2"/></a>`, `/a/b/@x: missing != "2"`},
+		{`<a><b x="1"/></a>`, `<a><b/></a>`, `/a/b/@x: "1" != missing`},
+		{`<a><b/><c/></a>`, `<a><b/><d/></a>`, `/a/c: <c> != <d>`},
+		{`<a><b/></a>`, `<a><b/><c/></a>`, `/a: missing != <c>`},
+		{`<a>x</a>`, `<a>y</a>`, `/a/text(): "x" != "y"`},
+		{`<a><?pi x?></a>`, `<a><?pi y?></a>`, `/a/processing-instruction(): <?pi x?> != <?pi y?>`},
+	}
+
+	for _, c := range cases {
+		equal, reason := equalStrings(t, c[0], c[1], EqualOptions{})
+		expect(t, "差异说明:"+c[2], !equal && (c[2] == reason))
+	}
+}
@@ -0,0 +1,61 @@
+package tinydom
+
+import (
+	"errors"
+	"strings"
+)
+
+// ResolveIDRef 把elem的IDREF类型的属性name解析成它引用的元素,通过GetElementByID在元素所在的文档中查找.
+// 属性不存在、元素不在文档中或者引用的ID不存在时返回错误.
+func ResolveIDRef(elem XMLElement, name string) (XMLElement, error) {
+	doc, err := idrefDocument(elem, name)
+	if nil != err {
+		return nil, err
+	}
+
+	id := strings.TrimSpace(elem.Attribute(name, ""))
+	target := GetElementByID(doc, id)
+	if nil == target {
+		return nil, errors.New("IDREF does not match any ID:" + id)
+	}
+
+	return target, nil
+}
+
+// ResolveIDRefs 把elem的IDREFS类型的属性name解析成它引用的元素列表,引用的ID以空白分隔.
+// 有ID不存在时返回已经解析出来的元素和第一个不存在的ID的错误.
+func ResolveIDRefs(elem XMLElement, name string) ([]XMLElement, error) {
+	doc, err := idrefDocument(elem, name)
+	if nil != err {
+		return nil, err
+	}
+
+	var targets []XMLElement
+	for _, id := range strings.Fields(elem.Attribute(name, "")) {
+		target := GetElementByID(doc, id)
+		if nil == target {
+			if nil == err {
+				err = errors.New("IDREF does not match any ID:" + id)
+			}
+			continue
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, err
+}
+
+// idrefDocument 返回elem所在的文档.节点的Document在移动之后可能没有更新,因此沿着父节点向上查找
+func idrefDocument(elem XMLElement, name string) (XMLDocument, error) {
+	if nil == elem.FindAttribute(name) {
+		return nil, errors.New("Attribute not found:" + name)
+	}
+
+	for node := elem.Parent(); nil != node; node = node.Parent() {
+		if doc := node.ToDocument(); nil != doc {
+			return doc, nil
+		}
+	}
+
+	return nil, errors.New("Element is not in a document:" + elem.Name())
+}
@@ -0,0 +1,68 @@
+package tinydom
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ID_xml_id属性(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b xml:id=" x "/></a>`))
+	expect(t, "丢弃前缀时xml:id作为id", "b" == GetElementByID(doc, "x").Name())
+
+	doc, _ = LoadDocumentWithOptions(strings.NewReader(`<a><b xml:id="x"/><c id="y"/></a>`), ParseOptions{KeepPrefix: true})
+	expect(t, "保留前缀时没有索引也能查找", "b" == GetElementByID(doc, "x").Name())
+
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+	expect(t, "缺省索引xml:id", "b" == GetElementByID(doc, "x").Name())
+	expect(t, "缺省索引id", "c" == GetElementByID(doc, "y").Name())
+}
+
+func Test_ID_DTD声明的ID(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<!DOCTYPE a [
+<!ATTLIST b key ID #IMPLIED>
+]><a><b key="k1" id="i1"/><c key="k2" id="i2"/></a>`))
+	dtd, err := LoadDTD(doc, nil)
+	expect(t, "加载DTD", nil == err)
+
+	EnableDTDIndex(doc, dtd)
+	defer DisableIndex(doc)
+	expect(t, "DTD声明的ID属性", "b" == GetElementByID(doc, "k1").Name())
+	expect(t, "没有声明ID的元素的属性不是ID", nil == GetElementByID(doc, "k2"))
+	expect(t, "id属性不是ID", (nil == GetElementByID(doc, "i1")) && (nil == GetElementByID(doc, "i2")))
+}
+
+func Test_ID_加载时检查重复(t *testing.T) {
+	_, err := LoadDocumentWithOptions(strings.NewReader(`<a><b xml:id="x"/><c xml:id="x"/></a>`), ParseOptions{UniqueIDs: true})
+	expect(t, "xml:id重复", (nil != err) && ("Duplicate ID:x" == err.Error()))
+
+	_, err = LoadDocumentWithOptions(strings.NewReader(`<a><b id="x"/><c id="x"/></a>`), ParseOptions{UniqueIDs: true})
+	expect(t, "没有指定的属性不检查", nil == err)
+
+	_, err = LoadDocumentWithOptions(strings.NewReader(`<a><b key="x"/><c xml:id="x"/></a>`), ParseOptions{UniqueIDs: true, IDAttributes: []string{"key"}})
+	expect(t, "指定的属性和xml:id重复", nil != err)
+
+	_, err = LoadDocument(strings.NewReader(`<a><b xml:id="x"/><c xml:id="x"/></a>`))
+	expect(t, "缺省不检查", nil == err)
+}
+
+func Test_ID_解析引用(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><user id="u1"/><user id="u2"/><group ref="u2" refs=" u1  u2 " bad="u1 u3"/></a>`))
+	group := doc.RootElement().FirstChildElement("group")
+
+	user, err := ResolveIDRef(group, "ref")
+	expect(t, "解析IDREF", (nil == err) && ("u2" == user.Attribute("id", "")))
+
+	users, err := ResolveIDRefs(group, "refs")
+	expect(t, "解析IDREFS", (nil == err) && (2 == len(users)) && ("u1" == users[0].Attribute("id", "")))
+
+	users, err = ResolveIDRefs(group, "bad")
+	expect(t, "部分ID不存在", (nil != err) && ("IDREF does not match any ID:u3" == err.Error()) && (1 == len(users)))
+
+	_, err = ResolveIDRef(group, "none")
+	expect(t, "属性不存在", nil != err)
+
+	group.Split()
+	_, err = ResolveIDRef(group, "ref")
+	expect(t, "元素不在文档中", nil != err)
+}
@@ -0,0 +1,369 @@
+package tinydom
+
+import "strings"
+
+// defaultIDAttributes 是缺省作为ID的属性名.解析时没有保留名字空间前缀的话,xml:id属性的名字是id
+var defaultIDAttributes = []string{"xml:id", "id"}
+
+// xmlIndex 是文档的元素名和ID索引,在插入、删除、移动节点,修改元素名和属性时增量维护
+type xmlIndex struct {
+	idAttrs []string                 // 作为ID的属性名,按照优先级排列
+	dtd     *DTD                     // 不为nil时DTD中声明为ID类型的属性优先作为ID
+	names   map[string][]XMLElement  // 元素名到元素的列表,按照文档顺序排列
+	ids     map[string][]XMLElement  // ID到元素,正常情况下只有一个元素
+	elemIDs map[XMLElement]indexedID // 元素当前被索引的ID
+}
+
+// indexedID 是元素被索引的ID和提供ID的属性.直接通过XMLAttribute.SetValue修改属性值时索引不会立即更新,
+// 查找时用属性当前的值来确认
+type indexedID struct {
+	id   string
+	attr XMLAttribute
+}
+
+// EnableIndex 为文档建立元素名和ID索引,之后在文档上的修改都会同步更新索引.
+// idAttributes是作为ID的属性名,按照优先级排列,缺省是xml:id和id.重复调用会按照新的属性名重建索引.
+// 只有本包创建的文档支持索引,其他实现的XMLDocument不受影响
+func EnableIndex(doc XMLDocument, idAttributes ...string) {
+	if 0 == len(idAttributes) {
+		idAttributes = defaultIDAttributes
+	}
+
+	if d, ok := doc.(*xmlDocumentImpl); ok {
+		d.enableIndex(idAttributes, nil)
+	}
+}
+
+// EnableDTDIndex 与EnableIndex相同,但是按照XML规范只把dtd中声明为ID类型的属性和xml:id属性作为ID
+func EnableDTDIndex(doc XMLDocument, dtd *DTD) {
+	if d, ok := doc.(*xmlDocumentImpl); ok {
+		d.enableIndex([]string{"xml:id"}, dtd)
+	}
+}
+
+func (d *xmlDocumentImpl) enableIndex(idAttributes []string, dtd *DTD) {
+	idx := &xmlIndex{
+		idAttrs: idAttributes,
+		dtd:     dtd,
+		names:   make(map[string][]XMLElement),
+		ids:     make(map[string][]XMLElement),
+		elemIDs: make(map[XMLElement]indexedID),
+	}
+
+	// 按照文档顺序遍历,元素列表自然是排好序的
+	for node := d.FirstChild(); nil != node; node = nextInDocument(node, d) {
+		if elem := node.ToElement(); nil != elem {
+			idx.names[elem.Name()] = append(idx.names[elem.Name()], elem)
+			idx.addID(elem)
+		}
+	}
+	d.index = idx
+}
+
+// DisableIndex 删除文档的索引
+func DisableIndex(doc XMLDocument) {
+	if d, ok := doc.(*xmlDocumentImpl); ok {
+		d.index = nil
+	}
+}
+
+// documentIndex 返回文档的索引,没有启用索引时返回nil
+func documentIndex(doc XMLDocument) *xmlIndex {
+	if d, ok := doc.(*xmlDocumentImpl); ok {
+		return d.index
+	}
+	return nil
+}
+
+// GetElementsByName 按照文档顺序返回doc中所有名为name的元素.没有启用索引时遍历整个文档
+func GetElementsByName(doc XMLDocument, name string) []XMLElement {
+	idx := documentIndex(doc)
+	if nil == idx {
+		var elems []XMLElement
+		for node := doc.FirstChild(); nil != node; node = nextInDocument(node, doc) {
+			if elem := node.ToElement(); (nil != elem) && (elem.Name() == name) {
+				elems = append(elems, elem)
+			}
+		}
+		return elems
+	}
+
+	return append([]XMLElement(nil), idx.names[name]...)
+}
+
+// GetElementByID 返回doc中ID为id的元素,有多个时返回最先被索引的一个.没有启用索引时遍历整个文档,以xml:id和id属性作为ID
+func GetElementByID(doc XMLDocument, id string) XMLElement {
+	idx := documentIndex(doc)
+	if nil == idx {
+		idx = &xmlIndex{idAttrs: defaultIDAttributes}
+		for node := doc.FirstChild(); nil != node; node = nextInDocument(node, doc) {
+			if elem := node.ToElement(); nil != elem {
+				if elemID, ok := idx.idOf(elem); ok && (elemID == id) {
+					return elem
+				}
+			}
+		}
+		return nil
+	}
+
+	if elem := idx.elementByID(id); nil != elem {
+		return elem
+	}
+
+	// 直接修改过值的ID属性还在旧的ID下,找不到时同步一次再查找
+	idx.syncIDs()
+	return idx.elementByID(id)
+}
+
+// nextInDocument 按照文档顺序返回node的下一个节点,不超出root的范围
+func nextInDocument(node XMLNode, root XMLNode) XMLNode {
+	if nil != node.FirstChild() {
+		return node.FirstChild()
+	}
+
+	for ; (nil != node) && (node != root); node = node.Parent() {
+		if nil != node.Next() {
+			return node.Next()
+		}
+	}
+	return nil
+}
+
+// prevInDocument 按照文档顺序返回node的上一个节点
+func prevInDocument(node XMLNode) XMLNode {
+	prev := node.Prev()
+	if nil == prev {
+		return node.Parent()
+	}
+
+	for nil != prev.LastChild() {
+		prev = prev.LastChild()
+	}
+	return prev
+}
+
+// nextAfterTree 按照文档顺序返回node的子树之后的第一个节点
+func nextAfterTree(node XMLNode) XMLNode {
+	for ; nil != node; node = node.Parent() {
+		if nil != node.Next() {
+			return node.Next()
+		}
+	}
+	return nil
+}
+
+// indexOf 沿着父节点找到节点所在的文档,返回文档的索引,不在文档中或者文档没有启用索引时返回nil.
+// 节点的document只在插入时设置在子树的根上,子树中的其他节点不能用它来查找文档
+func indexOf(node XMLNode) *xmlIndex {
+	for ; nil != node; node = node.Parent() {
+		if doc, ok := node.(*xmlDocumentImpl); ok {
+			return doc.index
+		}
+	}
+	return nil
+}
+
+func (idx *xmlIndex) addTree(node XMLNode) {
+	groups := make(map[string][]XMLElement)
+	for n := node; nil != n; n = nextInDocument(n, node) {
+		if elem := n.ToElement(); nil != elem {
+			groups[elem.Name()] = append(groups[elem.Name()], elem)
+			idx.addID(elem)
+		}
+	}
+
+	idx.insertNames(prevInDocument(node), nextAfterTree(node), groups)
+}
+
+func (idx *xmlIndex) removeTree(node XMLNode) {
+	groups := make(map[string][]XMLElement)
+	for n := node; nil != n; n = nextInDocument(n, node) {
+		if elem := n.ToElement(); nil != elem {
+			groups[elem.Name()] = append(groups[elem.Name()], elem)
+			idx.removeID(elem)
+		}
+	}
+
+	idx.removeNames(groups)
+}
+
+// addName 把已经在文档中的元素加入名字索引,元素的后代不受影响
+func (idx *xmlIndex) addName(elem XMLElement) {
+	idx.insertNames(prevInDocument(elem), nextInDocument(elem, nil), map[string][]XMLElement{elem.Name(): {elem}})
+}
+
+func (idx *xmlIndex) removeName(elem XMLElement) {
+	idx.removeNames(map[string][]XMLElement{elem.Name(): {elem}})
+}
+
+// insertNames 把按照名字分组、组内按照文档顺序排列的元素插入名字列表,这些元素在文档中位于prev和next之间.
+// 从prev向前、从next向后交替查找最近的已经被索引的同名元素来确定插入的位置,
+// 查找的距离不超过到最近的同名元素或者文档两端的距离,在文档末尾追加节点时不需要查找.
+func (idx *xmlIndex) insertNames(prev XMLNode, next XMLNode, groups map[string][]XMLElement) {
+	for name, elems := range groups {
+		if 0 == len(idx.names[name]) {
+			idx.names[name] = elems
+			delete(groups, name)
+		}
+	}
+
+	for 0 != len(groups) {
+		// 一个方向上已经没有节点了,剩下的元素在这个方向上没有同名元素
+		if nil == prev {
+			for name, elems := range groups {
+				idx.names[name] = insertElements(idx.names[name], 0, elems)
+			}
+			return
+		}
+
+		if nil == next {
+			for name, elems := range groups {
+				idx.names[name] = append(idx.names[name], elems...)
+			}
+			return
+		}
+
+		if elem := prev.ToElement(); nil != elem {
+			if elems, ok := groups[elem.Name()]; ok {
+				list := idx.names[elem.Name()]
+				idx.names[elem.Name()] = insertElements(list, lastIndexOf(list, elem)+1, elems)
+				delete(groups, elem.Name())
+			}
+		}
+
+		if elem := next.ToElement(); nil != elem {
+			if elems, ok := groups[elem.Name()]; ok {
+				list := idx.names[elem.Name()]
+				idx.names[elem.Name()] = insertElements(list, lastIndexOf(list, elem), elems)
+				delete(groups, elem.Name())
+			}
+		}
+
+		prev, next = prevInDocument(prev), nextInDocument(next, nil)
+	}
+}
+
+// removeNames 从名字列表中删除按照名字分组的一棵子树中的元素,子树中的同名元素在名字列表中是连续的
+func (idx *xmlIndex) removeNames(groups map[string][]XMLElement) {
+	for name, elems := range groups {
+		list := idx.names[name]
+		i := lastIndexOf(list, elems[0])
+		if (i < 0) || (i+len(elems) > len(list)) {
+			continue
+		}
+
+		if len(list) == len(elems) {
+			delete(idx.names, name)
+			continue
+		}
+
+		copy(list[i:], list[i+len(elems):])
+		for j := len(list) - len(elems); j < len(list); j++ {
+			list[j] = nil
+		}
+		idx.names[name] = list[:len(list)-len(elems)]
+	}
+}
+
+// lastIndexOf 从后向前查找elem在list中的下标,文档通常是在后面追加节点,从后向前查找更快
+func lastIndexOf(list []XMLElement, elem XMLElement) int {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == elem {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertElements 把elems插入到list的下标i处
+func insertElements(list []XMLElement, i int, elems []XMLElement) []XMLElement {
+	if i < 0 {
+		i = len(list)
+	}
+
+	list = append(list, elems...)
+	copy(list[i+len(elems):], list[i:len(list)-len(elems)])
+	copy(list[i:], elems)
+	return list
+}
+
+// idOf 返回元素的ID,没有ID属性时返回false.与DTD中的ID类型一样,ID的值会去掉首尾的空白
+func (idx *xmlIndex) idOf(elem XMLElement) (string, bool) {
+	if attr := idx.idAttribute(elem); nil != attr {
+		return strings.TrimSpace(attr.Value()), true
+	}
+	return "", false
+}
+
+// idAttribute 返回元素作为ID的属性
+func (idx *xmlIndex) idAttribute(elem XMLElement) XMLAttribute {
+	if nil != idx.dtd {
+		if name := idx.dtd.idAttribute(elem.Name()); "" != name {
+			if attr := elem.FindAttribute(name); nil != attr {
+				return attr
+			}
+		}
+	}
+
+	for _, name := range idx.idAttrs {
+		if attr := elem.FindAttribute(name); nil != attr {
+			return attr
+		}
+	}
+	return nil
+}
+
+// elementByID 返回最先被索引的、ID属性当前的值仍然是id的元素
+func (idx *xmlIndex) elementByID(id string) XMLElement {
+	for _, elem := range idx.ids[id] {
+		if strings.TrimSpace(idx.elemIDs[elem].attr.Value()) == id {
+			return elem
+		}
+	}
+	return nil
+}
+
+// syncIDs 重新索引ID属性被直接修改过的元素,需要检查所有被索引的元素
+func (idx *xmlIndex) syncIDs() {
+	for elem, indexed := range idx.elemIDs {
+		if strings.TrimSpace(indexed.attr.Value()) != indexed.id {
+			idx.removeID(elem)
+			idx.addID(elem)
+		}
+	}
+}
+
+func (idx *xmlIndex) addID(elem XMLElement) {
+	attr := idx.idAttribute(elem)
+	if nil == attr {
+		return
+	}
+
+	id := strings.TrimSpace(attr.Value())
+	idx.elemIDs[elem] = indexedID{id: id, attr: attr}
+	idx.ids[id] = append(idx.ids[id], elem)
+}
+
+func (idx *xmlIndex) removeID(elem XMLElement) {
+	indexed, ok := idx.elemIDs[elem]
+	if !ok {
+		return
+	}
+
+	id := indexed.id
+
+	delete(idx.elemIDs, elem)
+	elems := idx.ids[id]
+	for i := range elems {
+		if elems[i] == elem {
+			elems = append(elems[:i], elems[i+1:]...)
+			break
+		}
+	}
+
+	if 0 == len(elems) {
+		delete(idx.ids, id)
+	} else {
+		idx.ids[id] = elems
+	}
+}
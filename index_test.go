@@ -0,0 +1,237 @@
+package tinydom
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func indexNames(elems []XMLElement) string {
+	var names []string
+	for _, elem := range elems {
+		names = append(names, elem.Attribute("n", ""))
+	}
+	return strings.Join(names, " ")
+}
+
+func Test_Index_按名字查找(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b n="1"><b n="2"/></b><c/><b n="3"/></a>`))
+	expect(t, "没有索引时遍历查找", "1 2 3" == indexNames(GetElementsByName(doc, "b")))
+
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+	expect(t, "按照文档顺序返回", "1 2 3" == indexNames(GetElementsByName(doc, "b")))
+	expect(t, "不存在的名字", 0 == len(GetElementsByName(doc, "x")))
+
+	elems := GetElementsByName(doc, "b")
+	elems[0] = nil
+	expect(t, "返回的是副本", nil != GetElementsByName(doc, "b")[0])
+}
+
+// otherDocument 模拟其他包实现的XMLDocument
+type otherDocument struct {
+	XMLDocument
+}
+
+func Test_Index_其他实现的文档(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b n="1" id="x"/><b n="2"/></a>`))
+	other := otherDocument{doc}
+	EnableIndex(other)
+	defer DisableIndex(other)
+	expect(t, "不支持索引时遍历查找", "1 2" == indexNames(GetElementsByName(other, "b")))
+	expect(t, "不支持索引时按ID遍历查找", "1" == GetElementByID(other, "x").Attribute("n", ""))
+}
+
+func Test_Index_增量更新(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b n="1"/><c n="x"><b n="2"/></c></a>`))
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+	expect(t, "初始状态", "1 2" == indexNames(GetElementsByName(doc, "b")))
+
+	root := doc.RootElement()
+	b3 := NewElement("b")
+	b3.SetAttribute("n", "3")
+	root.InsertFirstChild(b3)
+	expect(t, "插入节点", "3 1 2" == indexNames(GetElementsByName(doc, "b")))
+
+	c := root.FirstChildElement("c")
+	c.InsertEndChild(b3)
+	expect(t, "移动节点", "1 2 3" == indexNames(GetElementsByName(doc, "b")))
+
+	b3.Split()
+	expect(t, "摘除节点", "1 2" == indexNames(GetElementsByName(doc, "b")))
+	expect(t, "摘除的节点不再被索引", nil == GetElementByID(doc, "3"))
+
+	c.SetName("b")
+	expect(t, "修改元素名", "1 x 2" == indexNames(GetElementsByName(doc, "b")))
+	expect(t, "旧名字不再被索引", 0 == len(GetElementsByName(doc, "c")))
+
+	root.DeleteChild(c)
+	expect(t, "删除子树", "1" == indexNames(GetElementsByName(doc, "b")))
+
+	DisableIndex(doc)
+	root.InsertEndChild(NewElement("b"))
+	expect(t, "关闭索引后遍历查找", 2 == len(GetElementsByName(doc, "b")))
+}
+
+func Test_Index_按ID查找(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b id="x"/><c key="y"/></a>`))
+	expect(t, "没有索引时以id属性查找", "b" == GetElementByID(doc, "x").Name())
+	expect(t, "没有索引时不存在的ID", nil == GetElementByID(doc, "y"))
+
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+	b := GetElementByID(doc, "x")
+	expect(t, "启用索引后查找", (nil != b) && ("b" == b.Name()))
+
+	b.FindAttribute("id").SetValue("z")
+	expect(t, "修改属性值后旧ID不存在", nil == GetElementByID(doc, "x"))
+	expect(t, "修改属性值后新ID存在", b == GetElementByID(doc, "z"))
+
+	b.SetAttribute("id", "w")
+	expect(t, "SetAttribute修改ID", b == GetElementByID(doc, "w"))
+
+	b.DeleteAttribute("id")
+	expect(t, "删除ID属性", nil == GetElementByID(doc, "w"))
+
+	b.SetAttribute("id", "v")
+	expect(t, "新增ID属性", b == GetElementByID(doc, "v"))
+
+	b.ClearAttributes()
+	expect(t, "清空属性", nil == GetElementByID(doc, "v"))
+
+	EnableIndex(doc, "key", "id")
+	c := doc.RootElement().FirstChildElement("c")
+	expect(t, "指定ID属性名", c == GetElementByID(doc, "y"))
+
+	c.SetAttribute("id", "u")
+	expect(t, "优先使用前面的属性名", (c == GetElementByID(doc, "y")) && (nil == GetElementByID(doc, "u")))
+
+	// 重复的ID中先被索引的元素的属性被直接修改之后,返回另一个元素
+	b.SetAttribute("key", "y")
+	c.FindAttribute("key").SetValue("t")
+	expect(t, "直接修改重复的ID", (b == GetElementByID(doc, "y")) && (c == GetElementByID(doc, "t")))
+}
+
+func Test_Index_随机修改后保持文档顺序(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b n="0"><c n="1"/></b></a>`))
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+
+	names := []string{"b", "c", "d"}
+	r := rand.New(rand.NewSource(1))
+	var elems []XMLElement
+	for node := doc.FirstChild(); nil != node; node = nextInDocument(node, doc) {
+		if elem := node.ToElement(); nil != elem {
+			elems = append(elems, elem)
+		}
+	}
+
+	for i := 0; i < 2000; i++ {
+		target := elems[r.Intn(len(elems))]
+		switch r.Intn(6) {
+		case 0:
+			elem := NewElement(names[r.Intn(len(names))])
+			elem.SetAttribute("n", strconv.Itoa(len(elems)))
+			elem.InsertEndChild(NewElement(names[r.Intn(len(names))]))
+			elems = append(elems, elem, elem.FirstChild().ToElement())
+			target.InsertFirstChild(elem)
+		case 1:
+			target.InsertBack(NewElement(names[r.Intn(len(names))]))
+		case 2:
+			target.InsertFront(NewElement(names[r.Intn(len(names))]))
+		case 3:
+			if target != doc.RootElement() {
+				// 移动子树,不能移动到自己的后代中
+				other := elems[r.Intn(len(elems))]
+				for p := other; nil != p; p = toElement(p.Parent()) {
+					if p == target {
+						other = doc.RootElement()
+						break
+					}
+				}
+				other.InsertEndChild(target)
+			}
+		case 4:
+			if target != doc.RootElement() {
+				target.Split()
+			}
+		case 5:
+			target.SetName(names[r.Intn(len(names))])
+		}
+
+		// 插入到文档中的新元素也参与后面的修改
+		elems = elems[:0]
+		for node := doc.FirstChild(); nil != node; node = nextInDocument(node, doc) {
+			if elem := node.ToElement(); nil != elem {
+				elems = append(elems, elem)
+			}
+		}
+
+		for _, name := range names {
+			got := GetElementsByName(doc, name)
+			var want []XMLElement
+			for _, elem := range elems {
+				if elem.Name() == name {
+					want = append(want, elem)
+				}
+			}
+
+			if len(got) != len(want) {
+				expect(t, "元素个数相同:"+name, false)
+				return
+			}
+			for j := range want {
+				if got[j] != want[j] {
+					expect(t, "元素按照文档顺序排列:"+name, false)
+					return
+				}
+			}
+		}
+	}
+}
+
+func Test_Index_通过所在文档查找索引(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a/>`))
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+
+	// 在文档外构造的子树插入文档之后,子树深处的节点的修改也要更新索引
+	other, _ := LoadDocument(strings.NewReader(`<x><b n="1"><b n="2"/></b></x>`))
+	sub := other.RootElement().FirstChildElement("b")
+	other.RootElement().DeleteChild(sub)
+	doc.RootElement().InsertEndChild(sub)
+	expect(t, "插入子树", "1 2" == indexNames(GetElementsByName(doc, "b")))
+
+	inner := sub.FirstChildElement("b")
+	inner.SetAttribute("id", "k")
+	expect(t, "修改子树深处元素的属性", inner == GetElementByID(doc, "k"))
+	inner.InsertEndChild(NewElement("b")).ToElement().SetAttribute("n", "3")
+	expect(t, "在子树深处插入元素", "1 2 3" == indexNames(GetElementsByName(doc, "b")))
+
+	// 没有启用索引的文档的修改不影响其他文档的索引
+	other.RootElement().InsertEndChild(NewElement("b"))
+	expect(t, "其他文档的修改", "1 2 3" == indexNames(GetElementsByName(doc, "b")))
+}
+
+func Benchmark_Index_插入和查找(b *testing.B) {
+	doc := NewDocument()
+	books := doc.InsertEndChild(NewElement("books"))
+	for i := 0; i < 20000; i++ {
+		books.InsertEndChild(NewElement("book")).InsertEndChild(NewElement("title"))
+	}
+	EnableIndex(doc)
+	defer DisableIndex(doc)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		book := NewElement("book")
+		book.InsertEndChild(NewElement("title"))
+		books.FirstChild().Next().InsertBack(book)
+		if 20001 != len(GetElementsByName(doc, "book")) {
+			b.Fatal("wrong number of books")
+		}
+		book.Split()
+	}
+}
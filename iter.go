@@ -0,0 +1,122 @@
+//go:build go1.23
+// +build go1.23
+
+package tinydom
+
+import "iter"
+
+// Children 返回node的子节点的迭代器,可以在循环中删除当前节点:
+//
+//	for child := range tinydom.Children(elem) {
+//	    ...
+//	}
+func Children(node XMLNode) iter.Seq[XMLNode] {
+	return func(yield func(XMLNode) bool) {
+		for child := node.FirstChild(); nil != child; {
+			next := child.Next()
+			if !yield(child) {
+				return
+			}
+			child = next
+		}
+	}
+}
+
+// ChildElements 返回node的名为name的子元素的迭代器,name为空时返回所有子元素,可以在循环中删除当前元素
+func ChildElements(node XMLNode, name string) iter.Seq[XMLElement] {
+	return func(yield func(XMLElement) bool) {
+		for elem := node.FirstChildElement(name); nil != elem; {
+			next := elem.NextElement(name)
+			if !yield(elem) {
+				return
+			}
+			elem = next
+		}
+	}
+}
+
+// Descendants 按照文档顺序返回node的所有后代节点的迭代器,不包括node自己
+func Descendants(node XMLNode) iter.Seq[XMLNode] {
+	return func(yield func(XMLNode) bool) {
+		descendants(node, yield)
+	}
+}
+
+func descendants(node XMLNode, yield func(XMLNode) bool) bool {
+	for child := node.FirstChild(); nil != child; {
+		next := child.Next()
+		if !yield(child) || !descendants(child, yield) {
+			return false
+		}
+		child = next
+	}
+	return true
+}
+
+// DescendantElements 按照文档顺序返回node的名为name的后代元素的迭代器,name为空时返回所有后代元素
+func DescendantElements(node XMLNode, name string) iter.Seq[XMLElement] {
+	return func(yield func(XMLElement) bool) {
+		for n := range Descendants(node) {
+			if elem := n.ToElement(); (nil != elem) && (("" == name) || (elem.Name() == name)) {
+				if !yield(elem) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Ancestors 从父节点开始由近及远地返回node的祖先节点的迭代器,最后一个通常是文档
+func Ancestors(node XMLNode) iter.Seq[XMLNode] {
+	return func(yield func(XMLNode) bool) {
+		for parent := node.Parent(); nil != parent; parent = parent.Parent() {
+			if !yield(parent) {
+				return
+			}
+		}
+	}
+}
+
+// FollowingSiblings 按照文档顺序返回node之后的兄弟节点的迭代器
+func FollowingSiblings(node XMLNode) iter.Seq[XMLNode] {
+	return func(yield func(XMLNode) bool) {
+		for sibling := node.Next(); nil != sibling; {
+			next := sibling.Next()
+			if !yield(sibling) {
+				return
+			}
+			sibling = next
+		}
+	}
+}
+
+// PrecedingSiblings 从最近的一个开始返回node之前的兄弟节点的迭代器
+func PrecedingSiblings(node XMLNode) iter.Seq[XMLNode] {
+	return func(yield func(XMLNode) bool) {
+		for sibling := node.Prev(); nil != sibling; {
+			prev := sibling.Prev()
+			if !yield(sibling) {
+				return
+			}
+			sibling = prev
+		}
+	}
+}
+
+// Attributes 按照顺序返回元素的属性的迭代器,代替ForeachAttribute的回调函数.
+// 迭代的是开始迭代时的属性列表,可以在循环中增加或者删除属性.
+func Attributes(elem XMLElement) iter.Seq[XMLAttribute] {
+	return func(yield func(XMLAttribute) bool) {
+		attrs := make([]XMLAttribute, 0, elem.AttributeCount())
+		elem.ForeachAttribute(func(attribute XMLAttribute) int {
+			attrs = append(attrs, attribute)
+			return 0
+		})
+
+		for _, attr := range attrs {
+			if !yield(attr) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+//go:build go1.23
+// +build go1.23
+
+package tinydom
+
+import (
+	"strings"
+	"testing"
+)
+
+func iterNames[T XMLNode](seq func(func(T) bool)) string {
+	var names []string
+	for node := range seq {
+		if elem := node.ToElement(); nil != elem {
+			names = append(names, elem.Name())
+		} else {
+			names = append(names, "#"+node.Value())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func Test_Iter_子节点和后代(t *testing.T) {
+	doc, err := LoadDocument(strings.NewReader(`<a><b><c/>x</b><d/><b/><!--e--></a>`))
+	expect(t, "加载文档", nil == err)
+	a := doc.RootElement()
+
+	expect(t, "子节点", "b,d,b,#e" == iterNames(Children(a)))
+	expect(t, "子元素", "b,d,b" == iterNames(ChildElements(a, "")))
+	expect(t, "指定名字的子元素", "b,b" == iterNames(ChildElements(a, "b")))
+	expect(t, "后代节点", "a,b,c,#x,d,b,#e" == iterNames(Descendants(doc)))
+	expect(t, "后代元素", "b,c,d,b" == iterNames(DescendantElements(a, "")))
+	expect(t, "指定名字的后代元素", "c" == iterNames(DescendantElements(doc, "c")))
+
+	count := 0
+	for range Descendants(doc) {
+		count++
+		if 3 == count {
+			break
+		}
+	}
+	expect(t, "提前结束迭代", 3 == count)
+}
+
+func Test_Iter_祖先和兄弟(t *testing.T) {
+	doc, err := LoadDocument(strings.NewReader(`<a><b/><c><d/></c><e/><f/></a>`))
+	expect(t, "加载文档", nil == err)
+	c := doc.RootElement().FirstChildElement("c")
+
+	var ancestors []XMLNode
+	for node := range Ancestors(c.FirstChild()) {
+		ancestors = append(ancestors, node)
+	}
+	expect(t, "祖先节点", (3 == len(ancestors)) && (c == ancestors[0]) && (doc == ancestors[2]))
+	expect(t, "后面的兄弟", "e,f" == iterNames(FollowingSiblings(c)))
+	expect(t, "前面的兄弟", "b" == iterNames(PrecedingSiblings(c)))
+	expect(t, "从最近的开始", "e,c,b" == iterNames(PrecedingSiblings(doc.RootElement().LastChild())))
+}
+
+func Test_Iter_迭代时修改(t *testing.T) {
+	doc, err := LoadDocument(strings.NewReader(`<a x="1" y="2" z="3"><b/><c/><b/><d/></a>`))
+	expect(t, "加载文档", nil == err)
+	a := doc.RootElement()
+
+	for elem := range ChildElements(a, "b") {
+		a.DeleteChild(elem)
+	}
+	expect(t, "删除当前元素", "c,d" == iterNames(Children(a)))
+
+	var names []string
+	for attr := range Attributes(a) {
+		names = append(names, attr.Name())
+		a.DeleteAttribute(attr.Name())
+	}
+	expect(t, "遍历并删除属性", ("x y z" == strings.Join(names, " ")) && (0 == a.AttributeCount()))
+}
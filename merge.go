@@ -0,0 +1,329 @@
+package tinydom
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// ConflictType 是三方合并中冲突的类型
+type ConflictType int
+
+const (
+	ConflictAttribute    ConflictType = iota // 双方把同一个属性改成了不同的值
+	ConflictContent                          // 双方把同一个文本、注释或者处理指令改成了不同的内容
+	ConflictDeleteModify                     // 一方删除了节点,另一方修改了它
+	ConflictInsert                           // 双方插入了标识相同但是内容不同的节点
+	ConflictOrder                            // 双方以不同的方式调整了子节点的顺序
+)
+
+var conflictTypeNames = []string{"attribute", "content", "delete-modify", "insert", "order"}
+
+// String 返回冲突类型的名字
+func (t ConflictType) String() string {
+	if (t < 0) || (int(t) >= len(conflictTypeNames)) {
+		return "unknown"
+	}
+	return conflictTypeNames[t]
+}
+
+// MergeConflict 是Merge无法自动解决的冲突.Base、Ours、Theirs是冲突的节点在三个文档中的版本,不存在的版本为nil.
+// ConflictAttribute的三个节点是属性所在的元素,Attribute是属性名;ConflictOrder的三个节点是子节点顺序冲突的父节点.
+// Path是节点在ours中的路径,ours中不存在时是在theirs或者base中的路径.
+type MergeConflict struct {
+	Type      ConflictType
+	Path      string
+	Attribute string
+	Base      XMLNode
+	Ours      XMLNode
+	Theirs    XMLNode
+}
+
+// String 返回冲突的可读形式,例如:attribute conflict /config/server[2]/@port
+func (c MergeConflict) String() string {
+	if "" != c.Attribute {
+		return c.Type.String() + " conflict " + c.Path + "/@" + c.Attribute
+	}
+	return c.Type.String() + " conflict " + c.Path
+}
+
+// MergeOptions 是Merge的选项
+type MergeOptions struct {
+	// Keys 是元素名到标识属性名的映射,键为"*"的项对其它元素生效;为nil时所有元素都使用id属性作为标识.
+	// 没有标识属性的元素按照同名兄弟元素之间的顺序对应.
+	Keys map[string]string
+
+	PreferTheirs    bool // 发生冲突时合并结果采用theirs的版本,缺省采用ours的版本
+	ConflictMarkers bool // 在发生冲突的位置插入<<<<<<< ours ... ======= ... >>>>>>> theirs形式的注释
+}
+
+// Merge 把ours和theirs相对于共同祖先base的修改合并成一个新文档,三个文档都不会被修改.
+//
+// 子节点按照标识对应:元素的标识是名字和标识属性的值,其它节点按照同类节点之间的顺序对应.只有一方修改的节点采用修改之后的版本,
+// 双方都修改了的元素逐个合并属性和子节点,双方新增的节点都被保留,子节点的顺序采用调整了顺序的一方.无法自动合并的修改作为冲突返回,
+// 合并结果中采用MergeOptions选择的一方的版本.
+func Merge(base XMLDocument, ours XMLDocument, theirs XMLDocument, opts MergeOptions) (XMLDocument, []MergeConflict) {
+	m := &merger{opts: opts, d: newDiffer(DiffOptions{})}
+	if nil == m.opts.Keys {
+		m.opts.Keys = map[string]string{"*": "id"}
+	}
+
+	result := NewDocument()
+	m.mergeChildren(base, ours, theirs, result)
+	return result, m.conflicts
+}
+
+type merger struct {
+	opts      MergeOptions
+	d         *differ // 用子树的签名判断节点是否被修改过
+	conflicts []MergeConflict
+}
+
+// same 判断两棵子树是否相同
+func (m *merger) same(a XMLNode, b XMLNode) bool {
+	return m.d.same(a, b)
+}
+
+// identity 返回子节点的标识,同一个父节点下标识唯一
+func (m *merger) identity(node XMLNode) string {
+	elem := node.ToElement()
+	if nil == elem {
+		return nodeKind(node)
+	}
+
+	name, ok := m.opts.Keys[elem.Name()]
+	if !ok {
+		name = m.opts.Keys["*"]
+	}
+
+	if attr := elem.FindAttribute(name); ("" != name) && (nil != attr) {
+		return "e" + elem.Name() + "\x00" + attr.Value()
+	}
+	return "e" + elem.Name()
+}
+
+// keyed 返回子节点的标识列表和标识到子节点的映射,标识相同的节点再用出现的次序区分
+func (m *merger) keyed(node XMLNode) ([]string, map[string]XMLNode) {
+	var keys []string
+	nodes := make(map[string]XMLNode)
+	counts := make(map[string]int)
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		id := m.identity(child)
+		counts[id]++
+		key := id + "\x01" + strconv.Itoa(counts[id])
+		keys = append(keys, key)
+		nodes[key] = child
+	}
+	return keys, nodes
+}
+
+func (m *merger) mergeChildren(base XMLNode, ours XMLNode, theirs XMLNode, result XMLNode) {
+	baseKeys, baseNodes := m.keyed(base)
+	oursKeys, oursNodes := m.keyed(ours)
+	theirsKeys, theirsNodes := m.keyed(theirs)
+
+	conflicted := func() {
+		m.conflict(MergeConflict{Type: ConflictOrder, Path: NodePath(ours), Base: base, Ours: ours, Theirs: theirs}, nil, nil)
+	}
+
+	for _, key := range m.order(baseKeys, oursKeys, theirsKeys, baseNodes, oursNodes, theirsNodes, conflicted) {
+		m.mergeNode(baseNodes[key], oursNodes[key], theirsNodes[key], result)
+	}
+}
+
+// order 返回合并之后子节点的顺序.以调整了顺序的一方为主,另一方新增的节点跟在它原来前面的节点之后
+func (m *merger) order(baseKeys, oursKeys, theirsKeys []string, baseNodes, oursNodes, theirsNodes map[string]XMLNode, conflicted func()) []string {
+	common := func(keys []string) []string {
+		var result []string
+		for _, key := range keys {
+			if (nil != baseNodes[key]) && (nil != oursNodes[key]) && (nil != theirsNodes[key]) {
+				result = append(result, key)
+			}
+		}
+		return result
+	}
+
+	equal := func(a []string, b []string) bool {
+		return strings.Join(a, "\x02") == strings.Join(b, "\x02")
+	}
+
+	baseOrder, oursOrder, theirsOrder := common(baseKeys), common(oursKeys), common(theirsKeys)
+	primary, secondary := oursKeys, theirsKeys
+	switch {
+	case equal(oursOrder, baseOrder) && !equal(theirsOrder, baseOrder):
+		primary, secondary = theirsKeys, oursKeys
+	case !equal(oursOrder, baseOrder) && !equal(theirsOrder, baseOrder) && !equal(oursOrder, theirsOrder):
+		conflicted()
+		if m.opts.PreferTheirs {
+			primary, secondary = theirsKeys, oursKeys
+		}
+	}
+
+	inPrimary := make(map[string]bool)
+	for _, key := range primary {
+		inPrimary[key] = true
+	}
+
+	anchor := ""
+	after := make(map[string][]string)
+	for _, key := range secondary {
+		if inPrimary[key] {
+			anchor = key
+			continue
+		}
+		after[anchor] = append(after[anchor], key)
+	}
+
+	result := after[""]
+	for _, key := range primary {
+		result = append(result, key)
+		result = append(result, after[key]...)
+	}
+	return result
+}
+
+// mergeNode 合并标识相同的一组子节点,结果添加到parent的末尾
+func (m *merger) mergeNode(base XMLNode, ours XMLNode, theirs XMLNode, parent XMLNode) {
+	switch {
+	case (nil == ours) && (nil == theirs):
+		// 双方都删除了
+	case (nil == base) && (nil == theirs):
+		parent.InsertEndChild(cloneNode(ours))
+	case (nil == base) && (nil == ours):
+		parent.InsertEndChild(cloneNode(theirs))
+	case nil == base:
+		if m.same(ours, theirs) {
+			parent.InsertEndChild(cloneNode(ours))
+			return
+		}
+		m.conflictNode(ConflictInsert, base, ours, theirs, parent)
+	case nil == ours:
+		if !m.same(base, theirs) {
+			m.conflictNode(ConflictDeleteModify, base, ours, theirs, parent)
+		}
+	case nil == theirs:
+		if !m.same(base, ours) {
+			m.conflictNode(ConflictDeleteModify, base, ours, theirs, parent)
+		}
+	case m.same(ours, theirs) || m.same(base, theirs):
+		parent.InsertEndChild(cloneNode(ours))
+	case m.same(base, ours):
+		parent.InsertEndChild(cloneNode(theirs))
+	case nil != ours.ToElement():
+		m.mergeElement(base.ToElement(), ours.ToElement(), theirs.ToElement(), parent)
+	default:
+		m.conflictNode(ConflictContent, base, ours, theirs, parent)
+	}
+}
+
+// mergeElement 合并双方都修改了的元素
+func (m *merger) mergeElement(base XMLElement, ours XMLElement, theirs XMLElement, parent XMLNode) {
+	type value struct {
+		value string
+		ok    bool
+	}
+
+	get := func(elem XMLElement, name string) value {
+		if attr := elem.FindAttribute(name); nil != attr {
+			return value{attr.Value(), true}
+		}
+		return value{}
+	}
+
+	var names []string
+	for _, elem := range []XMLElement{ours, theirs} {
+		elem.ForeachAttribute(func(attribute XMLAttribute) int {
+			if !containsString(names, attribute.Name()) {
+				names = append(names, attribute.Name())
+			}
+			return 0
+		})
+	}
+
+	elem := NewElement(ours.Name())
+	for _, name := range names {
+		b, o, t := get(base, name), get(ours, name), get(theirs, name)
+		v := o
+		switch {
+		case (o == t) || (b == t):
+		case b == o:
+			v = t
+		default:
+			conflict := MergeConflict{Type: ConflictAttribute, Path: NodePath(ours), Attribute: name, Base: base, Ours: ours, Theirs: theirs}
+			m.conflict(conflict, func() XMLNode {
+				return m.marker(attributeString(name, o.value, o.ok), attributeString(name, t.value, t.ok))
+			}, parent)
+			if m.opts.PreferTheirs {
+				v = t
+			}
+		}
+
+		if v.ok {
+			elem.SetAttribute(name, v.value)
+		}
+	}
+
+	parent.InsertEndChild(elem)
+	m.mergeChildren(base, ours, theirs, elem)
+}
+
+// conflictNode 记录子节点的冲突,合并结果中采用选择的一方的版本
+func (m *merger) conflictNode(typ ConflictType, base XMLNode, ours XMLNode, theirs XMLNode, parent XMLNode) {
+	conflict := MergeConflict{Type: typ, Base: base, Ours: ours, Theirs: theirs}
+	for _, node := range []XMLNode{ours, theirs, base} {
+		if nil != node {
+			conflict.Path = NodePath(node)
+			break
+		}
+	}
+
+	m.conflict(conflict, func() XMLNode {
+		return m.marker(nodeString(ours), nodeString(theirs))
+	}, parent)
+
+	chosen := ours
+	if m.opts.PreferTheirs {
+		chosen = theirs
+	}
+	if nil != chosen {
+		parent.InsertEndChild(cloneNode(chosen))
+	}
+}
+
+// conflict 记录冲突,需要时在parent的末尾插入冲突标记
+func (m *merger) conflict(conflict MergeConflict, marker func() XMLNode, parent XMLNode) {
+	m.conflicts = append(m.conflicts, conflict)
+	if m.opts.ConflictMarkers && (nil != marker) {
+		parent.InsertEndChild(marker())
+	}
+}
+
+// marker 返回冲突标记注释,注释中不允许出现的"--"被拆开
+func (m *merger) marker(ours string, theirs string) XMLNode {
+	text := "<<<<<<< ours\n" + ours + "\n=======\n" + theirs + "\n>>>>>>> theirs"
+	for strings.Contains(text, "--") {
+		text = strings.Replace(text, "--", "- -", -1)
+	}
+	return NewComment(text)
+}
+
+func nodeString(node XMLNode) string {
+	if nil == node {
+		return ""
+	}
+
+	buf := bytes.NewBufferString("")
+	node.Accept(NewSimplePrinter(buf, PrintStream))
+	return buf.String()
+}
+
+func attributeString(name string, value string, ok bool) string {
+	if !ok {
+		return ""
+	}
+
+	buf := bytes.NewBufferString(name + "=\"")
+	EscapeAttribute(buf, []byte(value))
+	buf.WriteString("\"")
+	return buf.String()
+}
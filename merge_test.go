@@ -0,0 +1,98 @@
+package tinydom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mergeStrings(t *testing.T, base string, ours string, theirs string, opts MergeOptions) (string, []MergeConflict) {
+	var docs []XMLDocument
+	for _, text := range []string{base, ours, theirs} {
+		doc, err := LoadDocument(strings.NewReader(text))
+		expect(t, "加载文档", nil == err)
+		docs = append(docs, doc)
+	}
+
+	result, conflicts := Merge(docs[0], docs[1], docs[2], opts)
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出结果", nil == SaveDocument(result, buf, PrintStream))
+	return buf.String(), conflicts
+}
+
+func Test_Merge_合并双方的修改(t *testing.T) {
+	const base = `<deploy>
+		<service id="web" port="80"><image>web:1</image></service>
+		<service id="db" port="5432"><image>db:1</image></service>
+		<service id="cache"/>
+	</deploy>`
+
+	result, conflicts := mergeStrings(t, base, `<deploy>
+		<service id="web" port="8080"><image>web:1</image></service>
+		<service id="db" port="5432"><image>db:1</image></service>
+		<service id="mail"/>
+	</deploy>`, `<deploy>
+		<service id="web" port="80" replicas="3"><image>web:2</image></service>
+		<service id="db" port="5432"><image>db:1</image></service>
+		<service id="cache"/>
+		<service id="queue"/>
+	</deploy>`, MergeOptions{})
+
+	expect(t, "没有冲突", 0 == len(conflicts))
+	expect(t, "合并结果", `<deploy><service id="web" port="8080" replicas="3"><image>web:2</image></service>`+
+		`<service id="db" port="5432"><image>db:1</image></service><service id="queue"/><service id="mail"/></deploy>` == result)
+}
+
+func Test_Merge_标识属性和顺序(t *testing.T) {
+	const base = `<list><item name="a"/><item name="b"/><item name="c"/></list>`
+
+	result, conflicts := mergeStrings(t, base,
+		`<list><item name="a" v="1"/><item name="b"/><item name="c"/></list>`,
+		`<list><item name="c"/><item name="a"/><item name="b"/></list>`,
+		MergeOptions{Keys: map[string]string{"item": "name"}})
+	expect(t, "没有冲突", 0 == len(conflicts))
+	expect(t, "采用调整了顺序的一方", `<list><item name="c"/><item name="a" v="1"/><item name="b"/></list>` == result)
+
+	_, conflicts = mergeStrings(t, base,
+		`<list><item name="b"/><item name="a"/><item name="c"/></list>`,
+		`<list><item name="c"/><item name="a"/><item name="b"/></list>`,
+		MergeOptions{Keys: map[string]string{"item": "name"}})
+	expect(t, "顺序冲突", (1 == len(conflicts)) && (ConflictOrder == conflicts[0].Type) && ("/list" == conflicts[0].Path))
+
+	result, conflicts = mergeStrings(t, `<list><item>1</item><item>2</item></list>`,
+		`<list><item>one</item><item>2</item></list>`,
+		`<list><item>1</item><item>two</item></list>`, MergeOptions{})
+	expect(t, "没有标识属性时按照顺序对应", (0 == len(conflicts)) && (`<list><item>one</item><item>two</item></list>` == result))
+}
+
+func Test_Merge_冲突(t *testing.T) {
+	const base = `<deploy><service id="web" port="80"><image>web:1</image></service><service id="db"/></deploy>`
+	const ours = `<deploy><service id="web" port="81"><image>web:2</image></service><service id="mail" v="1"/></deploy>`
+	const theirs = `<deploy><service id="web" port="82"><image>web:3</image></service><service id="db" v="2"/><service id="mail" v="2"/></deploy>`
+
+	result, conflicts := mergeStrings(t, base, ours, theirs, MergeOptions{})
+	expect(t, "冲突的数量", 4 == len(conflicts))
+	expect(t, "属性冲突", (ConflictAttribute == conflicts[0].Type) && ("port" == conflicts[0].Attribute))
+	expect(t, "属性冲突的可读形式", "attribute conflict /deploy/service[1]/@port" == conflicts[0].String())
+	expect(t, "文本冲突", (ConflictContent == conflicts[1].Type) && ("/deploy/service[1]/image/text()" == conflicts[1].Path))
+	expect(t, "删除和修改冲突", (ConflictDeleteModify == conflicts[2].Type) && (nil == conflicts[2].Ours) && (nil != conflicts[2].Theirs))
+	expect(t, "插入冲突", ConflictInsert == conflicts[3].Type)
+	expect(t, "缺省采用ours", `<deploy><service id="web" port="81"><image>web:2</image></service><service id="mail" v="1"/></deploy>` == result)
+
+	result, _ = mergeStrings(t, base, ours, theirs, MergeOptions{PreferTheirs: true})
+	expect(t, "采用theirs", `<deploy><service id="web" port="82"><image>web:3</image></service><service id="db" v="2"/><service id="mail" v="2"/></deploy>` == result)
+}
+
+func Test_Merge_冲突标记(t *testing.T) {
+	result, conflicts := mergeStrings(t, `<a><b>1</b><!--x--></a>`, `<a><b>2</b><!--x--></a>`, `<a><b>3</b><!--y--></a>`,
+		MergeOptions{ConflictMarkers: true})
+	expect(t, "冲突的数量", 1 == len(conflicts))
+	expect(t, "冲突标记", "<a><b><!--<<<<<<< ours\n2\n=======\n3\n>>>>>>> theirs-->2</b><!--y--></a>" == result)
+
+	result, _ = mergeStrings(t, `<a x="1"/>`, `<a x="2"/>`, `<a/>`, MergeOptions{ConflictMarkers: true})
+	expect(t, "属性冲突标记", "<!--<<<<<<< ours\nx=\"2\"\n=======\n\n>>>>>>> theirs--><a x=\"2\"/>" == result)
+
+	result, _ = mergeStrings(t, `<a><b/></a>`, `<a><b><!--c--></b></a>`, `<a/>`, MergeOptions{ConflictMarkers: true})
+	expect(t, "标记中的--被拆开", "<a><!--<<<<<<< ours\n<b><!- -c- -></b>\n=======\n\n>>>>>>> theirs--><b><!--c--></b></a>" == result)
+}
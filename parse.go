@@ -0,0 +1,414 @@
+package tinydom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Handler 是SAX风格的XML事件处理器,由Parse驱动.
+//
+// Parse交给Handler的是经过tinydom清理过的事件:全空白的文本已被丢弃,同名属性、多个根节点、根节点之外的文本等错误已被检出.
+// 任何一个回调返回非nil的错误,解析都会立即终止并将该错误返回给Parse的调用者.
+type Handler interface {
+	StartDocument() error
+	EndDocument() error
+
+	StartElement(name string, attrs []XMLAttribute) error
+	EndElement(name string) error
+
+	Text(text string) error
+	Comment(comment string) error
+	ProcInst(target string, inst string) error
+	Directive(directive string) error
+}
+
+// ParseOptions 解析选项,用于控制Parse的行为
+type ParseOptions struct {
+	KeepSpace  bool // 是否保留元素内部全为空白的文本,缺省情况下这些文本会被丢弃
+	KeepPrefix bool // 是否保留元素名和属性名的名字空间前缀,缺省情况下前缀会被丢弃,例如"xsl:template"只保留"template"
+
+	// UniqueIDs 为true时检查ID的唯一性,ID重复时解析失败.xml:id属性总是作为ID,
+	// IDAttributes指定其他作为ID的属性名,按照交给Handler的属性名(受KeepPrefix影响)比较
+	UniqueIDs    bool
+	IDAttributes []string
+}
+
+// Parse 从rd流中读取XML码流,并将解析出的事件依次交给handler处理
+func Parse(rd io.Reader, handler Handler, options ParseOptions) error {
+	p := newParser(handler, options)
+	if err := handler.StartDocument(); nil != err {
+		return err
+	}
+
+	lines := &lineCounter{rd: rd, line: 1}
+	decoder := xml.NewDecoder(bufio.NewReader(lines))
+	p.line = func() int {
+		return lines.lineAt(decoder.InputOffset())
+	}
+	for {
+		token, err := decoder.RawToken()
+		if io.EOF == err {
+			break
+		}
+
+		if nil != err {
+			return err
+		}
+
+		if err := p.handleToken(token); nil != err {
+			return err
+		}
+	}
+
+	return p.finish()
+}
+
+// xmlParser 负责把encoding/xml的原始token整理成Handler的事件,并检查文档结构的正确性
+type xmlParser struct {
+	handler       Handler
+	options       ParseOptions
+	names         []string // 当前所有未关闭的元素的原始名字
+	rootElemExist bool
+	ids           map[string]bool // 已经出现过的ID,只在UniqueIDs为true时使用
+	line          func() int      // 返回decoder当前的行号,用于给出与encoding/xml一致的语法错误
+}
+
+func newParser(handler Handler, options ParseOptions) *xmlParser {
+	p := new(xmlParser)
+	p.handler = handler
+	p.options = options
+	p.names = make([]string, 0, 16)
+	p.rootElemExist = false
+	if options.UniqueIDs {
+		p.ids = make(map[string]bool)
+	}
+	return p
+}
+
+func (p *xmlParser) handleToken(token xml.Token) error {
+	switch token.(type) {
+	case xml.StartElement:
+		return p.handleStartElement(token.(xml.StartElement))
+	case xml.EndElement:
+		return p.handleEndElement(token.(xml.EndElement))
+	case xml.CharData:
+		return p.handleCharData(token.(xml.CharData))
+	case xml.Comment:
+		return p.handler.Comment(string(token.(xml.Comment)))
+	case xml.Directive:
+		return p.handler.Directive(string(token.(xml.Directive)))
+	case xml.ProcInst:
+		procInst := token.(xml.ProcInst)
+		return p.handler.ProcInst(procInst.Target, string(procInst.Inst))
+	}
+
+	return errors.New("Unsupported token type")
+}
+
+// name 返回交给Handler的名字,缺省只有本地名
+func (p *xmlParser) name(name xml.Name) string {
+	if p.options.KeepPrefix {
+		return rawName(name)
+	}
+
+	return name.Local
+}
+
+func (p *xmlParser) handleStartElement(startElement xml.StartElement) error {
+	name := p.name(startElement.Name)
+
+	// 一个XML文档只允许有唯一一个根节点
+	if 0 == len(p.names) {
+		if p.rootElemExist {
+			return errors.New("Root element has been exist:" + name)
+		}
+
+		// 标记一下根节点已经存在了
+		p.rootElemExist = true
+	}
+
+	// 属性多时用map检查重名,避免逐个比较
+	var names map[string]bool
+	if len(startElement.Attr) > attrIndexThreshold {
+		names = make(map[string]bool, len(startElement.Attr))
+	}
+
+	attrs := make([]XMLAttribute, 0, len(startElement.Attr))
+	for _, item := range startElement.Attr {
+		attrName := p.name(item.Name)
+		if nil != names {
+			if names[attrName] {
+				return errors.New("Attributes have the same name:" + attrName)
+			}
+			names[attrName] = true
+		} else {
+			for _, attr := range attrs {
+				if attr.Name() == attrName {
+					return errors.New("Attributes have the same name:" + attrName)
+				}
+			}
+		}
+		attrs = append(attrs, newAttribute(attrName, item.Value))
+
+		if p.options.UniqueIDs && ((("xml" == item.Name.Space) && ("id" == item.Name.Local)) || containsString(p.options.IDAttributes, attrName)) {
+			id := strings.TrimSpace(item.Value)
+			if p.ids[id] {
+				return errors.New("Duplicate ID:" + id)
+			}
+			p.ids[id] = true
+		}
+	}
+
+	p.names = append(p.names, rawName(startElement.Name))
+	return p.handler.StartElement(name, attrs)
+}
+
+func (p *xmlParser) handleEndElement(endElement xml.EndElement) error {
+	name := rawName(endElement.Name)
+	if 0 == len(p.names) {
+		return p.syntaxError("unexpected end element </" + name + ">")
+	}
+
+	if last := p.names[len(p.names)-1]; last != name {
+		return p.syntaxError("element <" + last + "> closed by </" + name + ">")
+	}
+
+	p.names = p.names[:len(p.names)-1]
+	return p.handler.EndElement(p.name(endElement.Name))
+}
+
+func (p *xmlParser) handleCharData(charData xml.CharData) error {
+	shortCharData := bytes.TrimSpace(charData)
+	if 0 == len(shortCharData) {
+		if (0 == len(p.names)) || !p.options.KeepSpace {
+			return nil
+		}
+	} else if 0 == len(p.names) {
+		return errors.New("Text should be in the element")
+	}
+
+	return p.handler.Text(string(charData))
+}
+
+func (p *xmlParser) finish() error {
+	if 0 != len(p.names) {
+		return p.syntaxError("unexpected EOF")
+	}
+
+	// 不能是空文档
+	if !p.rootElemExist {
+		return errors.New("XML document missing the root element")
+	}
+
+	return p.handler.EndDocument()
+}
+
+// syntaxError 返回与encoding/xml的Decoder.Token相同的语法错误,标签不匹配之类的错误原来都是由Token报告的
+func (p *xmlParser) syntaxError(message string) error {
+	line := 0
+	if nil != p.line {
+		line = p.line()
+	}
+
+	return &xml.SyntaxError{Msg: message, Line: line}
+}
+
+// lineCounter 记录bufio从rd读入的数据块,按照decoder已经消费的字节数(InputOffset)计算行号.
+// 每块数据只在读入下一块时统计一次换行,当前块中的行号只在报告错误时才计算
+type lineCounter struct {
+	rd          io.Reader
+	line        int    // chunk之前的行号
+	base        int64  // chunk在码流中的偏移
+	chunk       []byte // 最近一次读入的数据,bufio在读入下一块之前不会覆盖它
+	lastNewline bool   // chunk之前的最后一个字节是否是换行
+}
+
+func (c *lineCounter) Read(data []byte) (int, error) {
+	if 0 != len(c.chunk) {
+		c.line += bytes.Count(c.chunk, []byte("\n"))
+		c.base += int64(len(c.chunk))
+		c.lastNewline = '\n' == c.chunk[len(c.chunk)-1]
+	}
+
+	n, err := c.rd.Read(data)
+	c.chunk = data[:n]
+	return n, err
+}
+
+// lineAt 返回码流中offset处的行号.decoder最多退回一个字节,因此offset最多比当前块的起点小1
+func (c *lineCounter) lineAt(offset int64) int {
+	if offset < c.base {
+		if c.lastNewline {
+			return c.line - 1
+		}
+		return c.line
+	}
+
+	if end := offset - c.base; end < int64(len(c.chunk)) {
+		return c.line + bytes.Count(c.chunk[:end], []byte("\n"))
+	}
+	return c.line + bytes.Count(c.chunk, []byte("\n"))
+}
+
+// rawName 返回元素在XML码流中的原始名字(带名字空间前缀),用于检查开始标签和结束标签是否匹配
+func rawName(name xml.Name) string {
+	if "" == name.Space {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+// ------------------------------------------------------------------
+
+// xmlDocumentBuilder 是一个用于构造XMLDocument的Handler
+type xmlDocumentBuilder struct {
+	doc    XMLDocument
+	parent XMLNode
+}
+
+func newDocumentBuilder() *xmlDocumentBuilder {
+	return new(xmlDocumentBuilder)
+}
+
+func (b *xmlDocumentBuilder) StartDocument() error {
+	b.doc = NewDocument()
+	b.parent = b.doc
+	return nil
+}
+
+func (b *xmlDocumentBuilder) EndDocument() error {
+	return nil
+}
+
+func (b *xmlDocumentBuilder) StartElement(name string, attrs []XMLAttribute) error {
+	node := NewElement(name)
+	elem := node.(*xmlElementImpl)
+	elem.attrs = make([]*xmlAttributeImpl, 0, len(attrs))
+	for _, attr := range attrs {
+		// 构造器只接收Parse为每个元素新创建的属性,已经检查过重名,直接放到新元素上,不用再复制一次
+		if impl, ok := attr.(*xmlAttributeImpl); ok {
+			elem.attrs = append(elem.attrs, impl)
+			continue
+		}
+		node.SetAttribute(attr.Name(), attr.Value())
+	}
+	b.parent.InsertEndChild(node)
+	b.parent = node
+	return nil
+}
+
+func (b *xmlDocumentBuilder) EndElement(name string) error {
+	b.parent = b.parent.Parent()
+	return nil
+}
+
+func (b *xmlDocumentBuilder) Text(text string) error {
+	b.parent.InsertEndChild(NewText(text))
+	return nil
+}
+
+func (b *xmlDocumentBuilder) Comment(comment string) error {
+	b.parent.InsertEndChild(NewComment(comment))
+	return nil
+}
+
+func (b *xmlDocumentBuilder) ProcInst(target string, inst string) error {
+	b.parent.InsertEndChild(NewProcInst(target, inst))
+	return nil
+}
+
+func (b *xmlDocumentBuilder) Directive(directive string) error {
+	b.parent.InsertEndChild(NewDirective(directive))
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// DefaultHandler 这个类的目的是简化编写定制的Handler,使得我们不需要实现Handler的所有接口
+type DefaultHandler struct {
+	OnStartDocument func() error
+	OnEndDocument   func() error
+	OnStartElement  func(name string, attrs []XMLAttribute) error
+	OnEndElement    func(name string) error
+	OnText          func(text string) error
+	OnComment       func(comment string) error
+	OnProcInst      func(target string, inst string) error
+	OnDirective     func(directive string) error
+}
+
+// StartDocument is the default implement of Handler
+func (h *DefaultHandler) StartDocument() error {
+	if nil == h.OnStartDocument {
+		return nil
+	}
+
+	return h.OnStartDocument()
+}
+
+// EndDocument is the default implement of Handler
+func (h *DefaultHandler) EndDocument() error {
+	if nil == h.OnEndDocument {
+		return nil
+	}
+
+	return h.OnEndDocument()
+}
+
+// StartElement is the default implement of Handler
+func (h *DefaultHandler) StartElement(name string, attrs []XMLAttribute) error {
+	if nil == h.OnStartElement {
+		return nil
+	}
+
+	return h.OnStartElement(name, attrs)
+}
+
+// EndElement is the default implement of Handler
+func (h *DefaultHandler) EndElement(name string) error {
+	if nil == h.OnEndElement {
+		return nil
+	}
+
+	return h.OnEndElement(name)
+}
+
+// Text is the default implement of Handler
+func (h *DefaultHandler) Text(text string) error {
+	if nil == h.OnText {
+		return nil
+	}
+
+	return h.OnText(text)
+}
+
+// Comment is the default implement of Handler
+func (h *DefaultHandler) Comment(comment string) error {
+	if nil == h.OnComment {
+		return nil
+	}
+
+	return h.OnComment(comment)
+}
+
+// ProcInst is the default implement of Handler
+func (h *DefaultHandler) ProcInst(target string, inst string) error {
+	if nil == h.OnProcInst {
+		return nil
+	}
+
+	return h.OnProcInst(target, inst)
+}
+
+// Directive is the default implement of Handler
+func (h *DefaultHandler) Directive(directive string) error {
+	if nil == h.OnDirective {
+		return nil
+	}
+
+	return h.OnDirective(directive)
+}
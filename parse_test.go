@@ -0,0 +1,199 @@
+package tinydom
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// recordHandler 将收到的事件按顺序记录成字符串,便于比较
+type recordHandler struct {
+	events []string
+}
+
+func (h *recordHandler) StartDocument() error {
+	h.events = append(h.events, "startdoc")
+	return nil
+}
+
+func (h *recordHandler) EndDocument() error {
+	h.events = append(h.events, "enddoc")
+	return nil
+}
+
+func (h *recordHandler) StartElement(name string, attrs []XMLAttribute) error {
+	event := "start:" + name
+	for _, attr := range attrs {
+		event += " " + attr.Name() + "=" + attr.Value()
+	}
+	h.events = append(h.events, event)
+	return nil
+}
+
+func (h *recordHandler) EndElement(name string) error {
+	h.events = append(h.events, "end:"+name)
+	return nil
+}
+
+func (h *recordHandler) Text(text string) error {
+	h.events = append(h.events, "text:"+text)
+	return nil
+}
+
+func (h *recordHandler) Comment(comment string) error {
+	h.events = append(h.events, "comment:"+comment)
+	return nil
+}
+
+func (h *recordHandler) ProcInst(target string, inst string) error {
+	h.events = append(h.events, "pi:"+target+" "+inst)
+	return nil
+}
+
+func (h *recordHandler) Directive(directive string) error {
+	h.events = append(h.events, "directive:"+directive)
+	return nil
+}
+
+func Test_Parse_事件序列(t *testing.T) {
+	xml := `<?xml version="1.0"?>
+	<!DOCTYPE books>
+	<books a="1" b="2">
+		<!--c-->
+		<book>The Moon</book>
+		<book/>
+	</books>`
+
+	handler := new(recordHandler)
+	err := Parse(strings.NewReader(xml), handler, ParseOptions{})
+	expect(t, "返回值检测", nil == err)
+
+	exp := []string{
+		"startdoc",
+		`pi:xml version="1.0"`,
+		"directive:DOCTYPE books",
+		"start:books a=1 b=2",
+		"comment:c",
+		"start:book",
+		"text:The Moon",
+		"end:book",
+		"start:book",
+		"end:book",
+		"end:books",
+		"enddoc",
+	}
+	expect(t, "事件个数", len(exp) == len(handler.events))
+	for i := 0; (i < len(exp)) && (i < len(handler.events)); i++ {
+		expect(t, "事件内容:"+exp[i], exp[i] == handler.events[i])
+	}
+}
+
+func Test_Parse_保留空白(t *testing.T) {
+	xml := "<a>\n\t<b/>\n</a>\n"
+
+	handler := new(recordHandler)
+	err := Parse(strings.NewReader(xml), handler, ParseOptions{KeepSpace: true})
+	expect(t, "返回值检测", nil == err)
+	expect(t, "元素内部的空白被保留", "text:\n\t" == handler.events[2])
+	expect(t, "根节点之外的空白总是被丢弃", "enddoc" == handler.events[len(handler.events)-1])
+	expect(t, "根节点之外的空白总是被丢弃", "end:a" == handler.events[len(handler.events)-2])
+}
+
+func Test_Parse_保留前缀(t *testing.T) {
+	xml := `<x:a xmlns:x="urn:x" x:id="1" y:id="2"><b/></x:a>`
+
+	handler := new(recordHandler)
+	err := Parse(strings.NewReader(xml), handler, ParseOptions{KeepPrefix: true})
+	expect(t, "返回值检测", nil == err)
+	expect(t, "元素名和属性名带前缀", "start:x:a xmlns:x=urn:x x:id=1 y:id=2" == handler.events[1])
+	expect(t, "结束标签带前缀", "end:x:a" == handler.events[4])
+
+	err = Parse(strings.NewReader(xml), new(recordHandler), ParseOptions{})
+	expect(t, "去掉前缀之后属性同名", nil != err)
+}
+
+func Test_Parse_格式错误(t *testing.T) {
+	tester := func(xml string) error {
+		return Parse(strings.NewReader(xml), &DefaultHandler{}, ParseOptions{})
+	}
+
+	expect(t, "空文档", nil != tester(""))
+	expect(t, "节点未关闭", nil != tester("<node><elem></node>"))
+	expect(t, "文档未结束", nil != tester("<node><elem/>"))
+	expect(t, "关闭节点多余", nil != tester("<node><elem></elem></elem></node>"))
+	expect(t, "名字空间前缀不匹配", nil != tester("<a:node></b:node>"))
+	expect(t, "多余的节点", nil != tester("<node></node><hello/>"))
+	expect(t, "文本出现在根节点之外", nil != tester("<node></node>text"))
+	expect(t, "属性同名", nil != tester(`<node attr="1" attr="2"/>`))
+	expect(t, "正常的文档", nil == tester(`<a:node x="1"><b/></a:node>`))
+}
+
+func Test_Parse_回调错误终止解析(t *testing.T) {
+	stop := errors.New("stop")
+	count := 0
+	handler := &DefaultHandler{OnStartElement: func(name string, attrs []XMLAttribute) error {
+		count++
+		if "b" == name {
+			return stop
+		}
+		return nil
+	}}
+
+	err := Parse(strings.NewReader("<a><b/><c/></a>"), handler, ParseOptions{})
+	expect(t, "回调的错误原样返回", stop == err)
+	expect(t, "回调返回错误后立即终止", 2 == count)
+}
+
+func Test_Parse_标签不匹配的语法错误(t *testing.T) {
+	tester := func(text string) *xml.SyntaxError {
+		_, err := LoadDocument(strings.NewReader(text))
+		syntaxError, _ := err.(*xml.SyntaxError)
+		return syntaxError
+	}
+
+	err := tester("<a>\n\n</b>")
+	expect(t, "标签不匹配", (nil != err) && (3 == err.Line) && ("element <a> closed by </b>" == err.Msg))
+	expect(t, "与encoding/xml的错误信息一致", (nil != err) && ("XML syntax error on line 3: element <a> closed by </b>" == err.Error()))
+
+	err = tester("<a>\n</a>\n</a>")
+	expect(t, "多余的结束标签", (nil != err) && (3 == err.Line) && ("unexpected end element </a>" == err.Msg))
+
+	err = tester("<a>\n<b>\n")
+	expect(t, "元素没有关闭", (nil != err) && (3 == err.Line) && ("unexpected EOF" == err.Msg))
+
+	// 行号跨越bufio的数据块时与encoding/xml一致
+	text := "<a>\n" + strings.Repeat("<b>text</b>\n", 1000) + "</c>"
+	want := 0
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	for {
+		if _, e := decoder.Token(); nil != e {
+			if syntaxError, ok := e.(*xml.SyntaxError); ok {
+				want = syntaxError.Line
+			}
+			break
+		}
+	}
+
+	err = tester(text)
+	expect(t, "大文档的行号", (nil != err) && (1002 == want) && (want == err.Line))
+
+	_, e := LoadDocument(iotest.OneByteReader(strings.NewReader(text)))
+	err, _ = e.(*xml.SyntaxError)
+	expect(t, "每次只读入一个字节", (nil != err) && (want == err.Line))
+}
+
+func Test_Parse_属性很多时检查重名(t *testing.T) {
+	var attrs []string
+	for i := 0; i < 100; i++ {
+		attrs = append(attrs, fmt.Sprintf(`a%d="%d"`, i, i))
+	}
+
+	doc, err := LoadDocument(strings.NewReader("<a " + strings.Join(attrs, " ") + "/>"))
+	expect(t, "没有重名的属性", (nil == err) && ("99" == doc.RootElement().Attribute("a99", "")))
+
+	_, err = LoadDocument(strings.NewReader("<a " + strings.Join(attrs, " ") + ` x:a50="x"/>`))
+	expect(t, "丢弃前缀之后重名", (nil != err) && ("Attributes have the same name:a50" == err.Error()))
+}
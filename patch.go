@@ -0,0 +1,430 @@
+package tinydom
+
+import (
+	"errors"
+	"strings"
+)
+
+// ApplyPatch 把RFC 5261格式的XML补丁应用到文档doc上,patch是补丁文档或者它的根元素,根元素的名字不限,通常是diff.
+//
+// 补丁由依次执行的add、replace、remove操作组成,操作的sel属性是XPath表达式,必须正好选中一个节点:
+//
+//	<add sel="/config" pos="prepend"><server/></add>     pos可以是prepend、before、after,缺省添加到最后
+//	<add sel="/config/server" type="@port">80</add>      添加属性
+//	<replace sel="/config/server/@port">8080</replace>   替换属性值、文本,或者用同类型的节点替换元素、注释、处理指令
+//	<remove sel="/config/server" ws="after"/>            ws可以是before、after、both,同时删除相邻的空白文本
+//
+// 由于tinydom不保留名字空间,不支持type="namespace::prefix"的操作.操作失败时返回错误,之前的操作已经生效.
+func ApplyPatch(doc XMLDocument, patch XMLNode) error {
+	if nil != patch.ToDocument() {
+		patch = patch.ToDocument().RootElement()
+	}
+
+	if nil == patch {
+		return errors.New("Patch document has no root element")
+	}
+
+	for op := patch.FirstChildElement(""); nil != op; op = op.NextElement("") {
+		var err error
+		switch op.Name() {
+		case "add":
+			err = patchAdd(doc, op)
+		case "replace":
+			err = patchReplace(doc, op)
+		case "remove":
+			err = patchRemove(doc, op)
+		default:
+			err = errors.New("Unsupported patch operation:" + op.Name())
+		}
+
+		if nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patchSelect 对操作的sel求值,结果必须正好是一个节点
+func patchSelect(doc XMLDocument, op XMLElement) (XPathNode, error) {
+	attr := op.FindAttribute("sel")
+	if nil == attr {
+		return XPathNode{}, errors.New(op.Name() + " must have the attribute sel")
+	}
+
+	x, err := CompileXPath(attr.Value())
+	if nil != err {
+		return XPathNode{}, err
+	}
+
+	nodes, err := x.Select(doc, nil)
+	if nil != err {
+		return XPathNode{}, err
+	}
+
+	if 1 != len(nodes) {
+		return XPathNode{}, errors.New("Patch selector must select exactly one node:" + attr.Value())
+	}
+	return nodes[0], nil
+}
+
+// patchContent 返回操作的内容的拷贝
+func patchContent(op XMLElement) []XMLNode {
+	var nodes []XMLNode
+	for child := op.FirstChild(); nil != child; child = child.Next() {
+		nodes = append(nodes, cloneNode(child))
+	}
+	return nodes
+}
+
+func patchAdd(doc XMLDocument, op XMLElement) error {
+	target, err := patchSelect(doc, op)
+	if nil != err {
+		return err
+	}
+
+	if typ := op.Attribute("type", ""); "" != typ {
+		elem := target.Node.ToElement()
+		switch {
+		case !strings.HasPrefix(typ, "@"):
+			return errors.New("Unsupported add type:" + typ)
+		case (nil != target.Attribute) || (nil == elem):
+			return errors.New("Attribute must be added to an element:" + typ)
+		case nil != elem.FindAttribute(typ[1:]):
+			return errors.New("Attribute already exists:" + typ)
+		}
+
+		if err := checkXMLName("attribute", typ[1:]); nil != err {
+			return err
+		}
+		elem.SetAttribute(typ[1:], op.Text())
+		return nil
+	}
+
+	if nil != target.Attribute {
+		return errors.New("Nodes can not be added to an attribute:" + op.Attribute("sel", ""))
+	}
+
+	pos := op.Attribute("pos", "")
+	node := target.Node
+	if (("before" == pos) || ("after" == pos)) && ((nil == node.Parent()) || (nil != node.ToDocument())) {
+		return errors.New("Nodes can not be added as the sibling of the root:" + op.Attribute("sel", ""))
+	}
+
+	if ("" == pos) || ("prepend" == pos) {
+		if (nil == node.ToElement()) && (nil == node.ToDocument()) {
+			return errors.New("Nodes can only be added to an element or the document:" + op.Attribute("sel", ""))
+		}
+	}
+
+	content := patchContent(op)
+	if ("prepend" == pos) || ("after" == pos) {
+		// 逆序插入到同一个位置,插入之后保持原来的顺序
+		for i, j := 0, len(content)-1; i < j; i, j = i+1, j-1 {
+			content[i], content[j] = content[j], content[i]
+		}
+	}
+
+	for _, child := range content {
+		var added XMLNode
+		switch pos {
+		case "":
+			added = node.InsertEndChild(child)
+		case "prepend":
+			added = node.InsertFirstChild(child)
+		case "before":
+			added = node.InsertFront(child)
+		case "after":
+			added = node.InsertBack(child)
+		default:
+			return errors.New("Invalid add position:" + pos)
+		}
+
+		if nil == added {
+			return errors.New("Node can not be added by patch:" + op.Attribute("sel", ""))
+		}
+	}
+
+	return nil
+}
+
+func patchReplace(doc XMLDocument, op XMLElement) error {
+	target, err := patchSelect(doc, op)
+	if nil != err {
+		return err
+	}
+
+	if nil != target.Attribute {
+		target.Attribute.SetValue(op.Text())
+		return nil
+	}
+
+	node := target.Node
+	if nil != node.ToText() {
+		if nil != op.FirstChildElement("") {
+			return errors.New("Text must be replaced by text:" + op.Attribute("sel", ""))
+		}
+		node.SetValue(XPathNode{Node: op}.Value())
+		return nil
+	}
+
+	if (nil == node.Parent()) || (nil != node.ToDocument()) {
+		return errors.New("Document can not be replaced:" + op.Attribute("sel", ""))
+	}
+
+	var content []XMLNode
+	for _, child := range patchContent(op) {
+		if (nil == child.ToText()) || ("" != strings.TrimSpace(child.Value())) {
+			content = append(content, child)
+		}
+	}
+
+	if (1 != len(content)) || (nodeKind(content[0])[:1] != nodeKind(node)[:1]) {
+		return errors.New("Node must be replaced by exactly one node of the same type:" + op.Attribute("sel", ""))
+	}
+
+	if nil == replaceNode(node, content[0]) {
+		return errors.New("Node can not be replaced:" + op.Attribute("sel", ""))
+	}
+	return nil
+}
+
+func patchRemove(doc XMLDocument, op XMLElement) error {
+	target, err := patchSelect(doc, op)
+	if nil != err {
+		return err
+	}
+
+	if nil != target.Attribute {
+		target.Node.ToElement().DeleteAttribute(target.Attribute.Name())
+		return nil
+	}
+
+	node := target.Node
+	if (nil == node.Parent()) || (nil != node.ToDocument()) || (nil != node.Parent().ToDocument() && (nil != node.ToElement())) {
+		return errors.New("Root element can not be removed:" + op.Attribute("sel", ""))
+	}
+
+	space := func(n XMLNode) bool {
+		return (nil != n) && (nil != n.ToText()) && ("" == strings.TrimSpace(n.Value()))
+	}
+
+	parent := node.Parent()
+	ws := op.Attribute("ws", "")
+	switch ws {
+	case "", "before", "after", "both":
+	default:
+		return errors.New("Invalid remove ws:" + ws)
+	}
+
+	if (("before" == ws) || ("both" == ws)) && space(node.Prev()) {
+		parent.DeleteChild(node.Prev())
+	}
+	if (("after" == ws) || ("both" == ws)) && space(node.Next()) {
+		parent.DeleteChild(node.Next())
+	}
+
+	parent.DeleteChild(node)
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// DiffPatch 比较文档a和b,返回把a变成b的RFC 5261补丁文档,根元素是diff.
+//
+// 补丁中的操作依次执行,每个操作的sel都是执行到这个操作时目标节点的路径.RFC 5261没有移动和改名操作,
+// 移动被表示成remove和add,改名被表示成用新名字的元素replace.比较的选项与Diff相同,被忽略的差异不会出现在补丁中.
+// DOCTYPE等不属于XPath数据模型的节点的变化无法用补丁表示,这时返回错误.
+func DiffPatch(a XMLDocument, b XMLDocument, opts DiffOptions) (XMLDocument, error) {
+	d := newDiffer(opts)
+	d.pairs[a] = b
+	d.diffNode(a, b)
+	changes := d.moves()
+
+	g := &patchGenerator{
+		work:    cloneNode(a),
+		forward: make(map[XMLNode]XMLNode),
+		targets: make(map[XMLNode]XMLNode),
+		patch:   NewDocument(),
+	}
+	g.root = g.patch.InsertEndChild(NewElement("diff")).ToElement()
+	g.mapTree(a, g.work)
+
+	for x, y := range d.pairs {
+		g.targets[y] = g.forward[x]
+	}
+
+	// 第一遍执行删除和原地的修改,插入和移动的节点按照b中的顺序在第二遍放到最终的位置
+	placed := make(map[XMLNode]bool)
+	for _, change := range changes {
+		if err := g.change(change, placed); nil != err {
+			return nil, err
+		}
+	}
+
+	var err error
+	var walk func(node XMLNode)
+	walk = func(node XMLNode) {
+		for child := node.FirstChild(); (nil != child) && (nil == err); child = child.Next() {
+			if moved, ok := placed[child]; ok {
+				err = g.place(child, moved)
+			}
+			walk(child)
+		}
+	}
+	walk(b)
+
+	if nil != err {
+		return nil, err
+	}
+	return g.patch, nil
+}
+
+type patchGenerator struct {
+	work    XMLNode             // a的拷贝,生成操作的同时在这个拷贝上执行操作,这样sel总是执行操作时的路径
+	forward map[XMLNode]XMLNode // a中的节点与拷贝中的节点
+	targets map[XMLNode]XMLNode // b中的节点与拷贝中对应的节点
+	patch   XMLDocument
+	root    XMLElement
+}
+
+func (g *patchGenerator) mapTree(a XMLNode, work XMLNode) {
+	g.forward[a] = work
+	for x, y := a.FirstChild(), work.FirstChild(); (nil != x) && (nil != y); x, y = x.Next(), y.Next() {
+		g.mapTree(x, y)
+	}
+}
+
+// op 向补丁中增加一个操作
+func (g *patchGenerator) op(name string, sel string, content ...XMLNode) XMLElement {
+	op := g.root.InsertElementEndChild(name)
+	op.SetAttribute("sel", sel)
+	for _, node := range content {
+		op.InsertEndChild(node)
+	}
+	return op
+}
+
+// selector 返回拷贝中的节点的XPath
+func (g *patchGenerator) selector(node XMLNode) (string, error) {
+	if !isXPathNode(node) {
+		return "", errors.New("Change can not be expressed by XML patch:" + NodePath(node))
+	}
+	return NodePath(node), nil
+}
+
+func (g *patchGenerator) change(change Change, placed map[XMLNode]bool) error {
+	switch change.Type {
+	case ChangeInsert:
+		placed[change.NewNode] = false
+		return nil
+	case ChangeMove:
+		placed[change.NewNode] = true
+		g.targets[change.NewNode] = g.forward[change.Node]
+		return nil
+	}
+
+	node := g.forward[change.Node]
+	sel, err := g.selector(node)
+	if nil != err {
+		return err
+	}
+
+	switch change.Type {
+	case ChangeDelete:
+		g.op("remove", sel)
+		node.Parent().DeleteChild(node)
+	case ChangeRename:
+		elem := node.ToElement()
+		elem.SetName(change.NewValue)
+		g.op("replace", sel, cloneNode(elem))
+	case ChangeAttribute:
+		g.attribute(change, node.ToElement(), sel)
+	case ChangeText:
+		var content XMLNode
+		switch {
+		case nil != node.ToText():
+			node.SetValue(change.NewValue)
+			content = NewText(change.NewValue)
+		case nil != node.ToComment():
+			node.SetValue(change.NewValue)
+			content = NewComment(change.NewValue)
+		default:
+			node.ToProcInst().SetInstruction(change.NewValue)
+			content = NewProcInst(node.ToProcInst().Target(), change.NewValue)
+		}
+		g.op("replace", sel, content)
+	}
+
+	return nil
+}
+
+func (g *patchGenerator) attribute(change Change, elem XMLElement, sel string) {
+	newElem := change.NewNode.ToElement()
+
+	// RFC 5261不能调整属性的顺序,只能按照新的顺序删除之后再依次添加
+	if "" == change.Attribute {
+		for _, name := range strings.Fields(change.NewValue) {
+			value := newElem.Attribute(name, "")
+			g.op("remove", sel+"/@"+name)
+			g.op("add", sel, NewText(value)).SetAttribute("type", "@"+name)
+			elem.DeleteAttribute(name)
+			elem.SetAttribute(name, value)
+		}
+		return
+	}
+
+	name := change.Attribute
+	switch {
+	case nil == newElem.FindAttribute(name):
+		g.op("remove", sel+"/@"+name)
+		elem.DeleteAttribute(name)
+	case nil == elem.FindAttribute(name):
+		g.op("add", sel, NewText(change.NewValue)).SetAttribute("type", "@"+name)
+		elem.SetAttribute(name, change.NewValue)
+	default:
+		g.op("replace", sel+"/@"+name, NewText(change.NewValue))
+		elem.SetAttribute(name, change.NewValue)
+	}
+}
+
+// place 把b中插入或者移动过来的节点放到拷贝中与b相同的位置:紧跟在前面一个已经就位的兄弟节点之后,或者作为第一个子节点
+func (g *patchGenerator) place(node XMLNode, moved bool) error {
+	var content XMLNode
+	if moved {
+		// RFC 5261没有移动操作,先从原来的位置删除
+		content = g.targets[node]
+		sel, err := g.selector(content)
+		if nil != err {
+			return err
+		}
+		g.op("remove", sel)
+		content.Parent().DeleteChild(content)
+	} else {
+		content = cloneNode(node)
+		g.targets[node] = content
+	}
+
+	prev := node.Prev()
+	for (nil != prev) && (nil == g.targets[prev]) {
+		prev = prev.Prev()
+	}
+
+	anchor, pos := g.targets[node.Parent()], "prepend"
+	if nil != prev {
+		anchor, pos = g.targets[prev], "after"
+	}
+
+	sel, err := g.selector(anchor)
+	if nil != err {
+		return err
+	}
+
+	g.op("add", sel, cloneNode(content)).SetAttribute("pos", pos)
+	if "after" == pos {
+		anchor.InsertBack(content)
+	} else {
+		anchor.InsertFirstChild(content)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package tinydom
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func patchString(t *testing.T, xml string, patch string) (string, error) {
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "加载文档", nil == err)
+
+	patchDoc, err := LoadDocument(strings.NewReader(patch))
+	expect(t, "加载补丁", nil == err)
+
+	if err := ApplyPatch(doc, patchDoc); nil != err {
+		return "", err
+	}
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出结果", nil == SaveDocument(doc, buf, PrintStream))
+	return buf.String(), nil
+}
+
+func Test_Patch_增加(t *testing.T) {
+	const xml = `<config><server port="80"/><log/></config>`
+
+	result, err := patchString(t, xml, `<diff>
+		<add sel="/config"><cache/></add>
+		<add sel="/config" pos="prepend"><a/><b/></add>
+		<add sel="/config/server" pos="before"><!--web--></add>
+		<add sel="/config/server" pos="after"><c/><d/></add>
+		<add sel="/config/server" type="@host">localhost</add>
+	</diff>`)
+	expect(t, "增加节点和属性", nil == err)
+	expect(t, "增加节点和属性的结果", `<config><a/><b/><!--web--><server port="80" host="localhost"/><c/><d/><log/><cache/></config>` == result)
+
+	_, err = patchString(t, xml, `<diff><add sel="/config/server" type="@port">8080</add></diff>`)
+	expect(t, "属性已经存在", nil != err)
+
+	_, err = patchString(t, xml, `<diff><add sel="/config" pos="after"><a/></add></diff>`)
+	expect(t, "根元素之后不能增加元素", nil != err)
+
+	_, err = patchString(t, xml, `<diff><add sel="/config/server/@port"><a/></add></diff>`)
+	expect(t, "属性不能增加子节点", nil != err)
+
+	_, err = patchString(t, xml, `<diff><add sel="/config" type="namespace::a">urn:a</add></diff>`)
+	expect(t, "不支持名字空间", nil != err)
+}
+
+func Test_Patch_替换(t *testing.T) {
+	const xml = `<config><server port="80">web</server><!--c--><?pi a?></config>`
+
+	result, err := patchString(t, xml, `<diff>
+		<replace sel="/config/server/@port">8080</replace>
+		<replace sel="/config/server/text()">db</replace>
+		<replace sel="/config/comment()"><!--comment--></replace>
+		<replace sel="/config/processing-instruction('pi')"><?pi b?></replace>
+	</diff>`)
+	expect(t, "替换属性、文本、注释和处理指令", nil == err)
+	expect(t, "替换的结果", `<config><server port="8080">db</server><!--comment--><?pi b?></config>` == result)
+
+	result, err = patchString(t, xml, `<diff><replace sel="/config"><settings/></replace></diff>`)
+	expect(t, "替换根元素", nil == err)
+	expect(t, "替换根元素的结果", `<settings/>` == result)
+
+	_, err = patchString(t, xml, `<diff><replace sel="/config/server"><!--c--></replace></diff>`)
+	expect(t, "元素只能被元素替换", nil != err)
+
+	_, err = patchString(t, xml, `<diff><replace sel="/config/server"><a/><b/></replace></diff>`)
+	expect(t, "元素只能被一个元素替换", nil != err)
+}
+
+func Test_Patch_删除(t *testing.T) {
+	doc := NewDocument()
+	config := doc.InsertElementEndChild("config")
+	config.InsertEndChild(NewText("\n  "))
+	config.InsertElementEndChild("server").SetAttribute("port", "80")
+	config.InsertEndChild(NewText("\n  "))
+	config.InsertElementEndChild("log")
+	config.InsertEndChild(NewText("\n"))
+
+	patch, err := LoadDocument(strings.NewReader(`<diff>
+		<remove sel="/config/server/@port"/>
+		<remove sel="/config/server" ws="both"/>
+	</diff>`))
+	expect(t, "加载补丁", nil == err)
+	expect(t, "删除属性和元素", nil == ApplyPatch(doc, patch))
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出结果", nil == SaveDocument(doc, buf, PrintStream))
+	expect(t, "同时删除了前后的空白", "<config><log/>\n</config>" == buf.String())
+
+	_, err = patchString(t, `<config/>`, `<diff><remove sel="/config"/></diff>`)
+	expect(t, "不能删除根元素", nil != err)
+}
+
+func Test_Patch_选择器错误(t *testing.T) {
+	const xml = `<config><server/><server/></config>`
+
+	_, err := patchString(t, xml, `<diff><remove sel="/config/server"/></diff>`)
+	expect(t, "选中了多个节点", nil != err)
+
+	_, err = patchString(t, xml, `<diff><remove sel="/config/cache"/></diff>`)
+	expect(t, "没有选中节点", nil != err)
+
+	_, err = patchString(t, xml, `<diff><remove sel="/config/["/></diff>`)
+	expect(t, "XPath语法错误", nil != err)
+
+	_, err = patchString(t, xml, `<diff><remove/></diff>`)
+	expect(t, "没有sel属性", nil != err)
+
+	_, err = patchString(t, xml, `<diff><move sel="/config"/></diff>`)
+	expect(t, "不支持的操作", nil != err)
+}
+
+func Test_Patch_根据差异生成补丁(t *testing.T) {
+	cases := [][2]string{
+		{`<config><server port="80"/></config>`, `<config><server port="80"/></config>`},
+		{`<config>
+			<server id="s1" port="80"><name>web</name></server>
+			<server id="s2"><name>db</name></server>
+			<cache size="1"/>
+			<log level="info"/>
+			<!--old-->
+			<?pi a?>
+		</config>`, `<config>
+			<server id="s2"><name>database</name></server>
+			<server id="s1" port="8080" host="localhost"><name>web</name></server>
+			<store size="1"/>
+			<!--new-->
+			<?pi b?>
+			<mail/>
+		</config>`},
+		{`<a><b><x>1</x></b><c/></a>`, `<a><c><x>1</x></c><b/></a>`},
+		{`<a x="1" y="2"><b/>text<c/></a>`, `<r y="2" x="1"><c/>text<b/><d>new</d></r>`},
+		{`<a><b/><c/><d/><e/></a>`, `<a><e/><d/><c/><b/></a>`},
+	}
+
+	for _, c := range cases {
+		a, err := LoadDocument(strings.NewReader(c[0]))
+		expect(t, "加载文档a", nil == err)
+		b, err := LoadDocument(strings.NewReader(c[1]))
+		expect(t, "加载文档b", nil == err)
+
+		patch, err := DiffPatch(a, b, DiffOptions{})
+		expect(t, "生成补丁", nil == err)
+		expect(t, "补丁的根元素", "diff" == patch.RootElement().Name())
+
+		expect(t, "应用补丁", nil == ApplyPatch(a, patch))
+		expect(t, "应用补丁之后与b相同", 0 == len(Diff(a, b, DiffOptions{})))
+	}
+
+	a, _ := LoadDocument(strings.NewReader(`<a x="1"/>`))
+	b, _ := LoadDocument(strings.NewReader(`<a x="1" y="2"/>`))
+	patch, err := DiffPatch(a, b, DiffOptions{})
+	expect(t, "生成补丁", nil == err)
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出补丁", nil == SaveDocument(patch, buf, PrintStream))
+	expect(t, "补丁的内容", `<diff><add sel="/a" type="@y">2</add></diff>` == buf.String())
+}
+
+// randomAttributes 返回从names中随机选出、随机排列的属性
+func randomAttributes(r *rand.Rand, names []string) string {
+	var attrs []string
+	for _, i := range r.Perm(len(names)) {
+		if 0 == r.Intn(2) {
+			attrs = append(attrs, fmt.Sprintf(` %s="%d"`, names[i], r.Intn(2)))
+		}
+	}
+	return strings.Join(attrs, "")
+}
+
+func Test_Patch_随机的属性变化(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	names := []string{"id", "x", "y", "z"}
+	random := func() string {
+		xml := "<a" + randomAttributes(r, names) + ">"
+		for i := 0; i < 3; i++ {
+			xml += "<b" + randomAttributes(r, names) + "/>"
+		}
+		return xml + "</a>"
+	}
+
+	for i := 0; i < 500; i++ {
+		textA, textB := random(), random()
+		a, _ := LoadDocument(strings.NewReader(textA))
+		b, _ := LoadDocument(strings.NewReader(textB))
+
+		patch, err := DiffPatch(a, b, DiffOptions{})
+		if (nil != err) || (nil != ApplyPatch(a, patch)) {
+			expect(t, "生成和应用补丁:"+textA+" "+textB, false)
+			return
+		}
+
+		if equal, reason := EqualExplain(a, b, EqualOptions{}); !equal {
+			expect(t, "应用补丁之后与b相同:"+textA+" "+textB+" "+reason, false)
+			return
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package tinydom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// XMLPushParser 是一个增量的XML解析器,适合XML码流分多次到达的场景,例如网络服务.
+//
+// 调用者每收到一段数据就调用一次Write,解析器会立即处理其中已经完整的部分并逐步构造XMLDocument,
+// 不完整的部分会被缓存起来等待后续的数据,因此不需要为每个连接阻塞一个读取io.Reader的goroutine.
+// 数据全部写入之后调用Close完成解析,Close返回的错误与LoadDocument一致.
+//
+// 一旦出错,后续的所有调用都会返回同一个错误,Document也会返回nil.
+type XMLPushParser interface {
+	io.WriteCloser
+
+	// Document 返回当前已经构造出来的文档,文档在Close成功之前可能是不完整的
+	Document() XMLDocument
+}
+
+type xmlPushParserImpl struct {
+	buf     []byte          // 尚未构成完整token的数据
+	scanner tokenScanner    // buf开头的不完整token已经扫描到的位置,下次从这里继续扫描
+	line    int             // 已经解析过的数据的行数,用于修正错误信息中的行号
+	builder *xmlPushHandler // 构造文档的handler
+	parser  *xmlParser      // 负责检查文档结构
+	closed  bool            // 是否已经调用过Close
+	err     error           // 第一个错误
+}
+
+// NewPushParser 创建一个增量的XML解析器.
+//
+// onElement可以为nil,否则每当一个元素的结束标签到达时,解析器都会立即调用onElement,
+// 此时该元素及其子孙节点都已经构造完毕,并且已经被插入到了文档中.onElement返回非nil的错误会终止解析.
+func NewPushParser(onElement func(XMLElement) error) XMLPushParser {
+	p := new(xmlPushParserImpl)
+	p.builder = new(xmlPushHandler)
+	p.builder.xmlDocumentBuilder = newDocumentBuilder()
+	p.builder.onElement = onElement
+	p.parser = newParser(p.builder, ParseOptions{})
+	p.builder.StartDocument()
+	p.line = 1
+	p.parser.line = func() int {
+		return p.line
+	}
+	return p
+}
+
+func (p *xmlPushParserImpl) Write(data []byte) (int, error) {
+	if nil != p.err {
+		return 0, p.err
+	}
+
+	if p.closed {
+		return 0, errors.New("Push parser has been closed")
+	}
+
+	p.buf = append(p.buf, data...)
+	end := p.scanner.scanCompleteTokens(p.buf)
+	if end > 0 {
+		if err := p.feed(p.buf[:end]); nil != err {
+			return len(data), err
+		}
+		p.buf = append(p.buf[:0], p.buf[end:]...)
+	}
+
+	return len(data), nil
+}
+
+func (p *xmlPushParserImpl) Close() error {
+	if nil != p.err {
+		return p.err
+	}
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	// 剩下的数据交给decoder,不完整的部分由decoder报告错误
+	if len(p.buf) > 0 {
+		if err := p.feed(p.buf); nil != err {
+			return err
+		}
+		p.buf = nil
+	}
+
+	if err := p.parser.finish(); nil != err {
+		p.err = err
+		return err
+	}
+
+	return nil
+}
+
+func (p *xmlPushParserImpl) Document() XMLDocument {
+	if nil != p.err {
+		return nil
+	}
+
+	return p.builder.doc
+}
+
+// feed 解析一段由完整token构成的数据
+func (p *xmlPushParserImpl) feed(data []byte) error {
+	start := p.line
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	p.parser.line = func() int {
+		return start + bytes.Count(data[:decoder.InputOffset()], []byte("\n"))
+	}
+	for {
+		token, err := decoder.RawToken()
+		if io.EOF == err {
+			break
+		}
+
+		if nil != err {
+			if syntaxError, ok := err.(*xml.SyntaxError); ok {
+				syntaxError.Line += p.line - 1
+			}
+			p.err = err
+			return err
+		}
+
+		if err := p.parser.handleToken(token); nil != err {
+			p.err = err
+			return err
+		}
+	}
+
+	p.line += bytes.Count(data, []byte("\n"))
+	return nil
+}
+
+// xmlPushHandler 在构造文档的同时,每当一个元素结束就通知调用者
+type xmlPushHandler struct {
+	*xmlDocumentBuilder
+	onElement func(XMLElement) error
+}
+
+func (h *xmlPushHandler) EndElement(name string) error {
+	elem := h.parent.ToElement()
+	h.xmlDocumentBuilder.EndElement(name)
+	if nil == h.onElement {
+		return nil
+	}
+
+	return h.onElement(elem)
+}
+
+// tokenScanner 查找完整token的边界.一个很长的token(文本、注释、CDATA等)可能分很多次到达,
+// 扫描器记住不完整的token已经扫描过的长度和引号、嵌套的状态,数据到达之后从上次的位置继续,
+// 避免每次都从token的开头重新扫描.
+type tokenScanner struct {
+	pos     int  // 不完整的token已经扫描过的长度
+	inquote byte // 扫描到pos时所在的引号
+	depth   int  // 扫描到pos时指令中尖括号的嵌套层次
+}
+
+// scanCompleteTokens 返回data中由完整的token构成的最长前缀的长度.
+// data必须从上次调用时剩下的不完整token开始
+func (s *tokenScanner) scanCompleteTokens(data []byte) int {
+	pos := 0
+	for pos < len(data) {
+		n := s.scanToken(data[pos:])
+		if 0 == n {
+			break
+		}
+		pos += n
+		*s = tokenScanner{}
+	}
+
+	return pos
+}
+
+// scanToken 返回data开头的完整token的长度,如果token还不完整则返回0.
+// 文本只有在遇到下一个'<'时才算完整,因为在此之前无法确定文本是否已经结束.
+func (s *tokenScanner) scanToken(data []byte) int {
+	if '<' != data[0] {
+		if i := bytes.IndexByte(data[s.pos:], '<'); i >= 0 {
+			return s.pos + i
+		}
+		s.pos = len(data)
+		return 0
+	}
+
+	for _, item := range []struct {
+		start string
+		end   string
+	}{{"<!--", "-->"}, {"<![CDATA[", "]]>"}, {"<?", "?>"}} {
+		if len(data) < len(item.start) {
+			if bytes.HasPrefix([]byte(item.start), data) {
+				return 0
+			}
+			continue
+		}
+
+		if bytes.HasPrefix(data, []byte(item.start)) {
+			// 结束标记可能跨越了上次数据的结尾
+			from := len(item.start)
+			if s.pos-len(item.end)+1 > from {
+				from = s.pos - len(item.end) + 1
+			}
+
+			i := bytes.Index(data[from:], []byte(item.end))
+			if i < 0 {
+				s.pos = len(data)
+				return 0
+			}
+			return from + i + len(item.end)
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte("<!")) {
+		return s.scanDirective(data)
+	}
+
+	// 开始标签和结束标签,引号中的'>'不算
+	i := 1
+	if s.pos > i {
+		i = s.pos
+	}
+	for ; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b == s.inquote:
+			s.inquote = 0
+		case 0 != s.inquote:
+		case ('"' == b) || ('\'' == b):
+			s.inquote = b
+		case '>' == b:
+			return i + 1
+		}
+	}
+
+	s.pos = len(data)
+	return 0
+}
+
+// scanDirective 按照encoding/xml的规则查找"<!DOCTYPE ...>"这类指令的结尾:
+// 引号中的尖括号不计入嵌套层次,指令中可以嵌套注释
+func (s *tokenScanner) scanDirective(data []byte) int {
+	i := 2
+	if s.pos > i {
+		i = s.pos
+	}
+	for ; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b == s.inquote:
+			s.inquote = 0
+		case 0 != s.inquote:
+		case ('"' == b) || ('\'' == b):
+			s.inquote = b
+		case '>' == b:
+			if 0 == s.depth {
+				return i + 1
+			}
+			s.depth--
+		case '<' == b:
+			rest := data[i+1:]
+			if len(rest) < 3 {
+				if bytes.HasPrefix([]byte("!--"), rest) {
+					// 还不能确定是不是注释,下次从'<'开始重新扫描
+					s.pos = i
+					return 0
+				}
+				s.depth++
+				continue
+			}
+
+			if !bytes.HasPrefix(rest, []byte("!--")) {
+				s.depth++
+				continue
+			}
+
+			end := bytes.Index(rest[3:], []byte("-->"))
+			if end < 0 {
+				s.pos = i
+				return 0
+			}
+			i += 1 + 3 + end + 2
+		}
+	}
+
+	s.pos = len(data)
+	return 0
+}
@@ -0,0 +1,150 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_PushParser_按任意分片写入(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<!--comment1-->
+	<!DOCTYPE poem [
+		<!ELEMENT poem (#PCDATA)>
+		<!-- a > b -->
+		<!ATTLIST poem title CDATA "<>">
+	]>
+	<node attr1="a>b" attr2='c"d'><elem><!--comment2--></elem><str>Hello &amp; world</str>
+	<data><![CDATA[<raw> & ]]></data><?pi inst?><hello/></node>
+	`
+
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "返回值检测", nil == err)
+	exp := bytes.NewBufferString("")
+	doc.Accept(NewSimplePrinter(exp, PrintStream))
+
+	for _, size := range []int{1, 2, 3, 7, 64, len(xml)} {
+		p := NewPushParser(nil)
+		for i := 0; i < len(xml); i += size {
+			end := i + size
+			if end > len(xml) {
+				end = len(xml)
+			}
+			n, err := p.Write([]byte(xml[i:end]))
+			expect(t, "写入成功", (nil == err) && (end-i == n))
+		}
+		expect(t, "解析成功", nil == p.Close())
+
+		buf := bytes.NewBufferString("")
+		p.Document().Accept(NewSimplePrinter(buf, PrintStream))
+		expect(t, "与LoadDocument的结果一致", exp.String() == buf.String())
+	}
+}
+
+func Test_PushParser_从上次的位置继续扫描(t *testing.T) {
+	var s tokenScanner
+	expect(t, "注释不完整", 0 == s.scanCompleteTokens([]byte("<!-- abc -")))
+	expect(t, "记住扫描过的位置", 10 == s.pos)
+	expect(t, "结束标记跨越两次数据", 12 == s.scanCompleteTokens([]byte("<!-- abc -->")))
+	expect(t, "完整token之后重置状态", 0 == s.pos)
+
+	s = tokenScanner{}
+	expect(t, "标签不完整", 0 == s.scanCompleteTokens([]byte(`<a x="1>`)))
+	expect(t, "记住引号", ('"' == s.inquote) && (8 == s.pos))
+	expect(t, "引号中的'>'不算", 11 == s.scanCompleteTokens([]byte(`<a x="1>"/>`)))
+
+	text := "<![CDATA[" + strings.Repeat("x]]", 100000) + "]]>"
+	xml := "<a>" + strings.Repeat("text ", 100000) + text + "<!--" + strings.Repeat("- ", 100000) + "--></a>"
+	p := NewPushParser(nil)
+	for i := 0; i < len(xml); i += 4096 {
+		end := i + 4096
+		if end > len(xml) {
+			end = len(xml)
+		}
+		p.Write([]byte(xml[i:end]))
+	}
+	expect(t, "分很多次到达的长token", nil == p.Close())
+	count := 0
+	for node := p.Document().RootElement().FirstChild(); nil != node; node = node.Next() {
+		count++
+	}
+	expect(t, "长token的内容", 3 == count)
+}
+
+func Test_PushParser_元素结束时立即通知(t *testing.T) {
+	var names []string
+	p := NewPushParser(func(elem XMLElement) error {
+		names = append(names, elem.Name())
+		expect(t, "元素已经插入文档", nil != elem.Parent())
+		return nil
+	})
+
+	p.Write([]byte("<books><book><name>The"))
+	expect(t, "尚未有元素结束", 0 == len(names))
+	expect(t, "文档已经部分构造", nil != p.Document().FirstChildElement("books"))
+
+	p.Write([]byte(" Moon</name></bo"))
+	expect(t, "name元素已经结束", 1 == len(names) && "name" == names[0])
+	expect(t, "已经完整的元素可以访问", "The Moon" == p.Document().FirstChildElement("books").FirstChildElement("book").FirstChildElement("name").Text())
+
+	p.Write([]byte("ok><book/></books>"))
+	expect(t, "解析成功", nil == p.Close())
+	expect(t, "按结束顺序通知", 4 == len(names) && "book" == names[1] && "book" == names[2] && "books" == names[3])
+}
+
+func Test_PushParser_回调错误终止解析(t *testing.T) {
+	stop := errors.New("stop")
+	p := NewPushParser(func(elem XMLElement) error {
+		return stop
+	})
+
+	_, err := p.Write([]byte("<a><b/><c/></a>"))
+	expect(t, "回调的错误原样返回", stop == err)
+	expect(t, "后续调用返回同一个错误", stop == p.Close())
+	expect(t, "出错之后没有文档", nil == p.Document())
+}
+
+func Test_PushParser_格式错误(t *testing.T) {
+	tester := func(chunks ...string) error {
+		p := NewPushParser(nil)
+		for _, chunk := range chunks {
+			if _, err := p.Write([]byte(chunk)); nil != err {
+				return err
+			}
+		}
+		return p.Close()
+	}
+
+	expect(t, "空文档", nil != tester(""))
+	expect(t, "节点未关闭", nil != tester("<node><elem>", "</node>"))
+	expect(t, "文档未结束", nil != tester("<node><elem/>"))
+	expect(t, "标签不完整", nil != tester("<node/", ""))
+	expect(t, "注释不完整", nil != tester("<node/><!-- abc"))
+	expect(t, "关闭节点多余", nil != tester("<node></node>", "</node>"))
+	expect(t, "多余的节点", nil != tester("<node></node>", "<hello/>"))
+	expect(t, "文本出现在根节点之外", nil != tester("<node></node>", "text"))
+	expect(t, "属性同名", nil != tester(`<node attr="1" `, `attr="2"/>`))
+	expect(t, "根节点之后的空白", nil == tester("<node/>", "\n\t \n"))
+}
+
+func Test_PushParser_语法错误的行号(t *testing.T) {
+	p := NewPushParser(nil)
+	p.Write([]byte("<a>\n<b>"))
+	p.Write([]byte("\n</c>"))
+	err := p.Close()
+
+	_, want := LoadDocument(strings.NewReader("<a>\n<b>\n</c>"))
+	expect(t, "与LoadDocument的错误一致", (nil != err) && (nil != want) && (want.Error() == err.Error()))
+	expect(t, "错误的行号", (nil != err) && ("XML syntax error on line 3: element <b> closed by </c>" == err.Error()))
+}
+
+func Test_PushParser_Close之后不能写入(t *testing.T) {
+	p := NewPushParser(nil)
+	p.Write([]byte("<a/>"))
+	expect(t, "解析成功", nil == p.Close())
+	expect(t, "重复Close", nil == p.Close())
+	_, err := p.Write([]byte("<b/>"))
+	expect(t, "Close之后不能写入", nil != err)
+	expect(t, "文档仍然可用", nil != p.Document().FirstChildElement("a"))
+}
@@ -0,0 +1,1085 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+const xsdDatatypeLibrary = "http://www.w3.org/2001/XMLSchema-datatypes"
+
+// RelaxNG 是一个编译好的RELAX NG模式,可以由XML语法或者紧凑语法(.rnc)加载.
+//
+// 校验使用James Clark提出的求导算法:每读入一个节点就对模式求导,文档有效当且仅当最终的模式可以匹配空序列.
+// 由于tinydom的节点名不带名字空间前缀,模式中的名字只比较本地名,ns属性和nsName都被忽略.
+type RelaxNG struct {
+	start *rngPattern
+}
+
+const (
+	rngNotAllowed = iota
+	rngEmpty
+	rngText
+	rngChoice
+	rngInterleave
+	rngGroup
+	rngOneOrMore
+	rngList
+	rngData
+	rngValue
+	rngAttribute
+	rngElement
+	rngAfter
+	rngRef
+)
+
+// rngPattern 是简化之后的模式.element和attribute的p1是内容,data的p1是except,
+// rngRef只在编译期间使用,编译完成之后所有的引用都被替换成了被引用的模式.
+type rngPattern struct {
+	kind     int
+	p1       *rngPattern
+	p2       *rngPattern
+	names    *rngNameClass
+	datatype *xsdSimpleType
+	value    string
+}
+
+var (
+	rngNotAllowedPattern = &rngPattern{kind: rngNotAllowed}
+	rngEmptyPattern      = &rngPattern{kind: rngEmpty}
+	rngTextPattern       = &rngPattern{kind: rngText}
+)
+
+const (
+	rngAnyName = iota
+	rngName
+	rngNameChoice
+)
+
+// rngNameClass 是名字类,anyName的except保存在c1中
+type rngNameClass struct {
+	kind int
+	name string
+	c1   *rngNameClass
+	c2   *rngNameClass
+}
+
+func (nc *rngNameClass) contains(name string) bool {
+	switch nc.kind {
+	case rngAnyName:
+		return (nil == nc.c1) || !nc.c1.contains(name)
+	case rngName:
+		return nc.name == name
+	}
+
+	return nc.c1.contains(name) || nc.c2.contains(name)
+}
+
+func (nc *rngNameClass) String() string {
+	switch nc.kind {
+	case rngAnyName:
+		return "*"
+	case rngName:
+		return nc.name
+	}
+
+	return nc.c1.String() + "|" + nc.c2.String()
+}
+
+// LoadRelaxNG 加载XML语法的RELAX NG模式,include和externalRef通过resolver加载,resolver可以为nil
+func LoadRelaxNG(rd io.Reader, resolver Resolver) (*RelaxNG, error) {
+	doc, err := LoadDocument(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	c := newRNGCompiler(resolver, false)
+	return c.compileRoot(doc.RootElement())
+}
+
+// LoadRelaxNGCompact 加载紧凑语法的RELAX NG模式,include和external通过resolver加载,resolver可以为nil
+func LoadRelaxNGCompact(rd io.Reader, resolver Resolver) (*RelaxNG, error) {
+	root, err := parseRNC(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	c := newRNGCompiler(resolver, true)
+	return c.compileRoot(root)
+}
+
+// ------------------------------------------------------------------
+
+type rngCompiler struct {
+	resolver  Resolver
+	compact   bool
+	loading   map[string]bool
+	locations map[XMLNode]string // 被加载的模式文件的根节点到它的位置,用于解析其中的相对位置
+	refs      []*rngPattern
+}
+
+// rngScope 是一个grammar的作用域,start也作为一个名为空串的define保存
+type rngScope struct {
+	parent  *rngScope
+	defines map[string]*rngDefine
+}
+
+type rngDefine struct {
+	name    string
+	combine string
+	body    *rngPattern
+	ref     *rngPattern // 所有引用共享的占位模式
+	defined bool
+}
+
+func newRNGCompiler(resolver Resolver, compact bool) *rngCompiler {
+	return &rngCompiler{resolver: resolver, compact: compact, loading: make(map[string]bool), locations: make(map[XMLNode]string)}
+}
+
+func (c *rngCompiler) compileRoot(root XMLElement) (*RelaxNG, error) {
+	if nil == root {
+		return nil, errors.New("RELAX NG schema missing the root element")
+	}
+
+	start, err := c.pattern(root, nil)
+	if nil != err {
+		return nil, err
+	}
+
+	// 用被引用的模式替换所有的占位模式
+	for _, ref := range c.refs {
+		target := ref.p1
+		for depth := 0; rngRef == target.kind; depth++ {
+			if depth > len(c.refs) {
+				return nil, errors.New("Reference loop not through an element")
+			}
+			target = target.p1
+		}
+		*ref = *target
+	}
+
+	if err := checkRNGRecursion(start, make(map[*rngPattern]int), make(map[*rngPattern]bool)); nil != err {
+		return nil, err
+	}
+
+	return &RelaxNG{start: start}, nil
+}
+
+// checkRNGRecursion 检查不经过element的递归引用,这类模式会使求导算法陷入死循环.
+// 引用替换之后同一个element可能有多个副本,它们共享内容,所以每个element的内容只检查一次,并且使用新的state.
+func checkRNGRecursion(p *rngPattern, state map[*rngPattern]int, contents map[*rngPattern]bool) error {
+	switch state[p] {
+	case 1:
+		return errors.New("Recursive reference not through an element")
+	case 2:
+		return nil
+	}
+
+	state[p] = 1
+	var children []*rngPattern
+	switch p.kind {
+	case rngElement:
+		// element的内容是新的起点,可以引用外层的模式
+		state[p] = 2
+		if contents[p.p1] {
+			return nil
+		}
+		contents[p.p1] = true
+		return checkRNGRecursion(p.p1, make(map[*rngPattern]int), contents)
+	case rngChoice, rngInterleave, rngGroup:
+		children = []*rngPattern{p.p1, p.p2}
+	case rngOneOrMore, rngList, rngAttribute:
+		children = []*rngPattern{p.p1}
+	case rngData:
+		if nil != p.p1 {
+			children = []*rngPattern{p.p1}
+		}
+	}
+
+	for _, child := range children {
+		if err := checkRNGRecursion(child, state, contents); nil != err {
+			return err
+		}
+	}
+
+	state[p] = 2
+	return nil
+}
+
+// location 返回elem中引用的href相对于顶层模式的位置
+func (c *rngCompiler) location(elem XMLElement, href string) string {
+	return resolveLocation(c.locations[treeRoot(elem)], href)
+}
+
+// load 通过resolver加载位于location的模式文件,返回其根元素
+func (c *rngCompiler) load(location string) (XMLElement, error) {
+	if nil == c.resolver {
+		return nil, errors.New("Missing resolver for RELAX NG schema:" + location)
+	}
+
+	rd, err := c.resolver(location)
+	if nil != err {
+		return nil, err
+	}
+	defer rd.Close()
+
+	var root XMLElement
+	if c.compact {
+		if root, err = parseRNC(rd); nil != err {
+			return nil, err
+		}
+	} else {
+		doc, err := LoadDocument(rd)
+		if nil != err {
+			return nil, err
+		}
+		root = doc.RootElement()
+	}
+
+	if nil != root {
+		c.locations[treeRoot(root)] = location
+	}
+	return root, nil
+}
+
+func (scope *rngScope) define(name string) *rngDefine {
+	d := scope.defines[name]
+	if nil == d {
+		d = &rngDefine{name: name, ref: &rngPattern{kind: rngRef}}
+		scope.defines[name] = d
+	}
+
+	return d
+}
+
+func (c *rngCompiler) reference(scope *rngScope, name string) (*rngPattern, error) {
+	if nil == scope {
+		return nil, errors.New("Reference outside of grammar:" + name)
+	}
+
+	ref := &rngPattern{kind: rngRef, p1: scope.define(name).ref}
+	c.refs = append(c.refs, ref)
+	return ref, nil
+}
+
+func (c *rngCompiler) grammar(elem XMLElement, parent *rngScope) (*rngPattern, error) {
+	scope := &rngScope{parent: parent, defines: make(map[string]*rngDefine)}
+	if err := c.grammarContent(elem, scope, nil); nil != err {
+		return nil, err
+	}
+
+	scope.define("")
+	names := make([]string, 0, len(scope.defines))
+	for name := range scope.defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		d := scope.defines[name]
+		if !d.defined {
+			if "" == name {
+				return nil, errors.New("Grammar must have a start")
+			}
+			return nil, errors.New("Undefined reference:" + name)
+		}
+
+		d.ref.p1 = d.body
+	}
+
+	start := &rngPattern{kind: rngRef, p1: scope.defines[""].ref}
+	c.refs = append(c.refs, start)
+	return start, nil
+}
+
+// grammarContent 收集grammar中的start和define,include的内容合并到当前作用域,
+// overrides中的名字已经在include元素中重新定义,被包含的文件中同名的定义被忽略
+func (c *rngCompiler) grammarContent(elem XMLElement, scope *rngScope, overrides map[string]bool) error {
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		switch child.Name() {
+		case "start", "define":
+			name := child.Attribute("name", "")
+			if ("define" == child.Name()) && ("" == name) {
+				return errors.New("define must have a name")
+			}
+
+			if overrides[name] {
+				continue
+			}
+
+			body, err := c.group(child, scope)
+			if nil != err {
+				return err
+			}
+
+			if err := addRNGDefine(scope.define(name), child.Attribute("combine", ""), body); nil != err {
+				return err
+			}
+		case "div":
+			if err := c.grammarContent(child, scope, overrides); nil != err {
+				return err
+			}
+		case "include":
+			if err := c.include(child, scope, overrides); nil != err {
+				return err
+			}
+		case "documentation":
+		default:
+			return errors.New("Unexpected element in grammar:" + child.Name())
+		}
+	}
+
+	return nil
+}
+
+func (c *rngCompiler) include(elem XMLElement, scope *rngScope, overrides map[string]bool) error {
+	href := c.location(elem, elem.Attribute("href", ""))
+	if c.loading[href] {
+		return errors.New("Recursive include:" + href)
+	}
+
+	root, err := c.load(href)
+	if nil != err {
+		return err
+	}
+
+	if (nil == root) || ("grammar" != root.Name()) {
+		return errors.New("Included schema must be a grammar:" + href)
+	}
+
+	inner := make(map[string]bool)
+	for name := range overrides {
+		inner[name] = true
+	}
+	collectRNGOverrides(elem, inner)
+
+	c.loading[href] = true
+	defer delete(c.loading, href)
+	if err := c.grammarContent(root, scope, inner); nil != err {
+		return err
+	}
+
+	return c.grammarContent(elem, scope, overrides)
+}
+
+func collectRNGOverrides(elem XMLElement, overrides map[string]bool) {
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		switch child.Name() {
+		case "start", "define":
+			overrides[child.Attribute("name", "")] = true
+		case "div":
+			collectRNGOverrides(child, overrides)
+		}
+	}
+}
+
+// addRNGDefine 合并同名的定义,最多只能有一个定义不带combine属性
+func addRNGDefine(d *rngDefine, combine string, body *rngPattern) error {
+	if !d.defined {
+		d.body, d.combine, d.defined = body, combine, true
+		return nil
+	}
+
+	switch {
+	case ("" == combine) && ("" == d.combine):
+		return errors.New("Duplicate definition:" + d.name)
+	case ("" != combine) && ("" != d.combine) && (combine != d.combine):
+		return errors.New("Conflicting combine for definition:" + d.name)
+	case "" == combine:
+		combine = d.combine
+	}
+
+	kind := rngChoice
+	switch combine {
+	case "choice":
+	case "interleave":
+		kind = rngInterleave
+	default:
+		return errors.New("Invalid combine:" + combine)
+	}
+
+	d.body = &rngPattern{kind: kind, p1: d.body, p2: body}
+	d.combine = combine
+	return nil
+}
+
+// group 将元素的所有子模式组合成一个group
+func (c *rngCompiler) group(elem XMLElement, scope *rngScope) (*rngPattern, error) {
+	return c.combineChildren(elem, scope, rngGroup, elem.FirstChildElement(""))
+}
+
+func (c *rngCompiler) combineChildren(elem XMLElement, scope *rngScope, kind int, first XMLElement) (*rngPattern, error) {
+	var result *rngPattern
+	for child := first; nil != child; child = child.NextElement("") {
+		if "documentation" == child.Name() {
+			continue
+		}
+
+		p, err := c.pattern(child, scope)
+		if nil != err {
+			return nil, err
+		}
+
+		if nil == result {
+			result = p
+		} else {
+			result = &rngPattern{kind: kind, p1: result, p2: p}
+		}
+	}
+
+	if nil == result {
+		return nil, errors.New("Missing pattern in " + elem.Name())
+	}
+
+	return result, nil
+}
+
+func (c *rngCompiler) pattern(elem XMLElement, scope *rngScope) (*rngPattern, error) {
+	switch elem.Name() {
+	case "element", "attribute":
+		return c.namedPattern(elem, scope)
+	case "group":
+		return c.combineChildren(elem, scope, rngGroup, elem.FirstChildElement(""))
+	case "interleave":
+		return c.combineChildren(elem, scope, rngInterleave, elem.FirstChildElement(""))
+	case "choice":
+		return c.combineChildren(elem, scope, rngChoice, elem.FirstChildElement(""))
+	case "optional", "zeroOrMore", "oneOrMore", "list", "mixed":
+		p, err := c.group(elem, scope)
+		if nil != err {
+			return nil, err
+		}
+
+		switch elem.Name() {
+		case "optional":
+			return &rngPattern{kind: rngChoice, p1: p, p2: rngEmptyPattern}, nil
+		case "zeroOrMore":
+			return &rngPattern{kind: rngChoice, p1: &rngPattern{kind: rngOneOrMore, p1: p}, p2: rngEmptyPattern}, nil
+		case "oneOrMore":
+			return &rngPattern{kind: rngOneOrMore, p1: p}, nil
+		case "list":
+			return &rngPattern{kind: rngList, p1: p}, nil
+		}
+		return &rngPattern{kind: rngInterleave, p1: p, p2: rngTextPattern}, nil
+	case "ref":
+		return c.reference(scope, elem.Attribute("name", ""))
+	case "parentRef":
+		if nil == scope {
+			return nil, errors.New("parentRef outside of grammar")
+		}
+		return c.reference(scope.parent, elem.Attribute("name", ""))
+	case "empty":
+		return rngEmptyPattern, nil
+	case "text":
+		return rngTextPattern, nil
+	case "notAllowed":
+		return rngNotAllowedPattern, nil
+	case "data", "value":
+		return c.dataPattern(elem, scope)
+	case "grammar":
+		return c.grammar(elem, scope)
+	case "externalRef":
+		href := c.location(elem, elem.Attribute("href", ""))
+		if c.loading[href] {
+			return nil, errors.New("Recursive externalRef:" + href)
+		}
+
+		root, err := c.load(href)
+		if nil != err {
+			return nil, err
+		}
+
+		c.loading[href] = true
+		defer delete(c.loading, href)
+		return c.pattern(root, nil)
+	}
+
+	return nil, errors.New("Unsupported RELAX NG pattern:" + elem.Name())
+}
+
+func (c *rngCompiler) namedPattern(elem XMLElement, scope *rngScope) (*rngPattern, error) {
+	p := &rngPattern{kind: rngElement}
+	if "attribute" == elem.Name() {
+		p.kind = rngAttribute
+	}
+
+	first := elem.FirstChildElement("")
+	if name := elem.Attribute("name", ""); "" != name {
+		p.names = &rngNameClass{kind: rngName, name: localName(strings.TrimSpace(name))}
+	} else {
+		if nil == first {
+			return nil, errors.New(elem.Name() + " must have a name")
+		}
+
+		var err error
+		if p.names, err = rngNames(first); nil != err {
+			return nil, err
+		}
+		first = first.NextElement("")
+	}
+
+	if (nil == first) && (rngAttribute == p.kind) {
+		p.p1 = rngTextPattern
+		return p, nil
+	}
+
+	var err error
+	p.p1, err = c.combineChildren(elem, scope, rngGroup, first)
+	return p, err
+}
+
+func rngNames(elem XMLElement) (*rngNameClass, error) {
+	switch elem.Name() {
+	case "name":
+		return &rngNameClass{kind: rngName, name: localName(strings.TrimSpace(elem.Text()))}, nil
+	case "anyName", "nsName":
+		nc := &rngNameClass{kind: rngAnyName}
+		if except := elem.FirstChildElement("except"); nil != except {
+			var err error
+			if nc.c1, err = rngNameChoices(except); nil != err {
+				return nil, err
+			}
+		}
+		return nc, nil
+	case "choice":
+		return rngNameChoices(elem)
+	}
+
+	return nil, errors.New("Invalid name class:" + elem.Name())
+}
+
+func rngNameChoices(elem XMLElement) (*rngNameClass, error) {
+	var result *rngNameClass
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		nc, err := rngNames(child)
+		if nil != err {
+			return nil, err
+		}
+
+		if nil == result {
+			result = nc
+		} else {
+			result = &rngNameClass{kind: rngNameChoice, c1: result, c2: nc}
+		}
+	}
+
+	if nil == result {
+		return nil, errors.New("Missing name class in " + elem.Name())
+	}
+
+	return result, nil
+}
+
+// datatypeLibrary 返回元素继承的datatypeLibrary属性
+func datatypeLibrary(elem XMLElement) string {
+	for node := XMLNode(elem); nil != node; node = node.Parent() {
+		if e := node.ToElement(); nil != e {
+			if attr := e.FindAttribute("datatypeLibrary"); nil != attr {
+				return attr.Value()
+			}
+		}
+	}
+
+	return ""
+}
+
+// rngDatatype 查找数据类型,内置库只有string和token,XML Schema的数据类型库复用XML Schema的内置类型
+func rngDatatype(library string, name string) (*xsdSimpleType, error) {
+	switch library {
+	case "":
+		if ("string" == name) || ("token" == name) {
+			return xsdBuiltinTypes[name], nil
+		}
+	case xsdDatatypeLibrary:
+		if t := xsdBuiltinTypes[name]; nil != t {
+			return t, nil
+		}
+	default:
+		return nil, errors.New("Unsupported datatype library:" + library)
+	}
+
+	return nil, errors.New("Unknown datatype:" + name)
+}
+
+func (c *rngCompiler) dataPattern(elem XMLElement, scope *rngScope) (*rngPattern, error) {
+	typ := elem.Attribute("type", "")
+	if ("" == typ) && ("value" == elem.Name()) {
+		typ = "token"
+	}
+
+	library := datatypeLibrary(elem)
+	if ("value" == elem.Name()) && (nil == elem.FindAttribute("type")) {
+		library = ""
+	}
+
+	datatype, err := rngDatatype(library, typ)
+	if nil != err {
+		return nil, err
+	}
+
+	if "value" == elem.Name() {
+		value := elementText(elem)
+		if err := datatype.validate(value); nil != err {
+			return nil, err
+		}
+		return &rngPattern{kind: rngValue, datatype: datatype, value: value}, nil
+	}
+
+	p := &rngPattern{kind: rngData, datatype: datatype}
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		switch child.Name() {
+		case "param":
+			if p.datatype == datatype {
+				p.datatype = newXSDSimpleType(typ, datatype)
+			}
+
+			if err := p.datatype.applyFacet(child.Attribute("name", ""), child.Text()); nil != err {
+				return nil, err
+			}
+		case "except":
+			if p.p1, err = c.combineChildren(child, scope, rngChoice, child.FirstChildElement("")); nil != err {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("Unexpected element in data:" + child.Name())
+		}
+	}
+
+	return p, nil
+}
+
+// ------------------------------------------------------------------
+
+// Validate 使用RELAX NG模式校验文档,返回所有的校验错误,文档有效时返回空列表.
+// 出错之后校验器会跳过出错的元素、属性或者文本继续校验,因此可以一次报告多个错误.
+func (g *RelaxNG) Validate(doc XMLDocument) []ValidationError {
+	v := &rngValidator{interned: make(map[rngKey]*rngPattern)}
+
+	root := doc.RootElement()
+	if nil == root {
+		v.report(doc, "XML document missing the root element")
+		return v.errors
+	}
+
+	v.element(g.start, root)
+	return v.errors
+}
+
+type rngKey struct {
+	kind int
+	p1   *rngPattern
+	p2   *rngPattern
+}
+
+type rngValidator struct {
+	interned  map[rngKey]*rngPattern
+	dataError error
+	lax       bool // 为true时data、value和list接受任意的值,用于在数据类型错误之后继续校验
+	errors    []ValidationError
+}
+
+// laxDeriv 在数据类型出错之后,忽略数据类型重新求导,使出错的值仍然被当作已经匹配
+func (v *rngValidator) laxDeriv(deriv func() *rngPattern) *rngPattern {
+	v.lax = true
+	defer func() { v.lax = false }()
+	return deriv()
+}
+
+func (v *rngValidator) report(node XMLNode, message string) {
+	v.errors = append(v.errors, ValidationError{Node: node, Path: NodePath(node), Message: message})
+}
+
+// element 用模式p匹配元素elem,返回匹配之后的模式
+func (v *rngValidator) element(p *rngPattern, elem XMLElement) *rngPattern {
+	open := v.startTagOpenDeriv(p, elem.Name())
+	if rngNotAllowed == open.kind {
+		v.report(elem, "Element is not allowed here:"+elem.Name()+", expected "+describeExpected(rngExpected(p, false)))
+		return p
+	}
+
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		v.dataError = nil
+		next := v.attDeriv(open, attribute.Name(), attribute.Value())
+		if rngNotAllowed != next.kind {
+			open = next
+		} else if nil != v.dataError {
+			v.report(elem, "Invalid attribute "+attribute.Name()+", "+v.dataError.Error())
+			if next = v.laxDeriv(func() *rngPattern { return v.attDeriv(open, attribute.Name(), attribute.Value()) }); rngNotAllowed != next.kind {
+				open = next
+			}
+		} else {
+			v.report(elem, "Attribute is not allowed:"+attribute.Name())
+		}
+		return 0
+	})
+
+	content := v.startTagCloseDeriv(open, false)
+	if rngNotAllowed == content.kind {
+		v.report(elem, "Required attribute is missing:"+strings.Join(rngRequiredAttributes(open), "|"))
+		content = v.startTagCloseDeriv(open, true)
+	}
+
+	content, emptyError := v.children(content, elem)
+
+	end := v.endTagDeriv(content, false)
+	if rngNotAllowed == end.kind {
+		if nil != emptyError {
+			v.report(elem, "Invalid content of element "+elem.Name()+", "+emptyError.Error())
+		} else {
+			v.report(elem, "Content of element is incomplete:"+elem.Name()+", expected "+describeExpected(rngExpected(content, false)))
+		}
+		end = v.endTagDeriv(content, true)
+	}
+
+	return end
+}
+
+// children 依次匹配元素的子节点,相邻的文本节点合并成一个字符串,子元素之间的空白被忽略.
+// 元素只包含空白时,第二个返回值是按照空串匹配内容时数据类型报告的错误.
+func (v *rngValidator) children(p *rngPattern, elem XMLElement) (*rngPattern, error) {
+	var text bytes.Buffer
+	hasElement := false
+	matchText := func() {
+		value := text.String()
+		text.Reset()
+		if "" == strings.Trim(value, " \t\r\n") {
+			return
+		}
+
+		v.dataError = nil
+		next := v.textDeriv(p, value)
+		if rngNotAllowed != next.kind {
+			p = next
+		} else if nil != v.dataError {
+			v.report(elem, "Invalid content of element "+elem.Name()+", "+v.dataError.Error())
+			if next = v.laxDeriv(func() *rngPattern { return v.textDeriv(p, value) }); rngNotAllowed != next.kind {
+				p = next
+			}
+		} else {
+			v.report(elem, "Text is not allowed in element:"+elem.Name())
+		}
+	}
+
+	for child := elem.FirstChild(); nil != child; child = child.Next() {
+		if nil != child.ToText() {
+			text.WriteString(child.Value())
+			continue
+		}
+
+		if e := child.ToElement(); nil != e {
+			matchText()
+			hasElement = true
+			p = v.element(p, e)
+		}
+	}
+
+	// 只有空白的元素既可以匹配空的内容,也可以匹配值为空白的data和value
+	if value := text.String(); !hasElement && ("" == strings.Trim(value, " \t\r\n")) {
+		v.dataError = nil
+		return v.choice(p, v.textDeriv(p, value)), v.dataError
+	}
+
+	matchText()
+	return p, nil
+}
+
+// rngExpected 列出模式在当前位置期望的元素名或者属性名
+func rngExpected(p *rngPattern, attribute bool) []string {
+	var names []string
+	var walk func(p *rngPattern)
+	walk = func(p *rngPattern) {
+		switch p.kind {
+		case rngChoice, rngInterleave:
+			walk(p.p1)
+			walk(p.p2)
+		case rngGroup:
+			walk(p.p1)
+			if attribute || rngNullable(p.p1) {
+				walk(p.p2)
+			}
+		case rngOneOrMore, rngAfter:
+			walk(p.p1)
+		case rngElement:
+			if !attribute && !containsString(names, p.names.String()) {
+				names = append(names, p.names.String())
+			}
+		case rngAttribute:
+			if attribute && !containsString(names, p.names.String()) {
+				names = append(names, p.names.String())
+			}
+		case rngText, rngData, rngValue, rngList:
+			if !attribute && !containsString(names, "text") {
+				names = append(names, "text")
+			}
+		}
+	}
+
+	walk(p)
+	sort.Strings(names)
+	return names
+}
+
+// rngRequiredAttributes 列出模式中必须出现的属性,choice只有两个分支都需要属性时才算必选
+func rngRequiredAttributes(p *rngPattern) []string {
+	var names []string
+	switch p.kind {
+	case rngGroup, rngInterleave:
+		names = append(rngRequiredAttributes(p.p1), rngRequiredAttributes(p.p2)...)
+	case rngChoice:
+		names1, names2 := rngRequiredAttributes(p.p1), rngRequiredAttributes(p.p2)
+		if (0 != len(names1)) && (0 != len(names2)) {
+			names = append(names1, names2...)
+		}
+	case rngOneOrMore, rngAfter:
+		names = rngRequiredAttributes(p.p1)
+	case rngAttribute:
+		names = []string{p.names.String()}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ------------------------------------------------------------------
+
+func (v *rngValidator) intern(kind int, p1 *rngPattern, p2 *rngPattern) *rngPattern {
+	key := rngKey{kind: kind, p1: p1, p2: p2}
+	if p := v.interned[key]; nil != p {
+		return p
+	}
+
+	p := &rngPattern{kind: kind, p1: p1, p2: p2}
+	v.interned[key] = p
+	return p
+}
+
+func (v *rngValidator) choice(p1 *rngPattern, p2 *rngPattern) *rngPattern {
+	switch {
+	case rngNotAllowed == p1.kind:
+		return p2
+	case rngNotAllowed == p2.kind:
+		return p1
+	case p1 == p2:
+		return p1
+	case (rngChoice == p2.kind) && ((p2.p1 == p1) || (p2.p2 == p1)):
+		return p2
+	case (rngChoice == p1.kind) && ((p1.p1 == p2) || (p1.p2 == p2)):
+		return p1
+	}
+
+	return v.intern(rngChoice, p1, p2)
+}
+
+func (v *rngValidator) group(p1 *rngPattern, p2 *rngPattern) *rngPattern {
+	switch {
+	case (rngNotAllowed == p1.kind) || (rngNotAllowed == p2.kind):
+		return rngNotAllowedPattern
+	case rngEmpty == p1.kind:
+		return p2
+	case rngEmpty == p2.kind:
+		return p1
+	}
+
+	return v.intern(rngGroup, p1, p2)
+}
+
+func (v *rngValidator) interleave(p1 *rngPattern, p2 *rngPattern) *rngPattern {
+	switch {
+	case (rngNotAllowed == p1.kind) || (rngNotAllowed == p2.kind):
+		return rngNotAllowedPattern
+	case rngEmpty == p1.kind:
+		return p2
+	case rngEmpty == p2.kind:
+		return p1
+	}
+
+	return v.intern(rngInterleave, p1, p2)
+}
+
+func (v *rngValidator) after(p1 *rngPattern, p2 *rngPattern) *rngPattern {
+	if (rngNotAllowed == p1.kind) || (rngNotAllowed == p2.kind) {
+		return rngNotAllowedPattern
+	}
+
+	return v.intern(rngAfter, p1, p2)
+}
+
+func (v *rngValidator) oneOrMore(p *rngPattern) *rngPattern {
+	if rngNotAllowed == p.kind {
+		return rngNotAllowedPattern
+	}
+
+	return v.intern(rngOneOrMore, p, nil)
+}
+
+func rngNullable(p *rngPattern) bool {
+	switch p.kind {
+	case rngGroup, rngInterleave:
+		return rngNullable(p.p1) && rngNullable(p.p2)
+	case rngChoice:
+		return rngNullable(p.p1) || rngNullable(p.p2)
+	case rngOneOrMore:
+		return rngNullable(p.p1)
+	case rngEmpty, rngText:
+		return true
+	}
+
+	return false
+}
+
+func (v *rngValidator) textDeriv(p *rngPattern, s string) *rngPattern {
+	if v.lax && ((rngValue == p.kind) || (rngData == p.kind) || (rngList == p.kind)) {
+		return rngEmptyPattern
+	}
+
+	switch p.kind {
+	case rngChoice:
+		return v.choice(v.textDeriv(p.p1, s), v.textDeriv(p.p2, s))
+	case rngInterleave:
+		return v.choice(v.interleave(v.textDeriv(p.p1, s), p.p2), v.interleave(p.p1, v.textDeriv(p.p2, s)))
+	case rngGroup:
+		result := v.group(v.textDeriv(p.p1, s), p.p2)
+		if rngNullable(p.p1) {
+			return v.choice(result, v.textDeriv(p.p2, s))
+		}
+		return result
+	case rngAfter:
+		return v.after(v.textDeriv(p.p1, s), p.p2)
+	case rngOneOrMore:
+		return v.group(v.textDeriv(p.p1, s), v.choice(v.oneOrMore(p.p1), rngEmptyPattern))
+	case rngText:
+		return p
+	case rngValue:
+		if (nil == p.datatype.validate(s)) && p.datatype.equal(s, p.value) {
+			return rngEmptyPattern
+		}
+		v.dataError = errors.New("Value must be \"" + p.value + "\":" + s)
+	case rngData:
+		if err := p.datatype.validate(s); nil != err {
+			v.dataError = err
+			return rngNotAllowedPattern
+		}
+
+		if (nil != p.p1) && rngNullable(v.textDeriv(p.p1, s)) {
+			v.dataError = errors.New("Value is excluded:" + s)
+			return rngNotAllowedPattern
+		}
+		return rngEmptyPattern
+	case rngList:
+		result := p.p1
+		for _, word := range strings.Fields(s) {
+			result = v.textDeriv(result, word)
+		}
+
+		if rngNullable(result) {
+			return rngEmptyPattern
+		}
+	}
+
+	return rngNotAllowedPattern
+}
+
+func (v *rngValidator) applyAfter(f func(*rngPattern) *rngPattern, p *rngPattern) *rngPattern {
+	switch p.kind {
+	case rngAfter:
+		return v.after(p.p1, f(p.p2))
+	case rngChoice:
+		return v.choice(v.applyAfter(f, p.p1), v.applyAfter(f, p.p2))
+	}
+
+	return rngNotAllowedPattern
+}
+
+func (v *rngValidator) startTagOpenDeriv(p *rngPattern, name string) *rngPattern {
+	switch p.kind {
+	case rngChoice:
+		return v.choice(v.startTagOpenDeriv(p.p1, name), v.startTagOpenDeriv(p.p2, name))
+	case rngElement:
+		if p.names.contains(name) {
+			return v.after(p.p1, rngEmptyPattern)
+		}
+	case rngInterleave:
+		return v.choice(
+			v.applyAfter(func(x *rngPattern) *rngPattern { return v.interleave(x, p.p2) }, v.startTagOpenDeriv(p.p1, name)),
+			v.applyAfter(func(x *rngPattern) *rngPattern { return v.interleave(p.p1, x) }, v.startTagOpenDeriv(p.p2, name)))
+	case rngOneOrMore:
+		return v.applyAfter(func(x *rngPattern) *rngPattern {
+			return v.group(x, v.choice(v.oneOrMore(p.p1), rngEmptyPattern))
+		}, v.startTagOpenDeriv(p.p1, name))
+	case rngGroup:
+		result := v.applyAfter(func(x *rngPattern) *rngPattern { return v.group(x, p.p2) }, v.startTagOpenDeriv(p.p1, name))
+		if rngNullable(p.p1) {
+			return v.choice(result, v.startTagOpenDeriv(p.p2, name))
+		}
+		return result
+	case rngAfter:
+		return v.applyAfter(func(x *rngPattern) *rngPattern { return v.after(x, p.p2) }, v.startTagOpenDeriv(p.p1, name))
+	}
+
+	return rngNotAllowedPattern
+}
+
+func (v *rngValidator) attDeriv(p *rngPattern, name string, value string) *rngPattern {
+	switch p.kind {
+	case rngAfter:
+		return v.after(v.attDeriv(p.p1, name, value), p.p2)
+	case rngChoice:
+		return v.choice(v.attDeriv(p.p1, name, value), v.attDeriv(p.p2, name, value))
+	case rngGroup:
+		return v.choice(v.group(v.attDeriv(p.p1, name, value), p.p2), v.group(p.p1, v.attDeriv(p.p2, name, value)))
+	case rngInterleave:
+		return v.choice(v.interleave(v.attDeriv(p.p1, name, value), p.p2), v.interleave(p.p1, v.attDeriv(p.p2, name, value)))
+	case rngOneOrMore:
+		return v.group(v.attDeriv(p.p1, name, value), v.choice(v.oneOrMore(p.p1), rngEmptyPattern))
+	case rngAttribute:
+		if !p.names.contains(name) {
+			break
+		}
+
+		if (rngNullable(p.p1) && ("" == strings.Trim(value, " \t\r\n"))) || rngNullable(v.textDeriv(p.p1, value)) {
+			return rngEmptyPattern
+		}
+	}
+
+	return rngNotAllowedPattern
+}
+
+// startTagCloseDeriv 在所有属性都匹配完之后,剩下的属性模式都是缺失的必选属性.
+// recover为true时把缺失的属性当作已经匹配,以便继续校验元素的内容.
+func (v *rngValidator) startTagCloseDeriv(p *rngPattern, recover bool) *rngPattern {
+	switch p.kind {
+	case rngAfter:
+		return v.after(v.startTagCloseDeriv(p.p1, recover), p.p2)
+	case rngChoice:
+		return v.choice(v.startTagCloseDeriv(p.p1, recover), v.startTagCloseDeriv(p.p2, recover))
+	case rngGroup:
+		return v.group(v.startTagCloseDeriv(p.p1, recover), v.startTagCloseDeriv(p.p2, recover))
+	case rngInterleave:
+		return v.interleave(v.startTagCloseDeriv(p.p1, recover), v.startTagCloseDeriv(p.p2, recover))
+	case rngOneOrMore:
+		return v.oneOrMore(v.startTagCloseDeriv(p.p1, recover))
+	case rngAttribute:
+		if recover {
+			return rngEmptyPattern
+		}
+		return rngNotAllowedPattern
+	}
+
+	return p
+}
+
+// endTagDeriv 在元素结束时检查内容是否完整,recover为true时忽略缺失的内容
+func (v *rngValidator) endTagDeriv(p *rngPattern, recover bool) *rngPattern {
+	switch p.kind {
+	case rngChoice:
+		return v.choice(v.endTagDeriv(p.p1, recover), v.endTagDeriv(p.p2, recover))
+	case rngAfter:
+		if recover || rngNullable(p.p1) {
+			return p.p2
+		}
+	}
+
+	return rngNotAllowedPattern
+}
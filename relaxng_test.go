@@ -0,0 +1,175 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const rngTestSchema = `<?xml version="1.0"?>
+<grammar xmlns="http://relaxng.org/ns/structure/1.0" datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+	<include href="common.rng">
+		<define name="lang">
+			<choice><value>en</value><value>zh</value></choice>
+		</define>
+	</include>
+
+	<start>
+		<element name="library">
+			<optional><attribute name="version"><value type="decimal">1.0</value></attribute></optional>
+			<oneOrMore><ref name="book"/></oneOrMore>
+			<zeroOrMore><externalRef href="note.rng"/></zeroOrMore>
+		</element>
+	</start>
+
+	<define name="book">
+		<element name="book">
+			<attribute name="id"><data type="ID"/></attribute>
+			<optional><attribute name="lang"><ref name="lang"/></attribute></optional>
+			<interleave>
+				<element name="title"><text/></element>
+				<oneOrMore><element name="author"><data type="token"><param name="maxLength">10</param></data></element></oneOrMore>
+				<optional><element name="tags"><list><oneOrMore><data type="NCName"/></oneOrMore></list></element></optional>
+			</interleave>
+			<optional>
+				<element name="price"><data type="decimal"><param name="minInclusive">0</param></data></element>
+			</optional>
+		</element>
+	</define>
+</grammar>`
+
+const rngTestCommon = `<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+	<define name="lang"><value>fr</value></define>
+</grammar>`
+
+const rngTestNote = `<element name="note" xmlns="http://relaxng.org/ns/structure/1.0">
+	<mixed><zeroOrMore><element><anyName/><text/></element></zeroOrMore></mixed>
+</element>`
+
+func rngTestResolver(location string) (io.ReadCloser, error) {
+	switch location {
+	case "common.rng":
+		return ioutil.NopCloser(strings.NewReader(rngTestCommon)), nil
+	case "note.rng":
+		return ioutil.NopCloser(strings.NewReader(rngTestNote)), nil
+	}
+	return nil, errors.New("not found:" + location)
+}
+
+func validateRelaxNGString(t *testing.T, xml string) []ValidationError {
+	schema, err := LoadRelaxNG(strings.NewReader(rngTestSchema), rngTestResolver)
+	expect(t, "加载模式", nil == err)
+
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "返回值检测", nil == err)
+	return schema.Validate(doc)
+}
+
+func Test_RelaxNG_有效文档(t *testing.T) {
+	errs := validateRelaxNGString(t, `<library version="1.00">
+		<book id="b1" lang="zh">
+			<author>A</author>
+			<tags> go  xml </tags>
+			<title>Go</title>
+			<author>B</author>
+			<price>12.5</price>
+		</book>
+		<book id="b2"><title/><author>C</author></book>
+		<note>some <b>bold</b> text</note>
+	</library>`)
+	expect(t, "没有校验错误", 0 == len(errs))
+}
+
+func Test_RelaxNG_内容错误(t *testing.T) {
+	errs := validateRelaxNGString(t, `<library><note/></library>`)
+	expect(t, "缺少book", (2 == len(errs)) && ("/library/note" == errs[0].Path) && strings.HasSuffix(errs[0].Message, "expected book"))
+	expect(t, "跳过出错的元素之后内容仍然不完整", ("/library" == errs[1].Path) && strings.HasPrefix(errs[1].Message, "Content of element is incomplete"))
+
+	errs = validateRelaxNGString(t, `<library><book id="a"><title/></book></library>`)
+	expect(t, "缺少author", (1 == len(errs)) && ("/library/book" == errs[0].Path) && strings.Contains(errs[0].Message, "incomplete"))
+
+	errs = validateRelaxNGString(t, `<library><book id="a"><title/><author>A</author><price>1</price><tags/></book></library>`)
+	expect(t, "interleave之后的元素顺序", (1 == len(errs)) && ("/library/book/tags" == errs[0].Path))
+
+	errs = validateRelaxNGString(t, `<library><book id="a"><title/><title/><author>A</author></book><book id="b"><title/><author>B</author></book></library>`)
+	expect(t, "出错之后继续校验", (1 == len(errs)) && ("/library/book[1]/title[2]" == errs[0].Path))
+
+	errs = validateRelaxNGString(t, `<library><book id="a"><title/><author>A</author>text</book></library>`)
+	expect(t, "不允许文本", (1 == len(errs)) && ("/library/book" == errs[0].Path) && strings.HasPrefix(errs[0].Message, "Text is not allowed"))
+
+	errs = validateRelaxNGString(t, `<book id="a"><title/><author>A</author></book>`)
+	expect(t, "根元素不匹配", (1 == len(errs)) && ("/book" == errs[0].Path))
+}
+
+func Test_RelaxNG_属性和数据类型(t *testing.T) {
+	errs := validateRelaxNGString(t, `<library version="2.0" other="x"><book lang="fr"><title/><author>A</author></book></library>`)
+	expect(t, "错误个数", 4 == len(errs))
+	expect(t, "值不匹配", ("/library" == errs[0].Path) && strings.Contains(errs[0].Message, "version"))
+	expect(t, "未声明的属性", ("/library" == errs[1].Path) && strings.HasSuffix(errs[1].Message, ":other"))
+	expect(t, "include中覆盖的定义", ("/library/book" == errs[2].Path) && strings.Contains(errs[2].Message, "lang"))
+	expect(t, "必选属性", ("/library/book" == errs[3].Path) && strings.HasSuffix(errs[3].Message, ":id"))
+
+	errs = validateRelaxNGString(t, `<library><book id="1"><title/><author>a very long name</author><tags>a 1b</tags><price>-1</price></book></library>`)
+	expect(t, "数据类型错误个数", 4 == len(errs))
+	expect(t, "ID格式", strings.Contains(errs[0].Message, "Invalid attribute id"))
+	expect(t, "maxLength", ("/library/book/author" == errs[1].Path) && strings.Contains(errs[1].Message, "at most 10"))
+	expect(t, "list的每一项", "/library/book/tags" == errs[2].Path)
+	expect(t, "minInclusive", ("/library/book/price" == errs[3].Path) && strings.Contains(errs[3].Message, "at least 0"))
+}
+
+func Test_RelaxNG_递归和组合(t *testing.T) {
+	schema, err := LoadRelaxNG(strings.NewReader(`<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+		<start><ref name="node"/></start>
+		<define name="node">
+			<element name="node"><ref name="attrs"/><zeroOrMore><ref name="node"/></zeroOrMore></element>
+		</define>
+		<define name="attrs" combine="interleave"><optional><attribute name="a"/></optional></define>
+		<define name="attrs" combine="interleave"><optional><attribute name="b"/></optional></define>
+	</grammar>`), nil)
+	expect(t, "加载模式", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<node b="1" a="2"><node/><node><node c="3"/></node></node>`))
+	errs := schema.Validate(doc)
+	expect(t, "递归校验", (1 == len(errs)) && ("/node/node[2]/node" == errs[0].Path))
+}
+
+func Test_RelaxNG_加载错误(t *testing.T) {
+	_, err := LoadRelaxNG(strings.NewReader(rngTestSchema), nil)
+	expect(t, "没有resolver", nil != err)
+
+	tester := func(body string) error {
+		_, err := LoadRelaxNG(strings.NewReader(`<grammar xmlns="http://relaxng.org/ns/structure/1.0">`+body+`</grammar>`), nil)
+		return err
+	}
+
+	expect(t, "合法的模式", nil == tester(`<start><element name="a"><empty/></element></start>`))
+	expect(t, "没有start", nil != tester(`<define name="a"><element name="a"><empty/></element></define>`))
+	expect(t, "未定义的引用", nil != tester(`<start><ref name="b"/></start>`))
+	expect(t, "重复定义", nil != tester(`<start><ref name="a"/></start><define name="a"><empty/></define><define name="a"><text/></define>`))
+	expect(t, "不经过元素的递归", nil != tester(`<start><element name="a"><ref name="b"/></element></start><define name="b"><group><text/><ref name="b"/></group></define>`))
+	expect(t, "未知的数据类型", nil != tester(`<start><element name="a"><data type="foo"/></element></start>`))
+	expect(t, "不支持的模式", nil != tester(`<start><foo/></start>`))
+}
+
+func Test_RelaxNG_嵌套的相对位置(t *testing.T) {
+	files := map[string]string{
+		"lib/grammar.rng": `<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+			<include href="defs.rng"/>
+			<start><ref name="item"/></start>
+		</grammar>`,
+		"lib/defs.rng": `<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+			<define name="item"><element name="item"><externalRef href="sub/text.rng"/></element></define>
+		</grammar>`,
+		"lib/sub/text.rng": `<text xmlns="http://relaxng.org/ns/structure/1.0"/>`,
+	}
+
+	schema, err := LoadRelaxNG(strings.NewReader(`<element name="r" xmlns="http://relaxng.org/ns/structure/1.0">
+		<externalRef href="lib/grammar.rng"/>
+	</element>`), fileResolver(files))
+	expect(t, "相对于引用它的模式文件查找", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<r><item>x</item></r>`))
+	expect(t, "使用嵌套引用的模式", (nil != schema) && (0 == len(schema.Validate(doc))))
+}
@@ -0,0 +1,688 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseRNC 解析RELAX NG的紧凑语法,并将其转换成等价的XML语法,转换之后的元素树交给XML语法的编译器处理.
+// 注释和标注([...]以及>>)被忽略.
+func parseRNC(rd io.Reader) (XMLElement, error) {
+	data, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	tokens, err := scanRNC(string(data))
+	if nil != err {
+		return nil, err
+	}
+
+	p := &rncParser{tokens: tokens, datatypes: map[string]string{"xsd": xsdDatatypeLibrary}}
+	return p.topLevel()
+}
+
+const (
+	rncEOF = iota
+	rncIdent
+	rncLiteral
+	rncPunct
+)
+
+type rncToken struct {
+	kind    int
+	text    string
+	escaped bool // 以'\'开头的标识符,不作为关键字
+	line    int
+}
+
+// scanRNC 将紧凑语法切分成token,带前缀的名字"a:b"和"a:*"作为一个标识符
+func scanRNC(s string) ([]rncToken, error) {
+	var tokens []rncToken
+	line := 1
+	pos := 0
+	fail := func(message string) error {
+		return errors.New(message + " at line " + strconv.Itoa(line))
+	}
+
+	readName := func() string {
+		start := pos
+		for pos < len(s) {
+			r, size := utf8.DecodeRuneInString(s[pos:])
+			if ((start == pos) && !isNCNameStartChar(r)) || !isNCNameChar(r) {
+				break
+			}
+			pos += size
+		}
+		return s[start:pos]
+	}
+
+	for pos < len(s) {
+		c := s[pos]
+		switch {
+		case '\n' == c:
+			line++
+			pos++
+		case isSpaceByte(c):
+			pos++
+		case '#' == c:
+			for (pos < len(s)) && ('\n' != s[pos]) {
+				pos++
+			}
+		case '[' == c:
+			// 标注,跳过配对的方括号,方括号中的字面量可能包含方括号
+			depth := 0
+			for pos < len(s) {
+				switch s[pos] {
+				case '[':
+					depth++
+				case ']':
+					depth--
+				case '\n':
+					line++
+				case '"', '\'':
+					end := strings.IndexByte(s[pos+1:], s[pos])
+					if end < 0 {
+						return nil, fail("Unterminated literal")
+					}
+					pos += end + 1
+				}
+				pos++
+				if 0 == depth {
+					break
+				}
+			}
+
+			if 0 != depth {
+				return nil, fail("Unterminated annotation")
+			}
+		case strings.HasPrefix(s[pos:], ">>"):
+			// 跟随标注: >> name [ ... ],名字交给下一轮循环后丢弃
+			pos += 2
+			for (pos < len(s)) && isSpaceByte(s[pos]) {
+				pos++
+			}
+			readName()
+			if (pos < len(s)) && (':' == s[pos]) {
+				pos++
+				readName()
+			}
+		case ('"' == c) || ('\'' == c):
+			quote := s[pos : pos+1]
+			if strings.HasPrefix(s[pos:], quote+quote+quote) {
+				quote = quote + quote + quote
+			}
+
+			end := strings.Index(s[pos+len(quote):], quote)
+			if end < 0 {
+				return nil, fail("Unterminated literal")
+			}
+
+			text := s[pos+len(quote) : pos+len(quote)+end]
+			if (1 == len(quote)) && strings.ContainsAny(text, "\n") {
+				return nil, fail("Newline in literal")
+			}
+
+			tokens = append(tokens, rncToken{kind: rncLiteral, text: text, line: line})
+			line += strings.Count(text, "\n")
+			pos += len(quote) + end + len(quote)
+		case strings.HasPrefix(s[pos:], "|=") || strings.HasPrefix(s[pos:], "&="):
+			tokens = append(tokens, rncToken{kind: rncPunct, text: s[pos : pos+2], line: line})
+			pos += 2
+		case strings.IndexByte("{}()=,&|?*+-~", c) >= 0:
+			tokens = append(tokens, rncToken{kind: rncPunct, text: s[pos : pos+1], line: line})
+			pos++
+		default:
+			escaped := false
+			if '\\' == c {
+				escaped = true
+				pos++
+			}
+
+			name := readName()
+			if "" == name {
+				return nil, fail("Unexpected character '" + string(c) + "'")
+			}
+
+			if (pos < len(s)) && (':' == s[pos]) {
+				pos++
+				if (pos < len(s)) && ('*' == s[pos]) {
+					pos++
+					name += ":*"
+				} else if local := readName(); "" != local {
+					name += ":" + local
+				} else {
+					return nil, fail("Invalid name " + name)
+				}
+			}
+
+			tokens = append(tokens, rncToken{kind: rncIdent, text: name, escaped: escaped, line: line})
+		}
+	}
+
+	return append(tokens, rncToken{kind: rncEOF, line: line}), nil
+}
+
+// ------------------------------------------------------------------
+
+type rncParser struct {
+	tokens    []rncToken
+	pos       int
+	datatypes map[string]string
+}
+
+func (p *rncParser) peek() rncToken {
+	return p.tokens[p.pos]
+}
+
+func (p *rncParser) next() rncToken {
+	t := p.tokens[p.pos]
+	if rncEOF != t.kind {
+		p.pos++
+	}
+	return t
+}
+
+func (p *rncParser) fail(message string) error {
+	t := p.peek()
+	if rncEOF == t.kind {
+		return errors.New(message + " at end of schema")
+	}
+
+	return errors.New(message + " at line " + strconv.Itoa(t.line) + " near '" + t.text + "'")
+}
+
+// isPunct 判断下一个token是否是指定的标点
+func (p *rncParser) isPunct(text string) bool {
+	t := p.peek()
+	return (rncPunct == t.kind) && (text == t.text)
+}
+
+// isKeyword 判断下一个token是否是指定的关键字
+func (p *rncParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return (rncIdent == t.kind) && !t.escaped && (keyword == t.text)
+}
+
+func (p *rncParser) expect(text string) error {
+	if !p.isPunct(text) {
+		return p.fail("Expect '" + text + "'")
+	}
+
+	p.next()
+	return nil
+}
+
+// literal 读取字面量,多个字面量可以用'~'连接
+func (p *rncParser) literal() (string, error) {
+	if rncLiteral != p.peek().kind {
+		return "", p.fail("Expect a literal")
+	}
+
+	s := p.next().text
+	for p.isPunct("~") {
+		p.next()
+		if rncLiteral != p.peek().kind {
+			return "", p.fail("Expect a literal")
+		}
+		s += p.next().text
+	}
+
+	return s, nil
+}
+
+func rncElement(name string, children ...XMLElement) XMLElement {
+	elem := NewElement(name)
+	for _, child := range children {
+		elem.InsertEndChild(child)
+	}
+	return elem
+}
+
+func (p *rncParser) topLevel() (XMLElement, error) {
+	for {
+		switch {
+		case p.isKeyword("namespace"):
+			p.next()
+			p.next()
+			if err := p.expect("="); nil != err {
+				return nil, err
+			}
+			if _, err := p.literal(); nil != err {
+				return nil, err
+			}
+		case p.isKeyword("default"):
+			p.next()
+			if !p.isKeyword("namespace") {
+				return nil, p.fail("Expect 'namespace'")
+			}
+			p.next()
+			if rncIdent == p.peek().kind {
+				p.next()
+			}
+			if err := p.expect("="); nil != err {
+				return nil, err
+			}
+			if _, err := p.literal(); nil != err {
+				return nil, err
+			}
+		case p.isKeyword("datatypes"):
+			p.next()
+			prefix := p.next().text
+			if err := p.expect("="); nil != err {
+				return nil, err
+			}
+			uri, err := p.literal()
+			if nil != err {
+				return nil, err
+			}
+			p.datatypes[prefix] = uri
+		default:
+			return p.body()
+		}
+	}
+}
+
+// body 解析声明之后的部分,可以是一个模式,也可以是grammar的内容
+func (p *rncParser) body() (XMLElement, error) {
+	var root XMLElement
+	if p.isGrammarContent() {
+		root = NewElement("grammar")
+		if err := p.grammarContent(root); nil != err {
+			return nil, err
+		}
+	} else {
+		var err error
+		if root, err = p.pattern(); nil != err {
+			return nil, err
+		}
+	}
+
+	if rncEOF != p.peek().kind {
+		return nil, p.fail("Unexpected content")
+	}
+
+	return root, nil
+}
+
+func (p *rncParser) isGrammarContent() bool {
+	t := p.peek()
+	if rncIdent != t.kind {
+		return false
+	}
+
+	if !t.escaped && (("start" == t.text) || ("div" == t.text) || ("include" == t.text)) {
+		return true
+	}
+
+	next := p.tokens[p.pos+1]
+	return (rncPunct == next.kind) && (("=" == next.text) || ("|=" == next.text) || ("&=" == next.text))
+}
+
+// grammarContent 解析start、define、div和include,直到'}'或者文件结束
+func (p *rncParser) grammarContent(parent XMLElement) error {
+	for !p.isPunct("}") && (rncEOF != p.peek().kind) {
+		t := p.next()
+		if rncIdent != t.kind {
+			return p.fail("Expect a definition")
+		}
+
+		switch {
+		case !t.escaped && (("div" == t.text) || ("include" == t.text)):
+			elem := NewElement(t.text)
+			if "include" == t.text {
+				href, err := p.literal()
+				if nil != err {
+					return err
+				}
+				elem.SetAttribute("href", href)
+
+				if p.isKeyword("inherit") {
+					p.next()
+					p.next()
+					p.next()
+				}
+
+				if !p.isPunct("{") {
+					parent.InsertEndChild(elem)
+					continue
+				}
+			}
+
+			if err := p.expect("{"); nil != err {
+				return err
+			}
+			if err := p.grammarContent(elem); nil != err {
+				return err
+			}
+			if err := p.expect("}"); nil != err {
+				return err
+			}
+			parent.InsertEndChild(elem)
+		default:
+			elem := NewElement("define")
+			if !t.escaped && ("start" == t.text) {
+				elem = NewElement("start")
+			} else {
+				elem.SetAttribute("name", t.text)
+			}
+
+			op := p.next()
+			switch {
+			case (rncPunct != op.kind):
+				return p.fail("Expect '='")
+			case "|=" == op.text:
+				elem.SetAttribute("combine", "choice")
+			case "&=" == op.text:
+				elem.SetAttribute("combine", "interleave")
+			case "=" != op.text:
+				return p.fail("Expect '='")
+			}
+
+			pattern, err := p.pattern()
+			if nil != err {
+				return err
+			}
+			elem.InsertEndChild(pattern)
+			parent.InsertEndChild(elem)
+		}
+	}
+
+	return nil
+}
+
+// pattern 解析由',','&','|'连接的模式,同一层中不能混用不同的连接符
+func (p *rncParser) pattern() (XMLElement, error) {
+	first, err := p.particle()
+	if nil != err {
+		return nil, err
+	}
+
+	ops := map[string]string{",": "group", "&": "interleave", "|": "choice"}
+	t := p.peek()
+	name, ok := ops[t.text]
+	if (rncPunct != t.kind) || !ok {
+		return first, nil
+	}
+
+	container := rncElement(name, first)
+	for p.isPunct(t.text) {
+		p.next()
+		item, err := p.particle()
+		if nil != err {
+			return nil, err
+		}
+		container.InsertEndChild(item)
+	}
+
+	if next := p.peek(); (rncPunct == next.kind) && ("" != ops[next.text]) {
+		return nil, p.fail("Mixed operators without parentheses")
+	}
+
+	return container, nil
+}
+
+func (p *rncParser) particle() (XMLElement, error) {
+	primary, err := p.primary()
+	if nil != err {
+		return nil, err
+	}
+
+	for _, item := range []struct {
+		op   string
+		name string
+	}{{"?", "optional"}, {"*", "zeroOrMore"}, {"+", "oneOrMore"}} {
+		if p.isPunct(item.op) {
+			p.next()
+			return rncElement(item.name, primary), nil
+		}
+	}
+
+	return primary, nil
+}
+
+// block 解析"{ pattern }"
+func (p *rncParser) block(name string) (XMLElement, error) {
+	if err := p.expect("{"); nil != err {
+		return nil, err
+	}
+
+	pattern, err := p.pattern()
+	if nil != err {
+		return nil, err
+	}
+
+	if err := p.expect("}"); nil != err {
+		return nil, err
+	}
+
+	return rncElement(name, pattern), nil
+}
+
+func (p *rncParser) primary() (XMLElement, error) {
+	t := p.peek()
+	switch t.kind {
+	case rncLiteral:
+		value, err := p.literal()
+		if nil != err {
+			return nil, err
+		}
+
+		elem := NewElement("value")
+		elem.SetText(value)
+		return elem, nil
+	case rncPunct:
+		if !p.isPunct("(") {
+			return nil, p.fail("Expect a pattern")
+		}
+
+		p.next()
+		pattern, err := p.pattern()
+		if nil != err {
+			return nil, err
+		}
+		return pattern, p.expect(")")
+	case rncEOF:
+		return nil, p.fail("Expect a pattern")
+	}
+
+	if t.escaped {
+		p.next()
+		elem := NewElement("ref")
+		elem.SetAttribute("name", t.text)
+		return elem, nil
+	}
+
+	switch t.text {
+	case "element", "attribute":
+		p.next()
+		nc, err := p.nameClass()
+		if nil != err {
+			return nil, err
+		}
+
+		elem, err := p.block(t.text)
+		if nil != err {
+			return nil, err
+		}
+
+		elem.InsertFirstChild(nc)
+		return elem, nil
+	case "list", "mixed":
+		p.next()
+		return p.block(t.text)
+	case "empty", "text", "notAllowed":
+		p.next()
+		return NewElement(t.text), nil
+	case "parent":
+		p.next()
+		name := p.next()
+		if rncIdent != name.kind {
+			return nil, p.fail("Expect an identifier")
+		}
+
+		elem := NewElement("parentRef")
+		elem.SetAttribute("name", name.text)
+		return elem, nil
+	case "external":
+		p.next()
+		href, err := p.literal()
+		if nil != err {
+			return nil, err
+		}
+
+		if p.isKeyword("inherit") {
+			p.next()
+			p.next()
+			p.next()
+		}
+
+		elem := NewElement("externalRef")
+		elem.SetAttribute("href", href)
+		return elem, nil
+	case "grammar":
+		p.next()
+		elem := NewElement("grammar")
+		if err := p.expect("{"); nil != err {
+			return nil, err
+		}
+		if err := p.grammarContent(elem); nil != err {
+			return nil, err
+		}
+		return elem, p.expect("}")
+	case "string", "token":
+		return p.datatype("", t.text)
+	}
+
+	if i := strings.IndexByte(t.text, ':'); i >= 0 {
+		library, ok := p.datatypes[t.text[:i]]
+		if !ok {
+			return nil, p.fail("Undeclared datatype prefix")
+		}
+		return p.datatype(library, t.text[i+1:])
+	}
+
+	p.next()
+	elem := NewElement("ref")
+	elem.SetAttribute("name", t.text)
+	return elem, nil
+}
+
+// datatype 解析"type literal"形式的value,或者"type { params } - except"形式的data
+func (p *rncParser) datatype(library string, name string) (XMLElement, error) {
+	p.next()
+	if rncLiteral == p.peek().kind {
+		value, err := p.literal()
+		if nil != err {
+			return nil, err
+		}
+
+		elem := NewElement("value")
+		elem.SetAttribute("type", name)
+		elem.SetAttribute("datatypeLibrary", library)
+		elem.SetText(value)
+		return elem, nil
+	}
+
+	elem := NewElement("data")
+	elem.SetAttribute("type", name)
+	elem.SetAttribute("datatypeLibrary", library)
+	if p.isPunct("{") {
+		p.next()
+		for !p.isPunct("}") {
+			t := p.next()
+			if rncIdent != t.kind {
+				return nil, p.fail("Expect a parameter name")
+			}
+
+			if err := p.expect("="); nil != err {
+				return nil, err
+			}
+
+			value, err := p.literal()
+			if nil != err {
+				return nil, err
+			}
+
+			param := NewElement("param")
+			param.SetAttribute("name", t.text)
+			param.SetText(value)
+			elem.InsertEndChild(param)
+		}
+		p.next()
+	}
+
+	if p.isPunct("-") {
+		p.next()
+		except, err := p.primary()
+		if nil != err {
+			return nil, err
+		}
+		elem.InsertEndChild(rncElement("except", except))
+	}
+
+	return elem, nil
+}
+
+// nameClass 解析名字类:name、prefix:*、*,以及用'|'连接的选择和用'-'表示的排除
+func (p *rncParser) nameClass() (XMLElement, error) {
+	first, err := p.simpleNameClass()
+	if nil != err {
+		return nil, err
+	}
+
+	if !p.isPunct("|") {
+		return first, nil
+	}
+
+	choice := rncElement("choice", first)
+	for p.isPunct("|") {
+		p.next()
+		item, err := p.simpleNameClass()
+		if nil != err {
+			return nil, err
+		}
+		choice.InsertEndChild(item)
+	}
+
+	return choice, nil
+}
+
+func (p *rncParser) simpleNameClass() (XMLElement, error) {
+	t := p.next()
+	var elem XMLElement
+	switch {
+	case (rncPunct == t.kind) && ("(" == t.text):
+		nc, err := p.nameClass()
+		if nil != err {
+			return nil, err
+		}
+		return nc, p.expect(")")
+	case (rncPunct == t.kind) && ("*" == t.text):
+		elem = NewElement("anyName")
+	case (rncIdent == t.kind) && strings.HasSuffix(t.text, ":*"):
+		elem = NewElement("nsName")
+	case rncIdent == t.kind:
+		elem = NewElement("name")
+		elem.SetText(localName(t.text))
+		return elem, nil
+	default:
+		p.pos--
+		return nil, p.fail("Expect a name class")
+	}
+
+	if p.isPunct("-") {
+		p.next()
+		except, err := p.simpleNameClass()
+		if nil != err {
+			return nil, err
+		}
+		elem.InsertEndChild(rncElement("except", except))
+	}
+
+	return elem, nil
+}
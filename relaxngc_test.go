@@ -0,0 +1,105 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const rncTestSchema = `# 紧凑语法的图书馆模式
+default namespace = "http://example.com/library"
+namespace xlink = "http://www.w3.org/1999/xlink"
+datatypes d = "http://www.w3.org/2001/XMLSchema-datatypes"
+
+include "common.rnc" {
+	lang = "en" | "zh"
+}
+
+[ a:documentation [ "library [root]" ] ]
+start = element library {
+	attribute version { xsd:decimal "1.0" }?,
+	book+,
+	external "note.rnc"*
+}
+
+book = element book {
+	attribute id { d:ID },
+	attribute \lang { lang }?,
+	(element title { text }
+		& element author { xsd:token { maxLength = "10" } }+
+		& element tags { list { xsd:NCName+ } }?),
+	element price { xsd:decimal { minInclusive = "0" } - "0" }?
+}
+>> a:note [ "follow annotation" ]
+`
+
+func rncTestResolver(location string) (io.ReadCloser, error) {
+	switch location {
+	case "common.rnc":
+		return ioutil.NopCloser(strings.NewReader(`lang = "fr"`)), nil
+	case "note.rnc":
+		return ioutil.NopCloser(strings.NewReader(`element note { mixed { element * - (b | i) { text }* } }`)), nil
+	}
+	return nil, errors.New("not found:" + location)
+}
+
+func Test_RelaxNGCompact_校验(t *testing.T) {
+	schema, err := LoadRelaxNGCompact(strings.NewReader(rncTestSchema), rncTestResolver)
+	expect(t, "加载模式", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<library version="1.0">
+		<book id="b1" lang="zh"><author>A</author><tags>go xml</tags><title>Go</title><price>1.5</price></book>
+		<note>text <em>word</em></note>
+	</library>`))
+	expect(t, "有效文档", 0 == len(schema.Validate(doc)))
+
+	doc, _ = LoadDocument(strings.NewReader(`<library><book id="b1" lang="fr"><title/><author>A</author><price>0</price></book><note><b/></note></library>`))
+	errs := schema.Validate(doc)
+	expect(t, "错误个数", 3 == len(errs))
+	expect(t, "include中覆盖的定义", ("/library/book" == errs[0].Path) && strings.Contains(errs[0].Message, "lang"))
+	expect(t, "data的except", "/library/book/price" == errs[1].Path)
+	expect(t, "名字类的except", "/library/note/b" == errs[2].Path)
+}
+
+func Test_RelaxNGCompact_单个模式(t *testing.T) {
+	schema, err := LoadRelaxNGCompact(strings.NewReader(`element a { (element b { empty } | element c { empty })+, attribute * { text }* }`), nil)
+	expect(t, "加载模式", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<a x="1" y="2"><c/><b/><c/></a>`))
+	expect(t, "有效文档", 0 == len(schema.Validate(doc)))
+
+	doc, _ = LoadDocument(strings.NewReader(`<a><b/><d/></a>`))
+	errs := schema.Validate(doc)
+	expect(t, "不允许的元素", (1 == len(errs)) && ("/a/d" == errs[0].Path) && strings.HasSuffix(errs[0].Message, "expected b|c"))
+}
+
+func Test_RelaxNGCompact_语法错误(t *testing.T) {
+	tester := func(s string) error {
+		_, err := LoadRelaxNGCompact(strings.NewReader(s), nil)
+		return err
+	}
+
+	expect(t, "合法的模式", nil == tester(`start = element a { \element }  \element = text`))
+	expect(t, "混用连接符", nil != tester(`element a { text, empty | empty }`))
+	expect(t, "没有结束的字面量", nil != tester(`element a { "abc }`))
+	expect(t, "没有结束的标注", nil != tester(`[ element a { text }`))
+	expect(t, "缺少括号", nil != tester(`element a { text`))
+	expect(t, "未声明的数据类型前缀", nil != tester(`element a { foo:int }`))
+	expect(t, "多余的内容", nil != tester(`element a { text } text`))
+	expect(t, "错误的字符", nil != tester(`element a { @ }`))
+}
+
+func Test_RelaxNGCompact_嵌套的相对位置(t *testing.T) {
+	files := map[string]string{
+		"lib/item.rnc":     `element item { external "sub/text.rnc" }`,
+		"lib/sub/text.rnc": `text`,
+	}
+
+	schema, err := LoadRelaxNGCompact(strings.NewReader(`element r { external "lib/item.rnc" }`), fileResolver(files))
+	expect(t, "相对于引用它的模式文件查找", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<r><item>x</item></r>`))
+	expect(t, "使用嵌套引用的模式", (nil != schema) && (0 == len(schema.Validate(doc))))
+}
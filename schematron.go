@@ -0,0 +1,777 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Schematron 是编译好的ISO Schematron模式,规则中的表达式使用XPath 1.0(queryBinding为xslt、xslt1或者xpath).
+//
+// 支持pattern、rule、assert、report、let、diagnostics、name、value-of,抽象规则(extends)、抽象模式(is-a和param)、
+// phase以及include.规则的context是XSLT模式,同一个pattern中每个节点只会触发第一个匹配的规则.
+// 表达式中可以使用XSLT的current()函数,它返回规则的上下文节点.
+type Schematron struct {
+	Title        string
+	DefaultPhase string
+	Functions    map[string]XPathFunc // 扩展函数,校验时可以在表达式中调用
+
+	lets        []*schematronLet
+	patterns    []*schematronPattern
+	phases      map[string]*schematronPhase
+	diagnostics map[string]schematronMessage
+}
+
+// SchematronReport 是Schematron校验的结果,结构与SVRL(Schematron Validation Report Language)对应
+type SchematronReport struct {
+	Title             string
+	Phase             string
+	FiredRules        []SchematronFiredRule
+	FailedAsserts     []SchematronResult
+	SuccessfulReports []SchematronResult
+}
+
+// Valid 判断文档是否通过校验,即没有失败的assert.report只是报告,不影响校验的结果
+func (r *SchematronReport) Valid() bool {
+	return 0 == len(r.FailedAsserts)
+}
+
+// SchematronFiredRule 记录一次规则的触发
+type SchematronFiredRule struct {
+	Pattern string // 所在pattern的id
+	Rule    string // 规则的id
+	Context string // 规则的context
+	Node    XPathNode
+}
+
+// SchematronResult 是一个失败的assert或者成功的report
+type SchematronResult struct {
+	Node        XPathNode // 规则的上下文节点
+	Location    string    // 上下文节点的路径
+	Pattern     string
+	Rule        string
+	ID          string
+	Role        string
+	Flag        string
+	Test        string
+	Text        string
+	Diagnostics []SchematronDiagnostic
+}
+
+// SchematronDiagnostic 是assert或者report引用的诊断信息
+type SchematronDiagnostic struct {
+	ID   string
+	Text string
+}
+
+type schematronLet struct {
+	name  string
+	value *XPath
+}
+
+type schematronPattern struct {
+	id    string
+	lets  []*schematronLet
+	rules []*schematronRule
+}
+
+type schematronRule struct {
+	id      string
+	context *XPath
+	lets    []*schematronLet
+	checks  []*schematronCheck
+}
+
+type schematronCheck struct {
+	report      bool
+	id          string
+	role        string
+	flag        string
+	test        *XPath
+	message     schematronMessage
+	diagnostics []string
+}
+
+type schematronPhase struct {
+	lets     []*schematronLet
+	patterns []string
+}
+
+// schematronMessage 是assert、report和diagnostic的消息,由文本、value-of和name组成
+type schematronMessage []schematronPiece
+
+type schematronPiece struct {
+	text string
+	expr *XPath
+	name bool // 为true时输出expr选中的节点的名字,expr为nil时输出上下文节点的名字
+}
+
+// LoadSchematron 加载一个Schematron模式,include通过resolver加载,resolver可以为nil
+func LoadSchematron(rd io.Reader, resolver Resolver) (*Schematron, error) {
+	doc, err := loadSchematronDocument(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	root := doc.RootElement()
+	if (nil == root) || ("schema" != root.Name()) {
+		return nil, errors.New("Schematron schema must have the root element schema")
+	}
+
+	switch root.Attribute("queryBinding", "") {
+	case "", "xslt", "xslt1", "xpath":
+	default:
+		return nil, errors.New("Unsupported query binding:" + root.Attribute("queryBinding", ""))
+	}
+
+	c := &schematronCompiler{
+		resolver:      resolver,
+		included:      make(map[string]XMLElement),
+		locations:     make(map[XMLNode]string),
+		abstractRules: make(map[string]XMLElement),
+		abstractPats:  make(map[string]XMLElement),
+		schema: &Schematron{
+			DefaultPhase: root.Attribute("defaultPhase", ""),
+			phases:       make(map[string]*schematronPhase),
+			diagnostics:  make(map[string]schematronMessage),
+		},
+	}
+
+	if err := c.compileSchema(root); nil != err {
+		return nil, err
+	}
+
+	return c.schema, nil
+}
+
+// loadSchematronDocument 加载模式文档时保留空白,否则消息中<name/> <value-of/>之间的空格会丢失
+func loadSchematronDocument(rd io.Reader) (XMLDocument, error) {
+	builder := newDocumentBuilder()
+	if err := Parse(rd, builder, ParseOptions{KeepSpace: true}); nil != err {
+		return nil, err
+	}
+
+	return builder.doc, nil
+}
+
+type schematronCompiler struct {
+	resolver      Resolver
+	included      map[string]XMLElement // 位置到被包含的文档的根元素
+	locations     map[XMLNode]string    // 被包含的文档到它的位置,用于解析其中的相对位置
+	abstractRules map[string]XMLElement
+	abstractPats  map[string]XMLElement
+	diagnosticRef []string
+	schema        *Schematron
+}
+
+// children 返回元素的子元素,include被替换成被包含的文档的根元素
+func (c *schematronCompiler) children(elem XMLElement) ([]XMLElement, error) {
+	var result []XMLElement
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		if "include" != child.Name() {
+			result = append(result, child)
+			continue
+		}
+
+		location := resolveLocation(c.locations[treeRoot(child)], child.Attribute("href", ""))
+		included, err := c.include(location)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, included)
+	}
+
+	return result, nil
+}
+
+func (c *schematronCompiler) include(href string) (XMLElement, error) {
+	if nil == c.resolver {
+		return nil, errors.New("Missing resolver for Schematron include:" + href)
+	}
+
+	// 抽象规则在编译之前需要预先收集,同一个文件会被访问多次,所以缓存加载的结果
+	if root, ok := c.included[href]; ok {
+		return root, nil
+	}
+
+	rd, err := c.resolver(href)
+	if nil != err {
+		return nil, err
+	}
+	defer rd.Close()
+
+	doc, err := loadSchematronDocument(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == doc.RootElement() {
+		return nil, errors.New("Included document has no root element:" + href)
+	}
+
+	c.included[href] = doc.RootElement()
+	c.locations[doc] = href
+	return doc.RootElement(), nil
+}
+
+func (c *schematronCompiler) compileSchema(root XMLElement) error {
+	children, err := c.children(root)
+	if nil != err {
+		return err
+	}
+
+	// 先收集抽象规则和抽象模式,它们可以在定义之前被引用
+	for _, child := range children {
+		if "pattern" != child.Name() {
+			continue
+		}
+
+		if "true" == child.Attribute("abstract", "") {
+			c.abstractPats[child.Attribute("id", "")] = child
+			continue
+		}
+
+		rules, err := c.children(child)
+		if nil != err {
+			return err
+		}
+		for _, rule := range rules {
+			if ("rule" == rule.Name()) && ("true" == rule.Attribute("abstract", "")) {
+				c.abstractRules[rule.Attribute("id", "")] = rule
+			}
+		}
+	}
+
+	for _, child := range children {
+		switch child.Name() {
+		case "title":
+			c.schema.Title = strings.Join(strings.Fields(child.Text()), " ")
+		case "let":
+			let, err := c.let(child, nil)
+			if nil != err {
+				return err
+			}
+			c.schema.lets = append(c.schema.lets, let)
+		case "pattern":
+			if "true" == child.Attribute("abstract", "") {
+				continue
+			}
+
+			pattern, err := c.pattern(child)
+			if nil != err {
+				return err
+			}
+			c.schema.patterns = append(c.schema.patterns, pattern)
+		case "phase":
+			if err := c.phase(child); nil != err {
+				return err
+			}
+		case "diagnostics":
+			diagnostics, err := c.children(child)
+			if nil != err {
+				return err
+			}
+			for _, diagnostic := range diagnostics {
+				message, err := c.message(diagnostic, nil)
+				if nil != err {
+					return err
+				}
+				c.schema.diagnostics[diagnostic.Attribute("id", "")] = message
+			}
+		case "ns", "p", "properties":
+		default:
+			return errors.New("Unsupported Schematron element:" + child.Name())
+		}
+	}
+
+	for _, id := range c.diagnosticRef {
+		if _, ok := c.schema.diagnostics[id]; !ok {
+			return errors.New("Undefined diagnostic:" + id)
+		}
+	}
+
+	if "" != c.schema.DefaultPhase {
+		if _, ok := c.schema.phases[c.schema.DefaultPhase]; !ok {
+			return errors.New("Undefined phase:" + c.schema.DefaultPhase)
+		}
+	}
+
+	return nil
+}
+
+// schematronParamRegexp 匹配抽象模式中的参数引用$name
+var schematronParamRegexp = regexp.MustCompile(`\$[A-Za-z_][\w.\-]*`)
+
+// expr 读取元素的属性作为XPath表达式,抽象模式的参数在编译之前被替换
+func (c *schematronCompiler) expr(elem XMLElement, name string, params map[string]string, pattern bool) (*XPath, error) {
+	attr := elem.FindAttribute(name)
+	if nil == attr {
+		return nil, errors.New(elem.Name() + " must have the attribute " + name)
+	}
+
+	source := attr.Value()
+	if nil != params {
+		source = schematronParamRegexp.ReplaceAllStringFunc(source, func(ref string) string {
+			if value, ok := params[ref[1:]]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+
+	if pattern {
+		return compileXPathPattern(source)
+	}
+	return CompileXPath(source)
+}
+
+func (c *schematronCompiler) let(elem XMLElement, params map[string]string) (*schematronLet, error) {
+	name := elem.Attribute("name", "")
+	if "" == name {
+		return nil, errors.New("let must have a name")
+	}
+
+	value, err := c.expr(elem, "value", params, false)
+	if nil != err {
+		return nil, err
+	}
+
+	return &schematronLet{name: name, value: value}, nil
+}
+
+func (c *schematronCompiler) pattern(elem XMLElement) (*schematronPattern, error) {
+	pattern := &schematronPattern{id: elem.Attribute("id", "")}
+
+	var params map[string]string
+	if isA := elem.Attribute("is-a", ""); "" != isA {
+		abstract, ok := c.abstractPats[isA]
+		if !ok {
+			return nil, errors.New("Undefined abstract pattern:" + isA)
+		}
+
+		params = make(map[string]string)
+		for param := elem.FirstChildElement("param"); nil != param; param = param.NextElement("param") {
+			params[param.Attribute("name", "")] = param.Attribute("value", "")
+		}
+		elem = abstract
+	}
+
+	children, err := c.children(elem)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, child := range children {
+		switch child.Name() {
+		case "let":
+			let, err := c.let(child, params)
+			if nil != err {
+				return nil, err
+			}
+			pattern.lets = append(pattern.lets, let)
+		case "rule":
+			if "true" == child.Attribute("abstract", "") {
+				continue
+			}
+
+			rule, err := c.rule(child, params)
+			if nil != err {
+				return nil, err
+			}
+			pattern.rules = append(pattern.rules, rule)
+		case "title", "p", "param":
+		default:
+			return nil, errors.New("Unsupported Schematron element:" + child.Name())
+		}
+	}
+
+	return pattern, nil
+}
+
+func (c *schematronCompiler) rule(elem XMLElement, params map[string]string) (*schematronRule, error) {
+	context, err := c.expr(elem, "context", params, true)
+	if nil != err {
+		return nil, err
+	}
+
+	rule := &schematronRule{id: elem.Attribute("id", ""), context: context}
+	return rule, c.ruleContent(rule, elem, params, make(map[string]bool))
+}
+
+// ruleContent 编译规则的内容,extends引用的抽象规则的内容在引用的位置展开
+func (c *schematronCompiler) ruleContent(rule *schematronRule, elem XMLElement, params map[string]string, extending map[string]bool) error {
+	children, err := c.children(elem)
+	if nil != err {
+		return err
+	}
+
+	for _, child := range children {
+		switch child.Name() {
+		case "let":
+			let, err := c.let(child, params)
+			if nil != err {
+				return err
+			}
+			rule.lets = append(rule.lets, let)
+		case "assert", "report":
+			check, err := c.check(child, params)
+			if nil != err {
+				return err
+			}
+			rule.checks = append(rule.checks, check)
+		case "extends":
+			id := child.Attribute("rule", "")
+			abstract, ok := c.abstractRules[id]
+			if !ok {
+				return errors.New("Undefined abstract rule:" + id)
+			}
+
+			if extending[id] {
+				return errors.New("Recursive abstract rule:" + id)
+			}
+
+			extending[id] = true
+			if err := c.ruleContent(rule, abstract, params, extending); nil != err {
+				return err
+			}
+			delete(extending, id)
+		case "title", "p":
+		default:
+			return errors.New("Unsupported Schematron element:" + child.Name())
+		}
+	}
+
+	return nil
+}
+
+func (c *schematronCompiler) check(elem XMLElement, params map[string]string) (*schematronCheck, error) {
+	test, err := c.expr(elem, "test", params, false)
+	if nil != err {
+		return nil, err
+	}
+
+	message, err := c.message(elem, params)
+	if nil != err {
+		return nil, err
+	}
+
+	check := &schematronCheck{
+		report:      "report" == elem.Name(),
+		id:          elem.Attribute("id", ""),
+		role:        elem.Attribute("role", ""),
+		flag:        elem.Attribute("flag", ""),
+		test:        test,
+		message:     message,
+		diagnostics: strings.Fields(elem.Attribute("diagnostics", "")),
+	}
+	c.diagnosticRef = append(c.diagnosticRef, check.diagnostics...)
+	return check, nil
+}
+
+// message 编译消息的内容,emph、dir、span等只保留其中的文本
+func (c *schematronCompiler) message(elem XMLElement, params map[string]string) (schematronMessage, error) {
+	var message schematronMessage
+	for child := elem.FirstChild(); nil != child; child = child.Next() {
+		if nil != child.ToText() {
+			message = append(message, schematronPiece{text: child.Value()})
+			continue
+		}
+
+		e := child.ToElement()
+		if nil == e {
+			continue
+		}
+
+		switch e.Name() {
+		case "value-of":
+			expr, err := c.expr(e, "select", params, false)
+			if nil != err {
+				return nil, err
+			}
+			message = append(message, schematronPiece{expr: expr})
+		case "name":
+			piece := schematronPiece{name: true}
+			if nil != e.FindAttribute("path") {
+				var err error
+				if piece.expr, err = c.expr(e, "path", params, false); nil != err {
+					return nil, err
+				}
+			}
+			message = append(message, piece)
+		default:
+			inner, err := c.message(e, params)
+			if nil != err {
+				return nil, err
+			}
+			message = append(message, inner...)
+		}
+	}
+
+	return message, nil
+}
+
+func (c *schematronCompiler) phase(elem XMLElement) error {
+	id := elem.Attribute("id", "")
+	if "" == id {
+		return errors.New("phase must have an id")
+	}
+
+	phase := &schematronPhase{}
+	children, err := c.children(elem)
+	if nil != err {
+		return err
+	}
+
+	for _, child := range children {
+		switch child.Name() {
+		case "active":
+			phase.patterns = append(phase.patterns, child.Attribute("pattern", ""))
+		case "let":
+			let, err := c.let(child, nil)
+			if nil != err {
+				return err
+			}
+			phase.lets = append(phase.lets, let)
+		case "p":
+		default:
+			return errors.New("Unsupported Schematron element:" + child.Name())
+		}
+	}
+
+	c.schema.phases[id] = phase
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// Validate 使用默认的phase校验文档,没有默认的phase时使用所有的pattern.
+// 返回的错误是表达式求值时的错误,例如引用了未定义的变量或者函数,文档不满足规则时通过报告返回.
+func (s *Schematron) Validate(doc XMLDocument) (*SchematronReport, error) {
+	return s.ValidatePhase(doc, "#DEFAULT")
+}
+
+// ValidatePhase 只使用指定phase中的pattern校验文档,phase为"#ALL"时使用所有的pattern,为"#DEFAULT"时使用默认的phase
+func (s *Schematron) ValidatePhase(doc XMLDocument, phase string) (*SchematronReport, error) {
+	if "#DEFAULT" == phase {
+		phase = s.DefaultPhase
+		if "" == phase {
+			phase = "#ALL"
+		}
+	}
+
+	patterns := s.patterns
+	var phaseLets []*schematronLet
+	if "#ALL" != phase {
+		p, ok := s.phases[phase]
+		if !ok {
+			return nil, errors.New("Undefined phase:" + phase)
+		}
+
+		patterns = nil
+		for _, pattern := range s.patterns {
+			if containsString(p.patterns, pattern.id) {
+				patterns = append(patterns, pattern)
+			}
+		}
+		phaseLets = p.lets
+	}
+
+	v := &schematronValidator{
+		report: &SchematronReport{Title: s.Title, Phase: phase},
+		schema: s,
+		root:   XPathNode{Node: doc},
+	}
+
+	functions := map[string]XPathFunc{
+		"current": func(context XPathNode, args []interface{}) (interface{}, error) {
+			return []XPathNode{v.current}, nil
+		},
+	}
+	for name, f := range s.Functions {
+		functions[name] = f
+	}
+	v.evaluator = newXPathEvaluator(&XPathEnv{Variables: make(map[string]interface{}), Functions: functions})
+
+	variables, err := v.bind(v.evaluator.env.Variables, append(append([]*schematronLet{}, s.lets...), phaseLets...), v.root)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, pattern := range patterns {
+		if err := v.pattern(pattern, variables); nil != err {
+			return nil, err
+		}
+	}
+
+	return v.report, nil
+}
+
+type schematronValidator struct {
+	report    *SchematronReport
+	schema    *Schematron
+	root      XPathNode
+	current   XPathNode
+	evaluator *xpathEvaluator
+}
+
+func (v *schematronValidator) evaluate(x *XPath, node XPathNode, variables map[string]interface{}) (interface{}, error) {
+	v.evaluator.env.Variables = variables
+	return x.expr.eval(v.evaluator, xpathContext{node: node, position: 1, size: 1})
+}
+
+// bind 在node上依次计算let的值,返回包含新变量的变量表,外层的变量表不受影响
+func (v *schematronValidator) bind(variables map[string]interface{}, lets []*schematronLet, node XPathNode) (map[string]interface{}, error) {
+	if 0 == len(lets) {
+		return variables, nil
+	}
+
+	result := make(map[string]interface{}, len(variables)+len(lets))
+	for name, value := range variables {
+		result[name] = value
+	}
+
+	for _, let := range lets {
+		value, err := v.evaluate(let.value, node, result)
+		if nil != err {
+			return nil, err
+		}
+		result[let.name] = value
+	}
+
+	return result, nil
+}
+
+func (v *schematronValidator) pattern(pattern *schematronPattern, variables map[string]interface{}) error {
+	variables, err := v.bind(variables, pattern.lets, v.root)
+	if nil != err {
+		return err
+	}
+
+	// 从文档根对每个规则的context求值,得到规则匹配的节点
+	matches := make([]map[XPathNode]bool, len(pattern.rules))
+	for i, rule := range pattern.rules {
+		v.current = v.root
+		value, err := v.evaluate(rule.context, v.root, variables)
+		if nil != err {
+			return err
+		}
+
+		nodes, ok := value.([]XPathNode)
+		if !ok {
+			return errors.New("Rule context is not a node-set:" + rule.context.String())
+		}
+
+		matches[i] = make(map[XPathNode]bool)
+		for _, node := range nodes {
+			matches[i][node] = true
+		}
+	}
+
+	var nodes []XPathNode
+	xpathAxis(xpathAxisDescendantOrSelf, v.root, func(n XPathNode) {
+		nodes = append(nodes, n)
+		xpathAxis(xpathAxisAttribute, n, func(attr XPathNode) {
+			nodes = append(nodes, attr)
+		})
+	})
+
+	for _, node := range nodes {
+		for i, rule := range pattern.rules {
+			if !matches[i][node] {
+				continue
+			}
+
+			if err := v.fire(pattern, rule, node, variables); nil != err {
+				return err
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+func (v *schematronValidator) fire(pattern *schematronPattern, rule *schematronRule, node XPathNode, variables map[string]interface{}) error {
+	v.current = node
+	v.report.FiredRules = append(v.report.FiredRules, SchematronFiredRule{
+		Pattern: pattern.id,
+		Rule:    rule.id,
+		Context: rule.context.String(),
+		Node:    node,
+	})
+
+	variables, err := v.bind(variables, rule.lets, node)
+	if nil != err {
+		return err
+	}
+
+	for _, check := range rule.checks {
+		value, err := v.evaluate(check.test, node, variables)
+		if nil != err {
+			return err
+		}
+
+		if XPathBoolean(value) != check.report {
+			continue
+		}
+
+		result := SchematronResult{
+			Node:     node,
+			Location: node.Path(),
+			Pattern:  pattern.id,
+			Rule:     rule.id,
+			ID:       check.id,
+			Role:     check.role,
+			Flag:     check.flag,
+			Test:     check.test.String(),
+		}
+
+		if result.Text, err = v.render(check.message, node, variables); nil != err {
+			return err
+		}
+
+		for _, id := range check.diagnostics {
+			text, err := v.render(v.schema.diagnostics[id], node, variables)
+			if nil != err {
+				return err
+			}
+			result.Diagnostics = append(result.Diagnostics, SchematronDiagnostic{ID: id, Text: text})
+		}
+
+		if check.report {
+			v.report.SuccessfulReports = append(v.report.SuccessfulReports, result)
+		} else {
+			v.report.FailedAsserts = append(v.report.FailedAsserts, result)
+		}
+	}
+
+	return nil
+}
+
+// render 生成消息的文本,空白被规范化
+func (v *schematronValidator) render(message schematronMessage, node XPathNode, variables map[string]interface{}) (string, error) {
+	var text bytes.Buffer
+	for _, piece := range message {
+		switch {
+		case piece.name && (nil == piece.expr):
+			text.WriteString(node.Name())
+		case nil != piece.expr:
+			value, err := v.evaluate(piece.expr, node, variables)
+			if nil != err {
+				return "", err
+			}
+
+			if !piece.name {
+				text.WriteString(XPathString(value))
+			} else if nodes, ok := value.([]XPathNode); ok && (0 != len(nodes)) {
+				text.WriteString(nodes[0].Name())
+			}
+		default:
+			text.WriteString(piece.text)
+		}
+	}
+
+	return strings.Join(strings.Fields(text.String()), " "), nil
+}
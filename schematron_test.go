@@ -0,0 +1,191 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const schematronTestSchema = `<?xml version="1.0"?>
+<sch:schema xmlns:sch="http://purl.oclc.org/dsdl/schematron" queryBinding="xslt" defaultPhase="all">
+	<sch:title>Library rules</sch:title>
+	<sch:let name="maxPrice" value="100"/>
+
+	<sch:phase id="all">
+		<sch:active pattern="books"/>
+		<sch:active pattern="prices"/>
+		<sch:active pattern="ids"/>
+	</sch:phase>
+	<sch:phase id="quick">
+		<sch:active pattern="books"/>
+	</sch:phase>
+
+	<sch:pattern id="books">
+		<sch:rule id="english" context="book[@lang='en']">
+			<sch:extends rule="titled"/>
+			<sch:assert id="isbn" test="isbn" role="error" diagnostics="d-isbn">English book <sch:value-of select="@id"/> must have an isbn</sch:assert>
+		</sch:rule>
+		<sch:rule context="book">
+			<sch:extends rule="titled"/>
+			<sch:report test="not(@lang)" role="info">The <sch:name/> <sch:value-of select="@id"/> has no language</sch:report>
+		</sch:rule>
+		<sch:rule abstract="true" id="titled">
+			<sch:assert test="normalize-space(title)">A <sch:emph>book</sch:emph> must have a title</sch:assert>
+		</sch:rule>
+	</sch:pattern>
+
+	<sch:include href="prices.sch"/>
+
+	<sch:pattern id="ids" is-a="unique">
+		<sch:param name="element" value="book"/>
+		<sch:param name="key" value="@id"/>
+	</sch:pattern>
+
+	<sch:pattern abstract="true" id="unique">
+		<sch:rule context="$element">
+			<sch:let name="value" value="string($key)"/>
+			<sch:assert test="count(//$element[$key = $value]) = 1"><sch:name/> key <sch:value-of select="$value"/> is not unique</sch:assert>
+		</sch:rule>
+	</sch:pattern>
+
+	<sch:diagnostics>
+		<sch:diagnostic id="d-isbn">Add an isbn element to <sch:value-of select="current()/title"/></sch:diagnostic>
+	</sch:diagnostics>
+</sch:schema>`
+
+const schematronTestPrices = `<sch:pattern id="prices" xmlns:sch="http://purl.oclc.org/dsdl/schematron">
+	<sch:rule context="@price">
+		<sch:assert test=". &gt;= 0 and . &lt;= $maxPrice" flag="price">Price <sch:value-of select="."/> of <sch:name path=".."/> is out of range</sch:assert>
+	</sch:rule>
+</sch:pattern>`
+
+func schematronTestResolver(location string) (io.ReadCloser, error) {
+	if "prices.sch" != location {
+		return nil, errors.New("not found:" + location)
+	}
+	return ioutil.NopCloser(strings.NewReader(schematronTestPrices)), nil
+}
+
+func validateSchematronString(t *testing.T, xml string, phase string) *SchematronReport {
+	schema, err := LoadSchematron(strings.NewReader(schematronTestSchema), schematronTestResolver)
+	expect(t, "加载模式", nil == err)
+
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "返回值检测", nil == err)
+
+	report, err := schema.ValidatePhase(doc, phase)
+	expect(t, "校验", nil == err)
+	return report
+}
+
+func Test_Schematron_有效文档(t *testing.T) {
+	report := validateSchematronString(t, `<library>
+		<book id="b1" lang="en" price="10"><title>Go</title><isbn>1</isbn></book>
+		<book id="b2" lang="zh"><title>XML</title></book>
+	</library>`, "#DEFAULT")
+	expect(t, "有效", report.Valid())
+	expect(t, "标题和phase", ("Library rules" == report.Title) && ("all" == report.Phase))
+	expect(t, "触发的规则", 5 == len(report.FiredRules))
+	expect(t, "第一个规则", ("books" == report.FiredRules[0].Pattern) && ("english" == report.FiredRules[0].Rule) && ("/library/book[1]" == report.FiredRules[0].Node.Path()))
+	expect(t, "属性作为上下文", "/library/book[1]/@price" == report.FiredRules[2].Node.Path())
+}
+
+func Test_Schematron_断言和报告(t *testing.T) {
+	report := validateSchematronString(t, `<library>
+		<book id="b1" lang="en" price="120"><title> </title></book>
+		<book id="b1"><title>XML</title></book>
+	</library>`, "#ALL")
+	expect(t, "无效", !report.Valid())
+	expect(t, "失败的断言个数", 5 == len(report.FailedAsserts))
+
+	title := report.FailedAsserts[0]
+	expect(t, "抽象规则中的断言", ("/library/book[1]" == title.Location) && ("english" == title.Rule) && ("A book must have a title" == title.Text))
+
+	isbn := report.FailedAsserts[1]
+	expect(t, "断言的属性", ("isbn" == isbn.ID) && ("error" == isbn.Role) && ("isbn" == isbn.Test) && ("books" == isbn.Pattern))
+	expect(t, "value-of", "English book b1 must have an isbn" == isbn.Text)
+	expect(t, "诊断信息", (1 == len(isbn.Diagnostics)) && ("d-isbn" == isbn.Diagnostics[0].ID) && ("Add an isbn element to" == isbn.Diagnostics[0].Text))
+
+	price := report.FailedAsserts[2]
+	expect(t, "include和schema的变量", ("/library/book[1]/@price" == price.Location) && ("price" == price.Flag) && ("Price 120 of book is out of range" == price.Text))
+
+	unique := report.FailedAsserts[3]
+	expect(t, "抽象模式", ("ids" == unique.Pattern) && ("/library/book[1]" == unique.Location) && ("book key b1 is not unique" == unique.Text))
+	expect(t, "抽象模式的第二个节点", "/library/book[2]" == report.FailedAsserts[4].Location)
+
+	expect(t, "成功的报告", (1 == len(report.SuccessfulReports)) && ("The book b1 has no language" == report.SuccessfulReports[0].Text))
+}
+
+func Test_Schematron_Phase(t *testing.T) {
+	report := validateSchematronString(t, `<library><book id="b1" price="-1"><title>Go</title></book></library>`, "quick")
+	expect(t, "只校验phase中的pattern", report.Valid() && (1 == len(report.FiredRules)))
+
+	schema, _ := LoadSchematron(strings.NewReader(schematronTestSchema), schematronTestResolver)
+	doc, _ := LoadDocument(strings.NewReader(`<library/>`))
+	_, err := schema.ValidatePhase(doc, "none")
+	expect(t, "未定义的phase", nil != err)
+}
+
+func Test_Schematron_扩展函数和错误(t *testing.T) {
+	schema, err := LoadSchematron(strings.NewReader(`<schema xmlns="http://purl.oclc.org/dsdl/schematron">
+		<pattern>
+			<rule context="/*"><assert test="ext:check(name())">root <value-of select="$undefined"/></assert></rule>
+		</pattern>
+	</schema>`), nil)
+	expect(t, "加载模式", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<library/>`))
+	schema.Functions = map[string]XPathFunc{
+		"ext:check": func(context XPathNode, args []interface{}) (interface{}, error) {
+			return "library" == XPathString(args[0]), nil
+		},
+	}
+	report, err := schema.Validate(doc)
+	expect(t, "扩展函数", (nil == err) && report.Valid() && ("#ALL" == report.Phase))
+
+	doc, _ = LoadDocument(strings.NewReader(`<catalog/>`))
+	_, err = schema.Validate(doc)
+	expect(t, "消息中未定义的变量", nil != err)
+
+	tester := func(body string) error {
+		_, err := LoadSchematron(strings.NewReader(`<schema xmlns="http://purl.oclc.org/dsdl/schematron">`+body+`</schema>`), nil)
+		return err
+	}
+
+	expect(t, "合法的模式", nil == tester(`<pattern><rule context="a"><assert test="b"/></rule></pattern>`))
+	expect(t, "缺少context", nil != tester(`<pattern><rule><assert test="b"/></rule></pattern>`))
+	expect(t, "context不是模式", nil != tester(`<pattern><rule context="1 + 2"><assert test="b"/></rule></pattern>`))
+	expect(t, "test的语法错误", nil != tester(`<pattern><rule context="a"><assert test="b["/></rule></pattern>`))
+	expect(t, "未定义的抽象规则", nil != tester(`<pattern><rule context="a"><extends rule="x"/></rule></pattern>`))
+	expect(t, "未定义的诊断", nil != tester(`<pattern><rule context="a"><assert test="b" diagnostics="d"/></rule></pattern>`))
+	expect(t, "未定义的抽象模式", nil != tester(`<pattern is-a="x"/>`))
+	expect(t, "没有resolver", nil != tester(`<include href="a.sch"/>`))
+	expect(t, "不支持的元素", nil != tester(`<foo/>`))
+	expect(t, "不支持的查询语言", nil != func() error {
+		_, err := LoadSchematron(strings.NewReader(`<schema queryBinding="xslt2"/>`), nil)
+		return err
+	}())
+}
+
+func Test_Schematron_嵌套的相对位置(t *testing.T) {
+	files := map[string]string{
+		"lib/pattern.sch": `<pattern xmlns="http://purl.oclc.org/dsdl/schematron"><include href="rules/root.sch"/></pattern>`,
+		"lib/rules/root.sch": `<rule xmlns="http://purl.oclc.org/dsdl/schematron" context="/*">
+			<assert test="@id">root must have an id</assert>
+		</rule>`,
+	}
+
+	schema, err := LoadSchematron(strings.NewReader(`<schema xmlns="http://purl.oclc.org/dsdl/schematron">
+		<include href="lib/pattern.sch"/>
+	</schema>`), fileResolver(files))
+	expect(t, "相对于包含它的文档查找", nil == err)
+	if nil != err {
+		return
+	}
+
+	doc, _ := LoadDocument(strings.NewReader(`<library/>`))
+	report, err := schema.Validate(doc)
+	expect(t, "使用嵌套包含的规则", (nil == err) && (1 == len(report.FailedAsserts)))
+}
@@ -0,0 +1,136 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// StreamElements 以流的方式处理超大的XML文档.
+//
+// path指定需要处理的元素的绝对路径,例如"/catalog/book",路径中的某一级可以用"*"匹配任意元素名.
+// 每当一个匹配的元素读取完毕,StreamElements就为该元素单独构造一颗DOM树并交给fn处理,fn返回之后这颗DOM树即被丢弃,
+// 因此无论文档有多大,内存占用只和单个匹配元素的大小相关.
+//
+// 匹配元素的子孙节点不会再被匹配.fn返回非nil的错误时处理立即终止并返回该错误.
+// 文档格式错误时返回的错误与LoadDocument一致.
+func StreamElements(rd io.Reader, path string, fn func(XMLElement) error) error {
+	steps, err := splitStreamPath(path)
+	if nil != err {
+		return err
+	}
+
+	handler := new(xmlStreamHandler)
+	handler.steps = steps
+	handler.names = make([]string, 0, len(steps)+8)
+	handler.fn = fn
+	return Parse(rd, handler, ParseOptions{})
+}
+
+// xmlStreamHandler 只为路径匹配的元素构造DOM树,其他的事件全部丢弃
+type xmlStreamHandler struct {
+	steps   []string
+	names   []string
+	builder *xmlDocumentBuilder // 不为nil表示当前正在为某个匹配的元素构造DOM树
+	fn      func(XMLElement) error
+}
+
+func (h *xmlStreamHandler) StartDocument() error {
+	return nil
+}
+
+func (h *xmlStreamHandler) EndDocument() error {
+	return nil
+}
+
+func (h *xmlStreamHandler) StartElement(name string, attrs []XMLAttribute) error {
+	h.names = append(h.names, name)
+	if (nil == h.builder) && matchStreamPath(h.steps, h.names) {
+		h.builder = newDocumentBuilder()
+		h.builder.StartDocument()
+	}
+
+	if nil == h.builder {
+		return nil
+	}
+
+	return h.builder.StartElement(name, attrs)
+}
+
+func (h *xmlStreamHandler) EndElement(name string) error {
+	h.names = h.names[:len(h.names)-1]
+	if nil == h.builder {
+		return nil
+	}
+
+	h.builder.EndElement(name)
+	if h.builder.parent != h.builder.doc {
+		return nil
+	}
+
+	elem := h.builder.doc.FirstChildElement("")
+	h.builder = nil
+	return h.fn(elem)
+}
+
+func (h *xmlStreamHandler) Text(text string) error {
+	if nil == h.builder {
+		return nil
+	}
+
+	return h.builder.Text(text)
+}
+
+func (h *xmlStreamHandler) Comment(comment string) error {
+	if nil == h.builder {
+		return nil
+	}
+
+	return h.builder.Comment(comment)
+}
+
+func (h *xmlStreamHandler) ProcInst(target string, inst string) error {
+	if nil == h.builder {
+		return nil
+	}
+
+	return h.builder.ProcInst(target, inst)
+}
+
+func (h *xmlStreamHandler) Directive(directive string) error {
+	if nil == h.builder {
+		return nil
+	}
+
+	return h.builder.Directive(directive)
+}
+
+// splitStreamPath 将"/catalog/book"这样的路径拆分成每一级的元素名
+func splitStreamPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("Stream path should be absolute:" + path)
+	}
+
+	steps := strings.Split(path[1:], "/")
+	for _, step := range steps {
+		if "" == step {
+			return nil, errors.New("Invalid stream path:" + path)
+		}
+	}
+
+	return steps, nil
+}
+
+func matchStreamPath(steps []string, names []string) bool {
+	if len(steps) != len(names) {
+		return false
+	}
+
+	for i, step := range steps {
+		if ("*" != step) && (step != names[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,69 @@
+package tinydom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_StreamElements_基本功能(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<catalog>
+		<book id="1"><name>The Moon</name><!--c1--></book>
+		<magazine><book id="x"/></magazine>
+		<book id="2"><name>Go west</name></book>
+	</catalog>`
+
+	var ids []string
+	var names []string
+	err := StreamElements(strings.NewReader(xml), "/catalog/book", func(elem XMLElement) error {
+		expect(t, "每个元素都有独立的文档", nil != elem.Document())
+		expect(t, "每个元素都是独立文档的根节点", elem == elem.Document().FirstChildElement(""))
+		ids = append(ids, elem.Attribute("id", ""))
+		names = append(names, NewHandle(elem).FirstChildElement("name").ToElement().Text())
+		return nil
+	})
+	expect(t, "返回值检测", nil == err)
+	expect(t, "只处理路径匹配的元素", 2 == len(ids))
+	expect(t, "按文档顺序处理", "1" == ids[0] && "2" == ids[1])
+	expect(t, "匹配元素的子树被完整构造", "The Moon" == names[0] && "Go west" == names[1])
+}
+
+func Test_StreamElements_通配符(t *testing.T) {
+	xml := `<catalog><book/><magazine/><book><book/></book></catalog>`
+
+	count := 0
+	err := StreamElements(strings.NewReader(xml), "/catalog/*", func(elem XMLElement) error {
+		count++
+		return nil
+	})
+	expect(t, "返回值检测", nil == err)
+	expect(t, "匹配元素的子孙不会再被匹配", 3 == count)
+}
+
+func Test_StreamElements_回调终止(t *testing.T) {
+	xml := `<catalog><book/><book/><book/></catalog>`
+
+	stop := errors.New("stop")
+	count := 0
+	err := StreamElements(strings.NewReader(xml), "/catalog/book", func(elem XMLElement) error {
+		count++
+		return stop
+	})
+	expect(t, "回调的错误原样返回", stop == err)
+	expect(t, "回调返回错误后立即终止", 1 == count)
+}
+
+func Test_StreamElements_格式错误(t *testing.T) {
+	nop := func(elem XMLElement) error {
+		return nil
+	}
+
+	expect(t, "空文档", nil != StreamElements(strings.NewReader(""), "/a", nop))
+	expect(t, "节点未关闭", nil != StreamElements(strings.NewReader("<a><b></a>"), "/a/b", nop))
+	expect(t, "多余的根节点", nil != StreamElements(strings.NewReader("<a/><b/>"), "/a", nop))
+	expect(t, "文本出现在根节点之外", nil != StreamElements(strings.NewReader("<a/>text"), "/a", nop))
+	expect(t, "属性同名", nil != StreamElements(strings.NewReader(`<a><b x="1" x="2"/></a>`), "/a/b", nop))
+	expect(t, "路径必须是绝对路径", nil != StreamElements(strings.NewReader("<a/>"), "a", nop))
+	expect(t, "路径不能有空的层级", nil != StreamElements(strings.NewReader("<a/>"), "/a//b", nop))
+}
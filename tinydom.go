@@ -2,12 +2,10 @@
 package tinydom
 
 import (
-	"bytes"
-	"encoding/xml"
-	"errors"
 	"io"
+	"strconv"
+	"strings"
 	"unicode/utf8"
-	"container/list"
 	"os"
 )
 
@@ -80,7 +78,7 @@ type XMLNode interface {
 //
 // Text、SetText的作用是设置<node>与</node>之间的文字，虽然文字都是有XMLText对象来承载的，但是通常来说直接在XMLElement中访问会更加方便。
 //
-// FindAttribute和ForeachAttribute分别用于查找特定的XML节点的属性和遍历XML属性列表。
+// FindAttribute和ForeachAttribute分别用于查找特定的XML节点的属性和遍历XML属性列表，Go 1.23及以上版本推荐使用Attributes迭代器遍历属性。
 //
 // Attribute、SetAttribute、DeleteAttribute用于读取和删除属性。
 type XMLElement interface {
@@ -121,6 +119,7 @@ type XMLProcInst interface {
 	XMLNode
 	Target() string
 	Instruction() string
+	SetInstruction(string)
 }
 
 // XMLDirective 用于表达`<!`与`>`之间的部分，一般为DTD
@@ -129,8 +128,34 @@ type XMLDirective interface {
 }
 
 // XMLDocument 用于表达一个XML文档,这是整个XML文档的根
+//
+// 与LoadDocument一样,XMLDocument只允许有唯一一个根元素,文本也不能直接出现在文档之下,
+// 违反这个规则的插入操作(InsertEndChild、InsertFirstChild、InsertFront、InsertBack等)都会失败并返回nil.
+//
+// RootElement、SetRootElement用于读取和替换根元素.
+//
+// Declaration、SetDeclaration用于读取和设置XML声明,即<?xml version="1.0" encoding="UTF-8"?>.
+//
+// DocType用于查找文档类型声明,即<!DOCTYPE ...>,ParsedDocType返回解析之后的结构化表示.
 type XMLDocument interface {
 	XMLNode
+
+	RootElement() XMLElement
+	SetRootElement(elem XMLElement) XMLElement
+
+	Declaration() *XMLDeclaration
+	SetDeclaration(decl XMLDeclaration) XMLProcInst
+
+	DocType() XMLDirective
+	ParsedDocType() (*DocType, error)
+}
+
+// XMLDeclaration 是XML声明<?xml version="1.0" encoding="UTF-8" standalone="yes"?>解析之后的结果,
+// 声明中不存在的字段为空字符串
+type XMLDeclaration struct {
+	Version    string
+	Encoding   string
+	Standalone string
 }
 
 // XMLVisitor XML文档访问器,常用于遍历文档或者格式化输出XML文档
@@ -159,6 +184,26 @@ type XMLHandle interface {
 	PrevElement(name string) XMLHandle
 	NextElement(name string) XMLHandle
 
+	// EnsureChild、EnsurePath在子元素不存在时创建它,SetAttr、SetText返回自己以便链式调用,
+	// 当前节点不是元素或者文档时这些接口什么也不做,返回空的XMLHandle
+	EnsureChild(name string) XMLHandle
+	EnsurePath(path string) XMLHandle
+	SetAttr(name string, value string) XMLHandle
+	SetText(text string) XMLHandle
+	Attr(name string, def string) string
+
+	// ChildElement、Path用于一次定位到深层的节点,Attribute、Text以及带类型的版本在节点或者值不存在时返回缺省值
+	ChildElement(name string, index int) XMLHandle
+	Path(path string) XMLHandle
+	Attribute(name string, def string) string
+	IntAttribute(name string, def int) int
+	FloatAttribute(name string, def float64) float64
+	BoolAttribute(name string, def bool) bool
+	Text(def string) string
+	IntText(def int) int
+	FloatText(def float64) float64
+	BoolText(def bool) bool
+
 	ToNode() XMLNode
 	ToElement() XMLElement
 	ToText() XMLText
@@ -351,6 +396,10 @@ func (n *xmlNodeImpl) Split() XMLNode {
 }
 
 func (n *xmlNodeImpl) unlink(child XMLNode) {
+	if idx := indexOf(n.implobj); nil != idx {
+		idx.removeTree(child)
+	}
+
 	//if child.impl() == n.firstChild {
 	if child == n.firstChild {
 		n.firstChild = n.firstChild.Next()
@@ -392,6 +441,9 @@ func (n *xmlNodeImpl) InsertEndChild(addThis XMLNode) XMLNode {
 
 	addThis.setParent(n.implobj)
 	addThis.setDocument(n.document)
+	if idx := indexOf(n.implobj); nil != idx {
+		idx.addTree(addThis)
+	}
 	return addThis
 }
 
@@ -413,6 +465,9 @@ func (n *xmlNodeImpl) InsertFirstChild(addThis XMLNode) XMLNode {
 
 	addThis.setParent(n.implobj)
 	addThis.setDocument(n.document)
+	if idx := indexOf(n.implobj); nil != idx {
+		idx.addTree(addThis)
+	}
 	return addThis
 }
 
@@ -423,7 +478,7 @@ func (n *xmlNodeImpl) insertAfterChild(afterThis XMLNode, addThis XMLNode) XMLNo
 	// }
 
 	if afterThis.Next() == nil {
-		return n.InsertEndChild(addThis)
+		return n.implobj.InsertEndChild(addThis)
 	}
 
 	addThis.Split()
@@ -434,6 +489,9 @@ func (n *xmlNodeImpl) insertAfterChild(afterThis XMLNode, addThis XMLNode) XMLNo
 	afterThis.setNext(addThis)
 	addThis.setParent(n.implobj)
 	addThis.setDocument(n.document)
+	if idx := indexOf(n.implobj); nil != idx {
+		idx.addTree(addThis)
+	}
 
 	return addThis
 }
@@ -445,7 +503,7 @@ func (n *xmlNodeImpl) insertBeforeChild(beforeThis XMLNode, addThis XMLNode) XML
 	// }
 
 	if beforeThis.Prev() == nil {
-		return n.InsertFirstChild(addThis)
+		return n.implobj.InsertFirstChild(addThis)
 	}
 
 	addThis.Split()
@@ -456,6 +514,9 @@ func (n *xmlNodeImpl) insertBeforeChild(beforeThis XMLNode, addThis XMLNode) XML
 	beforeThis.setPrev(addThis)
 	addThis.setParent(n.implobj)
 	addThis.setDocument(n.document)
+	if idx := indexOf(n.implobj); nil != idx {
+		idx.addTree(addThis)
+	}
 
 	return addThis
 }
@@ -477,19 +538,28 @@ func (n *xmlNodeImpl) InsertFront(addThis XMLNode) XMLNode {
 }
 
 func (n *xmlNodeImpl) InsertElementFront(name string) XMLElement {
-	return n.InsertFront(NewElement(name)).ToElement()
+	return toElement(n.implobj.InsertFront(NewElement(name)))
 }
 
 func (n *xmlNodeImpl) InsertElementBack(name string) XMLElement {
-	return n.InsertBack(NewElement(name)).ToElement()
+	return toElement(n.implobj.InsertBack(NewElement(name)))
 }
 
 func (n *xmlNodeImpl) InsertElementEndChild(name string) XMLElement {
-	return n.InsertEndChild(NewElement(name)).ToElement()
+	return toElement(n.implobj.InsertEndChild(NewElement(name)))
 }
 
 func (n *xmlNodeImpl) InsertElementFirstChild(name string) XMLElement {
-	return n.InsertFirstChild(NewElement(name)).ToElement()
+	return toElement(n.implobj.InsertFirstChild(NewElement(name)))
+}
+
+// toElement 插入失败时节点为nil,此时直接返回nil
+func toElement(node XMLNode) XMLElement {
+	if nil == node {
+		return nil
+	}
+
+	return node.ToElement()
 }
 
 func (n *xmlNodeImpl) DeleteChildren() {
@@ -511,12 +581,14 @@ func (n *xmlNodeImpl) DeleteChild(node XMLNode) {
 
 // ------------------------------------------------------------------
 
+// attrIndexThreshold 属性个数超过这个值时才为属性建立名字索引,属性少时顺序查找,节省创建元素时的内存分配
+const attrIndexThreshold = 8
+
 type xmlElementImpl struct {
 	xmlNodeImpl
 
-	// rootAttribute XMLAttribute
-	attrlist *list.List
-	attrsmap map[string]*list.Element
+	attrs    []*xmlAttributeImpl // 按照插入顺序保存的属性
+	attrsmap map[string]int      // 属性名到attrs下标的索引,属性个数超过attrIndexThreshold时在查找时才建立
 }
 
 func (e *xmlElementImpl) ToElement() XMLElement {
@@ -526,10 +598,13 @@ func (e *xmlElementImpl) ToElement() XMLElement {
 func (e *xmlElementImpl) Accept(visitor XMLVisitor) bool {
 
 	if visitor.VisitEnterElement(e) {
-		for node := e.FirstChild(); nil != node; node = node.Next() {
+		// 先取得下一个节点,visitor删除或者移走当前节点不影响遍历
+		for node := e.FirstChild(); nil != node; {
+			next := node.Next()
 			if !node.Accept(visitor) {
 				break
 			}
+			node = next
 		}
 	}
 
@@ -544,50 +619,115 @@ func (e *xmlElementImpl) SetName(name string) {
 	e.SetValue(name)
 }
 
+// SetValue 修改元素名,同时更新文档的名字索引
+func (e *xmlElementImpl) SetValue(name string) {
+	idx := indexOf(e)
+	if nil != idx {
+		idx.removeName(e)
+	}
+
+	e.value = name
+	if nil != idx {
+		idx.addName(e)
+	}
+}
+
+// findAttribute 返回名为name的属性在attrs中的下标,不存在时返回-1
+func (e *xmlElementImpl) findAttribute(name string) int {
+	if len(e.attrs) <= attrIndexThreshold {
+		for i, attr := range e.attrs {
+			if attr.name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if nil == e.attrsmap {
+		e.attrsmap = make(map[string]int, len(e.attrs))
+		for i, attr := range e.attrs {
+			e.attrsmap[attr.name] = i
+		}
+	}
+
+	if i, ok := e.attrsmap[name]; ok {
+		return i
+	}
+	return -1
+}
+
 func (e *xmlElementImpl) FindAttribute(name string) XMLAttribute {
-	elem, ok := e.attrsmap[name]
-	if !ok {
+	i := e.findAttribute(name)
+	if i < 0 {
 		return nil
 	}
 
-	return elem.Value.(*xmlAttributeImpl)
+	return e.attrs[i]
 }
 
 func (e *xmlElementImpl) AttributeCount() int {
-	return len(e.attrsmap)
+	return len(e.attrs)
 }
 
 func (e *xmlElementImpl) Attribute(name string, def string) string {
-	attr, ok := e.attrsmap[name]
-	if !ok {
+	i := e.findAttribute(name)
+	if i < 0 {
 		return def
 	}
 
-	return attr.Value.(*xmlAttributeImpl).Value()
+	return e.attrs[i].Value()
 }
 
 func (e *xmlElementImpl) SetAttribute(name string, value string) XMLAttribute {
-	elem, ok := e.attrsmap[name]
-	if ok {
-		elem.Value.(*xmlAttributeImpl).SetValue(value)
-		return elem.Value.(*xmlAttributeImpl)
+	idx := indexOf(e)
+	if nil != idx {
+		idx.removeID(e)
+	}
+
+	var attr *xmlAttributeImpl
+	if i := e.findAttribute(name); i >= 0 {
+		attr = e.attrs[i]
+		attr.SetValue(value)
+	} else {
+		attr = newAttribute(name, value)
+		e.attrs = append(e.attrs, attr)
+		if nil != e.attrsmap {
+			e.attrsmap[name] = len(e.attrs) - 1
+		}
 	}
 
-	attr := newAttribute(name, value)
-	e.attrsmap[name] = e.attrlist.PushBack(attr)
+	if nil != idx {
+		idx.addID(e)
+	}
 	return attr
 }
 
 func (e *xmlElementImpl) DeleteAttribute(name string) XMLAttribute {
-	elem, ok := e.attrsmap[name]
-	if !ok {
+	i := e.findAttribute(name)
+	if i < 0 {
 		return nil
 	}
 
-	attr := elem.Value.(*xmlAttributeImpl)
+	attr := e.attrs[i]
+
+	idx := indexOf(e)
+	if nil != idx {
+		idx.removeID(e)
+	}
+
+	copy(e.attrs[i:], e.attrs[i+1:])
+	e.attrs[len(e.attrs)-1] = nil
+	e.attrs = e.attrs[:len(e.attrs)-1]
+	if nil != e.attrsmap {
+		delete(e.attrsmap, name)
+		for j := i; j < len(e.attrs); j++ {
+			e.attrsmap[e.attrs[j].name] = j
+		}
+	}
 
-	e.attrlist.Remove(elem)
-	delete(e.attrsmap, name)
+	if nil != idx {
+		idx.addID(e)
+	}
 	return attr
 }
 
@@ -609,18 +749,47 @@ func (e *xmlElementImpl) SetText(inText string) {
 }
 
 func (e *xmlElementImpl) ForeachAttribute(callback func(attribute XMLAttribute) int) int {
-	for elem := e.attrlist.Front(); nil != elem; elem = elem.Next() {
-		if ret := callback(elem.Value.(*xmlAttributeImpl)); 0 != ret {
+	for i := 0; i < len(e.attrs); i++ {
+		attr, next := e.attrs[i], (*xmlAttributeImpl)(nil)
+		if i+1 < len(e.attrs) {
+			next = e.attrs[i+1]
+		}
+
+		if ret := callback(attr); 0 != ret {
 			return ret
 		}
+
+		// 回调函数删除了当前或者之前的属性时,属性的下标会变化,从当前属性或者原来的下一个属性现在的位置继续
+		if (i < len(e.attrs)) && (e.attrs[i] == attr) {
+			continue
+		}
+
+		if j := e.findAttribute(attr.name); (j >= 0) && (e.attrs[j] == attr) {
+			i = j
+			continue
+		}
+
+		if nil == next {
+			break
+		}
+
+		j := e.findAttribute(next.name)
+		if (j < 0) || (e.attrs[j] != next) {
+			break
+		}
+		i = j - 1
 	}
 
 	return 0
 }
 
 func (e *xmlElementImpl) ClearAttributes() {
-	e.attrlist = list.New()
-	e.attrsmap = make(map[string]*list.Element)
+	if idx := indexOf(e); nil != idx {
+		idx.removeID(e)
+	}
+
+	e.attrs = nil
+	e.attrsmap = nil
 }
 
 // ------------------------------------------------------------------
@@ -668,10 +837,16 @@ func (p *xmlProcInstImpl) Instruction() string {
 	return p.instruction
 }
 
+func (p *xmlProcInstImpl) SetInstruction(inst string) {
+	p.instruction = inst
+}
+
 // ------------------------------------------------------------------
 
 type xmlDocumentImpl struct {
 	xmlNodeImpl
+
+	index *xmlIndex // 元素名和ID索引,没有启用索引时为nil
 }
 
 func (d *xmlDocumentImpl) ToDocument() XMLDocument {
@@ -681,16 +856,192 @@ func (d *xmlDocumentImpl) ToDocument() XMLDocument {
 func (d *xmlDocumentImpl) Accept(visitor XMLVisitor) bool {
 
 	if visitor.VisitEnterDocument(d) {
-		for node := d.FirstChild(); nil != node; node = node.Next() {
+		// 先取得下一个节点,visitor删除或者移走当前节点不影响遍历
+		for node := d.FirstChild(); nil != node; {
+			next := node.Next()
 			if !node.Accept(visitor) {
 				break
 			}
+			node = next
 		}
 	}
 
 	return visitor.VisitExitDocument(d)
 }
 
+// acceptChild 检查addThis能否直接插入到文档之下:文档只能有一个根元素,文本不能出现在根元素之外
+func (d *xmlDocumentImpl) acceptChild(addThis XMLNode) bool {
+	if (nil != addThis.ToText()) || (nil != addThis.ToDocument()) {
+		return false
+	}
+
+	if elem := addThis.ToElement(); nil != elem {
+		root := d.RootElement()
+		return (nil == root) || (root == elem)
+	}
+
+	return true
+}
+
+func (d *xmlDocumentImpl) InsertEndChild(addThis XMLNode) XMLNode {
+	if !d.acceptChild(addThis) {
+		return nil
+	}
+
+	return d.xmlNodeImpl.InsertEndChild(addThis)
+}
+
+func (d *xmlDocumentImpl) InsertFirstChild(addThis XMLNode) XMLNode {
+	if !d.acceptChild(addThis) {
+		return nil
+	}
+
+	return d.xmlNodeImpl.InsertFirstChild(addThis)
+}
+
+func (d *xmlDocumentImpl) insertAfterChild(afterThis XMLNode, addThis XMLNode) XMLNode {
+	if !d.acceptChild(addThis) {
+		return nil
+	}
+
+	return d.xmlNodeImpl.insertAfterChild(afterThis, addThis)
+}
+
+func (d *xmlDocumentImpl) insertBeforeChild(beforeThis XMLNode, addThis XMLNode) XMLNode {
+	if !d.acceptChild(addThis) {
+		return nil
+	}
+
+	return d.xmlNodeImpl.insertBeforeChild(beforeThis, addThis)
+}
+
+func (d *xmlDocumentImpl) RootElement() XMLElement {
+	return d.FirstChildElement("")
+}
+
+func (d *xmlDocumentImpl) SetRootElement(elem XMLElement) XMLElement {
+	root := d.RootElement()
+	if nil == root {
+		return toElement(d.InsertEndChild(elem))
+	}
+
+	if root == elem {
+		return elem
+	}
+
+	// 新的根元素放在原来的根元素的位置上
+	prev := root.Prev()
+	root.Split()
+	if nil == prev {
+		return toElement(d.InsertFirstChild(elem))
+	}
+
+	return toElement(prev.InsertBack(elem))
+}
+
+func (d *xmlDocumentImpl) declarationNode() XMLProcInst {
+	for node := d.FirstChild(); nil != node; node = node.Next() {
+		if procInst := node.ToProcInst(); (nil != procInst) && ("xml" == procInst.Target()) {
+			return procInst
+		}
+	}
+
+	return nil
+}
+
+func (d *xmlDocumentImpl) Declaration() *XMLDeclaration {
+	procInst := d.declarationNode()
+	if nil == procInst {
+		return nil
+	}
+
+	decl := new(XMLDeclaration)
+	for _, attr := range parsePseudoAttributes(procInst.Instruction()) {
+		switch attr.name {
+		case "version":
+			decl.Version = attr.value
+		case "encoding":
+			decl.Encoding = attr.value
+		case "standalone":
+			decl.Standalone = attr.value
+		}
+	}
+
+	return decl
+}
+
+func (d *xmlDocumentImpl) SetDeclaration(decl XMLDeclaration) XMLProcInst {
+	version := decl.Version
+	if "" == version {
+		version = "1.0"
+	}
+
+	inst := `version="` + version + `"`
+	if "" != decl.Encoding {
+		inst += ` encoding="` + decl.Encoding + `"`
+	}
+	if "" != decl.Standalone {
+		inst += ` standalone="` + decl.Standalone + `"`
+	}
+
+	procInst := d.declarationNode()
+	if nil == procInst {
+		procInst = NewProcInst("xml", inst)
+		d.InsertFirstChild(procInst)
+		return procInst
+	}
+
+	procInst.SetInstruction(inst)
+	return procInst
+}
+
+func (d *xmlDocumentImpl) DocType() XMLDirective {
+	for node := d.FirstChild(); nil != node; node = node.Next() {
+		directive := node.ToDirective()
+		if (nil != directive) && strings.HasPrefix(strings.TrimSpace(directive.Value()), "DOCTYPE") {
+			return directive
+		}
+	}
+
+	return nil
+}
+
+// ParsedDocType 返回解析之后的文档类型声明,文档没有文档类型声明时返回nil
+func (d *xmlDocumentImpl) ParsedDocType() (*DocType, error) {
+	directive := d.DocType()
+	if nil == directive {
+		return nil, nil
+	}
+
+	return ParseDocType(directive.Value())
+}
+
+// parsePseudoAttributes 解析处理指令中形如name="value"的伪属性,例如XML声明中的version、encoding
+func parsePseudoAttributes(inst string) []xmlAttributeImpl {
+	var attrs []xmlAttributeImpl
+	for {
+		inst = strings.TrimSpace(inst)
+		eq := strings.IndexByte(inst, '=')
+		if eq <= 0 {
+			return attrs
+		}
+
+		name := strings.TrimSpace(inst[:eq])
+		inst = strings.TrimSpace(inst[eq+1:])
+		if (0 == len(inst)) || (('"' != inst[0]) && ('\'' != inst[0])) {
+			return attrs
+		}
+
+		end := strings.IndexByte(inst[1:], inst[0])
+		if end < 0 {
+			return attrs
+		}
+
+		attrs = append(attrs, xmlAttributeImpl{name: name, value: inst[1 : end+1]})
+		inst = inst[end+2:]
+	}
+}
+
 // ------------------------------------------------------------------
 
 type xmlTextImpl struct {
@@ -748,8 +1099,6 @@ func NewElement(name string) XMLElement {
 	node := new(xmlElementImpl)
 	node.implobj = node
 	node.value = name
-	node.attrsmap = make(map[string]*list.Element)
-	node.attrlist = list.New()
 	return node
 }
 
@@ -787,101 +1136,19 @@ func NewDocument() XMLDocument {
 	return doc
 }
 
-type context struct {
-	doc           XMLDocument
-	parent        XMLNode
-	rootElemExist bool
-}
-
-func handleStartElement(startElement xml.StartElement, ctx *context) error {
-	//startElement := token.(xml.StartElement)
-
-	// 一个XML文档只允许有唯一一个根节点
-	if ctx.doc == ctx.parent {
-		if ctx.rootElemExist {
-			return errors.New("Root element has been exist:" + startElement.Name.Local)
-		}
-
-		// 标记一下根节点已经存在了
-		ctx.rootElemExist = true
-	}
-
-	node := NewElement(startElement.Name.Local)
-	for _, item := range startElement.Attr {
-		if nil != node.FindAttribute(item.Name.Local) {
-			return errors.New("Attributes have the same name:" + item.Name.Local)
-		}
-		node.SetAttribute(item.Name.Local, item.Value)
-	}
-	ctx.parent.InsertEndChild(node)
-	ctx.parent = node
-
-	return nil
-}
-
-func handleCharData(charData xml.CharData, ctx *context) error {
-	shortCharData := bytes.TrimSpace(charData)
-	if (nil != shortCharData) && (len(shortCharData) > 0) {
-		if ctx.doc == ctx.parent {
-			return errors.New("Text should be in the element")
-		}
-
-		node := NewText(string(charData))
-		ctx.parent.InsertEndChild(node)
-	}
-
-	return nil
-}
-
 // LoadDocument 从rd流中读取XML码流并构建成XMLDocument对象
 func LoadDocument(rd io.Reader) (XMLDocument, error) {
+	return LoadDocumentWithOptions(rd, ParseOptions{})
+}
 
-	// 创建一个context
-	ctx := new(context)
-	ctx.doc = NewDocument()
-	ctx.parent = ctx.doc
-	ctx.rootElemExist = false
-
-	// 创建一个decoder
-	decoder := xml.NewDecoder(rd)
-	var token xml.Token
-	var err error
-
-	for token, err = decoder.Token(); nil == err; token, err = decoder.Token() {
-		switch token.(type) {
-		case xml.StartElement:
-			err := handleStartElement(token.(xml.StartElement), ctx)
-			if nil != err {
-				return nil, err
-			}
-		case xml.EndElement:
-			ctx.parent = ctx.parent.Parent()
-		case xml.Comment:
-			ctx.parent.InsertEndChild(NewComment(string(token.(xml.Comment))))
-		case xml.Directive:
-			ctx.parent.InsertEndChild(NewDirective(string(token.(xml.Directive))))
-		case xml.ProcInst:
-			procInst := token.(xml.ProcInst)
-			ctx.parent.InsertEndChild(NewProcInst(procInst.Target, string(procInst.Inst)))
-		case xml.CharData:
-			if err := handleCharData(token.(xml.CharData), ctx); nil != err {
-				return nil, err
-			}
-		default:
-			return nil, errors.New("Unsupported token type")
-		}
-	}
-
-	if (nil == err) || (io.EOF == err) {
-		// 不能是空文档
-		if nil == ctx.doc.FirstChildElement("") {
-			return nil, errors.New("XML document missing the root element")
-		}
-
-		return ctx.doc, nil
+// LoadDocumentWithOptions 与LoadDocument相同,但是可以通过options指定解析选项
+func LoadDocumentWithOptions(rd io.Reader, options ParseOptions) (XMLDocument, error) {
+	builder := newDocumentBuilder()
+	if err := Parse(rd, builder, options); nil != err {
+		return nil, err
 	}
 
-	return nil, err
+	return builder.doc, nil
 }
 
 func LoadDocumentFromFile(name string) (XMLDocument, error) {
@@ -895,13 +1162,27 @@ func LoadDocumentFromFile(name string) (XMLDocument, error) {
 }
 
 // SaveDocumentToFile Print the xml-dom objects to the writer.
+//
+// options.CheckWellFormed为true时输出之前会用CheckWellFormed检查文档,文档无法输出成格式良好的XML时不输出任何内容,并返回第一个问题.
 func SaveDocument(doc XMLDocument, writer io.Writer, options PrintOptions) error {
+	if options.CheckWellFormed {
+		if errs := CheckWellFormed(doc); 0 != len(errs) {
+			return errs[0]
+		}
+	}
+
 	doc.Accept(NewSimplePrinter(writer, options))
 	return nil
 }
 
 // SaveDocumentToFile Print the xml-dom objects to the file.
 func SaveDocumentToFile(doc XMLDocument, name string, options PrintOptions) error {
+	if options.CheckWellFormed {
+		if errs := CheckWellFormed(doc); 0 != len(errs) {
+			return errs[0]
+		}
+	}
+
 	file, err := os.Create(name)
 	if nil != err {
 		return err
@@ -1010,6 +1291,9 @@ type xmlSimplePrinter struct {
 type PrintOptions struct {
 	Indent        []byte // 缩进前缀,只允许填写tab或者空白,如果Indent长度为0表示折行但是不缩进,如果Indent为null表示不折行
 	TextWrapWidth int    // 超过多长才强制换行
+
+	// CheckWellFormed 为true时SaveDocument和SaveDocumentToFile在输出之前检查文档是否能输出成格式良好的XML,NewSimplePrinter忽略这个选项
+	CheckWellFormed bool
 }
 
 var (
@@ -1127,7 +1411,7 @@ func (p *xmlSimplePrinter) VisitComment(node XMLComment) bool {
 func (p *xmlSimplePrinter) VisitDirective(node XMLDirective) bool {
 	p.indentSpace()
 	p.writer.Write([]byte("<!"))
-	EscapeText(p.writer, []byte(node.Value()))
+	p.writer.Write([]byte(node.Value())) // 指令原样输出,转义会破坏内部子集中的'<'
 	p.writer.Write([]byte(">"))
 	return true
 }
@@ -1217,6 +1501,201 @@ func (h *xmlHandleImpl) NextElement(name string) XMLHandle {
 	return NewHandle(h.node.NextElement(name))
 }
 
+// EnsureChild 返回名为name的第一个子元素,不存在时在最后创建一个.
+// name不是合法的元素名(例如"."、"..")或者文档已经有了其它名字的根元素时返回空的XMLHandle
+func (h *xmlHandleImpl) EnsureChild(name string) XMLHandle {
+	if ((nil == h.ToElement()) && (nil == h.ToDocument())) || !isName(name) {
+		return NewHandle(nil)
+	}
+
+	if elem := h.node.FirstChildElement(name); nil != elem {
+		return NewHandle(elem)
+	}
+
+	return NewHandle(h.node.InsertElementEndChild(name))
+}
+
+// EnsurePath 沿着以"/"分隔的元素名逐级调用EnsureChild,例如EnsurePath("server/http").
+// 与Path一样,以"/"开头时从文档开始,当前节点不在文档中时返回空的XMLHandle
+func (h *xmlHandleImpl) EnsurePath(path string) XMLHandle {
+	var handle XMLHandle = h
+	if strings.HasPrefix(path, "/") {
+		handle = h.document()
+	}
+
+	for _, name := range strings.Split(path, "/") {
+		if "" != name {
+			handle = handle.EnsureChild(name)
+		}
+	}
+	return handle
+}
+
+// SetAttr 设置当前元素的属性
+func (h *xmlHandleImpl) SetAttr(name string, value string) XMLHandle {
+	if nil == h.ToElement() {
+		return NewHandle(nil)
+	}
+
+	h.node.ToElement().SetAttribute(name, value)
+	return h
+}
+
+// SetText 设置当前元素的文本
+func (h *xmlHandleImpl) SetText(text string) XMLHandle {
+	if nil == h.ToElement() {
+		return NewHandle(nil)
+	}
+
+	h.node.ToElement().SetText(text)
+	return h
+}
+
+// Attr 返回当前元素的属性值,当前节点不是元素或者属性不存在时返回def
+func (h *xmlHandleImpl) Attr(name string, def string) string {
+	if nil == h.ToElement() {
+		return def
+	}
+
+	return h.node.ToElement().Attribute(name, def)
+}
+
+// ChildElement 返回名为name的第index个子元素,index从0开始,name为空时匹配任意元素
+func (h *xmlHandleImpl) ChildElement(name string, index int) XMLHandle {
+	if (nil == h.node) || (index < 0) {
+		return NewHandle(nil)
+	}
+
+	elem := h.node.FirstChildElement(name)
+	for ; (nil != elem) && (index > 0); index-- {
+		elem = elem.NextElement(name)
+	}
+
+	if nil == elem {
+		return NewHandle(nil)
+	}
+	return NewHandle(elem)
+}
+
+// Path 沿着以"/"分隔的路径查找元素,例如Path("books/book[2]/name").
+// 每一级是元素名或者表示任意元素的"*",可以带从1开始的序号;".."表示父节点,"."表示当前节点;以"/"开头时从文档开始查找.
+// 路径格式错误或者元素不存在时返回空的XMLHandle
+func (h *xmlHandleImpl) Path(path string) XMLHandle {
+	if nil == h.node {
+		return h
+	}
+
+	var handle XMLHandle = h
+	if strings.HasPrefix(path, "/") {
+		handle = h.document()
+	}
+
+	for _, step := range strings.Split(path, "/") {
+		index := 1
+		if i := strings.IndexByte(step, '['); (i >= 0) && strings.HasSuffix(step, "]") {
+			n, err := strconv.Atoi(step[i+1 : len(step)-1])
+			if (nil != err) || (n < 1) {
+				return NewHandle(nil)
+			}
+			step, index = step[:i], n
+		}
+
+		switch step {
+		case "", ".":
+		case "..":
+			handle = handle.Parent()
+		case "*":
+			handle = handle.ChildElement("", index-1)
+		default:
+			handle = handle.ChildElement(step, index-1)
+		}
+	}
+
+	return handle
+}
+
+// document 返回当前节点所在的文档,当前节点不在文档中时返回空的XMLHandle
+func (h *xmlHandleImpl) document() XMLHandle {
+	if nil == h.node {
+		return h
+	}
+
+	top := h.node
+	for nil != top.Parent() {
+		top = top.Parent()
+	}
+
+	if nil == top.ToDocument() {
+		return NewHandle(nil)
+	}
+	return NewHandle(top)
+}
+
+// Attribute 与Attr相同,返回当前元素的属性值,当前节点不是元素或者属性不存在时返回def
+func (h *xmlHandleImpl) Attribute(name string, def string) string {
+	return h.Attr(name, def)
+}
+
+// IntAttribute 返回整数类型的属性值,属性不存在或者无法转换时返回def
+func (h *xmlHandleImpl) IntAttribute(name string, def int) int {
+	return handleInt(h.Attr(name, ""), def)
+}
+
+// FloatAttribute 返回浮点数类型的属性值,属性不存在或者无法转换时返回def
+func (h *xmlHandleImpl) FloatAttribute(name string, def float64) float64 {
+	return handleFloat(h.Attr(name, ""), def)
+}
+
+// BoolAttribute 返回布尔类型的属性值,属性不存在或者无法转换时返回def
+func (h *xmlHandleImpl) BoolAttribute(name string, def bool) bool {
+	return handleBool(h.Attr(name, ""), def)
+}
+
+// Text 返回当前元素的文本,当前节点不是元素或者元素没有文本时返回def
+func (h *xmlHandleImpl) Text(def string) string {
+	if (nil == h.ToElement()) || (nil == h.node.FirstChild()) || (nil == h.node.FirstChild().ToText()) {
+		return def
+	}
+
+	return h.node.ToElement().Text()
+}
+
+// IntText 返回整数类型的文本,没有文本或者无法转换时返回def
+func (h *xmlHandleImpl) IntText(def int) int {
+	return handleInt(h.Text(""), def)
+}
+
+// FloatText 返回浮点数类型的文本,没有文本或者无法转换时返回def
+func (h *xmlHandleImpl) FloatText(def float64) float64 {
+	return handleFloat(h.Text(""), def)
+}
+
+// BoolText 返回布尔类型的文本,没有文本或者无法转换时返回def
+func (h *xmlHandleImpl) BoolText(def bool) bool {
+	return handleBool(h.Text(""), def)
+}
+
+func handleInt(value string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(value)); nil == err {
+		return n
+	}
+	return def
+}
+
+func handleFloat(value string, def float64) float64 {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); nil == err {
+		return f
+	}
+	return def
+}
+
+func handleBool(value string, def bool) bool {
+	if b, err := strconv.ParseBool(strings.TrimSpace(value)); nil == err {
+		return b
+	}
+	return def
+}
+
 func (h *xmlHandleImpl) ToNode() XMLNode {
 	return h.node
 }
@@ -1372,6 +1851,147 @@ func EscapeText(w io.Writer, s []byte) error {
 	return nil
 }
 
+// isNameStartChar 判断r能否作为XML名字的首字符,参见XML规范的NameStartChar产生式
+func isNameStartChar(r rune) bool {
+	return r == ':' ||
+		r >= 'A' && r <= 'Z' ||
+		r == '_' ||
+		r >= 'a' && r <= 'z' ||
+		r >= 0xC0 && r <= 0xD6 ||
+		r >= 0xD8 && r <= 0xF6 ||
+		r >= 0xF8 && r <= 0x2FF ||
+		r >= 0x370 && r <= 0x37D ||
+		r >= 0x37F && r <= 0x1FFF ||
+		r >= 0x200C && r <= 0x200D ||
+		r >= 0x2070 && r <= 0x218F ||
+		r >= 0x2C00 && r <= 0x2FEF ||
+		r >= 0x3001 && r <= 0xD7FF ||
+		r >= 0xF900 && r <= 0xFDCF ||
+		r >= 0xFDF0 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0xEFFFF
+}
+
+// isNameChar 判断r能否作为XML名字的后续字符,参见XML规范的NameChar产生式
+func isNameChar(r rune) bool {
+	return isNameStartChar(r) ||
+		r == '-' ||
+		r == '.' ||
+		r >= '0' && r <= '9' ||
+		r == 0xB7 ||
+		r >= 0x0300 && r <= 0x036F ||
+		r >= 0x203F && r <= 0x2040
+}
+
+// isNCNameStartChar 判断r是否可以作为不带冒号的名字(NCName)的首字符
+func isNCNameStartChar(r rune) bool {
+	return (':' != r) && isNameStartChar(r)
+}
+
+// isNCNameChar 判断r是否可以出现在不带冒号的名字(NCName)中
+func isNCNameChar(r rune) bool {
+	return (':' != r) && isNameChar(r)
+}
+
+// isName 判断s是否符合XML规范的Name产生式
+func isName(s string) bool {
+	if "" == s {
+		return false
+	}
+
+	for i, r := range s {
+		if (0 == i) && !isNameStartChar(r) {
+			return false
+		}
+
+		if !isNameChar(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isNmtoken 判断s是否符合XML规范的Nmtoken产生式
+func isNmtoken(s string) bool {
+	if "" == s {
+		return false
+	}
+
+	for _, r := range s {
+		if !isNameChar(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NodePath 返回节点在文档中的路径,格式与XPath一致,例如"/catalog/book[2]/name".
+// 只有存在同类型的兄弟节点时才会带上序号.不在文档中的节点返回的路径从其最顶层的祖先开始,并且不以'/'开头.
+func NodePath(node XMLNode) string {
+	if nil == node {
+		return ""
+	}
+
+	if nil != node.ToDocument() {
+		return "/"
+	}
+
+	step := pathStep(node)
+	sameKind := func(n XMLNode) bool {
+		return ("node()" == step) || (pathStep(n) == step)
+	}
+
+	parent := node.Parent()
+	if nil == parent {
+		return step
+	}
+
+	index := 1
+	for prev := node.Prev(); nil != prev; prev = prev.Prev() {
+		if sameKind(prev) {
+			index++
+		}
+	}
+
+	count := index
+	for next := node.Next(); nil != next; next = next.Next() {
+		if sameKind(next) {
+			count++
+		}
+	}
+
+	if count > 1 {
+		step += "[" + strconv.Itoa(index) + "]"
+	}
+
+	return joinPath(NodePath(parent), step)
+}
+
+// pathStep 返回节点在路径中不带序号的步骤,步骤相同的兄弟节点是同类节点,"node()"与所有兄弟节点同类
+func pathStep(node XMLNode) string {
+	switch {
+	case nil != node.ToElement():
+		return node.ToElement().Name()
+	case nil != node.ToText():
+		return "text()"
+	case nil != node.ToComment():
+		return "comment()"
+	case nil != node.ToProcInst():
+		return "processing-instruction()"
+	}
+	return "node()"
+}
+
+// joinPath 把步骤step连接到父节点的路径prefix后面
+func joinPath(prefix string, step string) string {
+	if "/" == prefix {
+		return "/" + step
+	}
+
+	return prefix + "/" + step
+}
+
 // Version 查询版本信息
 func Version() string {
 	return "1.2.0"
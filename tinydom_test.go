@@ -355,6 +355,57 @@ func Test_Element_属性基本功能(t *testing.T) {
 	expect(t, "修改属性值", "NewValue" == node.Attribute("attr1", "(default1)"))
 }
 
+func attributeNames(elem XMLElement) string {
+	var names []string
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		names = append(names, attribute.Name())
+		return 0
+	})
+	return strings.Join(names, " ")
+}
+
+func Test_Element_属性顺序(t *testing.T) {
+	elem := NewElement("node")
+	for i := 0; i < 12; i++ {
+		elem.SetAttribute(fmt.Sprintf("a%d", i), fmt.Sprintf("v%d", i))
+	}
+	expect(t, "超过阈值后查找", "v11" == elem.Attribute("a11", "") && "v0" == elem.Attribute("a0", ""))
+
+	elem.DeleteAttribute("a3")
+	elem.DeleteAttribute("a0")
+	elem.SetAttribute("a5", "x")
+	elem.SetAttribute("a3", "y")
+	expect(t, "删除之后保持插入顺序", "a1 a2 a4 a5 a6 a7 a8 a9 a10 a11 a3" == attributeNames(elem))
+	expect(t, "删除之后查找", ("x" == elem.Attribute("a5", "")) && ("y" == elem.Attribute("a3", "")) && (nil == elem.FindAttribute("a0")))
+	expect(t, "属性个数", 11 == elem.AttributeCount())
+
+	for i := 4; i < 12; i++ {
+		elem.DeleteAttribute(fmt.Sprintf("a%d", i))
+	}
+	elem.SetAttribute("b", "z")
+	expect(t, "低于阈值之后查找", ("a1 a2 a3 b" == attributeNames(elem)) && ("z" == elem.Attribute("b", "")))
+
+	elem.ClearAttributes()
+	expect(t, "清空属性", (0 == elem.AttributeCount()) && (nil == elem.FindAttribute("a1")))
+}
+
+func Test_Element_遍历时删除属性(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<node a="1" b="2" c="3" d="4"/>`))
+	elem := doc.RootElement()
+
+	var visited []string
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		visited = append(visited, attribute.Name())
+		if "b" == attribute.Name() {
+			elem.DeleteAttribute("b")
+			elem.DeleteAttribute("a")
+		}
+		return 0
+	})
+	expect(t, "删除当前和之前的属性不影响遍历", "a b c d" == strings.Join(visited, " "))
+	expect(t, "删除之后的属性", "c d" == attributeNames(elem))
+}
+
 func Test_ProcInst_基本功能测试(t *testing.T) {
 	xml := `<?xml version="1.0" encoding="UTF-8"?>
     <node attr1="value1" attr2="value2"></node>
@@ -591,7 +642,31 @@ func Test_Handle_基本功能测试_Parent(t *testing.T) {
 	expect(t, "返回值检测", nil != doc.FirstChild().Parent().ToDocument())
 }
 
-func Test_TODO_Document_通过修改文档破坏xml文档的有效性(t *testing.T) {
+func Test_Document_通过修改文档破坏xml文档的有效性(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<?xml version="1.0"?><root><a x="1"/><b>text</b></root>`))
+	expect(t, "修改之前是格式良好的", 0 == len(CheckWellFormed(doc)))
+
+	root := doc.RootElement()
+	root.FirstChildElement("a").SetName("my tag")
+	root.FirstChildElement("b").SetAttribute("a b", "1")
+	root.InsertEndChild(NewComment("a--b"))
+	root.InsertEndChild(NewProcInst("xml", `version="1.0"`))
+	root.InsertEndChild(NewText("bad\x01"))
+
+	errs := CheckWellFormed(doc)
+	expect(t, "问题个数", 5 == len(errs))
+	expect(t, "元素名", (root.FirstChild() == errs[0].Node) && strings.Contains(errs[0].Message, "my tag"))
+	expect(t, "属性名", "/root/b" == errs[1].Path)
+	expect(t, "注释", "/root/comment()" == errs[2].Path)
+	expect(t, "处理指令", strings.Contains(errs[3].Message, "reserved"))
+	expect(t, "非法字符", strings.Contains(errs[4].Message, "U+1"))
+
+	buf := bytes.NewBufferString("")
+	expect(t, "缺省不检查", (nil == SaveDocument(doc, buf, PrintStream)) && (0 != buf.Len()))
+
+	buf = bytes.NewBufferString("")
+	expect(t, "输出时报错", nil != SaveDocument(doc, buf, PrintOptions{CheckWellFormed: true}))
+	expect(t, "出错时不输出", 0 == buf.Len())
 }
 
 func Test_TODO_Document_各种dom树输出(t *testing.T) {
@@ -884,3 +959,236 @@ func Test_Attr_Order(t *testing.T) {
 	expect(t, "属性的顺序就是添加的顺序,不会应为key的不断变化而导致属性输出时,属性间的相对位置发生不断变化",
 	buf.String() == `<node attr5="55" attr2="22" attr3="33" attr4="44" attr6="66" attr9="99" attr=""/>`)
 }
+
+func Test_Document_RootElement(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<?xml version="1.0"?><!--c--><node/><!--d-->`))
+	expect(t, "读取根元素", "node" == doc.RootElement().Name())
+
+	old := doc.RootElement()
+	root := doc.SetRootElement(NewElement("newroot"))
+	expect(t, "替换根元素", (nil != root) && ("newroot" == doc.RootElement().Name()))
+	expect(t, "原来的根元素被拆除", nil == old.Parent())
+
+	buf := bytes.NewBufferString("")
+	doc.Accept(NewSimplePrinter(buf, PrintStream))
+	expect(t, "新的根元素在原来的位置上", `<?xml version="1.0"?><!--c--><newroot/><!--d-->` == buf.String())
+
+	expect(t, "设置同一个根元素", root == doc.SetRootElement(root))
+	expect(t, "空文档设置根元素", nil != NewDocument().SetRootElement(NewElement("a")))
+	expect(t, "空文档没有根元素", nil == NewDocument().RootElement())
+}
+
+func Test_Document_只能有一个根元素(t *testing.T) {
+	doc := NewDocument()
+	root := doc.InsertEndChild(NewElement("root"))
+	expect(t, "第一个根元素", nil != root)
+	expect(t, "InsertEndChild", nil == doc.InsertEndChild(NewElement("elem")))
+	expect(t, "InsertFirstChild", nil == doc.InsertFirstChild(NewElement("elem")))
+	expect(t, "InsertElementEndChild", nil == doc.InsertElementEndChild("elem"))
+	expect(t, "InsertElementFirstChild", nil == doc.InsertElementFirstChild("elem"))
+	expect(t, "InsertBack", nil == root.InsertBack(NewElement("elem")))
+	expect(t, "InsertFront", nil == root.InsertFront(NewElement("elem")))
+	expect(t, "InsertElementBack", nil == root.InsertElementBack("elem"))
+	expect(t, "InsertElementFront", nil == root.InsertElementFront("elem"))
+	expect(t, "文本不能出现在根元素之外", nil == doc.InsertEndChild(NewText("text")))
+	expect(t, "文档中仍然只有一个节点", (root == doc.FirstChild()) && (root == doc.LastChild()))
+
+	expect(t, "可以插入注释", nil != root.InsertFront(NewComment("comment")))
+	expect(t, "可以插入处理指令", nil != doc.InsertFirstChild(NewProcInst("pi", "inst")))
+	expect(t, "根元素可以移动位置", nil != doc.InsertFirstChild(root))
+	expect(t, "根元素可以移动位置", root == doc.FirstChild())
+
+	root.Split()
+	expect(t, "删除根元素之后可以插入新的根元素", nil != doc.InsertElementEndChild("elem"))
+}
+
+func Test_Document_Declaration(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<?xml version="1.0" encoding='utf-8' standalone="yes"?><node/>`))
+	decl := doc.Declaration()
+	expect(t, "读取声明", nil != decl)
+	expect(t, "version", "1.0" == decl.Version)
+	expect(t, "encoding", "utf-8" == decl.Encoding)
+	expect(t, "standalone", "yes" == decl.Standalone)
+
+	doc.SetDeclaration(XMLDeclaration{Encoding: "UTF-8"})
+	expect(t, "修改声明", "UTF-8" == doc.Declaration().Encoding)
+	expect(t, "修改声明", "" == doc.Declaration().Standalone)
+	expect(t, "修改声明", `version="1.0" encoding="UTF-8"` == doc.FirstChild().ToProcInst().Instruction())
+
+	doc, _ = LoadDocument(strings.NewReader(`<!--c--><node/>`))
+	expect(t, "没有声明", nil == doc.Declaration())
+	doc.SetDeclaration(XMLDeclaration{Version: "1.1"})
+	expect(t, "新增的声明在文档的最前面", "xml" == doc.FirstChild().ToProcInst().Target())
+	expect(t, "新增声明", "1.1" == doc.Declaration().Version)
+}
+
+func Test_Document_DocType(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<?xml version="1.0"?><!DOCTYPE poem SYSTEM "poem.dtd"><poem/>`))
+	doctype := doc.DocType()
+	expect(t, "读取文档类型声明", (nil != doctype) && (`DOCTYPE poem SYSTEM "poem.dtd"` == doctype.Value()))
+
+	doc, _ = LoadDocument(strings.NewReader(`<poem/>`))
+	expect(t, "没有文档类型声明", nil == doc.DocType())
+}
+
+func Test_NodePath(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c>x<!--1--><d/>y</c><b><?pi ?></b></a>`))
+	a := doc.FirstChildElement("a")
+	c := a.FirstChildElement("c")
+	expect(t, "文档", "/" == NodePath(doc))
+	expect(t, "根元素", "/a" == NodePath(a))
+	expect(t, "同名兄弟", "/a/b[2]" == NodePath(a.LastChildElement("b")))
+	expect(t, "唯一的元素不带序号", "/a/c/d" == NodePath(c.FirstChildElement("d")))
+	expect(t, "文本", "/a/c/text()[2]" == NodePath(c.LastChild()))
+	expect(t, "注释", "/a/c/comment()" == NodePath(c.FirstChild().Next()))
+	expect(t, "处理指令", "/a/b[2]/processing-instruction()" == NodePath(a.LastChild().FirstChild()))
+	expect(t, "不在文档中的节点", "e/f" == NodePath(NewElement("e").InsertEndChild(NewElement("f"))))
+}
+
+func Test_Accept_遍历时移动当前节点(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c/><b/><d/></a>`))
+	a := doc.FirstChildElement("a")
+	target := NewElement("target")
+
+	var names []string
+	doc.Accept(&DefaultVisitor{
+		EnterElement: func(elem XMLElement) bool {
+			names = append(names, elem.Name())
+			if "b" == elem.Name() {
+				target.InsertEndChild(elem)
+			}
+			return true
+		},
+	})
+
+	expect(t, "移走当前节点之后继续遍历原来的兄弟节点", "a b c b d" == strings.Join(names, " "))
+	expect(t, "节点被移走", (nil == a.FirstChildElement("b")) && (nil != target.LastChildElement("b")))
+}
+
+func Test_Handle_创建路径(t *testing.T) {
+	doc := NewDocument()
+	NewHandle(doc).EnsurePath("config/server/http").SetAttr("port", "80").SetAttr("host", "localhost")
+	NewHandle(doc).EnsurePath("/config/server/name").SetText("web")
+	NewHandle(doc).EnsurePath("config/server/http").SetAttr("port", "8080")
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出结果", nil == SaveDocument(doc, buf, PrintStream))
+	expect(t, "已经存在的元素不再创建", `<config><server><http port="8080" host="localhost"/><name>web</name></server></config>` == buf.String())
+
+	handle := NewHandle(doc)
+	expect(t, "读取属性", "8080" == handle.EnsurePath("config/server/http").Attr("port", "80"))
+	expect(t, "属性不存在时返回缺省值", "30" == handle.EnsurePath("config/server/http").Attr("timeout", "30"))
+	expect(t, "文档只能有一个根元素", nil == handle.EnsureChild("other").ToNode())
+	expect(t, "文本节点不能创建子元素", nil == handle.EnsurePath("config/server/name").FirstChild().EnsureChild("x").ToNode())
+
+	server := handle.Path("config/server")
+	expect(t, "以/开头时从文档开始", server.EnsurePath("/config/server/name").ToNode() == server.Path("/config/server/name").ToNode())
+	expect(t, "以/开头时不在当前节点下创建", nil == server.FirstChildElement("config").ToNode())
+	expect(t, "不在文档中的节点", nil == NewHandle(NewElement("a")).EnsurePath("/a/b").ToNode())
+
+	expect(t, "不合法的元素名", nil == server.EnsurePath("../x").ToNode())
+	expect(t, "不合法的元素名", nil == server.EnsureChild(".").ToNode())
+	expect(t, "不合法的元素名", nil == server.EnsureChild("a b").ToNode())
+	expect(t, "不合法的元素名", nil == server.EnsurePath("1x/y").ToNode())
+	expect(t, "没有创建不合法的元素", nil == server.ChildElement("", 2).ToNode())
+}
+
+func Test_Handle_空的创建(t *testing.T) {
+	handle := NewHandle(nil)
+	expect(t, "空的创建", nil == handle.EnsureChild("a").ToNode())
+	expect(t, "空的创建", nil == handle.EnsurePath("a/b").SetAttr("x", "1").SetText("y").ToNode())
+	expect(t, "空的属性", "def" == handle.Attr("x", "def"))
+}
+
+func Test_Handle_按序号和路径查找(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<books>
+		<book id="1" price="12.5" stock="true"><name>The Moon</name><pages>320</pages></book>
+		<magazine/>
+		<book id="2"><name>Go west</name><pages>x</pages></book>
+	</books>`))
+	handle := NewHandle(doc)
+
+	books := handle.FirstChildElement("books")
+	expect(t, "按序号查找", "2" == books.ChildElement("book", 1).Attribute("id", ""))
+	expect(t, "任意元素", "magazine" == books.ChildElement("", 1).ToElement().Name())
+	expect(t, "序号越界", nil == books.ChildElement("book", 2).ToNode())
+	expect(t, "负的序号", nil == books.ChildElement("book", -1).ToNode())
+
+	expect(t, "路径查找", "Go west" == handle.Path("books/book[2]/name").Text(""))
+	expect(t, "没有序号时是第一个", "The Moon" == handle.Path("books/book/name").Text(""))
+	expect(t, "任意元素", "magazine" == handle.Path("books/*[2]").ToElement().Name())
+	expect(t, "父节点和当前节点", "2" == handle.Path("books/book[2]/name/../.").Attribute("id", ""))
+	expect(t, "从文档开始", "320" == books.ChildElement("book", 1).Path("/books/book/pages").Text(""))
+	expect(t, "元素不存在", "def" == handle.Path("books/book[3]/name").Text("def"))
+	expect(t, "序号格式错误", nil == handle.Path("books/book[x]").ToNode())
+	expect(t, "序号从1开始", nil == handle.Path("books/book[0]").ToNode())
+	expect(t, "不在文档中的节点不能使用绝对路径", nil == NewHandle(NewElement("a")).Path("/a").ToNode())
+}
+
+func Test_Handle_带类型的读取(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<book id="1" price="12.5" stock="true" bad="x"><pages> 320 </pages><name/></book>`))
+	book := NewHandle(doc).FirstChildElement("book")
+
+	expect(t, "整数属性", 1 == book.IntAttribute("id", 0))
+	expect(t, "浮点数属性", 12.5 == book.FloatAttribute("price", 0))
+	expect(t, "布尔属性", book.BoolAttribute("stock", false))
+	expect(t, "无法转换时返回缺省值", (7 == book.IntAttribute("bad", 7)) && (1.5 == book.FloatAttribute("bad", 1.5)) && book.BoolAttribute("bad", true))
+	expect(t, "属性不存在时返回缺省值", (7 == book.IntAttribute("none", 7)) && ("def" == book.Attribute("none", "def")))
+
+	expect(t, "整数文本", 320 == book.Path("pages").IntText(0))
+	expect(t, "浮点数文本", 320 == book.Path("pages").FloatText(0))
+	expect(t, "没有文本时返回缺省值", ("def" == book.Path("name").Text("def")) && (5 == book.Path("name").IntText(5)))
+	expect(t, "无法转换时返回缺省值", book.Path("pages").BoolText(true))
+
+	empty := NewHandle(nil)
+	expect(t, "空的读取", (nil == empty.Path("a/b").ToNode()) && (nil == empty.ChildElement("a", 0).ToNode()))
+	expect(t, "空的读取", (3 == empty.IntAttribute("a", 3)) && (2.5 == empty.FloatText(2.5)) && empty.BoolText(true) && ("x" == empty.Text("x")))
+}
+
+func benchmarkAttributeXML(attrCount int) string {
+	buf := bytes.NewBufferString("<root>")
+	for i := 0; i < 1000; i++ {
+		buf.WriteString("<item")
+		for j := 0; j < attrCount; j++ {
+			fmt.Fprintf(buf, ` a%d="v%d"`, j, i)
+		}
+		buf.WriteString("/>")
+	}
+	buf.WriteString("</root>")
+	return buf.String()
+}
+
+func Benchmark_LoadDocument_Attributes(b *testing.B) {
+	text := benchmarkAttributeXML(6)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LoadDocument(strings.NewReader(text))
+	}
+}
+
+func Benchmark_NewElement_SetAttribute(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		elem := NewElement("item")
+		elem.SetAttribute("id", "1")
+		elem.SetAttribute("name", "item")
+		elem.SetAttribute("type", "text")
+		elem.SetAttribute("value", "x")
+	}
+}
+
+func benchmarkFindAttribute(b *testing.B, attrCount int) {
+	elem := NewElement("item")
+	for i := 0; i < attrCount; i++ {
+		elem.SetAttribute(fmt.Sprintf("a%d", i), "v")
+	}
+
+	name := fmt.Sprintf("a%d", attrCount-1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		elem.FindAttribute(name)
+	}
+}
+
+func Benchmark_FindAttribute_4(b *testing.B)  { benchmarkFindAttribute(b, 4) }
+func Benchmark_FindAttribute_32(b *testing.B) { benchmarkFindAttribute(b, 32) }
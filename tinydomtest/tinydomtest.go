@@ -0,0 +1,201 @@
+// Package tinydomtest 提供在单元测试中断言XML内容的辅助函数.
+//
+// 比较都是按照XML的语义进行的,格式、转义方式、全空白的文本和属性顺序的差异不影响结果,断言失败时输出两个文档之间的结构化差异.
+package tinydomtest
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tinyhubs/tinydom"
+)
+
+// Update 为true时AssertGolden把结果写入golden文件而不是与之比较.
+// 缺省对应-tinydomtest.update参数,被测试的包有自己的-update参数时可以在TestMain中令Update指向它.
+var Update = flag.Bool("tinydomtest.update", false, "rewrite the golden files of tinydomtest")
+
+// tbHelper 是Go 1.9加入testing.TB的Helper方法,老版本的Go中断言失败时不能把调用者标记为测试辅助函数
+type tbHelper interface {
+	Helper()
+}
+
+// compareOptions 是断言使用的比较选项,只比较XML的语义
+var compareOptions = tinydom.EqualOptions{IgnoreAttributeOrder: true, IgnoreWhitespace: true}
+
+// AssertXMLEqual 断言want和got是语义相同的XML,失败时输出第一个差异和完整的结构化差异.
+// want和got可以是XML字符串、[]byte或者tinydom.XMLNode,另一边是文档之外的节点时XML字符串表示一个元素.
+func AssertXMLEqual(t testing.TB, want interface{}, got interface{}) bool {
+	if h, ok := t.(tbHelper); ok {
+		h.Helper()
+	}
+
+	wantNode, err := toNode(want)
+	if nil != err {
+		t.Errorf("tinydomtest: invalid want: %v", err)
+		return false
+	}
+
+	gotNode, err := toNode(got)
+	if nil != err {
+		t.Errorf("tinydomtest: invalid got: %v", err)
+		return false
+	}
+
+	// XML字符串总是被解析成文档,另一边不是文档时与文档的根元素比较
+	if _, ok := want.(tinydom.XMLNode); !ok && (nil == gotNode.ToDocument()) {
+		wantNode = wantNode.ToDocument().RootElement()
+	}
+	if _, ok := got.(tinydom.XMLNode); !ok && (nil == wantNode.ToDocument()) {
+		gotNode = gotNode.ToDocument().RootElement()
+	}
+
+	equal, reason := tinydom.EqualExplain(wantNode, gotNode, compareOptions)
+	if !equal {
+		changes := tinydom.Diff(wantNode, gotNode, tinydom.DiffOptions{IgnoreWhitespace: true, IgnoreAttributeOrder: true})
+		t.Errorf("XML not equal: %s\n%s", reason, tinydom.FormatDiff(changes))
+	}
+	return equal
+}
+
+// AssertXPath 断言以node为上下文节点对XPath表达式expr求值的结果等于want,结果按照want的类型转换之后再比较:
+// string、float64、bool分别按照XPath的string()、number()、boolean()函数转换;
+// int在结果是节点集时比较节点的个数,否则按照number()转换;[]string比较节点集中每个节点的字符串值.
+func AssertXPath(t testing.TB, node tinydom.XMLNode, expr string, want interface{}) bool {
+	if h, ok := t.(tbHelper); ok {
+		h.Helper()
+	}
+
+	x, err := tinydom.CompileXPath(expr)
+	if nil != err {
+		t.Errorf("tinydomtest: invalid xpath %s: %v", expr, err)
+		return false
+	}
+
+	result, err := x.Evaluate(node, nil)
+	if nil != err {
+		t.Errorf("tinydomtest: evaluate %s: %v", expr, err)
+		return false
+	}
+
+	var got interface{}
+	switch want.(type) {
+	case string:
+		got = tinydom.XPathString(result)
+	case float64:
+		got = tinydom.XPathNumber(result)
+	case bool:
+		got = tinydom.XPathBoolean(result)
+	case int:
+		if nodes, ok := result.([]tinydom.XPathNode); ok {
+			got = len(nodes)
+		} else {
+			got = int(tinydom.XPathNumber(result))
+		}
+	case []string:
+		nodes, ok := result.([]tinydom.XPathNode)
+		if !ok {
+			t.Errorf("XPath %s: result is not a node-set: %v", expr, result)
+			return false
+		}
+
+		values := []string{}
+		for _, n := range nodes {
+			values = append(values, n.Value())
+		}
+		got = values
+	default:
+		t.Errorf("tinydomtest: unsupported type of want: %T", want)
+		return false
+	}
+
+	if !equalValue(want, got) {
+		t.Errorf("XPath %s: want %s, got %s", expr, describe(want), describe(got))
+		return false
+	}
+	return true
+}
+
+// AssertGolden 断言got与golden文件name的内容语义相同.
+// Update为true(运行测试时指定-tinydomtest.update参数)时会把got写入golden文件,用于生成或者更新期望的结果.
+func AssertGolden(t testing.TB, name string, got tinydom.XMLNode) bool {
+	if h, ok := t.(tbHelper); ok {
+		h.Helper()
+	}
+
+	if (nil != Update) && *Update {
+		// 格式化输出会改变文本的内容,所以golden文件不缩进
+		buf := bytes.NewBufferString("")
+		got.Accept(tinydom.NewSimplePrinter(buf, tinydom.PrintStream))
+		buf.WriteString("\n")
+
+		if err := os.MkdirAll(filepath.Dir(name), 0755); nil != err {
+			t.Errorf("tinydomtest: update golden file: %v", err)
+			return false
+		}
+
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0644); nil != err {
+			t.Errorf("tinydomtest: update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(name)
+	if nil != err {
+		t.Errorf("tinydomtest: read golden file: %v (run the test with -tinydomtest.update to create it)", err)
+		return false
+	}
+
+	if !AssertXMLEqual(t, want, got) {
+		t.Errorf("golden file %s does not match, run the test with -tinydomtest.update to rewrite it", name)
+		return false
+	}
+	return true
+}
+
+// toNode 把断言的参数转换成节点
+func toNode(v interface{}) (tinydom.XMLNode, error) {
+	switch v := v.(type) {
+	case tinydom.XMLNode:
+		return v, nil
+	case string:
+		return tinydom.LoadDocument(strings.NewReader(v))
+	case []byte:
+		return tinydom.LoadDocument(bytes.NewReader(v))
+	}
+	return nil, errors.New("unsupported type, must be string, []byte or tinydom.XMLNode")
+}
+
+func equalValue(want interface{}, got interface{}) bool {
+	if values, ok := want.([]string); ok {
+		return strings.Join(values, "\x00") == strings.Join(got.([]string), "\x00") && (len(values) == len(got.([]string)))
+	}
+	return want == got
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		var quoted []string
+		for _, s := range v {
+			quoted = append(quoted, strconv.Quote(s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
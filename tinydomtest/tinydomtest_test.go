@@ -0,0 +1,119 @@
+package tinydomtest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinyhubs/tinydom"
+)
+
+// update 与tinydomtest的标志不冲突,导入tinydomtest的包可以定义自己的-update参数
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func expect(t *testing.T, message string, result bool) {
+	if result {
+		return
+	}
+
+	fmt.Println(message)
+	t.Fail()
+}
+
+// recorder 记录断言失败的信息,不让被测试的断言使当前测试失败
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func Test_AssertXMLEqual_语义比较(t *testing.T) {
+	r := &recorder{TB: t}
+	expect(t, "格式和属性顺序不影响比较", AssertXMLEqual(r, `<a x="1" y="2"><b/></a>`, "<a y='2' x='1'>\n  <b/>\n</a>"))
+	expect(t, "没有错误信息", 0 == len(r.errors))
+
+	doc, _ := tinydom.LoadDocument(strings.NewReader(`<a><b port="8080"/></a>`))
+	expect(t, "内容不同", !AssertXMLEqual(r, []byte(`<a><b port="80"/></a>`), doc))
+	expect(t, "输出差异", (1 == len(r.errors)) && strings.Contains(r.errors[0], `/a/b/@port: "80" != "8080"`) &&
+		strings.Contains(r.errors[0], `attribute /a/b/@port: "80" -> "8080"`))
+
+	r = &recorder{TB: t}
+	expect(t, "不是XML", !AssertXMLEqual(r, `<a>`, `<a/>`))
+	expect(t, "不支持的类型", !AssertXMLEqual(r, `<a/>`, 1))
+	expect(t, "参数错误的信息", 2 == len(r.errors))
+}
+
+func Test_AssertXMLEqual_断言元素(t *testing.T) {
+	doc, _ := tinydom.LoadDocument(strings.NewReader(`<a><b x="1"><c/></b></a>`))
+	b := doc.RootElement().FirstChildElement("b")
+
+	r := &recorder{TB: t}
+	expect(t, "与元素比较", AssertXMLEqual(r, `<b x="1"><c/></b>`, b))
+	expect(t, "元素在前", AssertXMLEqual(r, b, []byte(`<b x="1"><c/></b>`)))
+	expect(t, "没有错误信息", 0 == len(r.errors))
+
+	expect(t, "元素不同", !AssertXMLEqual(r, `<b x="2"><c/></b>`, b))
+	expect(t, "差异信息", (1 == len(r.errors)) && strings.Contains(r.errors[0], `/b/@x: "2" != "1"`))
+	expect(t, "与文档比较时不取根元素", !AssertXMLEqual(r, `<b x="1"><c/></b>`, doc))
+}
+
+func Test_AssertXPath_各种类型(t *testing.T) {
+	doc, _ := tinydom.LoadDocument(strings.NewReader(`<books><book id="1">Go</book><book id="2">XML</book></books>`))
+
+	r := &recorder{TB: t}
+	expect(t, "字符串", AssertXPath(r, doc, "/books/book[2]", "XML"))
+	expect(t, "数字", AssertXPath(r, doc, "sum(//@id)", 3.0))
+	expect(t, "布尔值", AssertXPath(r, doc, "count(//book) = 2", true))
+	expect(t, "节点个数", AssertXPath(r, doc, "//book", 2))
+	expect(t, "节点的值", AssertXPath(r, doc, "//book/@id", []string{"1", "2"}))
+	expect(t, "没有错误信息", 0 == len(r.errors))
+
+	expect(t, "值不同", !AssertXPath(r, doc, "//book", []string{"Go"}))
+	expect(t, "值不同的信息", (1 == len(r.errors)) && (`XPath //book: want ["Go"], got ["Go", "XML"]` == r.errors[0]))
+	expect(t, "表达式错误", !AssertXPath(r, doc, "//[", "x"))
+	expect(t, "不是节点集", !AssertXPath(r, doc, "1", []string{}))
+}
+
+func Test_AssertGolden_更新和比较(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinydomtest")
+	expect(t, "创建临时目录", nil == err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "testdata", "books.xml")
+	doc, _ := tinydom.LoadDocument(strings.NewReader(`<books><book id="1">Go</book></books>`))
+
+	r := &recorder{TB: t}
+	expect(t, "golden文件不存在", !AssertGolden(r, name, doc))
+
+	flag.Set("tinydomtest.update", "true")
+	expect(t, "更新golden文件", AssertGolden(r, name, doc))
+	flag.Set("tinydomtest.update", "false")
+
+	data, err := ioutil.ReadFile(name)
+	expect(t, "golden文件已经生成", (nil == err) && strings.Contains(string(data), `<book id="1">Go</book>`))
+
+	r = &recorder{TB: t}
+	expect(t, "与golden文件相同", AssertGolden(r, name, doc))
+
+	doc.RootElement().FirstChildElement("book").SetText("XML")
+	expect(t, "与golden文件不同", !AssertGolden(r, name, doc))
+	expect(t, "错误信息", (2 == len(r.errors)) && strings.Contains(r.errors[1], "-tinydomtest.update"))
+
+	// 令Update指向被测试的包自己的-update参数
+	defer func(old *bool) { Update = old }(Update)
+	Update = update
+	*update = true
+	defer func() { *update = false }()
+	expect(t, "使用自己的标志更新golden文件", AssertGolden(r, name, doc))
+	data, _ = ioutil.ReadFile(name)
+	expect(t, "golden文件已经更新", strings.Contains(string(data), `<book id="1">XML</book>`))
+}
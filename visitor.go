@@ -0,0 +1,226 @@
+package tinydom
+
+import "strconv"
+
+// VisitContext 是ContextVisitor的回调函数得到的遍历上下文,只在回调函数执行期间有效,回调函数返回之后内容会变化
+type VisitContext struct {
+	Node      XMLNode   // 当前节点,VisitAttribute时是属性所在的元素
+	Depth     int       // 当前节点相对于起始节点的深度,起始节点为0
+	Index     int       // 当前节点是父节点的第几个子节点,从0开始,起始节点为0
+	Ancestors []XMLNode // 从起始节点到父节点的祖先节点,不包括当前节点
+
+	path string // 当前节点的路径,遍历子节点时逐级拼接
+}
+
+// Parent 返回当前节点的父节点,起始节点返回nil
+func (c *VisitContext) Parent() XMLNode {
+	if 0 == len(c.Ancestors) {
+		return nil
+	}
+	return c.Ancestors[len(c.Ancestors)-1]
+}
+
+// Path 返回当前节点在文档中的路径,格式与NodePath相同.
+// 路径中的序号按照开始遍历父节点的子节点时的兄弟节点计算,回调函数增删兄弟节点之后可能与NodePath不同.
+func (c *VisitContext) Path() string {
+	if ("" == c.path) && (nil != c.Node) {
+		return NodePath(c.Node)
+	}
+	return c.path
+}
+
+// ContextVisitor 与XMLVisitor相同,但是每个回调函数都能得到遍历的上下文,不需要自己维护深度和祖先的栈.
+// VisitAttribute在VisitEnterElement返回true之后、遍历子节点之前依次对每个属性调用,返回false时不再遍历剩下的属性,
+// 回调函数中可以修改或者删除属性.
+type ContextVisitor interface {
+	VisitEnterDocument(*VisitContext, XMLDocument) bool
+	VisitExitDocument(*VisitContext, XMLDocument) bool
+
+	VisitEnterElement(*VisitContext, XMLElement) bool
+	VisitExitElement(*VisitContext, XMLElement) bool
+	VisitAttribute(*VisitContext, XMLAttribute) bool
+
+	VisitProcInst(*VisitContext, XMLProcInst) bool
+	VisitText(*VisitContext, XMLText) bool
+	VisitComment(*VisitContext, XMLComment) bool
+	VisitDirective(*VisitContext, XMLDirective) bool
+}
+
+// AcceptContext 用visitor遍历node和它的后代,返回值的含义与XMLNode.Accept相同
+func AcceptContext(node XMLNode, visitor ContextVisitor) bool {
+	ctx := &VisitContext{path: NodePath(node)}
+	return acceptContext(ctx, node, visitor)
+}
+
+func acceptContext(ctx *VisitContext, node XMLNode, visitor ContextVisitor) bool {
+	ctx.Node = node
+	switch {
+	case nil != node.ToElement():
+		elem := node.ToElement()
+		if visitor.VisitEnterElement(ctx, elem) {
+			var attrs []XMLAttribute
+			elem.ForeachAttribute(func(attribute XMLAttribute) int {
+				attrs = append(attrs, attribute)
+				return 0
+			})
+
+			for _, attr := range attrs {
+				ctx.Node = elem
+				if !visitor.VisitAttribute(ctx, attr) {
+					break
+				}
+			}
+
+			acceptChildren(ctx, node, visitor)
+		}
+		return visitor.VisitExitElement(ctx, elem)
+	case nil != node.ToDocument():
+		if visitor.VisitEnterDocument(ctx, node.ToDocument()) {
+			acceptChildren(ctx, node, visitor)
+		}
+		return visitor.VisitExitDocument(ctx, node.ToDocument())
+	case nil != node.ToText():
+		return visitor.VisitText(ctx, node.ToText())
+	case nil != node.ToComment():
+		return visitor.VisitComment(ctx, node.ToComment())
+	case nil != node.ToProcInst():
+		return visitor.VisitProcInst(ctx, node.ToProcInst())
+	case nil != node.ToDirective():
+		return visitor.VisitDirective(ctx, node.ToDirective())
+	}
+	return true
+}
+
+// acceptChildren 遍历子节点,返回之后ctx恢复成node的上下文
+func acceptChildren(ctx *VisitContext, node XMLNode, visitor ContextVisitor) {
+	depth, index, path := ctx.Depth, ctx.Index, ctx.path
+	ctx.Ancestors = append(ctx.Ancestors, node)
+	ctx.Depth = depth + 1
+	ctx.Index = 0
+
+	// 先统计每一类子节点的个数,遍历时按照已经遇到的个数得到序号,不需要为每个子节点重新扫描兄弟节点
+	total, counts := 0, make(map[string]int)
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		counts[pathStep(child)]++
+		total++
+	}
+
+	// 先取得下一个节点,visitor删除或者移走当前节点不影响遍历
+	seen := make(map[string]int)
+	for child := node.FirstChild(); nil != child; ctx.Index++ {
+		next := child.Next()
+
+		step := pathStep(child)
+		seen[step]++
+		position, count := seen[step], counts[step]
+		if "node()" == step {
+			position, count = ctx.Index+1, total
+		}
+		if count > 1 {
+			step += "[" + strconv.Itoa(position) + "]"
+		}
+		ctx.path = joinPath(path, step)
+
+		if !acceptContext(ctx, child, visitor) {
+			break
+		}
+		child = next
+	}
+
+	ctx.Ancestors = ctx.Ancestors[:len(ctx.Ancestors)-1]
+	ctx.Node, ctx.Depth, ctx.Index, ctx.path = node, depth, index, path
+}
+
+// DefaultContextVisitor 简化编写ContextVisitor,只需要设置关心的回调函数,没有设置的回调函数返回true
+type DefaultContextVisitor struct {
+	EnterDocument func(*VisitContext, XMLDocument) bool
+	ExitDocument  func(*VisitContext, XMLDocument) bool
+	EnterElement  func(*VisitContext, XMLElement) bool
+	ExitElement   func(*VisitContext, XMLElement) bool
+	Attribute     func(*VisitContext, XMLAttribute) bool
+	ProcInst      func(*VisitContext, XMLProcInst) bool
+	Text          func(*VisitContext, XMLText) bool
+	Comment       func(*VisitContext, XMLComment) bool
+	Directive     func(*VisitContext, XMLDirective) bool
+}
+
+// VisitEnterDocument is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitEnterDocument(ctx *VisitContext, doc XMLDocument) bool {
+	if nil == v.EnterDocument {
+		return true
+	}
+
+	return v.EnterDocument(ctx, doc)
+}
+
+// VisitExitDocument is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitExitDocument(ctx *VisitContext, doc XMLDocument) bool {
+	if nil == v.ExitDocument {
+		return true
+	}
+
+	return v.ExitDocument(ctx, doc)
+}
+
+// VisitEnterElement is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitEnterElement(ctx *VisitContext, elem XMLElement) bool {
+	if nil == v.EnterElement {
+		return true
+	}
+
+	return v.EnterElement(ctx, elem)
+}
+
+// VisitExitElement is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitExitElement(ctx *VisitContext, elem XMLElement) bool {
+	if nil == v.ExitElement {
+		return true
+	}
+
+	return v.ExitElement(ctx, elem)
+}
+
+// VisitAttribute is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitAttribute(ctx *VisitContext, attr XMLAttribute) bool {
+	if nil == v.Attribute {
+		return true
+	}
+
+	return v.Attribute(ctx, attr)
+}
+
+// VisitProcInst is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitProcInst(ctx *VisitContext, pi XMLProcInst) bool {
+	if nil == v.ProcInst {
+		return true
+	}
+
+	return v.ProcInst(ctx, pi)
+}
+
+// VisitText is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitText(ctx *VisitContext, text XMLText) bool {
+	if nil == v.Text {
+		return true
+	}
+
+	return v.Text(ctx, text)
+}
+
+// VisitComment is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitComment(ctx *VisitContext, c XMLComment) bool {
+	if nil == v.Comment {
+		return true
+	}
+
+	return v.Comment(ctx, c)
+}
+
+// VisitDirective is the default implement of ContextVisitor
+func (v *DefaultContextVisitor) VisitDirective(ctx *VisitContext, d XMLDirective) bool {
+	if nil == v.Directive {
+		return true
+	}
+
+	return v.Directive(ctx, d)
+}
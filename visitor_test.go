@@ -0,0 +1,153 @@
+package tinydom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_AcceptContext_深度和路径(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<config><server port="80"/><server><name>web</name></server></config>`))
+
+	var lines []string
+	AcceptContext(doc, &DefaultContextVisitor{
+		EnterElement: func(ctx *VisitContext, elem XMLElement) bool {
+			lines = append(lines, fmt.Sprintf("%d %d %s %s", ctx.Depth, ctx.Index, ctx.Path(), ctx.Parent().Value()))
+			return true
+		},
+		Text: func(ctx *VisitContext, text XMLText) bool {
+			lines = append(lines, fmt.Sprintf("%d %d %s %d", ctx.Depth, ctx.Index, ctx.Path(), len(ctx.Ancestors)))
+			return true
+		},
+		ExitDocument: func(ctx *VisitContext, doc XMLDocument) bool {
+			lines = append(lines, fmt.Sprintf("%d %d %s", ctx.Depth, ctx.Index, ctx.Path()))
+			return true
+		},
+	})
+
+	expect(t, "上下文", strings.Join([]string{
+		"1 0 /config ",
+		"2 0 /config/server[1] config",
+		"2 1 /config/server[2] config",
+		"3 0 /config/server[2]/name server",
+		"4 0 /config/server[2]/name/text() 4",
+		"0 0 /",
+	}, "\n") == strings.Join(lines, "\n"))
+
+	server := doc.RootElement().LastChildElement("server")
+	var depths []int
+	AcceptContext(server, &DefaultContextVisitor{
+		EnterElement: func(ctx *VisitContext, elem XMLElement) bool {
+			depths = append(depths, ctx.Depth)
+			if 0 == ctx.Depth {
+				expect(t, "起始节点没有父节点", nil == ctx.Parent())
+			}
+			return true
+		},
+	})
+	expect(t, "深度相对于起始节点", "[0 1]" == fmt.Sprint(depths))
+}
+
+func Test_AcceptContext_路径与NodePath相同(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<!DOCTYPE a><?pi x?><a>1<b/><!--c-->2<b><c/><?pi y?><?pi z?></b><!--d--><e/></a>`))
+	detached := NewElement("x")
+	detached.InsertEndChild(NewElement("y"))
+	detached.InsertEndChild(NewElement("y")).InsertEndChild(NewText("t"))
+
+	for _, start := range []XMLNode{doc, doc.RootElement().LastChildElement("b"), detached} {
+		var mismatch []string
+		check := func(ctx *VisitContext) {
+			if ctx.Path() != NodePath(ctx.Node) {
+				mismatch = append(mismatch, ctx.Path()+" != "+NodePath(ctx.Node))
+			}
+		}
+
+		count := 0
+		AcceptContext(start, &DefaultContextVisitor{
+			EnterElement: func(ctx *VisitContext, elem XMLElement) bool {
+				check(ctx)
+				count++
+				return true
+			},
+			ExitElement: func(ctx *VisitContext, elem XMLElement) bool {
+				check(ctx)
+				return true
+			},
+			Attribute: func(ctx *VisitContext, attr XMLAttribute) bool {
+				check(ctx)
+				return true
+			},
+			ProcInst: func(ctx *VisitContext, pi XMLProcInst) bool {
+				check(ctx)
+				count++
+				return true
+			},
+			Text: func(ctx *VisitContext, text XMLText) bool {
+				check(ctx)
+				count++
+				return true
+			},
+			Comment: func(ctx *VisitContext, comment XMLComment) bool {
+				check(ctx)
+				count++
+				return true
+			},
+			Directive: func(ctx *VisitContext, directive XMLDirective) bool {
+				check(ctx)
+				count++
+				return true
+			},
+		})
+		expect(t, "遍历了节点", count > 1)
+		expect(t, "路径与NodePath相同:"+strings.Join(mismatch, ","), 0 == len(mismatch))
+	}
+}
+
+func Test_AcceptContext_属性(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a x="1" secret="s" y="2"><b z="3"/></a>`))
+
+	var names []string
+	AcceptContext(doc, &DefaultContextVisitor{
+		EnterElement: func(ctx *VisitContext, elem XMLElement) bool {
+			return "b" != elem.Name()
+		},
+		Attribute: func(ctx *VisitContext, attr XMLAttribute) bool {
+			names = append(names, ctx.Path()+"/@"+attr.Name())
+			elem := ctx.Node.ToElement()
+			if "secret" == attr.Name() {
+				elem.DeleteAttribute(attr.Name())
+			} else {
+				attr.SetValue(attr.Value() + "0")
+			}
+			return true
+		},
+	})
+
+	expect(t, "遍历所有属性", "/a/@x /a/@secret /a/@y" == strings.Join(names, " "))
+	expect(t, "在同一次遍历中修改属性", "<a x=\"10\" y=\"20\"><b z=\"3\"/></a>" == walkString(doc))
+
+	names = nil
+	AcceptContext(doc, &DefaultContextVisitor{
+		Attribute: func(ctx *VisitContext, attr XMLAttribute) bool {
+			names = append(names, attr.Name())
+			return false
+		},
+	})
+	expect(t, "返回false时不再遍历剩下的属性", "x z" == strings.Join(names, " "))
+}
+
+func Test_AcceptContext_提前结束(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c/><d/></a>`))
+
+	var names []string
+	AcceptContext(doc, &DefaultContextVisitor{
+		EnterElement: func(ctx *VisitContext, elem XMLElement) bool {
+			names = append(names, elem.Name())
+			return true
+		},
+		ExitElement: func(ctx *VisitContext, elem XMLElement) bool {
+			return "c" != elem.Name()
+		},
+	})
+	expect(t, "与Accept相同,返回false时不再遍历后面的兄弟", "a b c" == strings.Join(names, " "))
+}
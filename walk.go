@@ -0,0 +1,130 @@
+package tinydom
+
+type walkOp int
+
+const (
+	walkContinue walkOp = iota
+	walkSkipChildren
+	walkStop
+	walkRemove
+	walkReplace
+)
+
+// WalkAction 是WalkFunc的返回值,决定Walk接下来怎么做
+type WalkAction struct {
+	op   walkOp
+	node XMLNode
+}
+
+var (
+	// WalkContinue 继续遍历
+	WalkContinue = WalkAction{op: walkContinue}
+
+	// WalkSkipChildren 不遍历当前节点的子节点,在退出节点时返回与WalkContinue相同
+	WalkSkipChildren = WalkAction{op: walkSkipChildren}
+
+	// WalkStop 立即终止遍历
+	WalkStop = WalkAction{op: walkStop}
+
+	// WalkRemove 删除当前节点,不再遍历它的子节点
+	WalkRemove = WalkAction{op: walkRemove}
+)
+
+// WalkReplace 用node替换当前节点,不遍历node.node为nil时不替换,与WalkContinue相同
+func WalkReplace(node XMLNode) WalkAction {
+	if nil == node {
+		return WalkContinue
+	}
+	return WalkAction{op: walkReplace, node: node}
+}
+
+// WalkFunc 是Walk的回调函数,进入节点时exit为false,子节点都遍历完之后再以exit为true调用一次
+type WalkFunc func(node XMLNode, exit bool) WalkAction
+
+// Walk 以深度优先的顺序遍历node和它的后代,同时支持前序(exit为false)和后序(exit为true)的处理.
+//
+// 与XMLVisitor不同,回调函数可以通过返回值区分跳过子节点和终止遍历,并且遍历过程中修改树是安全的:
+// 可以通过WalkRemove和WalkReplace删除或者替换当前节点,也可以直接删除、移动当前节点或者它的兄弟节点,
+// 遍历总是从当前节点现在的下一个兄弟继续;当前节点被移走时从它原来的下一个兄弟继续,
+// 原来的下一个兄弟也被移走时从原来的上一个兄弟现在的下一个兄弟继续,三者都被移走时不再遍历父节点剩下的子节点.
+// 被删除或者替换的节点不会再以exit为true调用回调函数,没有父节点的node不能被删除或者替换,
+// 父节点不接受node的替换者(例如用文本替换文档的根元素)时保留node.
+func Walk(node XMLNode, fn WalkFunc) {
+	walkNode(node, fn)
+}
+
+// walkNode 返回false表示遍历被终止
+func walkNode(node XMLNode, fn WalkFunc) bool {
+	action := fn(node, false)
+	switch action.op {
+	case walkStop:
+		return false
+	case walkRemove, walkReplace:
+		applyWalkAction(node, action)
+		return true
+	case walkContinue:
+		for child := node.FirstChild(); nil != child; {
+			prev, next := child.Prev(), child.Next()
+			if !walkNode(child, fn) {
+				return false
+			}
+
+			if child.Parent() == node {
+				next = child.Next()
+			} else if (nil != next) && (next.Parent() != node) {
+				// 当前节点和原来的下一个兄弟都被移走了,从原来的上一个兄弟的位置继续
+				if nil == prev {
+					next = node.FirstChild()
+				} else if prev.Parent() == node {
+					next = prev.Next()
+				} else {
+					break
+				}
+			}
+			child = next
+		}
+	}
+
+	action = fn(node, true)
+	if walkStop == action.op {
+		return false
+	}
+
+	applyWalkAction(node, action)
+	return true
+}
+
+func applyWalkAction(node XMLNode, action WalkAction) {
+	parent := node.Parent()
+	if nil == parent {
+		return
+	}
+
+	switch action.op {
+	case walkRemove:
+		parent.DeleteChild(node)
+	case walkReplace:
+		replaceNode(node, action.node)
+	}
+}
+
+// replaceNode 用newNode替换node.先删除再插入,这样文档的根元素也可以被替换;
+// 父节点不接受newNode时把node放回原来的位置并返回nil
+func replaceNode(node XMLNode, newNode XMLNode) XMLNode {
+	prev, parent := node.Prev(), node.Parent()
+	parent.DeleteChild(node)
+	if added := insertAfter(parent, prev, newNode); nil != added {
+		return added
+	}
+
+	insertAfter(parent, prev, node)
+	return nil
+}
+
+// insertAfter 把node插入到parent的子节点prev之后,prev为nil时作为parent的第一个子节点
+func insertAfter(parent XMLNode, prev XMLNode, node XMLNode) XMLNode {
+	if nil == prev {
+		return parent.InsertFirstChild(node)
+	}
+	return prev.InsertBack(node)
+}
@@ -0,0 +1,152 @@
+package tinydom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func walkString(node XMLNode) string {
+	buf := bytes.NewBufferString("")
+	node.Accept(NewSimplePrinter(buf, PrintStream))
+	return buf.String()
+}
+
+func Test_Walk_前序和后序(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b><c/></b>x<d/></a>`))
+
+	var events []string
+	Walk(doc.RootElement(), func(node XMLNode, exit bool) WalkAction {
+		name := node.Value()
+		if exit {
+			name = "/" + name
+		}
+		events = append(events, name)
+		return WalkContinue
+	})
+	expect(t, "遍历顺序", "a b c /c /b x /x d /d /a" == strings.Join(events, " "))
+
+	events = nil
+	Walk(doc.RootElement(), func(node XMLNode, exit bool) WalkAction {
+		if !exit {
+			events = append(events, node.Value())
+		}
+		switch {
+		case "b" == node.Value():
+			return WalkSkipChildren
+		case "x" == node.Value():
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	expect(t, "跳过子节点和终止遍历", "a b x" == strings.Join(events, " "))
+}
+
+func Test_Walk_删除和替换(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c><b/></c><!--x--><d>1</d></a>`))
+
+	var visited []string
+	Walk(doc, func(node XMLNode, exit bool) WalkAction {
+		if !exit && (nil == node.ToDocument()) {
+			visited = append(visited, node.Value())
+		}
+
+		switch {
+		case !exit && ("b" == node.Value()):
+			return WalkRemove
+		case nil != node.ToComment():
+			return WalkReplace(NewElement("comment"))
+		case exit && ("c" == node.Value()) && (nil == node.FirstChild()):
+			// 后序处理时子节点已经被删除
+			return WalkRemove
+		}
+		return WalkContinue
+	})
+
+	expect(t, "删除和替换的结果", "<a><comment/><d>1</d></a>" == walkString(doc))
+	expect(t, "被删除和替换的节点", "a b c b x d 1" == strings.Join(visited, " "))
+
+	Walk(doc, func(node XMLNode, exit bool) WalkAction {
+		if "a" == node.Value() {
+			return WalkReplace(NewElement("root"))
+		}
+		return WalkContinue
+	})
+	expect(t, "替换根元素", "<root/>" == walkString(doc))
+}
+
+func Test_Walk_回调函数直接修改树(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c/><d/><e/></a>`))
+	a := doc.RootElement()
+	other := NewElement("other")
+
+	var visited []string
+	Walk(a, func(node XMLNode, exit bool) WalkAction {
+		if exit {
+			return WalkContinue
+		}
+
+		visited = append(visited, node.Value())
+		switch node.Value() {
+		case "b":
+			// 移走当前节点,从原来的下一个兄弟继续
+			other.InsertEndChild(node)
+		case "c":
+			// 删除下一个兄弟,从现在的下一个兄弟继续
+			a.DeleteChild(node.Next())
+		case "e":
+			node.InsertBack(NewElement("f"))
+		}
+		return WalkContinue
+	})
+
+	expect(t, "遍历修改之后的树", "a b c e f" == strings.Join(visited, " "))
+	expect(t, "修改的结果", "<a><c/><e/><f/></a>" == walkString(a))
+}
+
+func Test_Walk_替换失败(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/></a>`))
+	root := doc.RootElement()
+
+	Walk(doc, func(node XMLNode, exit bool) WalkAction {
+		if node == root {
+			return WalkReplace(NewText("x"))
+		}
+		return WalkContinue
+	})
+	expect(t, "文档不接受文本,保留根元素", (root == doc.RootElement()) && ("<a><b/></a>" == walkString(doc)))
+
+	var visited []string
+	Walk(doc, func(node XMLNode, exit bool) WalkAction {
+		if !exit && (nil != node.ToElement()) {
+			visited = append(visited, node.Value())
+		}
+		return WalkReplace(nil)
+	})
+	expect(t, "用nil替换时继续遍历", ("a b" == strings.Join(visited, " ")) && ("<a><b/></a>" == walkString(doc)))
+}
+
+func Test_Walk_移走当前节点和下一个兄弟(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<a><b/><c/><d/><e/><f/><g/></a>`))
+	a := doc.RootElement()
+	other := NewElement("other")
+
+	var visited []string
+	Walk(a, func(node XMLNode, exit bool) WalkAction {
+		if exit {
+			return WalkContinue
+		}
+
+		visited = append(visited, node.Value())
+		switch node.Value() {
+		case "b", "e":
+			// 从原来的上一个兄弟的位置继续
+			other.InsertEndChild(node.Next())
+			other.InsertEndChild(node)
+		}
+		return WalkContinue
+	})
+
+	expect(t, "遍历剩下的节点", "a b d e g" == strings.Join(visited, " "))
+	expect(t, "修改的结果", "<a><d/><g/></a>" == walkString(a))
+}
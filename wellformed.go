@@ -0,0 +1,140 @@
+package tinydom
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CheckWellFormed 检查以node为根的子树输出之后是否是格式良好的XML,返回所有的问题,没有问题时返回空列表.
+//
+// NewElement、SetName、SetAttribute、NewComment、NewProcInst等接口不检查参数,修改之后的文档可能无法输出成合法的XML.
+// CheckWellFormed检查元素名和属性名是否符合XML的Name产生式,注释中不能有"--"也不能以'-'结尾,
+// 处理指令的目标不能是保留的"xml"(文档开头的XML声明除外),处理指令中不能有"?>",CDATA中不能有"]]>",
+// 以及所有的文本、属性值、注释中不能有XML规范不允许的字符.
+func CheckWellFormed(node XMLNode) []ValidationError {
+	var errs []ValidationError
+	report := func(node XMLNode, err error) {
+		if nil != err {
+			errs = append(errs, ValidationError{Node: node, Path: NodePath(node), Message: err.Error()})
+		}
+	}
+
+	var walk func(node XMLNode)
+	walk = func(node XMLNode) {
+		switch {
+		case nil != node.ToElement():
+			elem := node.ToElement()
+			report(node, checkXMLName("element", elem.Name()))
+
+			var names []string
+			elem.ForeachAttribute(func(attribute XMLAttribute) int {
+				if err := checkXMLName("attribute", attribute.Name()); nil != err {
+					report(node, err)
+				} else if containsString(names, attribute.Name()) {
+					report(node, errors.New("Attributes have the same name:"+attribute.Name()))
+				} else if err := checkXMLChars(attribute.Value()); nil != err {
+					report(node, errors.New("Invalid value of attribute "+attribute.Name()+", "+err.Error()))
+				}
+				names = append(names, attribute.Name())
+				return 0
+			})
+		case nil != node.ToText():
+			report(node, checkXMLText(node.Value(), node.ToText().CDATA()))
+		case nil != node.ToComment():
+			report(node, checkXMLComment(node.Value()))
+		case nil != node.ToProcInst():
+			pi := node.ToProcInst()
+			report(node, checkXMLProcInst(pi.Target(), pi.Instruction(), isXMLDeclaration(pi)))
+		case nil != node.ToDirective():
+			report(node, checkXMLChars(node.Value()))
+		}
+
+		for child := node.FirstChild(); nil != child; child = child.Next() {
+			walk(child)
+		}
+	}
+
+	walk(node)
+	return errs
+}
+
+// isXMLDeclaration 判断处理指令是否是文档开头的XML声明
+func isXMLDeclaration(pi XMLProcInst) bool {
+	parent := pi.Parent()
+	return ("xml" == pi.Target()) && (nil != parent) && (nil != parent.ToDocument()) && (nil == pi.Prev())
+}
+
+// isXMLChar 判断r是否是XML规范中Char产生式允许的字符
+func isXMLChar(r rune) bool {
+	return (0x9 == r) || (0xA == r) || (0xD == r) ||
+		((r >= 0x20) && (r <= 0xD7FF)) ||
+		((r >= 0xE000) && (r <= 0xFFFD)) ||
+		((r >= 0x10000) && (r <= 0x10FFFF))
+}
+
+// checkXMLChars 检查s中是否有非法的UTF-8编码或者XML不允许的字符
+func checkXMLChars(s string) error {
+	for i, r := range s {
+		if (utf8.RuneError == r) && !strings.HasPrefix(s[i:], string(utf8.RuneError)) {
+			return errors.New("Invalid UTF-8 encoding at offset " + strconv.Itoa(i))
+		}
+
+		if !isXMLChar(r) {
+			return errors.New("Invalid character U+" + strings.ToUpper(strconv.FormatInt(int64(r), 16)) + " at offset " + strconv.Itoa(i))
+		}
+	}
+
+	return nil
+}
+
+// checkXMLName 检查元素名或者属性名是否符合XML的Name产生式,kind用于错误信息
+func checkXMLName(kind string, name string) error {
+	if "" == name {
+		return errors.New(strings.ToUpper(kind[:1]) + kind[1:] + " name should not be empty")
+	}
+
+	if !isName(name) {
+		return errors.New("Invalid " + kind + " name:" + name)
+	}
+
+	return nil
+}
+
+func checkXMLText(text string, cdata bool) error {
+	if cdata && strings.Contains(text, "]]>") {
+		return errors.New("CDATA should not contain ']]>'")
+	}
+
+	return checkXMLChars(text)
+}
+
+func checkXMLComment(comment string) error {
+	if strings.Contains(comment, "--") || strings.HasSuffix(comment, "-") {
+		return errors.New("Comment should not contain '--' or end with '-'")
+	}
+
+	return checkXMLChars(comment)
+}
+
+// checkXMLProcInst 检查处理指令,declaration为true时允许目标为"xml"
+func checkXMLProcInst(target string, inst string, declaration bool) error {
+	if "" == target {
+		return errors.New("ProcInst target should not be empty")
+	}
+
+	if !isName(target) {
+		return errors.New("Invalid ProcInst target:" + target)
+	}
+
+	if ("xml" == strings.ToLower(target)) && !(declaration && ("xml" == target)) {
+		return errors.New("ProcInst target is reserved:" + target)
+	}
+
+	if strings.Contains(inst, "?>") {
+		return errors.New("ProcInst should not contain '?>'")
+	}
+
+	return checkXMLChars(inst)
+}
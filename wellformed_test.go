@@ -0,0 +1,35 @@
+package tinydom
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_CheckWellFormed_规则(t *testing.T) {
+	tester := func(node XMLNode) bool {
+		return 0 == len(CheckWellFormed(node))
+	}
+
+	expect(t, "合法的名字", tester(NewElement("中文:名字-1.x")))
+	expect(t, "数字开头的名字", !tester(NewElement("1a")))
+	expect(t, "空名字", !tester(NewElement("")))
+	bad := NewElement("a")
+	bad.SetAttribute("x", "\x0b")
+	expect(t, "属性值中的非法字符", !tester(bad))
+
+	expect(t, "合法的注释", tester(NewComment(" a - b ")))
+	expect(t, "注释以-结尾", !tester(NewComment("a-")))
+	cdata := NewText("a]]>b")
+	cdata.SetCDATA(true)
+	expect(t, "CDATA中的]]>", !tester(cdata))
+	expect(t, "普通文本中可以有]]>", tester(NewText("a]]>b")))
+	expect(t, "U+FFFD是合法字符", tester(NewText("�")))
+	expect(t, "代理区字符", !tester(NewText("\xed\xa0\x80")))
+	expect(t, "处理指令中的?>", !tester(NewProcInst("pi", "a?>b")))
+	expect(t, "处理指令的目标大小写不同也是保留的", !tester(NewProcInst("Xml", "")))
+	expect(t, "独立的xml处理指令不是XML声明", !tester(NewProcInst("xml", `version="1.0"`)))
+	expect(t, "指令中的非法字符", !tester(NewDirective("DOCTYPE \x02")))
+
+	doc, _ := LoadDocument(strings.NewReader(`<?xml version="1.0"?><!--c--><a x="1"><?pi data?><![CDATA[x]]></a>`))
+	expect(t, "加载的文档是格式良好的", tester(doc))
+}
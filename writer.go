@@ -0,0 +1,362 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+)
+
+// XMLWriter 是一个流式的XML输出器,无需构造DOM树即可直接输出XML文档,适合生成超大的文档.
+//
+// XMLWriter与NewSimplePrinter使用同样的转义规则和缩进规则,同样的文档两者输出的结果完全一致.
+// XMLWriter在输出的同时会检查文档的有效性:标签必须配对,只能有一个根节点,文本必须在元素内部,
+// 名字必须符合XML的Name产生式,不能输出XML不允许的字符等等,规则与CheckWellFormed相同.
+// 一旦出错,后续的所有调用都会返回同一个错误.
+//
+// Attr只能紧跟在StartElement或者另外一个Attr之后调用.EndElement关闭最近一个未关闭的元素.
+// 文档输出完毕之后应调用Close检查文档是否完整.
+type XMLWriter interface {
+	StartElement(name string) error
+	Attr(name string, value string) error
+	Text(text string) error
+	CDATA(text string) error
+	Comment(comment string) error
+	ProcInst(target string, inst string) error
+	Directive(directive string) error
+	EndElement() error
+
+	WriteNode(node XMLNode) error
+
+	Close() error
+}
+
+type xmlWriterImpl struct {
+	writer        io.Writer    // 输出目的地
+	options       PrintOptions // 格式化选项
+	firstPrint    bool         // 是否首次输出
+	names         []string     // 所有尚未关闭的元素
+	attrs         []string     // 当前开始标签中已经输出的属性
+	startTagOpen  bool         // 开始标签是否还未输出'>'
+	rootElemExist bool         // 根节点是否已经输出过了
+	err           error        // 第一个错误
+}
+
+// NewXMLWriter 创建一个流式的XML输出器,options用于控制输出的格式
+func NewXMLWriter(writer io.Writer, options PrintOptions) XMLWriter {
+	w := new(xmlWriterImpl)
+	w.writer = writer
+	w.options = options
+	w.firstPrint = true
+	w.names = make([]string, 0, 16)
+	w.startTagOpen = false
+	w.rootElemExist = false
+	return w
+}
+
+func (w *xmlWriterImpl) write(s string) {
+	if nil != w.err {
+		return
+	}
+
+	_, w.err = io.WriteString(w.writer, s)
+}
+
+func (w *xmlWriterImpl) escape(escaper func(io.Writer, []byte) error, s string) {
+	if nil != w.err {
+		return
+	}
+
+	w.err = escaper(w.writer, []byte(s))
+}
+
+func (w *xmlWriterImpl) fail(err error) error {
+	if nil == w.err {
+		w.err = err
+	}
+
+	return w.err
+}
+
+func (w *xmlWriterImpl) indentSpace() {
+	if nil != w.options.Indent {
+		if !w.firstPrint {
+			w.write("\n")
+		}
+	}
+
+	for i := 0; i < len(w.names); i++ {
+		w.write(string(w.options.Indent))
+	}
+
+	w.firstPrint = false
+}
+
+// closeStartTag 在输出元素的第一个子节点之前,补齐开始标签的'>'
+func (w *xmlWriterImpl) closeStartTag() {
+	if w.startTagOpen {
+		w.write(">")
+		w.startTagOpen = false
+		w.attrs = w.attrs[:0]
+	}
+}
+
+func (w *xmlWriterImpl) StartElement(name string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if err := checkXMLName("element", name); nil != err {
+		return w.fail(err)
+	}
+
+	// 一个XML文档只允许有唯一一个根节点
+	if 0 == len(w.names) {
+		if w.rootElemExist {
+			return w.fail(errors.New("Root element has been exist:" + name))
+		}
+		w.rootElemExist = true
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.write("<")
+	w.write(name)
+	w.names = append(w.names, name)
+	w.startTagOpen = true
+	return w.err
+}
+
+func (w *xmlWriterImpl) Attr(name string, value string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if !w.startTagOpen {
+		return w.fail(errors.New("Attribute should follow the start of an element:" + name))
+	}
+
+	if err := checkXMLName("attribute", name); nil != err {
+		return w.fail(err)
+	}
+
+	if err := checkXMLChars(value); nil != err {
+		return w.fail(errors.New("Invalid value of attribute " + name + ", " + err.Error()))
+	}
+
+	for _, attr := range w.attrs {
+		if attr == name {
+			return w.fail(errors.New("Attributes have the same name:" + name))
+		}
+	}
+	w.attrs = append(w.attrs, name)
+
+	w.write(" ")
+	w.write(name)
+	w.write(`="`)
+	w.escape(EscapeAttribute, value)
+	w.write(`"`)
+	return w.err
+}
+
+func (w *xmlWriterImpl) Text(text string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if 0 == len(w.names) {
+		return w.fail(errors.New("Text should be in the element"))
+	}
+
+	if err := checkXMLText(text, false); nil != err {
+		return w.fail(err)
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.escape(EscapeText, text)
+	return w.err
+}
+
+func (w *xmlWriterImpl) CDATA(text string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if 0 == len(w.names) {
+		return w.fail(errors.New("Text should be in the element"))
+	}
+
+	if err := checkXMLText(text, true); nil != err {
+		return w.fail(err)
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.write("<![CDATA[")
+	w.write(text)
+	w.write("]]>")
+	return w.err
+}
+
+func (w *xmlWriterImpl) Comment(comment string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if err := checkXMLComment(comment); nil != err {
+		return w.fail(err)
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.write("<!--")
+	w.write(comment)
+	w.write("-->")
+	return w.err
+}
+
+func (w *xmlWriterImpl) ProcInst(target string, inst string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	// 只有在输出任何内容之前,才可以用目标"xml"输出XML声明
+	if err := checkXMLProcInst(target, inst, w.firstPrint); nil != err {
+		return w.fail(err)
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.write("<?")
+	w.write(target)
+	w.write(" ")
+	w.write(inst)
+	w.write("?>")
+	return w.err
+}
+
+func (w *xmlWriterImpl) Directive(directive string) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if err := checkXMLChars(directive); nil != err {
+		return w.fail(err)
+	}
+
+	w.closeStartTag()
+	w.indentSpace()
+	w.write("<!")
+	w.write(directive)
+	w.write(">")
+	return w.err
+}
+
+func (w *xmlWriterImpl) EndElement() error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if 0 == len(w.names) {
+		return w.fail(errors.New("There is no element to end"))
+	}
+
+	name := w.names[len(w.names)-1]
+	w.names = w.names[:len(w.names)-1]
+
+	// 没有子节点的元素直接用"/>"结束
+	if w.startTagOpen {
+		w.startTagOpen = false
+		w.attrs = w.attrs[:0]
+		w.write("/>")
+		return w.err
+	}
+
+	w.indentSpace()
+	w.write("</")
+	w.write(name)
+	w.write(">")
+	return w.err
+}
+
+func (w *xmlWriterImpl) WriteNode(node XMLNode) error {
+	if nil != w.err {
+		return w.err
+	}
+
+	visitor := &xmlWriterVisitor{writer: w}
+	node.Accept(visitor)
+	return w.err
+}
+
+func (w *xmlWriterImpl) Close() error {
+	if nil != w.err {
+		return w.err
+	}
+
+	if 0 != len(w.names) {
+		return w.fail(errors.New("Element not closed:" + w.names[len(w.names)-1]))
+	}
+
+	// 不能是空文档
+	if !w.rootElemExist {
+		return w.fail(errors.New("XML document missing the root element"))
+	}
+
+	return nil
+}
+
+// xmlWriterVisitor 将DOM树的节点逐个交给XMLWriter输出
+type xmlWriterVisitor struct {
+	writer *xmlWriterImpl
+}
+
+func (v *xmlWriterVisitor) VisitEnterDocument(node XMLDocument) bool {
+	return true
+}
+
+func (v *xmlWriterVisitor) VisitExitDocument(node XMLDocument) bool {
+	return nil == v.writer.err
+}
+
+func (v *xmlWriterVisitor) VisitEnterElement(node XMLElement) bool {
+	if nil != v.writer.StartElement(node.Name()) {
+		return false
+	}
+
+	node.ForeachAttribute(func(attribute XMLAttribute) int {
+		if nil != v.writer.Attr(attribute.Name(), attribute.Value()) {
+			return -1
+		}
+		return 0
+	})
+
+	return nil == v.writer.err
+}
+
+func (v *xmlWriterVisitor) VisitExitElement(node XMLElement) bool {
+	if nil != v.writer.err {
+		return false
+	}
+
+	return nil == v.writer.EndElement()
+}
+
+func (v *xmlWriterVisitor) VisitProcInst(node XMLProcInst) bool {
+	return nil == v.writer.ProcInst(node.Target(), node.Instruction())
+}
+
+func (v *xmlWriterVisitor) VisitText(node XMLText) bool {
+	if node.CDATA() {
+		return nil == v.writer.CDATA(node.Value())
+	}
+
+	return nil == v.writer.Text(node.Value())
+}
+
+func (v *xmlWriterVisitor) VisitComment(node XMLComment) bool {
+	return nil == v.writer.Comment(node.Value())
+}
+
+func (v *xmlWriterVisitor) VisitDirective(node XMLDirective) bool {
+	return nil == v.writer.Directive(node.Value())
+}
@@ -0,0 +1,173 @@
+package tinydom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_XMLWriter_基本功能(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	w := NewXMLWriter(buf, PrintStream)
+	w.ProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	w.StartElement("books")
+	w.Attr("count", `2&"more"`)
+	w.StartElement("book")
+	w.Text("The <Moon>")
+	w.EndElement()
+	w.StartElement("book")
+	w.CDATA("<Go west>")
+	w.EndElement()
+	w.Comment("end")
+	w.StartElement("empty")
+	w.EndElement()
+	w.EndElement()
+	err := w.Close()
+
+	exp := `<?xml version="1.0" encoding="UTF-8"?><books count="2&amp;&quot;more&quot;">` +
+		`<book>The &lt;Moon></book><book><![CDATA[<Go west>]]></book><!--end--><empty/></books>`
+	expect(t, "返回值检测", nil == err)
+	expect(t, "检查输出结果", exp == buf.String())
+}
+
+func Test_XMLWriter_与SimplePrinter输出一致(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<!--comment1-->
+	<!DOCTYPE poem>
+	<node attr1="value1" attr2="v&amp;2"><elem><!--comment2--></elem><str>Hello &lt; world</str><hello/></node>`
+
+	for _, options := range []PrintOptions{PrintStream, PrintPretty, {Indent: []byte{}}} {
+		doc, _ := LoadDocument(strings.NewReader(xml))
+
+		buf1 := bytes.NewBufferString("")
+		doc.Accept(NewSimplePrinter(buf1, options))
+
+		buf2 := bytes.NewBufferString("")
+		w := NewXMLWriter(buf2, options)
+		expect(t, "输出整个文档", nil == w.WriteNode(doc))
+		expect(t, "文档是完整的", nil == w.Close())
+		expect(t, "输出结果一致", buf1.String() == buf2.String())
+	}
+}
+
+func Test_XMLWriter_WriteNode混合使用(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(`<book id="1"><name>The Moon</name></book>`))
+
+	buf := bytes.NewBufferString("")
+	w := NewXMLWriter(buf, PrintStream)
+	w.StartElement("books")
+	w.WriteNode(doc.FirstChildElement("book"))
+	w.WriteNode(doc.FirstChildElement("book"))
+	w.EndElement()
+	expect(t, "返回值检测", nil == w.Close())
+	expect(t, "检查输出结果", `<books><book id="1"><name>The Moon</name></book><book id="1"><name>The Moon</name></book></books>` == buf.String())
+}
+
+func Test_XMLWriter_有效性检查(t *testing.T) {
+	tester := func(fn func(w XMLWriter)) error {
+		w := NewXMLWriter(bytes.NewBufferString(""), PrintStream)
+		fn(w)
+		return w.Close()
+	}
+
+	expect(t, "空文档", nil != tester(func(w XMLWriter) {}))
+	expect(t, "元素未关闭", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+	}))
+	expect(t, "关闭节点多余", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.EndElement()
+		w.EndElement()
+	}))
+	expect(t, "多余的根节点", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.EndElement()
+		w.StartElement("b")
+		w.EndElement()
+	}))
+	expect(t, "文本出现在根节点之外", nil != tester(func(w XMLWriter) {
+		w.Text("text")
+		w.StartElement("a")
+		w.EndElement()
+	}))
+	expect(t, "属性必须紧跟开始标签", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Text("text")
+		w.Attr("x", "1")
+		w.EndElement()
+	}))
+	expect(t, "属性同名", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Attr("x", "1")
+		w.Attr("x", "2")
+		w.EndElement()
+	}))
+	expect(t, "注释中不能有--", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Comment("a--b")
+		w.EndElement()
+	}))
+	expect(t, "CDATA中不能有]]>", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.CDATA("a]]>b")
+		w.EndElement()
+	}))
+	expect(t, "元素名不合法", nil != tester(func(w XMLWriter) {
+		w.StartElement("1a")
+		w.EndElement()
+	}))
+	expect(t, "属性名不合法", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Attr("x y", "1")
+		w.EndElement()
+	}))
+	expect(t, "属性值中有非法字符", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Attr("x", "\x01")
+		w.EndElement()
+	}))
+	expect(t, "文本中有非法字符", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Text("a\x00b")
+		w.EndElement()
+	}))
+	expect(t, "文本中有非法的UTF-8编码", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.Text("a\xffb")
+		w.EndElement()
+	}))
+	expect(t, "XML声明只能在最前面", nil != tester(func(w XMLWriter) {
+		w.StartElement("a")
+		w.ProcInst("xml", `version="1.0"`)
+		w.EndElement()
+	}))
+	expect(t, "处理指令的目标是保留的", nil != tester(func(w XMLWriter) {
+		w.ProcInst("XML", `version="1.0"`)
+		w.StartElement("a")
+		w.EndElement()
+	}))
+	expect(t, "处理指令的目标不合法", nil != tester(func(w XMLWriter) {
+		w.ProcInst("a b", "")
+		w.StartElement("a")
+		w.EndElement()
+	}))
+	expect(t, "根节点之外可以有注释和处理指令", nil == tester(func(w XMLWriter) {
+		w.ProcInst("xml", `version="1.0"`)
+		w.Comment("c")
+		w.StartElement("a")
+		w.EndElement()
+		w.Comment("c")
+	}))
+}
+
+func Test_XMLWriter_错误之后不再输出(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	w := NewXMLWriter(buf, PrintStream)
+	w.StartElement("a")
+	w.EndElement()
+	err1 := w.StartElement("b")
+	err2 := w.Comment("c")
+	expect(t, "出错", nil != err1)
+	expect(t, "后续调用返回同一个错误", err1 == err2)
+	expect(t, "出错之后不再输出", "<a/>" == buf.String())
+}
@@ -0,0 +1,1538 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// XPathNode 是XPath节点集中的一个节点.
+//
+// XPath的数据模型中属性也是节点,但tinydom的属性不是XMLNode,所以属性节点用所在的元素(Node)和属性本身(Attribute)表示,
+// 其它节点的Attribute为nil.
+type XPathNode struct {
+	Node      XMLNode
+	Attribute XMLAttribute
+}
+
+// Value 返回节点的字符串值:元素和文档是所有后代文本的连接,属性、文本、注释分别是它们的值,处理指令是指令的内容
+func (n XPathNode) Value() string {
+	if nil != n.Attribute {
+		return n.Attribute.Value()
+	}
+
+	switch {
+	case nil != n.Node.ToElement(), nil != n.Node.ToDocument():
+		var text bytes.Buffer
+		var walk func(node XMLNode)
+		walk = func(node XMLNode) {
+			for child := node.FirstChild(); nil != child; child = child.Next() {
+				if nil != child.ToText() {
+					text.WriteString(child.Value())
+				} else if nil != child.ToElement() {
+					walk(child)
+				}
+			}
+		}
+		walk(n.Node)
+		return text.String()
+	case nil != n.Node.ToProcInst():
+		return n.Node.ToProcInst().Instruction()
+	}
+
+	return n.Node.Value()
+}
+
+// Name 返回元素名、属性名或者处理指令的目标,其它节点返回空字符串
+func (n XPathNode) Name() string {
+	switch {
+	case nil != n.Attribute:
+		return n.Attribute.Name()
+	case nil != n.Node.ToElement():
+		return n.Node.ToElement().Name()
+	case nil != n.Node.ToProcInst():
+		return n.Node.ToProcInst().Target()
+	}
+
+	return ""
+}
+
+// Path 返回节点的路径,属性节点的路径是所在元素的路径加上"/@name"
+func (n XPathNode) Path() string {
+	if nil == n.Attribute {
+		return NodePath(n.Node)
+	}
+
+	path := NodePath(n.Node)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path + "@" + n.Attribute.Name()
+}
+
+// XPathFunc 是XPath的扩展函数,context是调用函数时的上下文节点.
+// 参数和返回值的类型是float64、string、bool或者[]XPathNode之一.
+type XPathFunc func(context XPathNode, args []interface{}) (interface{}, error)
+
+// XPathEnv 是XPath求值的环境,提供变量和扩展函数,变量的值的类型与XPathFunc的返回值相同.
+// 扩展函数优先于同名的内置函数.
+type XPathEnv struct {
+	Variables map[string]interface{}
+	Functions map[string]XPathFunc
+}
+
+// XPath 是编译好的XPath 1.0表达式,可以反复在不同的节点上求值.
+//
+// 由于tinydom的节点名不带名字空间前缀,名字测试只比较本地名,"p:name"与"name"等价,"p:*"与"*"等价.
+type XPath struct {
+	source string
+	expr   xpathExpr
+}
+
+// CompileXPath 编译一个XPath 1.0表达式
+func CompileXPath(expr string) (*XPath, error) {
+	tokens, err := scanXPath(expr)
+	if nil != err {
+		return nil, errors.New("Invalid XPath expression " + strconv.Quote(expr) + ": " + err.Error())
+	}
+
+	p := &xpathParser{tokens: tokens}
+	e, err := p.expr()
+	if (nil == err) && (xpathTokEOF != p.peek().kind) {
+		err = p.fail()
+	}
+
+	if nil != err {
+		return nil, errors.New("Invalid XPath expression " + strconv.Quote(expr) + ": " + err.Error())
+	}
+
+	return &XPath{source: expr, expr: e}, nil
+}
+
+// String 返回表达式的源码
+func (x *XPath) String() string {
+	return x.source
+}
+
+// Evaluate 以node为上下文节点对表达式求值,结果的类型是float64、string、bool或者[]XPathNode之一,env可以为nil
+func (x *XPath) Evaluate(node XMLNode, env *XPathEnv) (interface{}, error) {
+	return x.EvaluateNode(XPathNode{Node: node}, env)
+}
+
+// EvaluateNode 与Evaluate相同,但是上下文节点可以是属性节点
+func (x *XPath) EvaluateNode(node XPathNode, env *XPathEnv) (interface{}, error) {
+	e := newXPathEvaluator(env)
+	return x.expr.eval(e, xpathContext{node: node, position: 1, size: 1})
+}
+
+// Select 以node为上下文节点对表达式求值,结果必须是节点集,节点按照文档顺序排列
+func (x *XPath) Select(node XMLNode, env *XPathEnv) ([]XPathNode, error) {
+	v, err := x.Evaluate(node, env)
+	if nil != err {
+		return nil, err
+	}
+
+	nodes, ok := v.([]XPathNode)
+	if !ok {
+		return nil, errors.New("XPath expression is not a node-set:" + x.source)
+	}
+
+	return nodes, nil
+}
+
+// XPathString 按照XPath的string()函数的规则将值转换成字符串
+func XPathString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case bool:
+		if value {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return xpathNumberString(value)
+	case []XPathNode:
+		if 0 == len(value) {
+			return ""
+		}
+		return value[0].Value()
+	}
+
+	return ""
+}
+
+// XPathNumber 按照XPath的number()函数的规则将值转换成数字,无法转换时返回NaN
+func XPathNumber(v interface{}) float64 {
+	switch value := v.(type) {
+	case float64:
+		return value
+	case bool:
+		if value {
+			return 1
+		}
+		return 0
+	}
+
+	s := strings.Trim(XPathString(v), " \t\r\n")
+	digits := strings.TrimPrefix(s, "-")
+	if ("" == digits) || ("." == digits) || ("" != strings.Trim(digits, "0123456789.")) || (strings.Count(digits, ".") > 1) {
+		return math.NaN()
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if nil != err {
+		return math.NaN()
+	}
+	return f
+}
+
+// XPathBoolean 按照XPath的boolean()函数的规则将值转换成布尔值
+func XPathBoolean(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case float64:
+		return (0 != value) && !math.IsNaN(value)
+	case string:
+		return "" != value
+	case []XPathNode:
+		return 0 != len(value)
+	}
+
+	return false
+}
+
+func xpathNumberString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case 0 == f:
+		return "0"
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// ------------------------------------------------------------------
+
+const (
+	xpathTokEOF = iota
+	xpathTokNumber
+	xpathTokLiteral
+	xpathTokName     // 名字测试:QName、NCName:*或者*
+	xpathTokOperator // 运算符:and or mod div * / // | + - = != < <= > >=
+	xpathTokPunct    // ( ) [ ] . .. @ , ::
+	xpathTokVariable
+)
+
+var xpathOperators = []string{"//", "!=", "<=", ">=", "/", "|", "+", "-", "=", "<", ">"}
+
+type xpathToken struct {
+	kind int
+	text string
+}
+
+// scanXPath 将表达式切分成token,并按照XPath规范的规则区分'*'和运算符名字是运算符还是名字测试
+func scanXPath(s string) ([]xpathToken, error) {
+	var tokens []xpathToken
+	pos := 0
+
+	// 前一个token不是运算符、'@'、'::'、'('、'['、','时,'*'和and、or、mod、div是运算符
+	operatorExpected := func() bool {
+		if 0 == len(tokens) {
+			return false
+		}
+
+		prev := tokens[len(tokens)-1]
+		switch prev.kind {
+		case xpathTokOperator:
+			return false
+		case xpathTokPunct:
+			return (")" == prev.text) || ("]" == prev.text) || ("." == prev.text) || (".." == prev.text)
+		}
+		return true
+	}
+
+	readNCName := func() string {
+		start := pos
+		for pos < len(s) {
+			r, size := utf8.DecodeRuneInString(s[pos:])
+			if ((start == pos) && !isNCNameStartChar(r)) || !isNCNameChar(r) {
+				break
+			}
+			pos += size
+		}
+		return s[start:pos]
+	}
+
+	for pos < len(s) {
+		c := s[pos]
+		switch {
+		case isSpaceByte(c):
+			pos++
+		case ('"' == c) || ('\'' == c):
+			end := strings.IndexByte(s[pos+1:], c)
+			if end < 0 {
+				return nil, errors.New("unterminated literal")
+			}
+			tokens = append(tokens, xpathToken{kind: xpathTokLiteral, text: s[pos+1 : pos+1+end]})
+			pos += end + 2
+		case (c >= '0' && c <= '9') || (('.' == c) && (pos+1 < len(s)) && (s[pos+1] >= '0') && (s[pos+1] <= '9')):
+			start := pos
+			for (pos < len(s)) && (((s[pos] >= '0') && (s[pos] <= '9')) || ('.' == s[pos])) {
+				pos++
+			}
+			tokens = append(tokens, xpathToken{kind: xpathTokNumber, text: s[start:pos]})
+		case '$' == c:
+			pos++
+			name := readNCName()
+			if (pos < len(s)) && (':' == s[pos]) {
+				pos++
+				local := readNCName()
+				if "" == local {
+					return nil, errors.New("invalid variable name")
+				}
+				name += ":" + local
+			}
+			if "" == name {
+				return nil, errors.New("invalid variable name")
+			}
+			tokens = append(tokens, xpathToken{kind: xpathTokVariable, text: name})
+		case '*' == c:
+			pos++
+			if operatorExpected() {
+				tokens = append(tokens, xpathToken{kind: xpathTokOperator, text: "*"})
+			} else {
+				tokens = append(tokens, xpathToken{kind: xpathTokName, text: "*"})
+			}
+		default:
+			matched := false
+			for _, op := range []string{"//", "!=", "<=", ">=", "::", "..", "/", "|", "+", "-", "=", "<", ">", "(", ")", "[", "]", ".", "@", ","} {
+				if strings.HasPrefix(s[pos:], op) {
+					kind := xpathTokPunct
+					if containsString(xpathOperators, op) {
+						kind = xpathTokOperator
+					}
+					tokens = append(tokens, xpathToken{kind: kind, text: op})
+					pos += len(op)
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+
+			name := readNCName()
+			if "" == name {
+				return nil, errors.New("unexpected character '" + string(c) + "'")
+			}
+
+			if operatorExpected() {
+				if ("and" != name) && ("or" != name) && ("mod" != name) && ("div" != name) {
+					return nil, errors.New("expect an operator near '" + name + "'")
+				}
+				tokens = append(tokens, xpathToken{kind: xpathTokOperator, text: name})
+				continue
+			}
+
+			// QName或者NCName:*,注意不要把轴的"::"当作前缀
+			if (pos+1 < len(s)) && (':' == s[pos]) && (':' != s[pos+1]) {
+				pos++
+				if '*' == s[pos] {
+					pos++
+					name += ":*"
+				} else if local := readNCName(); "" != local {
+					name += ":" + local
+				} else {
+					return nil, errors.New("invalid name '" + name + ":'")
+				}
+			}
+			tokens = append(tokens, xpathToken{kind: xpathTokName, text: name})
+		}
+	}
+
+	return append(tokens, xpathToken{kind: xpathTokEOF}), nil
+}
+
+// ------------------------------------------------------------------
+
+const (
+	xpathAxisChild = iota
+	xpathAxisDescendant
+	xpathAxisDescendantOrSelf
+	xpathAxisParent
+	xpathAxisAncestor
+	xpathAxisAncestorOrSelf
+	xpathAxisFollowingSibling
+	xpathAxisPrecedingSibling
+	xpathAxisFollowing
+	xpathAxisPreceding
+	xpathAxisAttribute
+	xpathAxisSelf
+	xpathAxisNamespace
+)
+
+var xpathAxes = map[string]int{
+	"child":              xpathAxisChild,
+	"descendant":         xpathAxisDescendant,
+	"descendant-or-self": xpathAxisDescendantOrSelf,
+	"parent":             xpathAxisParent,
+	"ancestor":           xpathAxisAncestor,
+	"ancestor-or-self":   xpathAxisAncestorOrSelf,
+	"following-sibling":  xpathAxisFollowingSibling,
+	"preceding-sibling":  xpathAxisPrecedingSibling,
+	"following":          xpathAxisFollowing,
+	"preceding":          xpathAxisPreceding,
+	"attribute":          xpathAxisAttribute,
+	"self":               xpathAxisSelf,
+	"namespace":          xpathAxisNamespace,
+}
+
+const (
+	xpathTestName = iota // 名字测试,name为"*"时匹配所有主节点类型的节点
+	xpathTestNode
+	xpathTestText
+	xpathTestComment
+	xpathTestProcInst // name不为空时只匹配该目标的处理指令
+)
+
+var xpathNodeTypes = map[string]int{
+	"node":                   xpathTestNode,
+	"text":                   xpathTestText,
+	"comment":                xpathTestComment,
+	"processing-instruction": xpathTestProcInst,
+}
+
+type xpathContext struct {
+	node     XPathNode
+	position int
+	size     int
+}
+
+type xpathExpr interface {
+	eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error)
+}
+
+type xpathLiteral string
+
+type xpathNumber float64
+
+type xpathVariable string
+
+type xpathNegate struct {
+	operand xpathExpr
+}
+
+type xpathBinary struct {
+	op    string
+	left  xpathExpr
+	right xpathExpr
+}
+
+type xpathFunctionCall struct {
+	name string
+	args []xpathExpr
+}
+
+type xpathStep struct {
+	axis       int
+	test       int
+	name       string
+	predicates []xpathExpr
+}
+
+// xpathPath 是路径表达式,filter为nil时是位置路径,否则是过滤表达式后面跟着的相对路径
+type xpathPath struct {
+	absolute   bool
+	filter     xpathExpr
+	predicates []xpathExpr // filter的谓词
+	steps      []*xpathStep
+}
+
+// ------------------------------------------------------------------
+
+type xpathParser struct {
+	tokens []xpathToken
+	pos    int
+}
+
+func (p *xpathParser) peek() xpathToken {
+	return p.tokens[p.pos]
+}
+
+func (p *xpathParser) peekAt(offset int) xpathToken {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *xpathParser) next() xpathToken {
+	t := p.tokens[p.pos]
+	if xpathTokEOF != t.kind {
+		p.pos++
+	}
+	return t
+}
+
+func (p *xpathParser) fail() error {
+	t := p.peek()
+	if xpathTokEOF == t.kind {
+		return errors.New("unexpected end of expression")
+	}
+	return errors.New("unexpected token '" + t.text + "'")
+}
+
+func (p *xpathParser) is(kind int, text string) bool {
+	t := p.peek()
+	return (kind == t.kind) && (text == t.text)
+}
+
+func (p *xpathParser) expect(kind int, text string) error {
+	if !p.is(kind, text) {
+		return p.fail()
+	}
+	p.next()
+	return nil
+}
+
+func (p *xpathParser) expr() (xpathExpr, error) {
+	return p.binary(0)
+}
+
+// xpathLevels 是二元运算符按照优先级从低到高的分组
+var xpathLevels = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+func (p *xpathParser) binary(level int) (xpathExpr, error) {
+	if level == len(xpathLevels) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if nil != err {
+		return nil, err
+	}
+
+	for (xpathTokOperator == p.peek().kind) && containsString(xpathLevels[level], p.peek().text) {
+		op := p.next().text
+		right, err := p.binary(level + 1)
+		if nil != err {
+			return nil, err
+		}
+		left = &xpathBinary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *xpathParser) unary() (xpathExpr, error) {
+	if p.is(xpathTokOperator, "-") {
+		p.next()
+		operand, err := p.unary()
+		if nil != err {
+			return nil, err
+		}
+		return &xpathNegate{operand: operand}, nil
+	}
+
+	left, err := p.path()
+	if nil != err {
+		return nil, err
+	}
+
+	for p.is(xpathTokOperator, "|") {
+		p.next()
+		right, err := p.path()
+		if nil != err {
+			return nil, err
+		}
+		left = &xpathBinary{op: "|", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// isPrimaryStart 判断下一个token是否是基本表达式的开始:变量、括号、字面量、数字或者函数调用
+func (p *xpathParser) isPrimaryStart() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathTokVariable, xpathTokLiteral, xpathTokNumber:
+		return true
+	case xpathTokPunct:
+		return "(" == t.text
+	case xpathTokName:
+		_, isNodeType := xpathNodeTypes[t.text]
+		return !isNodeType && (xpathTokPunct == p.peekAt(1).kind) && ("(" == p.peekAt(1).text)
+	}
+	return false
+}
+
+func (p *xpathParser) path() (xpathExpr, error) {
+	path := &xpathPath{}
+	switch {
+	case p.is(xpathTokOperator, "/"):
+		p.next()
+		path.absolute = true
+		if !p.isStepStart() {
+			return path, nil
+		}
+	case p.is(xpathTokOperator, "//"):
+		p.next()
+		path.absolute = true
+		path.steps = append(path.steps, &xpathStep{axis: xpathAxisDescendantOrSelf, test: xpathTestNode})
+	case p.isPrimaryStart():
+		primary, err := p.primary()
+		if nil != err {
+			return nil, err
+		}
+
+		path.filter = primary
+		if path.predicates, err = p.predicates(); nil != err {
+			return nil, err
+		}
+
+		if !p.is(xpathTokOperator, "/") && !p.is(xpathTokOperator, "//") {
+			if 0 == len(path.predicates) {
+				return primary, nil
+			}
+			return path, nil
+		}
+
+		if "//" == p.next().text {
+			path.steps = append(path.steps, &xpathStep{axis: xpathAxisDescendantOrSelf, test: xpathTestNode})
+		}
+	}
+
+	return path, p.relativePath(path)
+}
+
+func (p *xpathParser) isStepStart() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathTokName:
+		return true
+	case xpathTokPunct:
+		return ("." == t.text) || (".." == t.text) || ("@" == t.text)
+	}
+	return false
+}
+
+func (p *xpathParser) relativePath(path *xpathPath) error {
+	for {
+		step, err := p.step()
+		if nil != err {
+			return err
+		}
+		path.steps = append(path.steps, step)
+
+		switch {
+		case p.is(xpathTokOperator, "/"):
+			p.next()
+		case p.is(xpathTokOperator, "//"):
+			p.next()
+			path.steps = append(path.steps, &xpathStep{axis: xpathAxisDescendantOrSelf, test: xpathTestNode})
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *xpathParser) step() (*xpathStep, error) {
+	switch {
+	case p.is(xpathTokPunct, "."):
+		p.next()
+		return &xpathStep{axis: xpathAxisSelf, test: xpathTestNode}, nil
+	case p.is(xpathTokPunct, ".."):
+		p.next()
+		return &xpathStep{axis: xpathAxisParent, test: xpathTestNode}, nil
+	}
+
+	step := &xpathStep{axis: xpathAxisChild}
+	if p.is(xpathTokPunct, "@") {
+		p.next()
+		step.axis = xpathAxisAttribute
+	} else if (xpathTokName == p.peek().kind) && (xpathTokPunct == p.peekAt(1).kind) && ("::" == p.peekAt(1).text) {
+		axis, ok := xpathAxes[p.peek().text]
+		if !ok {
+			return nil, errors.New("unknown axis '" + p.peek().text + "'")
+		}
+		p.next()
+		p.next()
+		step.axis = axis
+	}
+
+	if xpathTokName != p.peek().kind {
+		return nil, p.fail()
+	}
+
+	t := p.next()
+
+	if test, ok := xpathNodeTypes[t.text]; ok && p.is(xpathTokPunct, "(") {
+		p.next()
+		step.test = test
+		if (xpathTestProcInst == test) && (xpathTokLiteral == p.peek().kind) {
+			step.name = p.next().text
+		}
+		if err := p.expect(xpathTokPunct, ")"); nil != err {
+			return nil, err
+		}
+	} else {
+		step.test = xpathTestName
+		step.name = t.text
+		if strings.HasSuffix(t.text, ":*") {
+			step.name = "*"
+		} else if i := strings.IndexByte(t.text, ':'); i >= 0 {
+			step.name = t.text[i+1:]
+		}
+	}
+
+	var err error
+	step.predicates, err = p.predicates()
+	return step, err
+}
+
+func (p *xpathParser) predicates() ([]xpathExpr, error) {
+	var predicates []xpathExpr
+	for p.is(xpathTokPunct, "[") {
+		p.next()
+		predicate, err := p.expr()
+		if nil != err {
+			return nil, err
+		}
+		if err := p.expect(xpathTokPunct, "]"); nil != err {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	return predicates, nil
+}
+
+func (p *xpathParser) primary() (xpathExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xpathTokVariable:
+		return xpathVariable(t.text), nil
+	case xpathTokLiteral:
+		return xpathLiteral(t.text), nil
+	case xpathTokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if nil != err {
+			return nil, errors.New("invalid number '" + t.text + "'")
+		}
+		return xpathNumber(f), nil
+	case xpathTokPunct:
+		e, err := p.expr()
+		if nil != err {
+			return nil, err
+		}
+		return e, p.expect(xpathTokPunct, ")")
+	}
+
+	// 函数调用
+	call := &xpathFunctionCall{name: t.text}
+	p.next()
+	for !p.is(xpathTokPunct, ")") {
+		if 0 != len(call.args) {
+			if err := p.expect(xpathTokPunct, ","); nil != err {
+				return nil, err
+			}
+		}
+
+		arg, err := p.expr()
+		if nil != err {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	p.next()
+	return call, nil
+}
+
+// ------------------------------------------------------------------
+
+type xpathEvaluator struct {
+	env   *XPathEnv
+	order map[XPathNode]int
+}
+
+func newXPathEvaluator(env *XPathEnv) *xpathEvaluator {
+	if nil == env {
+		env = &XPathEnv{}
+	}
+	return &xpathEvaluator{env: env, order: make(map[XPathNode]int)}
+}
+
+func (x xpathLiteral) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	return string(x), nil
+}
+
+func (x xpathNumber) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	return float64(x), nil
+}
+
+func (x xpathVariable) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	name := string(x)
+	if v, ok := e.env.Variables[name]; ok {
+		return v, nil
+	}
+
+	return nil, errors.New("Undefined XPath variable:" + name)
+}
+
+func (x *xpathNegate) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	v, err := x.operand.eval(e, ctx)
+	if nil != err {
+		return nil, err
+	}
+	return -XPathNumber(v), nil
+}
+
+func (x *xpathBinary) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	left, err := x.left.eval(e, ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	// and和or是短路求值
+	switch x.op {
+	case "and":
+		if !XPathBoolean(left) {
+			return false, nil
+		}
+	case "or":
+		if XPathBoolean(left) {
+			return true, nil
+		}
+	}
+
+	right, err := x.right.eval(e, ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	switch x.op {
+	case "and", "or":
+		return XPathBoolean(right), nil
+	case "|":
+		nodes1, ok1 := left.([]XPathNode)
+		nodes2, ok2 := right.([]XPathNode)
+		if !ok1 || !ok2 {
+			return nil, errors.New("Operands of '|' must be node-sets")
+		}
+		return e.sortNodes(append(append([]XPathNode{}, nodes1...), nodes2...)), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return xpathCompare(x.op, left, right), nil
+	}
+
+	a, b := XPathNumber(left), XPathNumber(right)
+	switch x.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "div":
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
+
+// xpathCompare 按照XPath 1.0的规则比较两个值,节点集与其它值比较时只要有一个节点满足条件即可
+func xpathCompare(op string, left interface{}, right interface{}) bool {
+	nodes1, ok1 := left.([]XPathNode)
+	nodes2, ok2 := right.([]XPathNode)
+	switch {
+	case ok1 && ok2:
+		for _, n1 := range nodes1 {
+			for _, n2 := range nodes2 {
+				if xpathCompareAtoms(op, n1.Value(), n2.Value()) {
+					return true
+				}
+			}
+		}
+		return false
+	case ok1:
+		if _, isBool := right.(bool); isBool {
+			return xpathCompareAtoms(op, XPathBoolean(left), right)
+		}
+		for _, n := range nodes1 {
+			if xpathCompareAtoms(op, xpathAtomLike(n.Value(), right), right) {
+				return true
+			}
+		}
+		return false
+	case ok2:
+		if _, isBool := left.(bool); isBool {
+			return xpathCompareAtoms(op, left, XPathBoolean(right))
+		}
+		for _, n := range nodes2 {
+			if xpathCompareAtoms(op, left, xpathAtomLike(n.Value(), left)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return xpathCompareAtoms(op, left, right)
+}
+
+// xpathAtomLike 将节点的字符串值转换成与另一个操作数相同的类型
+func xpathAtomLike(value string, other interface{}) interface{} {
+	if _, isNumber := other.(float64); isNumber {
+		return XPathNumber(value)
+	}
+	return value
+}
+
+func xpathCompareAtoms(op string, left interface{}, right interface{}) bool {
+	if ("=" == op) || ("!=" == op) {
+		var equal bool
+		_, bool1 := left.(bool)
+		_, bool2 := right.(bool)
+		_, number1 := left.(float64)
+		_, number2 := right.(float64)
+		switch {
+		case bool1 || bool2:
+			equal = XPathBoolean(left) == XPathBoolean(right)
+		case number1 || number2:
+			equal = XPathNumber(left) == XPathNumber(right)
+		default:
+			equal = XPathString(left) == XPathString(right)
+		}
+		return equal == ("=" == op)
+	}
+
+	a, b := XPathNumber(left), XPathNumber(right)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+func (x *xpathPath) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	var nodes []XPathNode
+	switch {
+	case nil != x.filter:
+		v, err := x.filter.eval(e, ctx)
+		if nil != err {
+			return nil, err
+		}
+
+		var ok bool
+		if nodes, ok = v.([]XPathNode); !ok {
+			if (0 == len(x.predicates)) && (0 == len(x.steps)) {
+				return v, nil
+			}
+			return nil, errors.New("Expression is not a node-set")
+		}
+
+		if nodes, err = e.filter(nodes, x.predicates); nil != err {
+			return nil, err
+		}
+	case x.absolute:
+		root := ctx.node.Node
+		for nil != root.Parent() {
+			root = root.Parent()
+		}
+		nodes = []XPathNode{{Node: root}}
+	default:
+		nodes = []XPathNode{ctx.node}
+	}
+
+	for _, step := range x.steps {
+		// 只有一个上下文节点时,结果已经是按照轴的方向排列的,不需要排序
+		if 1 == len(nodes) {
+			selected, err := e.step(step, nodes[0])
+			if nil != err {
+				return nil, err
+			}
+
+			if isXPathReverseAxis(step.axis) {
+				for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+					selected[i], selected[j] = selected[j], selected[i]
+				}
+			}
+			nodes = selected
+			continue
+		}
+
+		var result []XPathNode
+		for _, node := range nodes {
+			selected, err := e.step(step, node)
+			if nil != err {
+				return nil, err
+			}
+			result = append(result, selected...)
+		}
+		nodes = e.sortNodes(result)
+	}
+
+	return nodes, nil
+}
+
+// step 对一个上下文节点执行一个定位步,谓词中的位置按照轴的方向计算
+func (e *xpathEvaluator) step(step *xpathStep, node XPathNode) ([]XPathNode, error) {
+	var nodes []XPathNode
+	xpathAxis(step.axis, node, func(n XPathNode) {
+		if xpathNodeTest(step, n) {
+			nodes = append(nodes, n)
+		}
+	})
+
+	return e.filter(nodes, step.predicates)
+}
+
+// filter 依次用谓词过滤节点,谓词的值是数字时与位置比较,否则转换成布尔值
+func (e *xpathEvaluator) filter(nodes []XPathNode, predicates []xpathExpr) ([]XPathNode, error) {
+	for _, predicate := range predicates {
+		var result []XPathNode
+		for i, node := range nodes {
+			v, err := predicate.eval(e, xpathContext{node: node, position: i + 1, size: len(nodes)})
+			if nil != err {
+				return nil, err
+			}
+
+			if number, ok := v.(float64); ok {
+				if number == float64(i+1) {
+					result = append(result, node)
+				}
+			} else if XPathBoolean(v) {
+				result = append(result, node)
+			}
+		}
+		nodes = result
+	}
+
+	return nodes, nil
+}
+
+func xpathNodeTest(step *xpathStep, n XPathNode) bool {
+	switch step.test {
+	case xpathTestNode:
+		return true
+	case xpathTestText:
+		return (nil == n.Attribute) && (nil != n.Node.ToText())
+	case xpathTestComment:
+		return (nil == n.Attribute) && (nil != n.Node.ToComment())
+	case xpathTestProcInst:
+		return (nil == n.Attribute) && (nil != n.Node.ToProcInst()) && (("" == step.name) || (step.name == n.Node.ToProcInst().Target()))
+	}
+
+	// 名字测试只匹配轴的主节点类型:属性轴是属性,其它轴是元素
+	if xpathAxisAttribute == step.axis {
+		return (nil != n.Attribute) && (("*" == step.name) || (step.name == n.Attribute.Name()))
+	}
+	return (nil == n.Attribute) && (nil != n.Node.ToElement()) && (("*" == step.name) || (step.name == n.Node.ToElement().Name()))
+}
+
+// isXPathNode 判断节点是否属于XPath的数据模型,DOCTYPE等指令和XML声明不属于
+func isXPathNode(node XMLNode) bool {
+	if nil != node.ToDirective() {
+		return false
+	}
+
+	if pi := node.ToProcInst(); (nil != pi) && ("xml" == pi.Target()) {
+		return false
+	}
+
+	return true
+}
+
+func xpathChildren(node XMLNode, visit func(XPathNode)) {
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		if isXPathNode(child) {
+			visit(XPathNode{Node: child})
+		}
+	}
+}
+
+func xpathDescendants(node XMLNode, visit func(XPathNode)) {
+	xpathChildren(node, func(child XPathNode) {
+		visit(child)
+		xpathDescendants(child.Node, visit)
+	})
+}
+
+// xpathReverseDescendants 按照文档的逆序访问后代节点
+func xpathReverseDescendants(node XMLNode, visit func(XPathNode)) {
+	for child := node.LastChild(); nil != child; child = child.Prev() {
+		if isXPathNode(child) {
+			xpathReverseDescendants(child, visit)
+			visit(XPathNode{Node: child})
+		}
+	}
+}
+
+func xpathParent(n XPathNode) (XPathNode, bool) {
+	if nil != n.Attribute {
+		return XPathNode{Node: n.Node}, true
+	}
+
+	if parent := n.Node.Parent(); nil != parent {
+		return XPathNode{Node: parent}, true
+	}
+
+	return XPathNode{}, false
+}
+
+// xpathAxis 按照轴的方向访问轴上的节点,逆向轴按照文档的逆序访问
+func xpathAxis(axis int, n XPathNode, visit func(XPathNode)) {
+	switch axis {
+	case xpathAxisSelf:
+		visit(n)
+	case xpathAxisChild:
+		if nil == n.Attribute {
+			xpathChildren(n.Node, visit)
+		}
+	case xpathAxisDescendantOrSelf, xpathAxisDescendant:
+		if xpathAxisDescendantOrSelf == axis {
+			visit(n)
+		}
+		if nil == n.Attribute {
+			xpathDescendants(n.Node, visit)
+		}
+	case xpathAxisParent:
+		if parent, ok := xpathParent(n); ok {
+			visit(parent)
+		}
+	case xpathAxisAncestorOrSelf, xpathAxisAncestor:
+		if xpathAxisAncestorOrSelf == axis {
+			visit(n)
+		}
+		for parent, ok := xpathParent(n); ok; parent, ok = xpathParent(parent) {
+			visit(parent)
+		}
+	case xpathAxisFollowingSibling, xpathAxisPrecedingSibling:
+		if (nil != n.Attribute) || (nil == n.Node.Parent()) {
+			return
+		}
+		for sibling := xpathSibling(n.Node, axis); nil != sibling; sibling = xpathSibling(sibling, axis) {
+			if isXPathNode(sibling) {
+				visit(XPathNode{Node: sibling})
+			}
+		}
+	case xpathAxisFollowing:
+		node := n.Node
+		if nil != n.Attribute {
+			// 属性之后是所在元素的后代
+			xpathDescendants(node, visit)
+		}
+		for ; nil != node.Parent(); node = node.Parent() {
+			for sibling := node.Next(); nil != sibling; sibling = sibling.Next() {
+				if isXPathNode(sibling) {
+					visit(XPathNode{Node: sibling})
+					xpathDescendants(sibling, visit)
+				}
+			}
+		}
+	case xpathAxisPreceding:
+		for node := n.Node; nil != node.Parent(); node = node.Parent() {
+			for sibling := node.Prev(); nil != sibling; sibling = sibling.Prev() {
+				if isXPathNode(sibling) {
+					xpathReverseDescendants(sibling, visit)
+					visit(XPathNode{Node: sibling})
+				}
+			}
+		}
+	case xpathAxisAttribute:
+		if elem := n.Node.ToElement(); (nil == n.Attribute) && (nil != elem) {
+			elem.ForeachAttribute(func(attribute XMLAttribute) int {
+				// 名字空间声明不是属性
+				if "xmlns" != attribute.Name() {
+					visit(XPathNode{Node: elem, Attribute: attribute})
+				}
+				return 0
+			})
+		}
+	}
+}
+
+func isXPathReverseAxis(axis int) bool {
+	switch axis {
+	case xpathAxisParent, xpathAxisAncestor, xpathAxisAncestorOrSelf, xpathAxisPrecedingSibling, xpathAxisPreceding:
+		return true
+	}
+	return false
+}
+
+func xpathSibling(node XMLNode, axis int) XMLNode {
+	if xpathAxisFollowingSibling == axis {
+		return node.Next()
+	}
+	return node.Prev()
+}
+
+// sortNodes 去掉重复的节点,并按照文档顺序排列
+func (e *xpathEvaluator) sortNodes(nodes []XPathNode) []XPathNode {
+	if len(nodes) < 2 {
+		return nodes
+	}
+
+	seen := make(map[XPathNode]bool, len(nodes))
+	result := nodes[:0:0]
+	for _, node := range nodes {
+		if !seen[node] {
+			seen[node] = true
+			result = append(result, node)
+		}
+	}
+
+	sort.Stable(&xpathNodesInOrder{result, e})
+	return result
+}
+
+// xpathNodesInOrder 按照文档顺序排序节点
+type xpathNodesInOrder struct {
+	nodes []XPathNode
+	e     *xpathEvaluator
+}
+
+func (n *xpathNodesInOrder) Len() int { return len(n.nodes) }
+func (n *xpathNodesInOrder) Less(i, j int) bool {
+	return n.e.documentOrder(n.nodes[i]) < n.e.documentOrder(n.nodes[j])
+}
+func (n *xpathNodesInOrder) Swap(i, j int) { n.nodes[i], n.nodes[j] = n.nodes[j], n.nodes[i] }
+
+// documentOrder 返回节点在文档中的序号,第一次访问一棵树时为树中所有的节点编号,属性排在元素之后、子节点之前
+func (e *xpathEvaluator) documentOrder(n XPathNode) int {
+	if index, ok := e.order[n]; ok {
+		return index
+	}
+
+	root := n.Node
+	for nil != root.Parent() {
+		root = root.Parent()
+	}
+
+	var number func(node XMLNode)
+	number = func(node XMLNode) {
+		e.order[XPathNode{Node: node}] = len(e.order)
+		if elem := node.ToElement(); nil != elem {
+			elem.ForeachAttribute(func(attribute XMLAttribute) int {
+				e.order[XPathNode{Node: elem, Attribute: attribute}] = len(e.order)
+				return 0
+			})
+		}
+		for child := node.FirstChild(); nil != child; child = child.Next() {
+			number(child)
+		}
+	}
+	number(root)
+
+	return e.order[n]
+}
+
+// ------------------------------------------------------------------
+
+func (x *xpathFunctionCall) eval(e *xpathEvaluator, ctx xpathContext) (interface{}, error) {
+	args := make([]interface{}, len(x.args))
+	for i, arg := range x.args {
+		v, err := arg.eval(e, ctx)
+		if nil != err {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	if f := e.env.Functions[x.name]; nil != f {
+		return f(ctx.node, args)
+	}
+
+	name := x.name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+
+	f, ok := xpathFunctions[name]
+	if !ok {
+		return nil, errors.New("Unknown XPath function:" + x.name)
+	}
+
+	if (len(args) < f.minArgs) || ((f.maxArgs >= 0) && (len(args) > f.maxArgs)) {
+		return nil, errors.New("Wrong number of arguments for XPath function:" + x.name)
+	}
+
+	return f.call(e, ctx, args)
+}
+
+type xpathBuiltin struct {
+	minArgs int
+	maxArgs int // -1表示不限制参数的个数
+	call    func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error)
+}
+
+// xpathArgNodes 返回节点集参数,没有参数时返回上下文节点
+func xpathArgNodes(ctx xpathContext, args []interface{}) ([]XPathNode, error) {
+	if 0 == len(args) {
+		return []XPathNode{ctx.node}, nil
+	}
+
+	nodes, ok := args[0].([]XPathNode)
+	if !ok {
+		return nil, errors.New("Argument of XPath function must be a node-set")
+	}
+	return nodes, nil
+}
+
+// xpathArgString 返回字符串参数,没有参数时返回上下文节点的字符串值
+func xpathArgString(ctx xpathContext, args []interface{}) string {
+	if 0 == len(args) {
+		return ctx.node.Value()
+	}
+	return XPathString(args[0])
+}
+
+func xpathRound(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+
+	if (f < 0) && (f >= -0.5) {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
+
+var xpathFunctions map[string]xpathBuiltin
+
+func init() {
+	xpathFunctions = map[string]xpathBuiltin{
+		"last": {0, 0, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(ctx.size), nil
+		}},
+		"position": {0, 0, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(ctx.position), nil
+		}},
+		"count": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, err := xpathArgNodes(ctx, args)
+			return float64(len(nodes)), err
+		}},
+		"id": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			var ids []string
+			if nodes, ok := args[0].([]XPathNode); ok {
+				for _, node := range nodes {
+					ids = append(ids, strings.Fields(node.Value())...)
+				}
+			} else {
+				ids = strings.Fields(XPathString(args[0]))
+			}
+
+			// 没有DTD的时候,名为id的属性(包括xml:id)被当作ID
+			root := ctx.node.Node
+			for nil != root.Parent() {
+				root = root.Parent()
+			}
+
+			var result []XPathNode
+			xpathAxis(xpathAxisDescendantOrSelf, XPathNode{Node: root}, func(n XPathNode) {
+				if elem := n.Node.ToElement(); nil != elem {
+					if attr := elem.FindAttribute("id"); (nil != attr) && containsString(ids, attr.Value()) {
+						result = append(result, n)
+					}
+				}
+			})
+			return result, nil
+		}},
+		"local-name": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, err := xpathArgNodes(ctx, args)
+			if (nil != err) || (0 == len(nodes)) {
+				return "", err
+			}
+			return localName(e.sortNodes(nodes)[0].Name()), nil
+		}},
+		"name": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, err := xpathArgNodes(ctx, args)
+			if (nil != err) || (0 == len(nodes)) {
+				return "", err
+			}
+			return e.sortNodes(nodes)[0].Name(), nil
+		}},
+		"namespace-uri": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			_, err := xpathArgNodes(ctx, args)
+			return "", err
+		}},
+		"string": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathArgString(ctx, args), nil
+		}},
+		"concat": {2, -1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			var s bytes.Buffer
+			for _, arg := range args {
+				s.WriteString(XPathString(arg))
+			}
+			return s.String(), nil
+		}},
+		"starts-with": {2, 2, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(XPathString(args[0]), XPathString(args[1])), nil
+		}},
+		"contains": {2, 2, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.Contains(XPathString(args[0]), XPathString(args[1])), nil
+		}},
+		"substring-before": {2, 2, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			s, sep := XPathString(args[0]), XPathString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[:i], nil
+			}
+			return "", nil
+		}},
+		"substring-after": {2, 2, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			s, sep := XPathString(args[0]), XPathString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[i+len(sep):], nil
+			}
+			return "", nil
+		}},
+		"substring": {2, 3, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			runes := []rune(XPathString(args[0]))
+			start := xpathRound(XPathNumber(args[1]))
+			end := math.Inf(1)
+			if 3 == len(args) {
+				end = start + xpathRound(XPathNumber(args[2]))
+			}
+
+			// 第i个字符(从1开始)满足start <= i < end时被选中,NaN的比较总是false
+			var s bytes.Buffer
+			for i, r := range runes {
+				if (float64(i+1) >= start) && (float64(i+1) < end) {
+					s.WriteRune(r)
+				}
+			}
+			return s.String(), nil
+		}},
+		"string-length": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(utf8.RuneCountInString(xpathArgString(ctx, args))), nil
+		}},
+		"normalize-space": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.Join(strings.Fields(xpathArgString(ctx, args)), " "), nil
+		}},
+		"translate": {3, 3, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			from, to := []rune(XPathString(args[1])), []rune(XPathString(args[2]))
+			var s bytes.Buffer
+			for _, r := range XPathString(args[0]) {
+				i := strings.IndexRune(string(from), r)
+				if i < 0 {
+					s.WriteRune(r)
+					continue
+				}
+
+				// 字符串中的位置是字节偏移,需要转换成字符的序号
+				index := utf8.RuneCountInString(string(from)[:i])
+				if index < len(to) {
+					s.WriteRune(to[index])
+				}
+			}
+			return s.String(), nil
+		}},
+		"boolean": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return XPathBoolean(args[0]), nil
+		}},
+		"not": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return !XPathBoolean(args[0]), nil
+		}},
+		"true": {0, 0, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return true, nil
+		}},
+		"false": {0, 0, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return false, nil
+		}},
+		"lang": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			lang := strings.ToLower(XPathString(args[0]))
+			for node, ok := ctx.node, true; ok; node, ok = xpathParent(node) {
+				if elem := node.Node.ToElement(); (nil == node.Attribute) && (nil != elem) {
+					if attr := elem.FindAttribute("lang"); nil != attr {
+						value := strings.ToLower(attr.Value())
+						return (value == lang) || strings.HasPrefix(value, lang+"-"), nil
+					}
+				}
+			}
+			return false, nil
+		}},
+		"number": {0, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			if 0 == len(args) {
+				return XPathNumber(ctx.node.Value()), nil
+			}
+			return XPathNumber(args[0]), nil
+		}},
+		"sum": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, err := xpathArgNodes(ctx, args)
+			sum := 0.0
+			for _, node := range nodes {
+				sum += XPathNumber(node.Value())
+			}
+			return sum, err
+		}},
+		"floor": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return math.Floor(XPathNumber(args[0])), nil
+		}},
+		"ceiling": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return math.Ceil(XPathNumber(args[0])), nil
+		}},
+		"round": {1, 1, func(e *xpathEvaluator, ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathRound(XPathNumber(args[0])), nil
+		}},
+	}
+}
+
+// ------------------------------------------------------------------
+
+// compileXPathPattern 编译XSLT模式(例如Schematron规则的context),模式是用'|'连接的路径.
+// 相对路径被转换成以"//"开头的绝对路径,这样从文档根对模式求值就得到所有匹配的节点.
+func compileXPathPattern(pattern string) (*XPath, error) {
+	x, err := CompileXPath(pattern)
+	if nil != err {
+		return nil, err
+	}
+
+	e, ok := xpathPatternExpr(x.expr)
+	if !ok {
+		return nil, errors.New("Invalid XPath pattern:" + pattern)
+	}
+
+	return &XPath{source: pattern, expr: e}, nil
+}
+
+// xpathPatternExpr 将模式的语法树转换成从文档根求值的表达式,e不是合法的模式时返回false
+func xpathPatternExpr(e xpathExpr) (xpathExpr, bool) {
+	switch expr := e.(type) {
+	case *xpathBinary:
+		if "|" != expr.op {
+			return nil, false
+		}
+
+		left, ok1 := xpathPatternExpr(expr.left)
+		right, ok2 := xpathPatternExpr(expr.right)
+		return &xpathBinary{op: "|", left: left, right: right}, ok1 && ok2
+	case *xpathPath:
+		if expr.absolute || (nil != expr.filter) {
+			return expr, true
+		}
+
+		steps := append([]*xpathStep{{axis: xpathAxisDescendantOrSelf, test: xpathTestNode}}, expr.steps...)
+		return &xpathPath{absolute: true, steps: steps}, true
+	case *xpathFunctionCall:
+		return expr, ("id" == expr.name) || ("key" == expr.name)
+	}
+	return nil, false
+}
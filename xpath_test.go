@@ -0,0 +1,138 @@
+package tinydom
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const xpathTestDocument = `<?xml version="1.0"?>
+<library>
+	<book id="b1" lang="en-US" price="12.5"><title>Go</title><author>Alan</author><author>Brian</author></book>
+	<!--second-->
+	<book id="b2" lang="zh" price="30"><title>XML</title><author>Wang</author></book>
+	<book id="b3" price="7.5"><title>Data</title></book>
+	<?meta info?>
+</library>`
+
+func xpathEval(t *testing.T, doc XMLDocument, expr string) interface{} {
+	x, err := CompileXPath(expr)
+	expect(t, "编译"+expr, nil == err)
+
+	v, err := x.Evaluate(doc, nil)
+	expect(t, "求值"+expr, nil == err)
+	return v
+}
+
+func xpathPaths(v interface{}) string {
+	var paths []string
+	for _, node := range v.([]XPathNode) {
+		paths = append(paths, node.Path())
+	}
+	return strings.Join(paths, ",")
+}
+
+func Test_XPath_路径(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(xpathTestDocument))
+
+	expect(t, "子元素", "/library/book[1],/library/book[2],/library/book[3]" == xpathPaths(xpathEval(t, doc, "/library/book")))
+	expect(t, "后代和谓词", "/library/book[1]/author[2]" == xpathPaths(xpathEval(t, doc, "//author[2]")))
+	expect(t, "括号之后的位置", "/library/book[2]/author" == xpathPaths(xpathEval(t, doc, "(//author)[last()]")))
+	expect(t, "属性", "/library/book[1]/@id,/library/book[2]/@id" == xpathPaths(xpathEval(t, doc, "//book[@lang]/@id")))
+	expect(t, "属性通配", 3 == len(xpathEval(t, doc, "/library/book[1]/@*").([]XPathNode)))
+	expect(t, "父节点", "/library/book[3]" == xpathPaths(xpathEval(t, doc, "//title[.='Data']/..")))
+	expect(t, "逆向轴的位置", "/library/book[1]" == xpathPaths(xpathEval(t, doc, "//book[3]/preceding-sibling::book[2]")))
+	expect(t, "祖先", "/library,/library/book[2]" == xpathPaths(xpathEval(t, doc, "//author[.='Wang']/ancestor::*")))
+	expect(t, "following", "/library/book[2]/author,/library/book[3]/title" == xpathPaths(xpathEval(t, doc, "//book[2]/title/following::*[self::author or self::title]")))
+	expect(t, "preceding", "/library/book[1]/title,/library/book[2]/title" == xpathPaths(xpathEval(t, doc, "//book[3]/title/preceding::title")))
+	expect(t, "并集按文档顺序", "/library/book[1]/@id,/library/book[1]/title,/library/book[2]/title" == xpathPaths(xpathEval(t, doc, "//book[position() < 3]/title | //book[1]/@id")))
+	expect(t, "注释和处理指令", "/library/comment(),/library/processing-instruction()" == xpathPaths(xpathEval(t, doc, "/library/comment() | /library/processing-instruction('meta')")))
+	expect(t, "XML声明不是节点", 1 == len(xpathEval(t, doc, "/node()").([]XPathNode)))
+	expect(t, "id函数", "/library/book[2],/library/book[3]" == xpathPaths(xpathEval(t, doc, "id('b3 b2')")))
+	expect(t, "前缀只比较本地名", 3 == len(xpathEval(t, doc, "//lib:book").([]XPathNode)))
+}
+
+func Test_XPath_运算和函数(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(xpathTestDocument))
+
+	expect(t, "count", 3.0 == xpathEval(t, doc, "count(//author)"))
+	expect(t, "sum", 50.0 == xpathEval(t, doc, "sum(//@price)"))
+	expect(t, "算术优先级", 7.0 == xpathEval(t, doc, "1 + 2 * 3"))
+	expect(t, "div和mod", (2.5 == xpathEval(t, doc, "5 div 2")) && (-1.0 == xpathEval(t, doc, "-5 mod 2")))
+	expect(t, "运算符名字作为元素名", 0.0 == xpathEval(t, doc, "count(//div) * 2"))
+	expect(t, "节点集与字符串比较", true == xpathEval(t, doc, "//author = 'Wang'"))
+	expect(t, "节点集的不等比较", true == xpathEval(t, doc, "//author != 'Wang'"))
+	expect(t, "节点集与数字比较", true == xpathEval(t, doc, "//@price > 29"))
+	expect(t, "两个节点集比较", true == xpathEval(t, doc, "//book[1]/title = //title"))
+	expect(t, "布尔与节点集比较", true == xpathEval(t, doc, "//none = false()"))
+	expect(t, "NaN", math.IsNaN(xpathEval(t, doc, "number('abc')").(float64)))
+	expect(t, "数字转字符串", ("2" == xpathEval(t, doc, "string(4 div 2)")) && ("0.5" == xpathEval(t, doc, "string(1 div 2)")) && ("Infinity" == xpathEval(t, doc, "string(1 div 0)")))
+	expect(t, "concat", "Go-Alan" == xpathEval(t, doc, "concat(//title, '-', //author)"))
+	expect(t, "substring", ("234" == xpathEval(t, doc, "substring('12345', 1.5, 2.6)")) && ("12" == xpathEval(t, doc, "substring('12345', 0, 3)")))
+	expect(t, "substring-before和after", ("1999" == xpathEval(t, doc, "substring-before('1999/04/01', '/')")) && ("04/01" == xpathEval(t, doc, "substring-after('1999/04/01', '/')")))
+	expect(t, "translate", "BAr" == xpathEval(t, doc, "translate('bar', 'abc', 'AB')"))
+	expect(t, "normalize-space", "a b" == xpathEval(t, doc, "normalize-space('  a \n b ')"))
+	expect(t, "string-length", 3.0 == xpathEval(t, doc, "string-length('中文字')"))
+	expect(t, "round", (3.0 == xpathEval(t, doc, "round(2.5)")) && (-2.0 == xpathEval(t, doc, "round(-2.5)")))
+	expect(t, "lang", 1.0 == xpathEval(t, doc, "count(//title[lang('en')])"))
+	expect(t, "name和position", "author" == xpathEval(t, doc, "name(//book[1]/*[position() = last()])"))
+	expect(t, "starts-with和contains", true == xpathEval(t, doc, "starts-with(//title, 'G') and contains(//book[2]/title, 'M')"))
+}
+
+func Test_XPath_变量和扩展函数(t *testing.T) {
+	doc, _ := LoadDocument(strings.NewReader(xpathTestDocument))
+	x, err := CompileXPath("//book[@price > $min]/title[ext:upper(.) = 'XML']")
+	expect(t, "编译", nil == err)
+
+	env := &XPathEnv{
+		Variables: map[string]interface{}{"min": 10.0},
+		Functions: map[string]XPathFunc{
+			"ext:upper": func(context XPathNode, args []interface{}) (interface{}, error) {
+				return strings.ToUpper(XPathString(args[0])), nil
+			},
+		},
+	}
+	nodes, err := x.Select(doc, env)
+	expect(t, "变量和扩展函数", (nil == err) && (1 == len(nodes)) && ("/library/book[2]/title" == nodes[0].Path()))
+
+	_, err = x.Select(doc, nil)
+	expect(t, "未定义的变量", nil != err)
+
+	env.Functions["ext:upper"] = func(context XPathNode, args []interface{}) (interface{}, error) {
+		return nil, errors.New("failed")
+	}
+	_, err = x.Select(doc, env)
+	expect(t, "扩展函数的错误原样返回", (nil != err) && ("failed" == err.Error()))
+
+	x, _ = CompileXPath("string(@id)")
+	book := doc.RootElement().FirstChildElement("book")
+	v, _ := x.EvaluateNode(XPathNode{Node: book}, nil)
+	expect(t, "相对于元素求值", "b1" == v)
+
+	x, _ = CompileXPath("name(..)")
+	v, _ = x.EvaluateNode(XPathNode{Node: book, Attribute: book.FindAttribute("id")}, nil)
+	expect(t, "属性作为上下文节点", "book" == v)
+
+	_, err = x.Select(doc, nil)
+	expect(t, "结果不是节点集", nil != err)
+}
+
+func Test_XPath_语法错误(t *testing.T) {
+	for _, expr := range []string{"", "//", "a[", "a b", "count(", "'abc", "foo::a", "1 +", "a/[1]", "$", "@"} {
+		_, err := CompileXPath(expr)
+		expect(t, "语法错误:"+expr, nil != err)
+	}
+
+	x, _ := CompileXPath("unknown(1)")
+	_, err := x.Evaluate(NewDocument(), nil)
+	expect(t, "未知的函数", nil != err)
+
+	x, _ = CompileXPath("count(1)")
+	_, err = x.Evaluate(NewDocument(), nil)
+	expect(t, "参数不是节点集", nil != err)
+
+	x, _ = CompileXPath("concat('a')")
+	_, err = x.Evaluate(NewDocument(), nil)
+	expect(t, "参数个数错误", nil != err)
+}
@@ -0,0 +1,1221 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// Schema 是一个加载好的XML Schema,用于校验文档.
+//
+// tinydom只支持XML Schema中常用的子集:全局和局部的元素声明,complexType中的sequence、choice、all,
+// minOccurs和maxOccurs,group和attributeGroup,complexContent和simpleContent的extension与restriction,
+// any和anyAttribute,simpleType的restriction、list、union以及常用的约束面,还有所有的内置类型.
+//
+// 由于tinydom的节点名不带名字空间前缀,校验时只比较元素和属性的本地名,不区分名字空间.
+// 未声明的xmlns、xsi、schemaLocation、noNamespaceSchemaLocation、nil属性会被忽略.
+type Schema struct {
+	defs map[string]map[string]XMLElement // 全局定义,种类 -> 名字 -> 定义
+
+	elements        map[string]*xsdElement
+	simpleTypes     map[string]*xsdSimpleType
+	complexTypes    map[string]*xsdComplexType
+	groups          map[string]*xsdParticle
+	attributeGroups map[string]*xsdComplexType
+	attributes      map[string]*xsdAttribute
+	compiling       map[string]bool
+}
+
+// xsdElement 是一个元素声明,simple和complex只有一个不为nil,没有指定类型的元素使用anyType
+type xsdElement struct {
+	name     string
+	simple   *xsdSimpleType
+	complex  *xsdComplexType
+	nillable bool
+	fixed    string
+	hasFixed bool
+}
+
+// xsdComplexType 是一个复杂类型,attributeGroup也用它来表示
+type xsdComplexType struct {
+	name         string
+	anyContent   bool           // anyType,可以包含任意的属性和内容
+	mixed        bool           // 是否允许子元素之间出现文本
+	simple       *xsdSimpleType // simpleContent的类型
+	content      *xsdParticle   // 内容模型,为nil时不能包含子元素
+	attributes   []*xsdAttribute
+	anyAttribute bool
+
+	decls    map[string]*xsdElement // 内容模型中出现的元素声明
+	wildcard string                 // 内容模型中any的processContents,为空表示没有any
+}
+
+// xsdAttribute 是一个属性声明
+type xsdAttribute struct {
+	name     string
+	typ      *xsdSimpleType
+	use      string
+	fixed    string
+	hasFixed bool
+}
+
+const (
+	xsdParticleElement = iota
+	xsdParticleSequence
+	xsdParticleChoice
+	xsdParticleAll
+	xsdParticleAny
+)
+
+// xsdParticle 是内容模型中的粒子,max为-1表示unbounded
+type xsdParticle struct {
+	kind     int
+	min      int
+	max      int
+	element  *xsdElement
+	children []*xsdParticle
+	process  string
+}
+
+var xsdAnyType = &xsdComplexType{name: "anyType", anyContent: true, mixed: true, anyAttribute: true}
+
+// LoadSchema 加载一个XML Schema,schema中的include和import通过resolver加载,
+// resolver可以为nil,此时schema中不能有带schemaLocation的include和import.
+func LoadSchema(rd io.Reader, resolver Resolver) (*Schema, error) {
+	doc, err := LoadDocument(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	s := new(Schema)
+	s.defs = make(map[string]map[string]XMLElement)
+	s.elements = make(map[string]*xsdElement)
+	s.simpleTypes = make(map[string]*xsdSimpleType)
+	s.complexTypes = make(map[string]*xsdComplexType)
+	s.groups = make(map[string]*xsdParticle)
+	s.attributeGroups = make(map[string]*xsdComplexType)
+	s.attributes = make(map[string]*xsdAttribute)
+	s.compiling = make(map[string]bool)
+
+	if err := s.collect(doc, "", resolver, make(map[string]bool)); nil != err {
+		return nil, err
+	}
+
+	// 编译所有的全局定义,以便在加载时就发现schema中的错误
+	for _, kind := range []string{"simpleType", "complexType", "attribute", "attributeGroup", "group", "element"} {
+		names := make([]string, 0, len(s.defs[kind]))
+		for name := range s.defs[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var err error
+			switch kind {
+			case "simpleType":
+				_, err = s.simpleType(name)
+			case "complexType":
+				_, err = s.complexType(name)
+			case "attribute":
+				_, err = s.attribute(name)
+			case "attributeGroup":
+				_, err = s.attributeGroup(name)
+			case "group":
+				_, err = s.group(name)
+			case "element":
+				_, err = s.element(name)
+			}
+
+			if nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// collect 收集schema文档中的全局定义,include和import的文档一并收集.
+// base是doc的位置,loaded记录已经加载过的文档解析之后的位置
+func (s *Schema) collect(doc XMLDocument, base string, resolver Resolver, loaded map[string]bool) error {
+	root := doc.RootElement()
+	if (nil == root) || ("schema" != root.Name()) {
+		return errors.New("Root element of XML Schema must be schema")
+	}
+
+	for def := root.FirstChildElement(""); nil != def; def = def.NextElement("") {
+		switch def.Name() {
+		case "include", "import":
+			location := def.Attribute("schemaLocation", "")
+			if "" == location {
+				continue
+			}
+
+			location = resolveLocation(base, location)
+			if loaded[location] {
+				continue
+			}
+			loaded[location] = true
+
+			if nil == resolver {
+				return errors.New("Missing resolver for schema:" + location)
+			}
+
+			if err := s.collectExternal(location, resolver, loaded); nil != err {
+				return err
+			}
+		case "element", "simpleType", "complexType", "group", "attributeGroup", "attribute":
+			name := def.Attribute("name", "")
+			if "" == name {
+				return errors.New("Global " + def.Name() + " must have a name")
+			}
+
+			if nil == s.defs[def.Name()] {
+				s.defs[def.Name()] = make(map[string]XMLElement)
+			}
+
+			if nil != s.defs[def.Name()][name] {
+				return errors.New("Duplicate definition of " + def.Name() + ":" + name)
+			}
+			s.defs[def.Name()][name] = def
+		case "annotation", "notation":
+		default:
+			return errors.New("Unsupported schema element:" + def.Name())
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) collectExternal(location string, resolver Resolver, loaded map[string]bool) error {
+	rd, err := resolver(location)
+	if nil != err {
+		return err
+	}
+	defer rd.Close()
+
+	doc, err := LoadDocument(rd)
+	if nil != err {
+		return err
+	}
+
+	return s.collect(doc, location, resolver, loaded)
+}
+
+// localName 去掉QName的前缀
+func localName(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+
+	return qname
+}
+
+// isXSDReference 判断ctx中引用的qname是否属于XML Schema的名字空间.
+// tinydom加载时丢弃了名字空间前缀,"xmlns:xs"声明变成了名为"xs"的属性,这里沿着祖先节点查找这个属性.
+func isXSDReference(ctx XMLElement, qname string) bool {
+	prefix := "xmlns"
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefix = qname[:i]
+	}
+
+	for node := XMLNode(ctx); nil != node; node = node.Parent() {
+		if elem := node.ToElement(); nil != elem {
+			if attr := elem.FindAttribute(prefix); nil != attr {
+				return xsdNamespace == attr.Value()
+			}
+		}
+	}
+
+	return false
+}
+
+// resolveType 查找ctx中引用的类型,返回简单类型或者复杂类型.
+// 引用属于XML Schema名字空间时优先使用内置类型,否则优先使用schema中定义的类型.
+func (s *Schema) resolveType(ctx XMLElement, qname string) (*xsdSimpleType, *xsdComplexType, error) {
+	name := localName(qname)
+	builtin := func() (*xsdSimpleType, *xsdComplexType, bool) {
+		if "anyType" == name {
+			return nil, xsdAnyType, true
+		}
+
+		st := xsdBuiltinTypes[name]
+		return st, nil, nil != st
+	}
+
+	if isXSDReference(ctx, qname) {
+		if st, ct, ok := builtin(); ok {
+			return st, ct, nil
+		}
+	}
+
+	if nil != s.defs["complexType"][name] {
+		ct, err := s.complexType(name)
+		return nil, ct, err
+	}
+
+	if nil != s.defs["simpleType"][name] {
+		st, err := s.simpleType(name)
+		return st, nil, err
+	}
+
+	if st, ct, ok := builtin(); ok {
+		return st, ct, nil
+	}
+
+	return nil, nil, errors.New("Undefined type:" + qname)
+}
+
+func (s *Schema) resolveSimpleType(ctx XMLElement, qname string) (*xsdSimpleType, error) {
+	st, _, err := s.resolveType(ctx, qname)
+	if (nil == err) && (nil == st) {
+		return nil, errors.New("Type is not a simple type:" + qname)
+	}
+
+	return st, err
+}
+
+// childDefinitions 返回定义中除annotation之外的子元素
+func childDefinitions(def XMLElement) []XMLElement {
+	var children []XMLElement
+	for child := def.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		if "annotation" != child.Name() {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// ------------------------------------------------------------------
+
+func (s *Schema) simpleType(name string) (*xsdSimpleType, error) {
+	if st := s.simpleTypes[name]; nil != st {
+		return st, nil
+	}
+
+	st := newXSDSimpleType(name, nil)
+	s.simpleTypes[name] = st
+	return st, s.compileSimpleType(st, s.defs["simpleType"][name])
+}
+
+func (s *Schema) compileSimpleType(st *xsdSimpleType, def XMLElement) error {
+	for _, child := range childDefinitions(def) {
+		switch child.Name() {
+		case "restriction":
+			base, err := s.restrictionBase(child)
+			if nil != err {
+				return err
+			}
+
+			for b := base; nil != b; b = b.base {
+				if b == st {
+					return errors.New("Circular simple type definition:" + st.name)
+				}
+			}
+
+			st.base = base
+			st.primitive = base.primitive
+			if err := s.compileFacets(st, child); nil != err {
+				return err
+			}
+		case "list":
+			item, err := s.listItemType(child)
+			if nil != err {
+				return err
+			}
+
+			st.base = xsdBuiltinTypes["anySimpleType"]
+			st.item = item
+			st.whiteSpace = "collapse"
+		case "union":
+			st.base = xsdBuiltinTypes["anySimpleType"]
+			for _, member := range strings.Fields(child.Attribute("memberTypes", "")) {
+				t, err := s.resolveSimpleType(child, member)
+				if nil != err {
+					return err
+				}
+				st.members = append(st.members, t)
+			}
+
+			for _, inline := range childDefinitions(child) {
+				t, err := s.anonymousSimpleType(inline)
+				if nil != err {
+					return err
+				}
+				st.members = append(st.members, t)
+			}
+
+			if 0 == len(st.members) {
+				return errors.New("Union must have member types")
+			}
+		default:
+			return errors.New("Unsupported element in simpleType:" + child.Name())
+		}
+	}
+
+	if nil == st.base {
+		return errors.New("simpleType must have a restriction, list or union")
+	}
+
+	return nil
+}
+
+func (s *Schema) anonymousSimpleType(def XMLElement) (*xsdSimpleType, error) {
+	if "simpleType" != def.Name() {
+		return nil, errors.New("Expect an inline simpleType, but got:" + def.Name())
+	}
+
+	st := newXSDSimpleType("", nil)
+	return st, s.compileSimpleType(st, def)
+}
+
+// restrictionBase 返回restriction的基类型,基类型可以由base属性指定,也可以内嵌在restriction中
+func (s *Schema) restrictionBase(def XMLElement) (*xsdSimpleType, error) {
+	if base := def.Attribute("base", ""); "" != base {
+		return s.resolveSimpleType(def, base)
+	}
+
+	if inline := def.FirstChildElement("simpleType"); nil != inline {
+		return s.anonymousSimpleType(inline)
+	}
+
+	return nil, errors.New("restriction must have a base type")
+}
+
+func (s *Schema) listItemType(def XMLElement) (*xsdSimpleType, error) {
+	if item := def.Attribute("itemType", ""); "" != item {
+		return s.resolveSimpleType(def, item)
+	}
+
+	if inline := def.FirstChildElement("simpleType"); nil != inline {
+		return s.anonymousSimpleType(inline)
+	}
+
+	return nil, errors.New("list must have an item type")
+}
+
+// compileFacets 读取restriction中的约束面,属性声明留给调用者处理
+func (s *Schema) compileFacets(st *xsdSimpleType, def XMLElement) error {
+	for _, facet := range childDefinitions(def) {
+		switch facet.Name() {
+		case "simpleType", "attribute", "attributeGroup", "anyAttribute":
+		default:
+			if err := st.applyFacet(facet.Name(), facet.Attribute("value", "")); nil != err {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+func (s *Schema) complexType(name string) (*xsdComplexType, error) {
+	if ct := s.complexTypes[name]; nil != ct {
+		return ct, nil
+	}
+
+	ct := &xsdComplexType{name: name}
+	s.complexTypes[name] = ct
+	return ct, s.compileComplexType(ct, s.defs["complexType"][name])
+}
+
+func (s *Schema) compileComplexType(ct *xsdComplexType, def XMLElement) error {
+	ct.mixed = "true" == def.Attribute("mixed", "")
+	for _, child := range childDefinitions(def) {
+		var err error
+		switch child.Name() {
+		case "sequence", "choice", "all", "group":
+			ct.content, err = s.compileParticle(child)
+		case "attribute", "attributeGroup", "anyAttribute":
+			err = s.compileAttributeUse(ct, child)
+		case "simpleContent":
+			err = s.compileSimpleContent(ct, child)
+		case "complexContent":
+			err = s.compileComplexContent(ct, child)
+		default:
+			err = errors.New("Unsupported element in complexType:" + child.Name())
+		}
+
+		if nil != err {
+			return err
+		}
+	}
+
+	ct.decls = make(map[string]*xsdElement)
+	collectParticleDecls(ct, ct.content)
+	return nil
+}
+
+func collectParticleDecls(ct *xsdComplexType, p *xsdParticle) {
+	if nil == p {
+		return
+	}
+
+	switch p.kind {
+	case xsdParticleElement:
+		if nil == ct.decls[p.element.name] {
+			ct.decls[p.element.name] = p.element
+		}
+	case xsdParticleAny:
+		if "" == ct.wildcard {
+			ct.wildcard = p.process
+		}
+	default:
+		for _, child := range p.children {
+			collectParticleDecls(ct, child)
+		}
+	}
+}
+
+// derivation 返回simpleContent或者complexContent中的extension或者restriction,以及它的基类型
+func (s *Schema) derivation(def XMLElement) (XMLElement, *xsdSimpleType, *xsdComplexType, error) {
+	children := childDefinitions(def)
+	if (1 != len(children)) || (("extension" != children[0].Name()) && ("restriction" != children[0].Name())) {
+		return nil, nil, nil, errors.New(def.Name() + " must have an extension or a restriction")
+	}
+
+	deriv := children[0]
+	st, ct, err := s.resolveType(deriv, deriv.Attribute("base", ""))
+	return deriv, st, ct, err
+}
+
+// inheritAttributes 继承基类型的属性声明
+func inheritAttributes(ct *xsdComplexType, base *xsdComplexType) {
+	ct.attributes = append(ct.attributes, base.attributes...)
+	ct.anyAttribute = ct.anyAttribute || base.anyAttribute
+}
+
+func (s *Schema) compileSimpleContent(ct *xsdComplexType, def XMLElement) error {
+	deriv, st, base, err := s.derivation(def)
+	if nil != err {
+		return err
+	}
+
+	if nil != base {
+		if base.anyContent {
+			st = xsdBuiltinTypes["anySimpleType"]
+		} else if st = base.simple; nil == st {
+			return errors.New("Base type of simpleContent must have simple content:" + base.name)
+		}
+		inheritAttributes(ct, base)
+	}
+
+	ct.simple = st
+	if "restriction" == deriv.Name() {
+		ct.simple = newXSDSimpleType("", st)
+		if err := s.compileFacets(ct.simple, deriv); nil != err {
+			return err
+		}
+	}
+
+	return s.compileDerivationChildren(ct, deriv, false)
+}
+
+func (s *Schema) compileComplexContent(ct *xsdComplexType, def XMLElement) error {
+	deriv, _, base, err := s.derivation(def)
+	if nil != err {
+		return err
+	}
+
+	if nil == base {
+		return errors.New("Base type of complexContent must be a complex type:" + deriv.Attribute("base", ""))
+	}
+
+	if mixed := def.Attribute("mixed", ""); "" != mixed {
+		ct.mixed = "true" == mixed
+	}
+
+	inheritAttributes(ct, base)
+	if "extension" == deriv.Name() {
+		ct.mixed = ct.mixed || base.mixed
+		ct.content = base.content
+		if base.anyContent {
+			ct.anyContent = true
+		}
+	}
+
+	return s.compileDerivationChildren(ct, deriv, true)
+}
+
+// compileDerivationChildren 编译extension或者restriction中的内容模型和属性声明,
+// extension中的内容模型追加在基类型的内容模型之后
+func (s *Schema) compileDerivationChildren(ct *xsdComplexType, deriv XMLElement, complexContent bool) error {
+	for _, child := range childDefinitions(deriv) {
+		switch child.Name() {
+		case "attribute", "attributeGroup", "anyAttribute":
+			if err := s.compileAttributeUse(ct, child); nil != err {
+				return err
+			}
+		case "sequence", "choice", "all", "group":
+			if !complexContent {
+				return errors.New("simpleContent must not have a content model")
+			}
+
+			own, err := s.compileParticle(child)
+			if nil != err {
+				return err
+			}
+
+			if nil == ct.content {
+				ct.content = own
+			} else {
+				ct.content = &xsdParticle{kind: xsdParticleSequence, min: 1, max: 1, children: []*xsdParticle{ct.content, own}}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+func parseOccurs(def XMLElement) (int, int, error) {
+	min, err := strconv.Atoi(def.Attribute("minOccurs", "1"))
+	if (nil != err) || (min < 0) {
+		return 0, 0, errors.New("Invalid minOccurs:" + def.Attribute("minOccurs", ""))
+	}
+
+	max := -1
+	if value := def.Attribute("maxOccurs", "1"); "unbounded" != value {
+		if max, err = strconv.Atoi(value); (nil != err) || (max < min) {
+			return 0, 0, errors.New("Invalid maxOccurs:" + value)
+		}
+	}
+
+	return min, max, nil
+}
+
+func (s *Schema) compileParticle(def XMLElement) (*xsdParticle, error) {
+	min, max, err := parseOccurs(def)
+	if nil != err {
+		return nil, err
+	}
+
+	p := &xsdParticle{min: min, max: max}
+	switch def.Name() {
+	case "element":
+		p.kind = xsdParticleElement
+		p.element, err = s.localElement(def)
+	case "sequence", "choice", "all":
+		p.kind = map[string]int{"sequence": xsdParticleSequence, "choice": xsdParticleChoice, "all": xsdParticleAll}[def.Name()]
+		for _, child := range childDefinitions(def) {
+			c, err := s.compileParticle(child)
+			if nil != err {
+				return nil, err
+			}
+
+			if (xsdParticleAll == p.kind) && ((xsdParticleElement != c.kind) || (c.max > 1)) {
+				return nil, errors.New("all can only contain elements that occur at most once")
+			}
+			p.children = append(p.children, c)
+		}
+	case "group":
+		var group *xsdParticle
+		group, err = s.group(localName(def.Attribute("ref", "")))
+		p.kind = xsdParticleSequence
+		p.children = []*xsdParticle{group}
+	case "any":
+		p.kind = xsdParticleAny
+		p.process = def.Attribute("processContents", "strict")
+	default:
+		err = errors.New("Unsupported element in content model:" + def.Name())
+	}
+
+	if nil != err {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *Schema) group(name string) (*xsdParticle, error) {
+	if p := s.groups[name]; nil != p {
+		return p, nil
+	}
+
+	def := s.defs["group"][name]
+	if nil == def {
+		return nil, errors.New("Undefined group:" + name)
+	}
+
+	if s.compiling["group:"+name] {
+		return nil, errors.New("Circular group reference:" + name)
+	}
+	s.compiling["group:"+name] = true
+	defer delete(s.compiling, "group:"+name)
+
+	children := childDefinitions(def)
+	if 1 != len(children) {
+		return nil, errors.New("group must have exactly one sequence, choice or all:" + name)
+	}
+
+	p, err := s.compileParticle(children[0])
+	if nil != err {
+		return nil, err
+	}
+
+	s.groups[name] = p
+	return p, nil
+}
+
+// ------------------------------------------------------------------
+
+func (s *Schema) element(name string) (*xsdElement, error) {
+	if e := s.elements[name]; nil != e {
+		return e, nil
+	}
+
+	def := s.defs["element"][name]
+	if nil == def {
+		return nil, errors.New("Undefined element:" + name)
+	}
+
+	e := new(xsdElement)
+	s.elements[name] = e
+	return e, s.compileElement(e, def)
+}
+
+func (s *Schema) localElement(def XMLElement) (*xsdElement, error) {
+	if ref := def.Attribute("ref", ""); "" != ref {
+		return s.element(localName(ref))
+	}
+
+	e := new(xsdElement)
+	return e, s.compileElement(e, def)
+}
+
+func (s *Schema) compileElement(e *xsdElement, def XMLElement) error {
+	e.name = def.Attribute("name", "")
+	if "" == e.name {
+		return errors.New("element must have a name or a ref")
+	}
+
+	e.nillable = "true" == def.Attribute("nillable", "")
+	if attr := def.FindAttribute("fixed"); nil != attr {
+		e.fixed, e.hasFixed = attr.Value(), true
+	}
+
+	var err error
+	if typ := def.Attribute("type", ""); "" != typ {
+		e.simple, e.complex, err = s.resolveType(def, typ)
+		return err
+	}
+
+	if inline := def.FirstChildElement("simpleType"); nil != inline {
+		e.simple, err = s.anonymousSimpleType(inline)
+		return err
+	}
+
+	if inline := def.FirstChildElement("complexType"); nil != inline {
+		e.complex = new(xsdComplexType)
+		return s.compileComplexType(e.complex, inline)
+	}
+
+	e.complex = xsdAnyType
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+func (s *Schema) attribute(name string) (*xsdAttribute, error) {
+	if a := s.attributes[name]; nil != a {
+		return a, nil
+	}
+
+	def := s.defs["attribute"][name]
+	if nil == def {
+		return nil, errors.New("Undefined attribute:" + name)
+	}
+
+	a, err := s.compileAttribute(def)
+	if nil != err {
+		return nil, err
+	}
+
+	s.attributes[name] = a
+	return a, nil
+}
+
+func (s *Schema) attributeGroup(name string) (*xsdComplexType, error) {
+	if g := s.attributeGroups[name]; nil != g {
+		return g, nil
+	}
+
+	def := s.defs["attributeGroup"][name]
+	if nil == def {
+		return nil, errors.New("Undefined attributeGroup:" + name)
+	}
+
+	if s.compiling["attributeGroup:"+name] {
+		return nil, errors.New("Circular attributeGroup reference:" + name)
+	}
+	s.compiling["attributeGroup:"+name] = true
+	defer delete(s.compiling, "attributeGroup:"+name)
+
+	g := &xsdComplexType{name: name}
+	for _, child := range childDefinitions(def) {
+		if err := s.compileAttributeUse(g, child); nil != err {
+			return nil, err
+		}
+	}
+
+	s.attributeGroups[name] = g
+	return g, nil
+}
+
+func (s *Schema) compileAttribute(def XMLElement) (*xsdAttribute, error) {
+	a := new(xsdAttribute)
+	if ref := def.Attribute("ref", ""); "" != ref {
+		global, err := s.attribute(localName(ref))
+		if nil != err {
+			return nil, err
+		}
+		*a = *global
+	} else {
+		if a.name = def.Attribute("name", ""); "" == a.name {
+			return nil, errors.New("attribute must have a name or a ref")
+		}
+
+		var err error
+		a.typ = xsdBuiltinTypes["anySimpleType"]
+		if typ := def.Attribute("type", ""); "" != typ {
+			a.typ, err = s.resolveSimpleType(def, typ)
+		} else if inline := def.FirstChildElement("simpleType"); nil != inline {
+			a.typ, err = s.anonymousSimpleType(inline)
+		}
+
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	a.use = def.Attribute("use", "optional")
+	if attr := def.FindAttribute("fixed"); nil != attr {
+		a.fixed, a.hasFixed = attr.Value(), true
+	}
+
+	return a, nil
+}
+
+// compileAttributeUse 将attribute、attributeGroup、anyAttribute加入到类型中,
+// 同名的属性覆盖继承来的属性,use="prohibited"的属性被删除
+func (s *Schema) compileAttributeUse(ct *xsdComplexType, def XMLElement) error {
+	var attrs []*xsdAttribute
+	switch def.Name() {
+	case "attribute":
+		a, err := s.compileAttribute(def)
+		if nil != err {
+			return err
+		}
+		attrs = []*xsdAttribute{a}
+	case "attributeGroup":
+		g, err := s.attributeGroup(localName(def.Attribute("ref", "")))
+		if nil != err {
+			return err
+		}
+		attrs = g.attributes
+		ct.anyAttribute = ct.anyAttribute || g.anyAttribute
+	case "anyAttribute":
+		ct.anyAttribute = true
+	default:
+		return errors.New("Unsupported attribute declaration:" + def.Name())
+	}
+
+	for _, a := range attrs {
+		kept := ct.attributes[:0:0]
+		for _, old := range ct.attributes {
+			if old.name != a.name {
+				kept = append(kept, old)
+			}
+		}
+
+		if "prohibited" != a.use {
+			kept = append(kept, a)
+		}
+		ct.attributes = kept
+	}
+
+	return nil
+}
+
+func (ct *xsdComplexType) attribute(name string) *xsdAttribute {
+	for _, a := range ct.attributes {
+		if a.name == name {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// Validate 使用schema校验文档,返回所有的校验错误,文档有效时返回空列表.
+// 文档的根元素必须是schema中声明的全局元素.
+func (s *Schema) Validate(doc XMLDocument) []ValidationError {
+	v := &xsdValidator{schema: s}
+
+	root := doc.RootElement()
+	if nil == root {
+		v.report(doc, "XML document missing the root element")
+		return v.errors
+	}
+
+	decl := s.elements[root.Name()]
+	if nil == decl {
+		v.report(root, "Element is not declared as a global element:"+root.Name())
+		return v.errors
+	}
+
+	v.validateElement(root, decl)
+	return v.errors
+}
+
+type xsdValidator struct {
+	schema *Schema
+	errors []ValidationError
+}
+
+func (v *xsdValidator) report(node XMLNode, message string) {
+	v.errors = append(v.errors, ValidationError{Node: node, Path: NodePath(node), Message: message})
+}
+
+// isIgnorableXSDAttribute 判断属性是否是名字空间声明或者xsi属性,这些属性不需要声明
+func isIgnorableXSDAttribute(name string) bool {
+	switch name {
+	case "xmlns", "xsi", "schemaLocation", "noNamespaceSchemaLocation", "nil":
+		return true
+	}
+
+	return false
+}
+
+func (v *xsdValidator) validateElement(elem XMLElement, decl *xsdElement) {
+	ct := decl.complex
+	if (nil != ct) && ct.anyContent {
+		v.validateChildren(elem, ct)
+		return
+	}
+
+	v.validateAttributes(elem, ct)
+	if v.isNil(elem, decl) {
+		return
+	}
+
+	if nil != decl.simple {
+		v.validateSimpleContent(elem, decl, decl.simple)
+		return
+	}
+
+	if nil != ct.simple {
+		v.validateSimpleContent(elem, decl, ct.simple)
+		return
+	}
+
+	v.validateComplexContent(elem, ct)
+}
+
+// isNil 判断元素是否带有xsi:nil="true",nil元素不能有内容
+func (v *xsdValidator) isNil(elem XMLElement, decl *xsdElement) bool {
+	if !decl.nillable {
+		return false
+	}
+
+	switch elem.Attribute("nil", "") {
+	case "true", "1":
+	default:
+		return false
+	}
+
+	if nil != elem.FirstChildElement("") || ("" != elementText(elem)) {
+		v.report(elem, "Element is nil but has content:"+elem.Name())
+	}
+
+	return true
+}
+
+// elementText 返回元素中所有文本子节点的内容
+func elementText(elem XMLElement) string {
+	var sb bytes.Buffer
+	for child := elem.FirstChild(); nil != child; child = child.Next() {
+		if nil != child.ToText() {
+			sb.WriteString(child.Value())
+		}
+	}
+
+	return sb.String()
+}
+
+func (v *xsdValidator) validateAttributes(elem XMLElement, ct *xsdComplexType) {
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		var decl *xsdAttribute
+		if nil != ct {
+			decl = ct.attribute(attribute.Name())
+		}
+
+		if nil == decl {
+			if !isIgnorableXSDAttribute(attribute.Name()) && ((nil == ct) || !ct.anyAttribute) {
+				v.report(elem, "Attribute is not declared:"+attribute.Name())
+			}
+			return 0
+		}
+
+		if err := decl.typ.validate(attribute.Value()); nil != err {
+			v.report(elem, "Invalid attribute "+decl.name+", "+err.Error())
+			return 0
+		}
+
+		if decl.hasFixed && !decl.typ.equal(attribute.Value(), decl.fixed) {
+			v.report(elem, "Attribute must have the fixed value \""+decl.fixed+"\":"+decl.name)
+		}
+		return 0
+	})
+
+	if nil == ct {
+		return
+	}
+
+	for _, decl := range ct.attributes {
+		if ("required" == decl.use) && (nil == elem.FindAttribute(decl.name)) {
+			v.report(elem, "Required attribute is missing:"+decl.name)
+		}
+	}
+}
+
+func (v *xsdValidator) validateSimpleContent(elem XMLElement, decl *xsdElement, st *xsdSimpleType) {
+	if child := elem.FirstChildElement(""); nil != child {
+		v.report(child, "Element with simple content must not have child elements:"+elem.Name())
+		return
+	}
+
+	value := elementText(elem)
+	if err := st.validate(value); nil != err {
+		v.report(elem, "Invalid content of element "+elem.Name()+", "+err.Error())
+		return
+	}
+
+	if decl.hasFixed && !st.equal(value, decl.fixed) {
+		v.report(elem, "Element must have the fixed value \""+decl.fixed+"\":"+elem.Name())
+	}
+}
+
+func (v *xsdValidator) validateComplexContent(elem XMLElement, ct *xsdComplexType) {
+	var names []string
+	var elems []XMLElement
+	for child := elem.FirstChild(); nil != child; child = child.Next() {
+		if text := child.ToText(); nil != text {
+			if !ct.mixed && ("" != strings.Trim(text.Value(), " \t\r\n")) {
+				v.report(child, "Text is not allowed in element:"+elem.Name())
+			}
+			continue
+		}
+
+		if child := child.ToElement(); nil != child {
+			names = append(names, child.Name())
+			elems = append(elems, child)
+		}
+	}
+
+	m := &xsdMatcher{names: names}
+	ends := []int{0}
+	if nil != ct.content {
+		ends = m.match(ct.content, ends)
+	}
+
+	if !containsInt(ends, len(names)) {
+		sort.Strings(m.expected)
+		if m.furthest < len(elems) {
+			v.report(elems[m.furthest], "Element is not expected here:"+names[m.furthest]+", expected "+describeExpected(m.expected))
+		} else {
+			v.report(elem, "Content of element is incomplete:"+elem.Name()+", expected "+describeExpected(m.expected))
+		}
+	}
+
+	v.validateChildren(elem, ct)
+}
+
+// validateChildren 校验子元素,内容模型中没有声明的子元素按照any的processContents处理
+func (v *xsdValidator) validateChildren(elem XMLElement, ct *xsdComplexType) {
+	wildcard := ct.wildcard
+	if ct.anyContent {
+		wildcard = "lax"
+	}
+
+	for child := elem.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		if decl := ct.decls[child.Name()]; nil != decl {
+			v.validateElement(child, decl)
+			continue
+		}
+
+		switch wildcard {
+		case "strict", "lax":
+			if decl := v.schema.elements[child.Name()]; nil != decl {
+				v.validateElement(child, decl)
+			} else if "strict" == wildcard {
+				v.report(child, "Element is not declared as a global element:"+child.Name())
+			}
+		}
+	}
+}
+
+// ------------------------------------------------------------------
+
+// xsdMatcher 用内容模型匹配子元素的名字序列.匹配时维护所有可能到达的位置,
+// 同时记录能够到达的最远位置以及在该位置上期望的元素名,用于生成错误信息.
+type xsdMatcher struct {
+	names    []string
+	furthest int
+	expected []string
+}
+
+func (m *xsdMatcher) reach(pos int) {
+	if pos > m.furthest {
+		m.furthest = pos
+		m.expected = nil
+	}
+}
+
+func (m *xsdMatcher) expect(pos int, name string) {
+	m.reach(pos)
+	if (pos == m.furthest) && !containsString(m.expected, name) {
+		m.expected = append(m.expected, name)
+	}
+}
+
+func containsInt(items []int, n int) bool {
+	for _, item := range items {
+		if item == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendUniqueInt(items []int, n int) []int {
+	if containsInt(items, n) {
+		return items
+	}
+
+	return append(items, n)
+}
+
+// match 从starts中的每个位置开始匹配粒子p,按照minOccurs和maxOccurs重复,返回所有可能的结束位置
+func (m *xsdMatcher) match(p *xsdParticle, starts []int) []int {
+	var result []int
+	if 0 == p.min {
+		result = append(result, starts...)
+	}
+
+	current := starts
+	for i := 1; (p.max < 0) || (i <= p.max); i++ {
+		next := m.matchOnce(p, current)
+		if 0 == len(next) {
+			break
+		}
+
+		if i >= p.min {
+			grown := false
+			for _, pos := range next {
+				if !containsInt(result, pos) {
+					result = append(result, pos)
+					grown = true
+				}
+			}
+
+			// 没有到达新的位置,继续重复也不会有新的结果
+			if !grown {
+				break
+			}
+		}
+
+		current = next
+	}
+
+	return result
+}
+
+func (m *xsdMatcher) matchOnce(p *xsdParticle, starts []int) []int {
+	var next []int
+	switch p.kind {
+	case xsdParticleElement:
+		for _, pos := range starts {
+			if (pos < len(m.names)) && (m.names[pos] == p.element.name) {
+				m.reach(pos + 1)
+				next = appendUniqueInt(next, pos+1)
+			} else {
+				m.expect(pos, p.element.name)
+			}
+		}
+	case xsdParticleAny:
+		for _, pos := range starts {
+			if pos < len(m.names) {
+				m.reach(pos + 1)
+				next = appendUniqueInt(next, pos+1)
+			} else {
+				m.expect(pos, "*")
+			}
+		}
+	case xsdParticleSequence:
+		next = starts
+		for _, child := range p.children {
+			if next = m.match(child, next); 0 == len(next) {
+				break
+			}
+		}
+	case xsdParticleChoice:
+		for _, child := range p.children {
+			for _, pos := range m.match(child, starts) {
+				next = appendUniqueInt(next, pos)
+			}
+		}
+	case xsdParticleAll:
+		for _, pos := range starts {
+			if end, ok := m.matchAll(p, pos); ok {
+				next = appendUniqueInt(next, end)
+			}
+		}
+	}
+
+	return next
+}
+
+// matchAll 匹配all,all中的元素以任意顺序出现,每个最多出现一次
+func (m *xsdMatcher) matchAll(p *xsdParticle, pos int) (int, bool) {
+	used := make([]bool, len(p.children))
+	for pos < len(m.names) {
+		found := false
+		for i, child := range p.children {
+			if !used[i] && (child.element.name == m.names[pos]) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			break
+		}
+
+		pos++
+		m.reach(pos)
+	}
+
+	ok := true
+	for i, child := range p.children {
+		if !used[i] {
+			m.expect(pos, child.element.name)
+			ok = ok && (0 == child.min)
+		}
+	}
+
+	return pos, ok
+}
@@ -0,0 +1,253 @@
+package tinydom
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const xsdTestSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+	<xs:include schemaLocation="types.xsd"/>
+
+	<xs:element name="catalog">
+		<xs:complexType>
+			<xs:sequence>
+				<xs:element name="book" type="bookType" maxOccurs="unbounded"/>
+				<xs:group ref="extra" minOccurs="0"/>
+			</xs:sequence>
+			<xs:attribute name="version" type="xs:decimal" fixed="1.0"/>
+		</xs:complexType>
+	</xs:element>
+
+	<xs:group name="extra">
+		<xs:choice>
+			<xs:element name="note" type="xs:string"/>
+			<xs:element ref="comment" maxOccurs="2"/>
+		</xs:choice>
+	</xs:group>
+
+	<xs:element name="comment" nillable="true">
+		<xs:complexType mixed="true">
+			<xs:sequence>
+				<xs:any processContents="lax" minOccurs="0" maxOccurs="unbounded"/>
+			</xs:sequence>
+		</xs:complexType>
+	</xs:element>
+
+	<xs:complexType name="itemType">
+		<xs:all>
+			<xs:element name="title" type="xs:string"/>
+			<xs:element name="price" type="priceType" minOccurs="0"/>
+		</xs:all>
+		<xs:attributeGroup ref="common"/>
+	</xs:complexType>
+
+	<xs:complexType name="bookType">
+		<xs:complexContent>
+			<xs:extension base="itemType">
+				<xs:sequence>
+					<xs:element name="author" type="xs:token" minOccurs="1" maxOccurs="3"/>
+				</xs:sequence>
+				<xs:attribute name="lang" type="langType" use="required"/>
+			</xs:extension>
+		</xs:complexContent>
+	</xs:complexType>
+
+	<xs:attributeGroup name="common">
+		<xs:attribute name="id" type="xs:ID" use="required"/>
+		<xs:anyAttribute/>
+	</xs:attributeGroup>
+</xs:schema>`
+
+const xsdTestTypes = `<schema xmlns="http://www.w3.org/2001/XMLSchema">
+	<simpleType name="langType">
+		<restriction base="token">
+			<enumeration value="en"/>
+			<enumeration value="zh"/>
+		</restriction>
+	</simpleType>
+
+	<complexType name="priceType">
+		<simpleContent>
+			<extension base="money">
+				<attribute name="currency" type="string" default="CNY"/>
+			</extension>
+		</simpleContent>
+	</complexType>
+
+	<simpleType name="money">
+		<restriction base="decimal">
+			<minInclusive value="0"/>
+			<fractionDigits value="2"/>
+		</restriction>
+	</simpleType>
+</schema>`
+
+func xsdTestResolver(location string) (io.ReadCloser, error) {
+	if "types.xsd" != location {
+		return nil, errors.New("not found:" + location)
+	}
+	return ioutil.NopCloser(strings.NewReader(xsdTestTypes)), nil
+}
+
+func validateSchemaString(t *testing.T, xml string) []ValidationError {
+	schema, err := LoadSchema(strings.NewReader(xsdTestSchema), xsdTestResolver)
+	expect(t, "加载schema", nil == err)
+
+	doc, err := LoadDocument(strings.NewReader(xml))
+	expect(t, "返回值检测", nil == err)
+	return schema.Validate(doc)
+}
+
+func Test_Schema_有效文档(t *testing.T) {
+	errs := validateSchemaString(t, `<catalog version="1.00" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="catalog.xsd">
+		<book id="b1" lang="en" extra="any attribute">
+			<price currency="USD">12.50</price>
+			<title>Go</title>
+			<author>  Alan   Donovan </author>
+		</book>
+		<book id="b2" lang=" zh "><title>XML</title><author>A</author><author>B</author></book>
+		<comment>text <b>bold</b> <i>any</i></comment>
+		<comment xsi:nil="true"/>
+	</catalog>`)
+	expect(t, "没有校验错误", 0 == len(errs))
+}
+
+func Test_Schema_内容模型(t *testing.T) {
+	errs := validateSchemaString(t, `<catalog><note/></catalog>`)
+	expect(t, "缺少book", (1 == len(errs)) && ("/catalog/note" == errs[0].Path) && strings.HasSuffix(errs[0].Message, "expected book"))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title/></book></catalog>`)
+	expect(t, "缺少author", (1 == len(errs)) && ("/catalog/book" == errs[0].Path) && strings.HasSuffix(errs[0].Message, "expected author|price"))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title/><title/><author/></book></catalog>`)
+	expect(t, "all中的元素只能出现一次", (1 == len(errs)) && ("/catalog/book/title[2]" == errs[0].Path))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title/><author/><author/><author/><author/></book></catalog>`)
+	expect(t, "超过maxOccurs", (1 == len(errs)) && ("/catalog/book/author[4]" == errs[0].Path))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title/><author/></book><note/><comment/></catalog>`)
+	expect(t, "choice只能选一个", (1 == len(errs)) && ("/catalog/comment" == errs[0].Path))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en">text<title/><author/></book></catalog>`)
+	expect(t, "不允许文本", (1 == len(errs)) && ("/catalog/book/text()" == errs[0].Path))
+
+	errs = validateSchemaString(t, `<book/>`)
+	expect(t, "根元素没有声明", 1 == len(errs))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title/><author/></book><comment xsi:nil="true">x</comment></catalog>`)
+	expect(t, "nil元素不能有内容", (1 == len(errs)) && ("/catalog/comment" == errs[0].Path))
+}
+
+func Test_Schema_属性和简单类型(t *testing.T) {
+	errs := validateSchemaString(t, `<catalog version="2.0" other="x"><book lang="fr"><title/><price>-1</price><author/></book></catalog>`)
+	expect(t, "错误个数", 5 == len(errs))
+	expect(t, "固定值", ("/catalog" == errs[0].Path) && strings.HasSuffix(errs[0].Message, ":version"))
+	expect(t, "未声明的属性", ("/catalog" == errs[1].Path) && strings.HasSuffix(errs[1].Message, ":other"))
+	expect(t, "枚举值", ("/catalog/book" == errs[2].Path) && strings.Contains(errs[2].Message, "lang"))
+	expect(t, "必选属性", ("/catalog/book" == errs[3].Path) && strings.HasSuffix(errs[3].Message, ":id"))
+	expect(t, "simpleContent", ("/catalog/book/price" == errs[4].Path) && strings.Contains(errs[4].Message, "at least 0"))
+
+	errs = validateSchemaString(t, `<catalog><book id="1" lang="en"><title/><price currency="USD">1.234</price><author/></book></catalog>`)
+	expect(t, "ID格式与小数位数", (2 == len(errs)) && strings.Contains(errs[0].Message, "Invalid attribute id") && strings.Contains(errs[1].Message, "fraction digits"))
+
+	errs = validateSchemaString(t, `<catalog><book id="a" lang="en"><title><b/></title><author/></book></catalog>`)
+	expect(t, "简单类型的元素不能有子元素", (1 == len(errs)) && ("/catalog/book/title/b" == errs[0].Path))
+}
+
+func Test_Schema_加载错误(t *testing.T) {
+	_, err := LoadSchema(strings.NewReader(xsdTestSchema), nil)
+	expect(t, "没有resolver", nil != err)
+
+	_, err = LoadSchema(strings.NewReader(xsdTestSchema), func(location string) (io.ReadCloser, error) {
+		return nil, errors.New("not found")
+	})
+	expect(t, "resolver的错误原样返回", (nil != err) && ("not found" == err.Error()))
+
+	tester := func(body string) error {
+		_, err := LoadSchema(strings.NewReader(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">`+body+`</xs:schema>`), nil)
+		return err
+	}
+
+	expect(t, "合法的schema", nil == tester(`<xs:element name="a" type="xs:string"/>`))
+	expect(t, "未定义的类型", nil != tester(`<xs:element name="a" type="unknown"/>`))
+	expect(t, "未定义的元素", nil != tester(`<xs:element name="a"><xs:complexType><xs:sequence><xs:element ref="b"/></xs:sequence></xs:complexType></xs:element>`))
+	expect(t, "重复定义", nil != tester(`<xs:element name="a"/><xs:element name="a"/>`))
+	expect(t, "循环的类型定义", nil != tester(`<xs:simpleType name="a"><xs:restriction base="b"/></xs:simpleType><xs:simpleType name="b"><xs:restriction base="a"/></xs:simpleType>`))
+	expect(t, "循环的group", nil != tester(`<xs:group name="g"><xs:sequence><xs:group ref="g"/></xs:sequence></xs:group>`))
+	expect(t, "不支持的约束面", nil != tester(`<xs:simpleType name="a"><xs:restriction base="xs:string"><xs:foo value="1"/></xs:restriction></xs:simpleType>`))
+	expect(t, "错误的maxOccurs", nil != tester(`<xs:group name="g"><xs:sequence><xs:element name="a" minOccurs="2" maxOccurs="1"/></xs:sequence></xs:group>`))
+	expect(t, "根元素不是schema", nil != func() error { _, err := LoadSchema(strings.NewReader(`<a/>`), nil); return err }())
+}
+
+func Test_Schema_递归类型(t *testing.T) {
+	schema, err := LoadSchema(strings.NewReader(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+		<xs:element name="tree" type="node"/>
+		<xs:complexType name="node">
+			<xs:sequence><xs:element name="node" type="node" minOccurs="0" maxOccurs="unbounded"/></xs:sequence>
+			<xs:attribute name="depth" type="xs:nonNegativeInteger"/>
+		</xs:complexType>
+	</xs:schema>`), nil)
+	expect(t, "加载schema", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<tree><node depth="1"><node depth="2"/><node depth="-2"/></node></tree>`))
+	errs := schema.Validate(doc)
+	expect(t, "递归校验", (1 == len(errs)) && ("/tree/node/node[2]" == errs[0].Path))
+}
+
+func Test_Schema_嵌套的相对位置(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tinydom")
+	expect(t, "创建临时目录", nil == err)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "common"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "common", "types.xsd"), []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema">
+		<include schemaLocation="base.xsd"/>
+		<simpleType name="code"><restriction base="base"/></simpleType>
+	</schema>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "common", "base.xsd"), []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema">
+		<simpleType name="base"><restriction base="token"><maxLength value="3"/></restriction></simpleType>
+	</schema>`), 0644)
+
+	schema, err := LoadSchema(strings.NewReader(`<schema xmlns="http://www.w3.org/2001/XMLSchema">
+		<include schemaLocation="common/types.xsd"/>
+		<element name="code" type="code"/>
+	</schema>`), DirResolver(dir))
+	expect(t, "相对于被包含的schema查找", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<code>abcd</code>`))
+	expect(t, "使用嵌套包含的类型", (nil != schema) && (1 == len(schema.Validate(doc))))
+}
+
+func Test_Schema_同名的schema文件(t *testing.T) {
+	files := map[string]string{
+		"a/types.xsd": `<schema xmlns="http://www.w3.org/2001/XMLSchema">
+			<include schemaLocation="../shared.xsd"/>
+			<simpleType name="a"><restriction base="shared"/></simpleType>
+		</schema>`,
+		"b/types.xsd": `<schema xmlns="http://www.w3.org/2001/XMLSchema">
+			<include schemaLocation="../shared.xsd"/>
+			<simpleType name="b"><restriction base="shared"/></simpleType>
+		</schema>`,
+		"shared.xsd": `<schema xmlns="http://www.w3.org/2001/XMLSchema">
+			<simpleType name="shared"><restriction base="int"/></simpleType>
+		</schema>`,
+	}
+
+	schema, err := LoadSchema(strings.NewReader(`<schema xmlns="http://www.w3.org/2001/XMLSchema">
+		<include schemaLocation="a/types.xsd"/>
+		<include schemaLocation="b/types.xsd"/>
+		<element name="r"><complexType><sequence>
+			<element name="x" type="a"/><element name="y" type="b"/>
+		</sequence></complexType></element>
+	</schema>`), fileResolver(files))
+	expect(t, "不同目录中的同名文件都被加载,同一个文件只加载一次", nil == err)
+
+	doc, _ := LoadDocument(strings.NewReader(`<r><x>1</x><y>z</y></r>`))
+	expect(t, "两个文件中的类型", (nil != schema) && (1 == len(schema.Validate(doc))))
+}
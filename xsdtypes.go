@@ -0,0 +1,630 @@
+package tinydom
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// xsdSimpleType 是XML Schema的简单类型,内置类型和用户定义的类型都用它表示.
+//
+// 值的校验沿着base逐级进行:先按照本类型的whiteSpace规范化空白,然后依次检查基类型、本层的词法规则和本层的约束面.
+type xsdSimpleType struct {
+	name       string
+	base       *xsdSimpleType   // 基类型,anySimpleType的基类型为nil
+	primitive  string           // 原始类型的名字,用于比较大小和计算长度
+	item       *xsdSimpleType   // 由list定义的列表类型的元素类型
+	members    []*xsdSimpleType // 由union定义的联合类型的成员类型
+	whiteSpace string           // preserve,replace或者collapse,为空时继承基类型
+	lexical    func(string) bool
+	facets     xsdFacets
+}
+
+// xsdFacets 是定义在某一层类型上的约束面
+type xsdFacets struct {
+	patterns       []*regexp.Regexp // 同一层的多个pattern只要满足一个即可
+	enumeration    []string
+	length         int
+	minLength      int
+	maxLength      int
+	minInclusive   string
+	maxInclusive   string
+	minExclusive   string
+	maxExclusive   string
+	totalDigits    int
+	fractionDigits int
+}
+
+func newXSDFacets() xsdFacets {
+	return xsdFacets{length: -1, minLength: -1, maxLength: -1, totalDigits: -1, fractionDigits: -1}
+}
+
+// newXSDSimpleType 创建一个从base派生的简单类型
+func newXSDSimpleType(name string, base *xsdSimpleType) *xsdSimpleType {
+	t := &xsdSimpleType{name: name, base: base, facets: newXSDFacets()}
+	if nil != base {
+		t.primitive = base.primitive
+	}
+	return t
+}
+
+// isList 判断类型是否是列表类型
+func (t *xsdSimpleType) isList() bool {
+	for ; nil != t; t = t.base {
+		if nil != t.item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *xsdSimpleType) whiteSpaceRule() string {
+	for ; nil != t; t = t.base {
+		if "" != t.whiteSpace {
+			return t.whiteSpace
+		}
+	}
+
+	return "preserve"
+}
+
+// validate 校验一个值是否符合该类型,不符合时返回描述原因的错误
+func (t *xsdSimpleType) validate(value string) error {
+	return t.validateNormalized(normalizeXSDSpace(t.whiteSpaceRule(), value))
+}
+
+// equal 判断两个值在该类型的值空间中是否相等,例如decimal的"1.0"与"1.00"相等
+func (t *xsdSimpleType) equal(a string, b string) bool {
+	rule := t.whiteSpaceRule()
+	a, b = normalizeXSDSpace(rule, a), normalizeXSDSpace(rule, b)
+	if c, ok := compareXSDValues(t.primitive, a, b); ok {
+		return 0 == c
+	}
+
+	return a == b
+}
+
+func (t *xsdSimpleType) validateNormalized(value string) error {
+	switch {
+	case nil != t.item:
+		for _, item := range strings.Fields(value) {
+			if err := t.item.validate(item); nil != err {
+				return err
+			}
+		}
+	case nil != t.members:
+		matched := false
+		for _, member := range t.members {
+			if nil == member.validate(value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return errors.New("Value does not match any member type of union:" + value)
+		}
+	case nil != t.base:
+		if err := t.base.validateNormalized(value); nil != err {
+			return err
+		}
+	}
+
+	if (nil != t.lexical) && !t.lexical(value) {
+		return errors.New("Invalid " + t.name + " value:" + value)
+	}
+
+	return t.checkFacets(value)
+}
+
+func (t *xsdSimpleType) checkFacets(value string) error {
+	f := &t.facets
+	if len(f.patterns) > 0 {
+		matched := false
+		for _, pattern := range f.patterns {
+			if pattern.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return errors.New("Value does not match pattern:" + value)
+		}
+	}
+
+	if len(f.enumeration) > 0 {
+		found := false
+		for _, item := range f.enumeration {
+			if c, ok := compareXSDValues(t.primitive, value, item); (ok && (0 == c)) || (value == item) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.New("Value must be one of (" + strings.Join(f.enumeration, "|") + "):" + value)
+		}
+	}
+
+	if (f.length >= 0) || (f.minLength >= 0) || (f.maxLength >= 0) {
+		n := t.measure(value)
+		if (f.length >= 0) && (n != f.length) {
+			return errors.New("Length of value must be " + strconv.Itoa(f.length) + ":" + value)
+		}
+
+		if (f.minLength >= 0) && (n < f.minLength) {
+			return errors.New("Length of value must be at least " + strconv.Itoa(f.minLength) + ":" + value)
+		}
+
+		if (f.maxLength >= 0) && (n > f.maxLength) {
+			return errors.New("Length of value must be at most " + strconv.Itoa(f.maxLength) + ":" + value)
+		}
+	}
+
+	for _, bound := range []struct {
+		limit string
+		ok    func(int) bool
+		name  string
+	}{
+		{f.minInclusive, func(c int) bool { return c >= 0 }, "at least "},
+		{f.maxInclusive, func(c int) bool { return c <= 0 }, "at most "},
+		{f.minExclusive, func(c int) bool { return c > 0 }, "greater than "},
+		{f.maxExclusive, func(c int) bool { return c < 0 }, "less than "},
+	} {
+		if "" == bound.limit {
+			continue
+		}
+
+		if c, ok := compareXSDValues(t.primitive, value, bound.limit); ok && !bound.ok(c) {
+			return errors.New("Value must be " + bound.name + bound.limit + ":" + value)
+		}
+	}
+
+	if (f.totalDigits >= 0) || (f.fractionDigits >= 0) {
+		total, fraction := countDigits(value)
+		if (f.totalDigits >= 0) && (total > f.totalDigits) {
+			return errors.New("Value has more than " + strconv.Itoa(f.totalDigits) + " digits:" + value)
+		}
+
+		if (f.fractionDigits >= 0) && (fraction > f.fractionDigits) {
+			return errors.New("Value has more than " + strconv.Itoa(f.fractionDigits) + " fraction digits:" + value)
+		}
+	}
+
+	return nil
+}
+
+// applyFacet 在类型上增加一个约束面,XML Schema的facet和RELAX NG的param都通过它设置
+func (t *xsdSimpleType) applyFacet(name string, value string) error {
+	var err error
+	switch name {
+	case "pattern":
+		pattern, err := compileXSDPattern(value)
+		if nil != err {
+			return err
+		}
+		t.facets.patterns = append(t.facets.patterns, pattern)
+	case "enumeration":
+		t.facets.enumeration = append(t.facets.enumeration, value)
+	case "length":
+		t.facets.length, err = strconv.Atoi(value)
+	case "minLength":
+		t.facets.minLength, err = strconv.Atoi(value)
+	case "maxLength":
+		t.facets.maxLength, err = strconv.Atoi(value)
+	case "totalDigits":
+		t.facets.totalDigits, err = strconv.Atoi(value)
+	case "fractionDigits":
+		t.facets.fractionDigits, err = strconv.Atoi(value)
+	case "minInclusive":
+		t.facets.minInclusive = value
+	case "maxInclusive":
+		t.facets.maxInclusive = value
+	case "minExclusive":
+		t.facets.minExclusive = value
+	case "maxExclusive":
+		t.facets.maxExclusive = value
+	case "whiteSpace":
+		t.whiteSpace = value
+	default:
+		return errors.New("Unsupported facet:" + name)
+	}
+
+	if nil != err {
+		return errors.New("Invalid value of facet " + name + ":" + value)
+	}
+
+	return nil
+}
+
+// measure 计算length系列约束面使用的长度:列表是元素个数,二进制类型是字节数,其他类型是字符数
+func (t *xsdSimpleType) measure(value string) int {
+	if t.isList() {
+		return len(strings.Fields(value))
+	}
+
+	switch t.primitive {
+	case "hexBinary":
+		return len(value) / 2
+	case "base64Binary":
+		data, _ := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		return len(data)
+	}
+
+	return utf8.RuneCountInString(value)
+}
+
+// countDigits 计算十进制数的有效数字个数和小数位数,前导的0和小数部分末尾的0不计入
+func countDigits(value string) (int, int) {
+	value = strings.TrimLeft(value, "+-")
+	integer, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, fraction = value[:i], value[i+1:]
+	}
+
+	integer = strings.TrimLeft(integer, "0")
+	fraction = strings.TrimRight(fraction, "0")
+	return len(integer) + len(fraction), len(fraction)
+}
+
+func normalizeXSDSpace(rule string, value string) string {
+	switch rule {
+	case "replace":
+		return strings.Map(func(r rune) rune {
+			if ('\t' == r) || ('\n' == r) || ('\r' == r) {
+				return ' '
+			}
+			return r
+		}, value)
+	case "collapse":
+		return strings.Join(strings.Fields(value), " ")
+	}
+
+	return value
+}
+
+// compareXSDValues 按照原始类型比较两个值的大小,第二个返回值表示两个值是否可以比较
+func compareXSDValues(primitive string, a string, b string) (int, bool) {
+	switch primitive {
+	case "decimal":
+		x, ok1 := new(big.Rat).SetString(a)
+		y, ok2 := new(big.Rat).SetString(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case "float", "double":
+		x, err1 := strconv.ParseFloat(a, 64)
+		y, err2 := strconv.ParseFloat(b, 64)
+		if (nil != err1) || (nil != err2) || math.IsNaN(x) || math.IsNaN(y) {
+			return 0, false
+		}
+
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case "dateTime", "date", "time":
+		x, ok1 := parseXSDTime(primitive, a)
+		y, ok2 := parseXSDTime(primitive, b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	case "gYear", "gYearMonth", "gMonth", "gMonthDay", "gDay":
+		return strings.Compare(a, b), true
+	}
+
+	return 0, false
+}
+
+// parseXSDTime 解析日期和时间,没有时区的值按照UTC处理
+func parseXSDTime(primitive string, value string) (time.Time, bool) {
+	layouts := map[string]string{
+		"dateTime": "2006-01-02T15:04:05.999999999",
+		"date":     "2006-01-02",
+		"time":     "15:04:05.999999999",
+	}
+
+	layout := layouts[primitive]
+	if strings.HasSuffix(value, "Z") || xsdTimezone.MatchString(value) {
+		layout += "Z07:00"
+	}
+
+	t, err := time.Parse(layout, value)
+	return t, nil == err
+}
+
+var (
+	xsdTimezone      = regexp.MustCompile(`[+-]\d\d:\d\d$`)
+	xsdFourDigitYear = regexp.MustCompile(`^\d{4}-`)
+)
+
+// ------------------------------------------------------------------
+
+const xsdTZ = `(Z|[+-]\d\d:\d\d)?`
+
+var (
+	xsdLanguagePattern = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	xsdDecimalPattern  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	xsdIntegerPattern  = regexp.MustCompile(`^[+-]?\d+$`)
+	xsdFloatPattern    = regexp.MustCompile(`^([+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?|-?INF|NaN)$`)
+	xsdDurationPattern = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	xsdDateTimePattern = regexp.MustCompile(`^-?\d{4,}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?` + xsdTZ + `$`)
+	xsdDatePattern     = regexp.MustCompile(`^-?\d{4,}-\d\d-\d\d` + xsdTZ + `$`)
+	xsdTimePattern     = regexp.MustCompile(`^\d\d:\d\d:\d\d(\.\d+)?` + xsdTZ + `$`)
+	xsdGYearMonth      = regexp.MustCompile(`^-?\d{4,}-\d\d` + xsdTZ + `$`)
+	xsdGYear           = regexp.MustCompile(`^-?\d{4,}` + xsdTZ + `$`)
+	xsdGMonthDay       = regexp.MustCompile(`^--\d\d-\d\d` + xsdTZ + `$`)
+	xsdGDay            = regexp.MustCompile(`^---\d\d` + xsdTZ + `$`)
+	xsdGMonth          = regexp.MustCompile(`^--\d\d` + xsdTZ + `$`)
+	xsdHexBinary       = regexp.MustCompile(`^([0-9a-fA-F]{2})*$`)
+)
+
+func isNCName(s string) bool {
+	return isName(s) && !strings.Contains(s, ":")
+}
+
+func isQName(s string) bool {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return isNCName(s[:i]) && isNCName(s[i+1:])
+	}
+
+	return isNCName(s)
+}
+
+// isXSDDateTime 在正则表达式的基础上检查日期和时间的各个字段是否在合法范围之内
+func isXSDDateTime(primitive string, pattern *regexp.Regexp) func(string) bool {
+	return func(value string) bool {
+		if !pattern.MatchString(value) {
+			return false
+		}
+
+		// 只有四位数年份的日期能交给time包检查,"24:00:00"在XML Schema中是合法的
+		if strings.HasPrefix(value, "-") || strings.Contains(value, "24:00:00") {
+			return true
+		}
+
+		if ("time" != primitive) && !xsdFourDigitYear.MatchString(value) {
+			return true
+		}
+
+		_, ok := parseXSDTime(primitive, value)
+		return ok
+	}
+}
+
+// xsdBuiltinTypes 是XML Schema的内置简单类型
+var xsdBuiltinTypes = newXSDBuiltinTypes()
+
+func newXSDBuiltinTypes() map[string]*xsdSimpleType {
+	types := make(map[string]*xsdSimpleType)
+	anySimpleType := newXSDSimpleType("anySimpleType", nil)
+	types["anySimpleType"] = anySimpleType
+
+	primitive := func(name string, whiteSpace string, lexical func(string) bool) {
+		t := newXSDSimpleType(name, anySimpleType)
+		t.primitive = name
+		t.whiteSpace = whiteSpace
+		t.lexical = lexical
+		types[name] = t
+	}
+
+	derive := func(name string, base string, whiteSpace string, lexical func(string) bool) *xsdSimpleType {
+		t := newXSDSimpleType(name, types[base])
+		t.whiteSpace = whiteSpace
+		t.lexical = lexical
+		types[name] = t
+		return t
+	}
+
+	list := func(name string, item string) {
+		t := newXSDSimpleType(name, anySimpleType)
+		t.item = types[item]
+		t.whiteSpace = "collapse"
+		t.facets.minLength = 1
+		types[name] = t
+	}
+
+	bounded := func(name string, base string, min string, max string) {
+		t := derive(name, base, "", nil)
+		t.facets.minInclusive = min
+		t.facets.maxInclusive = max
+	}
+
+	primitive("string", "preserve", nil)
+	primitive("boolean", "collapse", func(s string) bool {
+		return ("true" == s) || ("false" == s) || ("1" == s) || ("0" == s)
+	})
+	primitive("decimal", "collapse", xsdDecimalPattern.MatchString)
+	primitive("float", "collapse", xsdFloatPattern.MatchString)
+	primitive("double", "collapse", xsdFloatPattern.MatchString)
+	primitive("duration", "collapse", func(s string) bool {
+		return xsdDurationPattern.MatchString(s) && !strings.HasSuffix(s, "P") && !strings.HasSuffix(s, "T")
+	})
+	primitive("dateTime", "collapse", isXSDDateTime("dateTime", xsdDateTimePattern))
+	primitive("date", "collapse", isXSDDateTime("date", xsdDatePattern))
+	primitive("time", "collapse", isXSDDateTime("time", xsdTimePattern))
+	primitive("gYearMonth", "collapse", xsdGYearMonth.MatchString)
+	primitive("gYear", "collapse", xsdGYear.MatchString)
+	primitive("gMonthDay", "collapse", xsdGMonthDay.MatchString)
+	primitive("gDay", "collapse", xsdGDay.MatchString)
+	primitive("gMonth", "collapse", xsdGMonth.MatchString)
+	primitive("hexBinary", "collapse", xsdHexBinary.MatchString)
+	primitive("base64Binary", "collapse", func(s string) bool {
+		_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		return nil == err
+	})
+	primitive("anyURI", "collapse", nil)
+	primitive("QName", "collapse", isQName)
+	primitive("NOTATION", "collapse", isQName)
+
+	derive("normalizedString", "string", "replace", nil)
+	derive("token", "normalizedString", "collapse", nil)
+	derive("language", "token", "", xsdLanguagePattern.MatchString)
+	derive("NMTOKEN", "token", "", isNmtoken)
+	derive("Name", "token", "", isName)
+	derive("NCName", "Name", "", isNCName)
+	derive("ID", "NCName", "", nil)
+	derive("IDREF", "NCName", "", nil)
+	derive("ENTITY", "NCName", "", nil)
+	list("NMTOKENS", "NMTOKEN")
+	list("IDREFS", "IDREF")
+	list("ENTITIES", "ENTITY")
+
+	derive("integer", "decimal", "", xsdIntegerPattern.MatchString)
+	bounded("nonPositiveInteger", "integer", "", "0")
+	bounded("negativeInteger", "nonPositiveInteger", "", "-1")
+	bounded("long", "integer", "-9223372036854775808", "9223372036854775807")
+	bounded("int", "long", "-2147483648", "2147483647")
+	bounded("short", "int", "-32768", "32767")
+	bounded("byte", "short", "-128", "127")
+	bounded("nonNegativeInteger", "integer", "0", "")
+	bounded("unsignedLong", "nonNegativeInteger", "", "18446744073709551615")
+	bounded("unsignedInt", "unsignedLong", "", "4294967295")
+	bounded("unsignedShort", "unsignedInt", "", "65535")
+	bounded("unsignedByte", "unsignedShort", "", "255")
+	bounded("positiveInteger", "nonNegativeInteger", "1", "")
+
+	return types
+}
+
+// ------------------------------------------------------------------
+
+// xsdNameStartClass和xsdNameClass是\i和\c在字符类中的写法
+const (
+	xsdNameStartClass = `_:A-Za-z\x{C0}-\x{D6}\x{D8}-\x{F6}\x{F8}-\x{2FF}\x{370}-\x{37D}\x{37F}-\x{1FFF}\x{200C}-\x{200D}\x{2070}-\x{218F}\x{2C00}-\x{2FEF}\x{3001}-\x{D7FF}\x{F900}-\x{FDCF}\x{FDF0}-\x{FFFD}`
+	xsdNameClass      = xsdNameStartClass + `\-.0-9\x{B7}\x{300}-\x{36F}\x{203F}-\x{2040}`
+)
+
+// compileXSDPattern 将XML Schema的正则表达式翻译成Go的正则表达式.
+// XML Schema的正则表达式总是匹配整个值,'^'和'$'是普通字符,'.'不匹配回车和换行,
+// 并且支持\i、\c等多字符转义.不支持字符类相减以及\p{IsBlock}这类按Unicode区块匹配的写法.
+func compileXSDPattern(pattern string) (*regexp.Regexp, error) {
+	var sb bytes.Buffer
+	inClass := false
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case '\\' == r:
+			if i+1 >= len(runes) {
+				return nil, errors.New("Invalid escape at the end of pattern:" + pattern)
+			}
+
+			i++
+			escape, err := translateXSDEscape(runes[i], inClass, pattern)
+			if nil != err {
+				return nil, err
+			}
+
+			if ('p' == runes[i]) || ('P' == runes[i]) {
+				end := i
+				for (end < len(runes)) && ('}' != runes[end]) {
+					end++
+				}
+
+				block := string(runes[i : end+1])
+				if strings.HasPrefix(block[1:], "{Is") {
+					return nil, errors.New("Unicode blocks are not supported in pattern:" + pattern)
+				}
+				escape = `\` + block
+				i = end
+			}
+			sb.WriteString(escape)
+		case inClass:
+			switch {
+			case (']' == r):
+				inClass = false
+				sb.WriteRune(r)
+			case ('-' == r) && (i+1 < len(runes)) && ('[' == runes[i+1]):
+				return nil, errors.New("Character class subtraction is not supported in pattern:" + pattern)
+			case '[' == r:
+				sb.WriteString(`\[`)
+			default:
+				sb.WriteRune(r)
+			}
+		case '[' == r:
+			inClass = true
+			sb.WriteRune(r)
+			if (i+1 < len(runes)) && ('^' == runes[i+1]) {
+				sb.WriteRune('^')
+				i++
+			}
+		case ('^' == r) || ('$' == r):
+			sb.WriteString(`\` + string(r))
+		case '.' == r:
+			sb.WriteString(`[^\n\r]`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	re, err := regexp.Compile(`^(?:` + sb.String() + `)$`)
+	if nil != err {
+		return nil, errors.New("Invalid pattern:" + pattern)
+	}
+
+	return re, nil
+}
+
+func translateXSDEscape(r rune, inClass bool, pattern string) (string, error) {
+	var class string
+	negated := false
+	switch r {
+	case 'i', 'I':
+		class, negated = xsdNameStartClass, ('I' == r)
+	case 'c', 'C':
+		class, negated = xsdNameClass, ('C' == r)
+	case 'd', 'D':
+		class, negated = `\p{Nd}`, ('D' == r)
+	case 'w', 'W':
+		class, negated = `\p{P}\p{Z}\p{C}`, ('w' == r)
+	case 's', 'S':
+		class, negated = ` \t\n\r`, ('S' == r)
+	case 'n':
+		return `\n`, nil
+	case 'r':
+		return `\r`, nil
+	case 't':
+		return `\t`, nil
+	case 'p', 'P':
+		return "", nil
+	case '\\', '|', '.', '?', '*', '+', '(', ')', '{', '}', '-', '[', ']', '^', '$':
+		return `\` + string(r), nil
+	default:
+		return "", errors.New("Invalid escape \\" + string(r) + " in pattern:" + pattern)
+	}
+
+	if !inClass {
+		if negated {
+			return "[^" + class + "]", nil
+		}
+		return "[" + class + "]", nil
+	}
+
+	if negated {
+		return "", errors.New("Negated escape \\" + string(r) + " in character class is not supported in pattern:" + pattern)
+	}
+
+	return class, nil
+}
@@ -0,0 +1,85 @@
+package tinydom
+
+import (
+	"testing"
+)
+
+func Test_XSDTypes_内置类型(t *testing.T) {
+	tester := func(name string, value string) bool {
+		return nil == xsdBuiltinTypes[name].validate(value)
+	}
+
+	expect(t, "string保留空白", tester("string", " a\tb "))
+	expect(t, "boolean", tester("boolean", " true ") && tester("boolean", "0") && !tester("boolean", "yes"))
+	expect(t, "decimal", tester("decimal", "-1.50") && tester("decimal", ".5") && !tester("decimal", "1e3"))
+	expect(t, "integer", tester("integer", "+42") && !tester("integer", "4.2"))
+	expect(t, "int的范围", tester("int", "2147483647") && !tester("int", "2147483648"))
+	expect(t, "unsignedByte的范围", tester("unsignedByte", "255") && !tester("unsignedByte", "-1") && !tester("unsignedByte", "256"))
+	expect(t, "positiveInteger", tester("positiveInteger", "1") && !tester("positiveInteger", "0"))
+	expect(t, "double", tester("double", "1.5E-3") && tester("double", "-INF") && tester("double", "NaN") && !tester("double", "abc"))
+	expect(t, "date", tester("date", "2024-02-29") && tester("date", "2024-01-01Z") && !tester("date", "2023-02-29") && !tester("date", "2024-1-1"))
+	expect(t, "dateTime", tester("dateTime", "2024-01-01T10:20:30.5+08:00") && !tester("dateTime", "2024-01-01 10:20:30"))
+	expect(t, "time", tester("time", "23:59:59") && !tester("time", "25:00:00"))
+	expect(t, "duration", tester("duration", "P1Y2M3DT4H5M6.7S") && tester("duration", "-PT1H") && !tester("duration", "P") && !tester("duration", "P1YT"))
+	expect(t, "gYear", tester("gYear", "2024") && !tester("gYear", "24"))
+	expect(t, "hexBinary", tester("hexBinary", "0aFF") && !tester("hexBinary", "0aF"))
+	expect(t, "base64Binary", tester("base64Binary", "aGVs bG8=") && !tester("base64Binary", "a==="))
+	expect(t, "language", tester("language", "zh-CN") && !tester("language", "zh_CN"))
+	expect(t, "NCName", tester("NCName", "_a.b-c") && !tester("NCName", "a:b") && !tester("NCName", "1a"))
+	expect(t, "QName", tester("QName", "xs:string") && !tester("QName", "a:b:c"))
+	expect(t, "NMTOKENS", tester("NMTOKENS", " 1a  b ") && !tester("NMTOKENS", "  "))
+	expect(t, "token折叠空白", tester("token", "  a \n b  "))
+}
+
+func Test_XSDTypes_约束面(t *testing.T) {
+	code := newXSDSimpleType("code", xsdBuiltinTypes["string"])
+	pattern, err := compileXSDPattern(`[A-Z]{2}\d{3}`)
+	expect(t, "编译pattern", nil == err)
+	code.facets.patterns = append(code.facets.patterns, pattern)
+	code.facets.maxLength = 5
+	expect(t, "pattern", (nil == code.validate("AB123")) && (nil != code.validate("ab123")) && (nil != code.validate("AB1234")))
+
+	price := newXSDSimpleType("price", xsdBuiltinTypes["decimal"])
+	price.facets.minExclusive = "0"
+	price.facets.maxInclusive = "999.99"
+	price.facets.totalDigits = 5
+	price.facets.fractionDigits = 2
+	expect(t, "数值范围", (nil == price.validate("999.99")) && (nil != price.validate("0")) && (nil != price.validate("1000")))
+	expect(t, "小数位数", (nil == price.validate("1.50")) && (nil != price.validate("1.505")))
+
+	size := newXSDSimpleType("size", xsdBuiltinTypes["token"])
+	size.facets.enumeration = []string{"S", "M", "L"}
+	expect(t, "枚举", (nil == size.validate(" M ")) && (nil != size.validate("XL")))
+
+	list := newXSDSimpleType("sizes", xsdBuiltinTypes["anySimpleType"])
+	list.item = size
+	limited := newXSDSimpleType("limited", list)
+	limited.facets.length = 2
+	expect(t, "列表", (nil == limited.validate("S L")) && (nil != limited.validate("S")) && (nil != limited.validate("S XL")))
+
+	union := newXSDSimpleType("union", xsdBuiltinTypes["anySimpleType"])
+	union.members = []*xsdSimpleType{xsdBuiltinTypes["int"], size}
+	expect(t, "联合", (nil == union.validate("12")) && (nil == union.validate("L")) && (nil != union.validate("XL")))
+
+	day := newXSDSimpleType("day", xsdBuiltinTypes["date"])
+	day.facets.minInclusive = "2024-01-01"
+	expect(t, "日期比较", (nil == day.validate("2024-06-01")) && (nil != day.validate("2023-12-31")))
+}
+
+func Test_XSDTypes_正则表达式(t *testing.T) {
+	tester := func(pattern string, value string) bool {
+		re, err := compileXSDPattern(pattern)
+		return (nil == err) && re.MatchString(value)
+	}
+
+	expect(t, "匹配整个值", tester(`\d+`, "123") && !tester(`\d+`, "a123"))
+	expect(t, "^和$是普通字符", tester(`^a$`, "^a$") && !tester(`^a$`, "a"))
+	expect(t, ".不匹配换行", tester(`a.c`, "abc") && !tester(`a.c`, "a\nc"))
+	expect(t, "名字字符", tester(`\i\c*`, "_a1") && !tester(`\i\c*`, "1a") && tester(`[\i]+`, "ab"))
+	expect(t, "Unicode类别", tester(`\p{Lu}\p{Ll}*`, "Hello"))
+
+	for _, pattern := range []string{`[a-z-[aeiou]]`, `\p{IsBasicLatin}`, `[\I]`, `\q`, `(a`} {
+		_, err := compileXSDPattern(pattern)
+		expect(t, "不支持的写法:"+pattern, nil != err)
+	}
+}
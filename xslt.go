@@ -0,0 +1,1772 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xsltNamespace 是XSLT的名字空间,样式表中只有这个名字空间中的元素才是XSLT指令
+const xsltNamespace = "http://www.w3.org/1999/XSL/Transform"
+
+// xsltMaxDepth 模板调用的最大嵌套深度,防止无限递归的样式表耗尽栈空间
+const xsltMaxDepth = 3000
+
+// Stylesheet 是编译好的XSLT 1.0样式表,可以反复转换不同的文档.
+//
+// 支持的顶层元素有template、variable、param、output、include、import、strip-space和preserve-space(后两个被忽略,
+// 因为LoadDocument已经丢弃了全空白的文本).支持的指令有apply-templates、call-template、with-param、sort、value-of、
+// for-each、if、choose、copy、copy-of、element、attribute、text、variable、comment、processing-instruction和message.
+// 模板按照导入优先级、priority(缺省按照模式计算)和在样式表中的顺序选择.
+//
+// 表达式使用XPath 1.0,另外还可以使用XSLT的current()、generate-id()、format-number()和system-property()函数.
+// 结果树片段(内容不为空的variable)可以直接当作节点集使用.
+//
+// 源文档中的名字不带名字空间前缀,所以模式和表达式中的名字测试只比较本地名.
+type Stylesheet struct {
+	Output    XSLTOutput
+	Functions map[string]XPathFunc // 扩展函数,转换时可以在表达式中调用
+	OnMessage func(message string) // 处理terminate不为yes的xsl:message,为nil时丢弃消息
+
+	rules   []*xsltRule
+	named   map[string]*xsltTemplate
+	globals []*xsltVariable
+}
+
+// XSLTOutput 是样式表中xsl:output的内容,只有method为xml的结果文档会带有XML声明
+type XSLTOutput struct {
+	Method             string // xml或者html
+	Version            string
+	Encoding           string
+	Standalone         string
+	Indent             bool
+	OmitXMLDeclaration bool
+	DoctypePublic      string
+	DoctypeSystem      string
+}
+
+// PrintOptions 返回与xsl:output的indent对应的输出选项
+func (o XSLTOutput) PrintOptions() PrintOptions {
+	if o.Indent {
+		return PrintPretty
+	}
+
+	return PrintStream
+}
+
+// LoadStylesheet 加载一个XSLT 1.0样式表,include和import通过resolver加载,resolver可以为nil
+func LoadStylesheet(rd io.Reader, resolver Resolver) (*Stylesheet, error) {
+	doc, err := loadStylesheetDocument(rd)
+	if nil != err {
+		return nil, err
+	}
+
+	c := &xsltCompiler{
+		resolver:  resolver,
+		locations: make(map[XMLNode]string),
+		sheet: &Stylesheet{
+			Output: XSLTOutput{Method: "xml"},
+			named:  make(map[string]*xsltTemplate),
+		},
+	}
+
+	if err := c.module(doc.RootElement()); nil != err {
+		return nil, err
+	}
+
+	return c.sheet, nil
+}
+
+// loadStylesheetDocument 加载样式表时保留名字空间前缀和空白,前缀用于区分XSLT指令和文字结果元素
+func loadStylesheetDocument(rd io.Reader) (XMLDocument, error) {
+	builder := newDocumentBuilder()
+	if err := Parse(rd, builder, ParseOptions{KeepSpace: true, KeepPrefix: true}); nil != err {
+		return nil, err
+	}
+
+	return builder.doc, nil
+}
+
+// Transform 对文档doc执行转换,返回新的结果文档,doc不会被修改.
+// params为顶层xsl:param提供值,值的类型与XPathFunc的返回值相同,params可以为nil.
+func (s *Stylesheet) Transform(doc XMLDocument, params map[string]interface{}) (XMLDocument, error) {
+	t := &xsltTransformer{
+		sheet:     s,
+		matches:   make(map[*xsltRule]map[XMLNode]map[XPathNode]bool),
+		ids:       make(map[XPathNode]string),
+		fragments: make(map[XMLNode]bool),
+	}
+
+	functions := map[string]XPathFunc{
+		"current": func(context XPathNode, args []interface{}) (interface{}, error) {
+			return []XPathNode{t.current}, nil
+		},
+		"generate-id":     t.generateID,
+		"format-number":   xsltFormatNumberFunc,
+		"system-property": xsltSystemProperty,
+	}
+	for name, f := range s.Functions {
+		functions[name] = f
+	}
+	t.evaluator = newXPathEvaluator(&XPathEnv{Functions: functions})
+
+	root := xsltContext{node: XPathNode{Node: doc}, position: 1, size: 1, variables: make(map[string]interface{})}
+	for _, global := range s.globals {
+		value, ok := params[global.name]
+		if !ok || !global.param {
+			var err error
+			if value, err = global.value(t, root); nil != err {
+				return nil, err
+			}
+		}
+		root.variables = xsltBind(root.variables, global.name, value)
+	}
+	t.globals = root.variables
+
+	result := NewDocument()
+	if ("xml" == s.Output.Method) && !s.Output.OmitXMLDeclaration {
+		result.SetDeclaration(XMLDeclaration{Version: s.Output.Version, Encoding: s.Output.Encoding, Standalone: s.Output.Standalone})
+	}
+
+	if err := t.applyTemplates(root, []XPathNode{root.node}, "", nil, result); nil != err {
+		return nil, err
+	}
+
+	if elem := result.RootElement(); (nil != elem) && ("" != s.Output.DoctypeSystem) {
+		doctype := "DOCTYPE " + elem.Name()
+		if "" != s.Output.DoctypePublic {
+			doctype += ` PUBLIC "` + s.Output.DoctypePublic + `"`
+		} else {
+			doctype += " SYSTEM"
+		}
+		elem.InsertFront(NewDirective(doctype + ` "` + s.Output.DoctypeSystem + `"`))
+	}
+
+	return result, nil
+}
+
+// ------------------------------------------------------------------
+
+// xsltRule 是模板的match中用'|'分开的一个选择,每个选择有自己的缺省优先级
+type xsltRule struct {
+	template   *xsltTemplate
+	pattern    *XPath // 从文档根求值的模式
+	priority   float64
+	precedence int // 导入优先级,越大越优先
+	order      int // 在样式表中的顺序
+}
+
+type xsltTemplate struct {
+	name   string
+	mode   string
+	params []*xsltVariable
+	body   xsltSequence
+}
+
+// xsltContext 是执行指令时的上下文,variables中包含全局变量和所有可见的局部变量
+type xsltContext struct {
+	node      XPathNode
+	position  int
+	size      int
+	variables map[string]interface{}
+}
+
+// xsltInstruction 是编译好的指令,out是结果树中当前的父节点
+type xsltInstruction interface {
+	exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error
+}
+
+// xsltSequence 是一组依次执行的指令,variable定义的局部变量对后面的兄弟指令可见
+type xsltSequence []xsltInstruction
+
+func (s xsltSequence) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	for _, inst := range s {
+		if v, ok := inst.(*xsltVariable); ok {
+			value, err := v.value(t, ctx)
+			if nil != err {
+				return err
+			}
+			ctx.variables = xsltBind(ctx.variables, v.name, value)
+			continue
+		}
+
+		if err := inst.exec(t, ctx, out); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xsltBind 返回增加了一个变量的新变量表,原来的变量表不受影响
+func xsltBind(variables map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(variables)+1)
+	for k, v := range variables {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// xsltVariable 是variable、param或者with-param,selectX和body都为空时值为空字符串
+type xsltVariable struct {
+	name    string
+	param   bool
+	selectX *XPath
+	body    xsltSequence
+}
+
+func (v *xsltVariable) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	return nil
+}
+
+func (v *xsltVariable) value(t *xsltTransformer, ctx xsltContext) (interface{}, error) {
+	if nil != v.selectX {
+		return t.evaluate(v.selectX, ctx)
+	}
+
+	if 0 == len(v.body) {
+		return "", nil
+	}
+
+	fragment, err := t.fragment(v.body, ctx)
+	if nil != err {
+		return nil, err
+	}
+	return []XPathNode{{Node: fragment}}, nil
+}
+
+// xsltText 是样式表中的文本和xsl:text
+type xsltText string
+
+func (x xsltText) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	return t.text(out, string(x))
+}
+
+// xsltNamespaceDecl 是需要复制到结果中的名字空间声明,prefix为空时是缺省名字空间
+type xsltNamespaceDecl struct {
+	prefix string
+	uri    string
+}
+
+type xsltLiteralElement struct {
+	name       string
+	namespaces []xsltNamespaceDecl
+	attributes []xsltAttributeTemplate
+	body       xsltSequence
+}
+
+type xsltAttributeTemplate struct {
+	name  string
+	value xsltAVT
+}
+
+func (x *xsltLiteralElement) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	elem := NewElement(x.name)
+	for _, ns := range x.namespaces {
+		name := "xmlns"
+		if "" != ns.prefix {
+			name += ":" + ns.prefix
+		}
+
+		elem.SetAttribute(name, ns.uri)
+	}
+
+	for _, attr := range x.attributes {
+		value, err := attr.value.eval(t, ctx)
+		if nil != err {
+			return err
+		}
+		elem.SetAttribute(attr.name, value)
+	}
+
+	if err := t.add(out, elem); nil != err {
+		return err
+	}
+
+	return x.body.exec(t, ctx, elem)
+}
+
+// xsltNamespaceInScope 返回结果树中node处名字为name(xmlns或者xmlns:prefix)的名字空间声明的值
+func xsltNamespaceInScope(node XMLNode, name string) string {
+	for ; nil != node; node = node.Parent() {
+		if elem := node.ToElement(); nil != elem {
+			if attr := elem.FindAttribute(name); nil != attr {
+				return attr.Value()
+			}
+		}
+	}
+
+	return ""
+}
+
+type xsltValueOf struct {
+	selectX *XPath
+}
+
+func (x *xsltValueOf) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	value, err := t.evaluate(x.selectX, ctx)
+	if nil != err {
+		return err
+	}
+
+	return t.text(out, XPathString(value))
+}
+
+type xsltApplyTemplates struct {
+	selectX *XPath
+	mode    string
+	sorts   []*xsltSort
+	params  []*xsltVariable
+}
+
+func (x *xsltApplyTemplates) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	nodes, err := t.selectNodes(x.selectX, ctx)
+	if nil != err {
+		return err
+	}
+
+	if nodes, err = t.sort(nodes, x.sorts, ctx); nil != err {
+		return err
+	}
+
+	params, err := t.params(x.params, ctx)
+	if nil != err {
+		return err
+	}
+
+	return t.applyTemplates(ctx, nodes, x.mode, params, out)
+}
+
+type xsltCallTemplate struct {
+	name   string
+	params []*xsltVariable
+}
+
+func (x *xsltCallTemplate) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	template, ok := t.sheet.named[x.name]
+	if !ok {
+		return errors.New("Undefined template:" + x.name)
+	}
+
+	params, err := t.params(x.params, ctx)
+	if nil != err {
+		return err
+	}
+
+	return t.invoke(template, ctx, params, out)
+}
+
+type xsltForEach struct {
+	selectX *XPath
+	sorts   []*xsltSort
+	body    xsltSequence
+}
+
+func (x *xsltForEach) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	nodes, err := t.selectNodes(x.selectX, ctx)
+	if nil != err {
+		return err
+	}
+
+	if nodes, err = t.sort(nodes, x.sorts, ctx); nil != err {
+		return err
+	}
+
+	for i, node := range nodes {
+		item := xsltContext{node: node, position: i + 1, size: len(nodes), variables: ctx.variables}
+		if err := x.body.exec(t, item, out); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xsltSort 是xsl:sort,order和data-type是属性值模板
+type xsltSort struct {
+	selectX  *XPath
+	order    xsltAVT
+	dataType xsltAVT
+}
+
+// xsltChoose 是xsl:if(只有一个分支)和xsl:choose,otherwise可以为空
+type xsltChoose struct {
+	tests     []*XPath
+	bodies    []xsltSequence
+	otherwise xsltSequence
+}
+
+func (x *xsltChoose) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	for i, test := range x.tests {
+		value, err := t.evaluate(test, ctx)
+		if nil != err {
+			return err
+		}
+
+		if XPathBoolean(value) {
+			return x.bodies[i].exec(t, ctx, out)
+		}
+	}
+
+	return x.otherwise.exec(t, ctx, out)
+}
+
+type xsltCopy struct {
+	body xsltSequence
+}
+
+func (x *xsltCopy) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	node := ctx.node
+	switch {
+	case nil != node.Attribute:
+		return t.attribute(out, node.Attribute.Name(), node.Attribute.Value())
+	case nil != node.Node.ToElement():
+		elem := NewElement(node.Node.ToElement().Name())
+		if err := t.add(out, elem); nil != err {
+			return err
+		}
+		return x.body.exec(t, ctx, elem)
+	case (nil != node.Node.ToDocument()) || t.fragments[node.Node]:
+		return x.body.exec(t, ctx, out)
+	}
+
+	return t.copy(out, node)
+}
+
+type xsltCopyOf struct {
+	selectX *XPath
+}
+
+func (x *xsltCopyOf) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	value, err := t.evaluate(x.selectX, ctx)
+	if nil != err {
+		return err
+	}
+
+	nodes, ok := value.([]XPathNode)
+	if !ok {
+		return t.text(out, XPathString(value))
+	}
+
+	for _, node := range nodes {
+		if err := t.copy(out, node); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xsltConstructor 是xsl:element、xsl:attribute、xsl:comment、xsl:processing-instruction和xsl:message
+type xsltConstructor struct {
+	kind      string
+	name      xsltAVT
+	terminate bool
+	body      xsltSequence
+}
+
+func (x *xsltConstructor) exec(t *xsltTransformer, ctx xsltContext, out XMLNode) error {
+	name, err := x.name.eval(t, ctx)
+	if nil != err {
+		return err
+	}
+
+	if "element" == x.kind {
+		if err := checkXMLName("element", name); nil != err {
+			return err
+		}
+
+		elem := NewElement(name)
+		if err := t.add(out, elem); nil != err {
+			return err
+		}
+		return x.body.exec(t, ctx, elem)
+	}
+
+	fragment, err := t.fragment(x.body, ctx)
+	if nil != err {
+		return err
+	}
+	value := XPathNode{Node: fragment}.Value()
+
+	switch x.kind {
+	case "attribute":
+		return t.attribute(out, name, value)
+	case "comment":
+		if err := checkXMLComment(value); nil != err {
+			return err
+		}
+		return t.add(out, NewComment(value))
+	case "processing-instruction":
+		if err := checkXMLProcInst(name, value, false); nil != err {
+			return err
+		}
+		return t.add(out, NewProcInst(name, strings.TrimLeft(value, " \t\r\n")))
+	}
+
+	if x.terminate {
+		return errors.New("Transform terminated by message:" + value)
+	}
+
+	if nil != t.sheet.OnMessage {
+		t.sheet.OnMessage(value)
+	}
+	return nil
+}
+
+// xsltAVT 是属性值模板,由文本和花括号中的表达式组成
+type xsltAVT []xsltAVTPiece
+
+type xsltAVTPiece struct {
+	text string
+	expr *XPath
+}
+
+func (a xsltAVT) eval(t *xsltTransformer, ctx xsltContext) (string, error) {
+	var text bytes.Buffer
+	for _, piece := range a {
+		if nil == piece.expr {
+			text.WriteString(piece.text)
+			continue
+		}
+
+		value, err := t.evaluate(piece.expr, ctx)
+		if nil != err {
+			return "", err
+		}
+		text.WriteString(XPathString(value))
+	}
+
+	return text.String(), nil
+}
+
+// compileAVT 编译属性值模板,"{{"和"}}"分别表示'{'和'}',表达式中字符串里的'}'不结束表达式
+func compileAVT(source string) (xsltAVT, error) {
+	var avt xsltAVT
+	var text bytes.Buffer
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case ('{' == c) && strings.HasPrefix(source[i:], "{{"), ('}' == c) && strings.HasPrefix(source[i:], "}}"):
+			text.WriteByte(c)
+			i++
+		case '}' == c:
+			return nil, errors.New("Unexpected '}' in attribute value template:" + source)
+		case '{' == c:
+			end := i + 1
+			for quote := byte(0); end < len(source); end++ {
+				if 0 != quote {
+					if quote == source[end] {
+						quote = 0
+					}
+				} else if ('"' == source[end]) || ('\'' == source[end]) {
+					quote = source[end]
+				} else if '}' == source[end] {
+					break
+				}
+			}
+
+			if end >= len(source) {
+				return nil, errors.New("Unclosed '{' in attribute value template:" + source)
+			}
+
+			x, err := CompileXPath(source[i+1 : end])
+			if nil != err {
+				return nil, err
+			}
+
+			if 0 != text.Len() {
+				avt = append(avt, xsltAVTPiece{text: text.String()})
+				text.Reset()
+			}
+			avt = append(avt, xsltAVTPiece{expr: x})
+			i = end
+		default:
+			text.WriteByte(c)
+		}
+	}
+
+	if 0 != text.Len() {
+		avt = append(avt, xsltAVTPiece{text: text.String()})
+	}
+	return avt, nil
+}
+
+// ------------------------------------------------------------------
+
+type xsltTransformer struct {
+	sheet     *Stylesheet
+	evaluator *xpathEvaluator
+	current   XPathNode
+	globals   map[string]interface{}
+	matches   map[*xsltRule]map[XMLNode]map[XPathNode]bool // 每个规则在每棵树中匹配的节点
+	ids       map[XPathNode]string
+	fragments map[XMLNode]bool // 承载结果树片段的元素
+	depth     int
+}
+
+func (t *xsltTransformer) evaluate(x *XPath, ctx xsltContext) (interface{}, error) {
+	t.current = ctx.node
+	t.evaluator.env.Variables = ctx.variables
+	return x.expr.eval(t.evaluator, xpathContext{node: ctx.node, position: ctx.position, size: ctx.size})
+}
+
+func (t *xsltTransformer) selectNodes(x *XPath, ctx xsltContext) ([]XPathNode, error) {
+	value, err := t.evaluate(x, ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	nodes, ok := value.([]XPathNode)
+	if !ok {
+		return nil, errors.New("XPath expression is not a node-set:" + x.String())
+	}
+	return nodes, nil
+}
+
+// fragment 执行body生成一个结果树片段,片段用一个没有名字的元素承载,把它当作根节点看待
+func (t *xsltTransformer) fragment(body xsltSequence, ctx xsltContext) (XMLNode, error) {
+	fragment := NewElement("")
+	t.fragments[fragment] = true
+	if err := body.exec(t, ctx, fragment); nil != err {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (t *xsltTransformer) params(params []*xsltVariable, ctx xsltContext) (map[string]interface{}, error) {
+	if 0 == len(params) {
+		return nil, nil
+	}
+
+	result := make(map[string]interface{}, len(params))
+	for _, param := range params {
+		value, err := param.value(t, ctx)
+		if nil != err {
+			return nil, err
+		}
+		result[param.name] = value
+	}
+	return result, nil
+}
+
+// applyTemplates 依次为每个节点选择模板并执行,没有匹配的模板时执行内置模板
+func (t *xsltTransformer) applyTemplates(ctx xsltContext, nodes []XPathNode, mode string, params map[string]interface{}, out XMLNode) error {
+	for i, node := range nodes {
+		item := xsltContext{node: node, position: i + 1, size: len(nodes), variables: t.globals}
+		template, err := t.find(node, mode)
+		if nil != err {
+			return err
+		}
+
+		if nil != template {
+			if err := t.invoke(template, item, params, out); nil != err {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case nil != node.Attribute, nil != node.Node.ToText():
+			err = t.text(out, node.Value())
+		case (nil != node.Node.ToElement()) || (nil != node.Node.ToDocument()):
+			var children []XPathNode
+			xpathAxis(xpathAxisChild, node, func(child XPathNode) {
+				children = append(children, child)
+			})
+			err = t.applyTemplates(item, children, mode, nil, out)
+		}
+
+		if nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// invoke 执行模板,模板中只能看到全局变量和传入的参数,没有传入的参数使用缺省值
+func (t *xsltTransformer) invoke(template *xsltTemplate, ctx xsltContext, params map[string]interface{}, out XMLNode) error {
+	if t.depth >= xsltMaxDepth {
+		return errors.New("Template recursion is too deep")
+	}
+	t.depth++
+	defer func() { t.depth-- }()
+
+	ctx.variables = t.globals
+	for _, param := range template.params {
+		value, ok := params[param.name]
+		if !ok {
+			var err error
+			if value, err = param.value(t, ctx); nil != err {
+				return err
+			}
+		}
+		ctx.variables = xsltBind(ctx.variables, param.name, value)
+	}
+
+	return template.body.exec(t, ctx, out)
+}
+
+// find 返回mode中匹配node的优先级最高的模板,优先级相同时选择样式表中靠后的模板
+func (t *xsltTransformer) find(node XPathNode, mode string) (*xsltTemplate, error) {
+	root := node.Node
+	for nil != root.Parent() {
+		root = root.Parent()
+	}
+
+	var best *xsltRule
+	for _, rule := range t.sheet.rules {
+		if mode != rule.template.mode {
+			continue
+		}
+
+		if (nil != best) && ((rule.precedence < best.precedence) || ((rule.precedence == best.precedence) && (rule.priority < best.priority))) {
+			continue
+		}
+
+		trees, ok := t.matches[rule]
+		if !ok {
+			trees = make(map[XMLNode]map[XPathNode]bool)
+			t.matches[rule] = trees
+		}
+
+		matched, ok := trees[root]
+		if !ok {
+			ctx := xsltContext{node: XPathNode{Node: root}, position: 1, size: 1, variables: t.globals}
+			nodes, err := t.selectNodes(rule.pattern, ctx)
+			if nil != err {
+				return nil, err
+			}
+
+			matched = make(map[XPathNode]bool, len(nodes))
+			for _, n := range nodes {
+				matched[n] = true
+			}
+			trees[root] = matched
+		}
+
+		if matched[node] {
+			best = rule
+		}
+	}
+
+	if nil == best {
+		return nil, nil
+	}
+	return best.template, nil
+}
+
+// sort 按照xsl:sort对节点排序,排序是稳定的,所有的键都相同的节点保持原来的顺序
+func (t *xsltTransformer) sort(nodes []XPathNode, sorts []*xsltSort, ctx xsltContext) ([]XPathNode, error) {
+	if 0 == len(sorts) {
+		return nodes, nil
+	}
+
+	descending := make([]bool, len(sorts))
+	numeric := make([]bool, len(sorts))
+	for i, s := range sorts {
+		order, err := s.order.eval(t, ctx)
+		if nil != err {
+			return nil, err
+		}
+
+		dataType, err := s.dataType.eval(t, ctx)
+		if nil != err {
+			return nil, err
+		}
+		descending[i] = "descending" == order
+		numeric[i] = "number" == dataType
+	}
+
+	keys := make([][]interface{}, len(nodes))
+	for i, node := range nodes {
+		item := xsltContext{node: node, position: i + 1, size: len(nodes), variables: ctx.variables}
+		for j, s := range sorts {
+			value, err := t.evaluate(s.selectX, item)
+			if nil != err {
+				return nil, err
+			}
+
+			if numeric[j] {
+				keys[i] = append(keys[i], XPathNumber(value))
+			} else {
+				keys[i] = append(keys[i], XPathString(value))
+			}
+		}
+	}
+
+	index := make([]int, len(nodes))
+	for i := range index {
+		index[i] = i
+	}
+
+	sort.Stable(&xsltSortIndex{index, keys, descending})
+
+	result := make([]XPathNode, len(nodes))
+	for i, j := range index {
+		result[i] = nodes[j]
+	}
+	return result, nil
+}
+
+// xsltSortIndex 按照xsl:sort计算出的排序键排序节点的下标
+type xsltSortIndex struct {
+	index      []int
+	keys       [][]interface{}
+	descending []bool
+}
+
+func (s *xsltSortIndex) Len() int      { return len(s.index) }
+func (s *xsltSortIndex) Swap(a, b int) { s.index[a], s.index[b] = s.index[b], s.index[a] }
+func (s *xsltSortIndex) Less(a, b int) bool {
+	for j := range s.descending {
+		c := xsltCompareKeys(s.keys[s.index[a]][j], s.keys[s.index[b]][j])
+		if s.descending[j] {
+			c = -c
+		}
+		if 0 != c {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// xsltCompareKeys 比较两个排序键,NaN比所有的数字都小
+func xsltCompareKeys(a interface{}, b interface{}) int {
+	if s, ok := a.(string); ok {
+		return strings.Compare(s, b.(string))
+	}
+
+	x, y := a.(float64), b.(float64)
+	switch {
+	case math.IsNaN(x) && math.IsNaN(y):
+		return 0
+	case math.IsNaN(x), x < y:
+		return -1
+	case math.IsNaN(y), x > y:
+		return 1
+	}
+	return 0
+}
+
+// add 把节点添加到结果树中,相邻的文本被合并
+func (t *xsltTransformer) add(out XMLNode, node XMLNode) error {
+	if text := node.ToText(); (nil != text) && !text.CDATA() {
+		return t.text(out, text.Value())
+	}
+
+	// 结果树中已经有同样的名字空间声明时,不再重复声明
+	if elem := node.ToElement(); nil != elem {
+		var redundant []string
+		elem.ForeachAttribute(func(attribute XMLAttribute) int {
+			name := attribute.Name()
+			if (("xmlns" == name) || strings.HasPrefix(name, "xmlns:")) && (attribute.Value() == xsltNamespaceInScope(out, name)) {
+				redundant = append(redundant, name)
+			}
+			return 0
+		})
+
+		for _, name := range redundant {
+			elem.DeleteAttribute(name)
+		}
+	}
+
+	if nil != out.InsertEndChild(node) {
+		return nil
+	}
+
+	if nil != node.ToElement() {
+		return errors.New("Result document must have only one root element:" + node.ToElement().Name())
+	}
+	return errors.New("Node can not be added to the result document")
+}
+
+func (t *xsltTransformer) text(out XMLNode, text string) error {
+	if "" == text {
+		return nil
+	}
+
+	if nil != out.ToDocument() {
+		if "" == strings.TrimSpace(text) {
+			return nil
+		}
+		return errors.New("Text can not be added to the result document:" + text)
+	}
+
+	if last := out.LastChild(); (nil != last) && (nil != last.ToText()) && !last.ToText().CDATA() {
+		last.SetValue(last.Value() + text)
+		return nil
+	}
+
+	out.InsertEndChild(NewText(text))
+	return nil
+}
+
+func (t *xsltTransformer) attribute(out XMLNode, name string, value string) error {
+	if err := checkXMLName("attribute", name); nil != err {
+		return err
+	}
+
+	if ("xmlns" == name) || strings.HasPrefix(name, "xmlns:") {
+		return errors.New("Namespace declaration can not be created by attribute:" + name)
+	}
+
+	elem := out.ToElement()
+	if (nil == elem) || t.fragments[out] {
+		return errors.New("Attribute must be added to an element:" + name)
+	}
+
+	if !elem.NoChildren() {
+		return errors.New("Attribute must be added before the children of element " + elem.Name() + ":" + name)
+	}
+
+	elem.SetAttribute(name, value)
+	return nil
+}
+
+// copy 把源树中的节点连同后代一起复制到结果树,文档和结果树片段复制它们的子节点
+func (t *xsltTransformer) copy(out XMLNode, node XPathNode) error {
+	if nil != node.Attribute {
+		return t.attribute(out, node.Attribute.Name(), node.Attribute.Value())
+	}
+
+	if (nil != node.Node.ToDocument()) || t.fragments[node.Node] {
+		for child := node.Node.FirstChild(); nil != child; child = child.Next() {
+			if !isXPathNode(child) {
+				continue
+			}
+
+			if err := t.add(out, cloneNode(child)); nil != err {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return t.add(out, cloneNode(node.Node))
+}
+
+// cloneNode 返回节点的深拷贝,拷贝不属于任何文档
+func cloneNode(node XMLNode) XMLNode {
+	var clone XMLNode
+	switch {
+	case nil != node.ToElement():
+		elem := NewElement(node.ToElement().Name())
+		node.ToElement().ForeachAttribute(func(attribute XMLAttribute) int {
+			elem.SetAttribute(attribute.Name(), attribute.Value())
+			return 0
+		})
+		clone = elem
+	case nil != node.ToText():
+		text := NewText(node.Value())
+		text.SetCDATA(node.ToText().CDATA())
+		return text
+	case nil != node.ToComment():
+		return NewComment(node.Value())
+	case nil != node.ToProcInst():
+		return NewProcInst(node.ToProcInst().Target(), node.ToProcInst().Instruction())
+	case nil != node.ToDirective():
+		return NewDirective(node.Value())
+	default:
+		clone = NewDocument()
+	}
+
+	for child := node.FirstChild(); nil != child; child = child.Next() {
+		clone.InsertEndChild(cloneNode(child))
+	}
+	return clone
+}
+
+// generateID 实现generate-id(),同一个节点在一次转换中总是得到同一个标识
+func (t *xsltTransformer) generateID(context XPathNode, args []interface{}) (interface{}, error) {
+	node := context
+	if 0 != len(args) {
+		nodes, ok := args[0].([]XPathNode)
+		if !ok {
+			return nil, errors.New("Argument of XPath function must be a node-set")
+		}
+
+		if 0 == len(nodes) {
+			return "", nil
+		}
+		node = t.evaluator.sortNodes(nodes)[0]
+	}
+
+	id, ok := t.ids[node]
+	if !ok {
+		id = "id" + strconv.Itoa(len(t.ids)+1)
+		t.ids[node] = id
+	}
+	return id, nil
+}
+
+func xsltSystemProperty(context XPathNode, args []interface{}) (interface{}, error) {
+	if 1 != len(args) {
+		return nil, errors.New("Wrong number of arguments for XPath function:system-property")
+	}
+
+	name := XPathString(args[0])
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+
+	switch name {
+	case "version":
+		return 1.0, nil
+	case "vendor":
+		return "tinydom", nil
+	case "vendor-url":
+		return "https://github.com/tinyhubs/tinydom", nil
+	}
+	return "", nil
+}
+
+func xsltFormatNumberFunc(context XPathNode, args []interface{}) (interface{}, error) {
+	if 2 != len(args) {
+		return nil, errors.New("Wrong number of arguments for XPath function:format-number")
+	}
+
+	return xsltFormatNumber(XPathNumber(args[0]), XPathString(args[1])), nil
+}
+
+// xsltFormatNumber 按照JDK DecimalFormat风格的模式格式化数字,支持'0'、'#'、'.'、','、'%'以及';'分隔的负数子模式
+func xsltFormatNumber(value float64, pattern string) string {
+	if math.IsNaN(value) {
+		return "NaN"
+	}
+
+	positive, negative := pattern, ""
+	if i := strings.IndexByte(pattern, ';'); i >= 0 {
+		positive, negative = pattern[:i], pattern[i+1:]
+	}
+
+	prefix, number, suffix := xsltSplitNumberPattern(positive)
+	if value < 0 {
+		if "" != negative {
+			prefix, _, suffix = xsltSplitNumberPattern(negative)
+		} else {
+			prefix = "-" + prefix
+		}
+		value = -value
+	}
+
+	if strings.ContainsRune(prefix+suffix, '%') {
+		value *= 100
+	} else if strings.ContainsRune(prefix+suffix, '‰') {
+		value *= 1000
+	}
+
+	if math.IsInf(value, 0) {
+		return prefix + "Infinity" + suffix
+	}
+
+	integer, fraction := number, ""
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		integer, fraction = number[:i], number[i+1:]
+	}
+
+	minInt := strings.Count(integer, "0")
+	minFrac := strings.Count(fraction, "0")
+	maxFrac := minFrac + strings.Count(fraction, "#")
+	grouping := 0
+	if i := strings.LastIndexByte(integer, ','); i >= 0 {
+		grouping = len(integer) - i - 1
+	}
+
+	digits := strconv.FormatFloat(value, 'f', maxFrac, 64)
+	intDigits, fracDigits := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intDigits, fracDigits = digits[:i], digits[i+1:]
+	}
+
+	for (len(fracDigits) > minFrac) && strings.HasSuffix(fracDigits, "0") {
+		fracDigits = fracDigits[:len(fracDigits)-1]
+	}
+
+	intDigits = strings.TrimLeft(intDigits, "0")
+	for len(intDigits) < minInt {
+		intDigits = "0" + intDigits
+	}
+
+	if grouping > 0 {
+		var grouped bytes.Buffer
+		for i, c := range intDigits {
+			if (i > 0) && (0 == (len(intDigits)-i)%grouping) {
+				grouped.WriteByte(',')
+			}
+			grouped.WriteRune(c)
+		}
+		intDigits = grouped.String()
+	}
+
+	if "" != fracDigits {
+		intDigits += "." + fracDigits
+	}
+	if "" == intDigits {
+		intDigits = "0"
+	}
+	return prefix + intDigits + suffix
+}
+
+// xsltSplitNumberPattern 把数字模式分成前缀、数字部分和后缀
+func xsltSplitNumberPattern(pattern string) (string, string, string) {
+	first := strings.IndexAny(pattern, "#0,.")
+	if first < 0 {
+		return pattern, "", ""
+	}
+
+	last := strings.LastIndexAny(pattern, "#0,.")
+	return pattern[:first], pattern[first : last+1], pattern[last+1:]
+}
+
+// ------------------------------------------------------------------
+
+type xsltCompiler struct {
+	resolver   Resolver
+	sheet      *Stylesheet
+	loading    []string           // 正在加载的include和import,用于检查循环引用
+	locations  map[XMLNode]string // 被加载的样式表文档到它的位置,用于解析其中的相对位置
+	precedence int
+	order      int
+}
+
+// xslName 返回XSLT指令的本地名,elem不是XSLT指令时返回false
+func xslName(elem XMLElement) (string, bool) {
+	prefix, local := "", elem.Name()
+	if i := strings.IndexByte(local, ':'); i >= 0 {
+		prefix, local = local[:i], local[i+1:]
+	}
+
+	return local, xsltNamespace == xsltLookupNamespace(elem, prefix)
+}
+
+// xsltLookupNamespace 在样式表中查找前缀对应的名字空间
+func xsltLookupNamespace(elem XMLElement, prefix string) string {
+	name := "xmlns"
+	if "" != prefix {
+		name += ":" + prefix
+	}
+
+	return xsltNamespaceInScope(elem, name)
+}
+
+// module 编译一个样式表模块:先加载所有的import,再编译其它的顶层元素
+func (c *xsltCompiler) module(root XMLElement) error {
+	if name, ok := xslName(root); !ok || (("stylesheet" != name) && ("transform" != name)) {
+		return errors.New("XSLT stylesheet must have the root element xsl:stylesheet or xsl:transform")
+	}
+
+	for child := root.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		if name, ok := xslName(child); ok && ("import" == name) {
+			if err := c.load(child); nil != err {
+				return err
+			}
+		}
+	}
+
+	precedence := c.precedence
+	c.precedence++
+	return c.topLevel(root, precedence)
+}
+
+func (c *xsltCompiler) topLevel(root XMLElement, precedence int) error {
+	for child := root.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		name, ok := xslName(child)
+		if !ok {
+			// 其它名字空间的顶层元素被忽略
+			continue
+		}
+
+		var err error
+		switch name {
+		case "import", "strip-space", "preserve-space":
+		case "include":
+			err = c.include(child, precedence)
+		case "template":
+			err = c.template(child, precedence)
+		case "variable", "param":
+			var global *xsltVariable
+			if global, err = c.variable(child); nil == err {
+				c.sheet.globals = append(c.sheet.globals, global)
+			}
+		case "output":
+			err = c.output(child)
+		default:
+			err = errors.New("Unsupported XSLT element:" + child.Name())
+		}
+
+		if nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open 通过resolver加载include或者import引用的样式表,返回它的根元素
+func (c *xsltCompiler) open(elem XMLElement) (XMLElement, string, error) {
+	href, err := c.attribute(elem, "href")
+	if nil != err {
+		return nil, "", err
+	}
+
+	if nil == c.resolver {
+		return nil, "", errors.New("Missing resolver for XSLT " + elem.Name() + ":" + href)
+	}
+
+	href = resolveLocation(c.locations[treeRoot(elem)], href)
+
+	if containsString(c.loading, href) {
+		return nil, "", errors.New("Recursive XSLT " + elem.Name() + ":" + href)
+	}
+
+	rd, err := c.resolver(href)
+	if nil != err {
+		return nil, "", err
+	}
+	defer rd.Close()
+
+	doc, err := loadStylesheetDocument(rd)
+	if nil != err {
+		return nil, "", err
+	}
+
+	c.locations[doc] = href
+	return doc.RootElement(), href, nil
+}
+
+// load 加载import引用的样式表,它的导入优先级比当前的样式表低
+func (c *xsltCompiler) load(elem XMLElement) error {
+	root, href, err := c.open(elem)
+	if nil != err {
+		return err
+	}
+
+	c.loading = append(c.loading, href)
+	defer func() { c.loading = c.loading[:len(c.loading)-1] }()
+	return c.module(root)
+}
+
+// include 把被包含的样式表的顶层元素当作当前样式表的一部分编译
+func (c *xsltCompiler) include(elem XMLElement, precedence int) error {
+	root, href, err := c.open(elem)
+	if nil != err {
+		return err
+	}
+
+	if name, ok := xslName(root); !ok || (("stylesheet" != name) && ("transform" != name)) {
+		return errors.New("XSLT stylesheet must have the root element xsl:stylesheet or xsl:transform:" + href)
+	}
+
+	c.loading = append(c.loading, href)
+	defer func() { c.loading = c.loading[:len(c.loading)-1] }()
+
+	for child := root.FirstChildElement(""); nil != child; child = child.NextElement("") {
+		if name, ok := xslName(child); ok && ("import" == name) {
+			if err := c.load(child); nil != err {
+				return err
+			}
+		}
+	}
+	return c.topLevel(root, precedence)
+}
+
+func (c *xsltCompiler) attribute(elem XMLElement, name string) (string, error) {
+	attr := elem.FindAttribute(name)
+	if nil == attr {
+		return "", errors.New(elem.Name() + " must have the attribute " + name)
+	}
+	return attr.Value(), nil
+}
+
+func (c *xsltCompiler) expr(elem XMLElement, name string) (*XPath, error) {
+	source, err := c.attribute(elem, name)
+	if nil != err {
+		return nil, err
+	}
+	return CompileXPath(source)
+}
+
+func (c *xsltCompiler) output(elem XMLElement) error {
+	output := &c.sheet.Output
+	var err error
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		value := attribute.Value()
+		switch attribute.Name() {
+		case "method":
+			if ("xml" != value) && ("html" != value) {
+				err = errors.New("Unsupported output method:" + value)
+				return 1
+			}
+			output.Method = value
+		case "version":
+			output.Version = value
+		case "encoding":
+			output.Encoding = value
+		case "standalone":
+			output.Standalone = value
+		case "indent":
+			output.Indent = "yes" == value
+		case "omit-xml-declaration":
+			output.OmitXMLDeclaration = "yes" == value
+		case "doctype-public":
+			output.DoctypePublic = value
+		case "doctype-system":
+			output.DoctypeSystem = value
+		}
+		return 0
+	})
+	return err
+}
+
+func (c *xsltCompiler) template(elem XMLElement, precedence int) error {
+	template := &xsltTemplate{
+		name: elem.Attribute("name", ""),
+		mode: elem.Attribute("mode", ""),
+	}
+
+	match := elem.Attribute("match", "")
+	if ("" == match) && ("" == template.name) {
+		return errors.New("template must have the attribute match or name")
+	}
+
+	var first XMLNode
+	for first = elem.FirstChild(); nil != first; first = first.Next() {
+		if !xsltIgnorable(first) {
+			if name, ok := xsltInstructionName(first); !ok || ("param" != name) {
+				break
+			}
+
+			param, err := c.variable(first.ToElement())
+			if nil != err {
+				return err
+			}
+			template.params = append(template.params, param)
+		}
+	}
+
+	var err error
+	if template.body, err = c.sequenceFrom(first); nil != err {
+		return err
+	}
+
+	if "" != template.name {
+		c.sheet.named[template.name] = template
+	}
+
+	if "" == match {
+		return nil
+	}
+
+	x, err := CompileXPath(match)
+	if nil != err {
+		return err
+	}
+
+	for _, alternative := range xsltAlternatives(x.expr) {
+		pattern, ok := xpathPatternExpr(alternative)
+		if !ok {
+			return errors.New("Invalid XPath pattern:" + match)
+		}
+
+		rule := &xsltRule{
+			template:   template,
+			pattern:    &XPath{source: match, expr: pattern},
+			priority:   xsltDefaultPriority(alternative),
+			precedence: precedence,
+			order:      c.order,
+		}
+		c.order++
+
+		if priority := elem.Attribute("priority", ""); "" != priority {
+			if rule.priority, err = strconv.ParseFloat(strings.TrimSpace(priority), 64); nil != err {
+				return errors.New("Invalid template priority:" + priority)
+			}
+		}
+		c.sheet.rules = append(c.sheet.rules, rule)
+	}
+
+	return nil
+}
+
+// xsltAlternatives 把用'|'连接的模式拆分成多个选择
+func xsltAlternatives(e xpathExpr) []xpathExpr {
+	if union, ok := e.(*xpathBinary); ok && ("|" == union.op) {
+		return append(xsltAlternatives(union.left), xsltAlternatives(union.right)...)
+	}
+	return []xpathExpr{e}
+}
+
+// xsltDefaultPriority 计算模式的缺省优先级:名字测试为0,通配和节点类型测试为-0.5,其它更复杂的模式为0.5
+func xsltDefaultPriority(e xpathExpr) float64 {
+	path, ok := e.(*xpathPath)
+	if !ok || path.absolute || (nil != path.filter) || (1 != len(path.steps)) {
+		return 0.5
+	}
+
+	step := path.steps[0]
+	if (0 != len(step.predicates)) || ((xpathAxisChild != step.axis) && (xpathAxisAttribute != step.axis)) {
+		return 0.5
+	}
+
+	if ((xpathTestName == step.test) && ("*" != step.name)) || ((xpathTestProcInst == step.test) && ("" != step.name)) {
+		return 0
+	}
+	return -0.5
+}
+
+func (c *xsltCompiler) variable(elem XMLElement) (*xsltVariable, error) {
+	name, _ := xslName(elem)
+	v := &xsltVariable{param: "param" == name}
+
+	var err error
+	if v.name, err = c.attribute(elem, "name"); nil != err {
+		return nil, err
+	}
+
+	if nil != elem.FindAttribute("select") {
+		if v.selectX, err = c.expr(elem, "select"); nil != err {
+			return nil, err
+		}
+
+		if nil != elem.FirstChild() {
+			return nil, errors.New(elem.Name() + " with the attribute select must be empty:" + v.name)
+		}
+		return v, nil
+	}
+
+	v.body, err = c.sequence(elem)
+	return v, err
+}
+
+// xsltIgnorable 判断样式表中的节点是否被忽略:注释、处理指令以及不在xml:space="preserve"之内的全空白文本
+func xsltIgnorable(node XMLNode) bool {
+	if (nil != node.ToComment()) || (nil != node.ToProcInst()) {
+		return true
+	}
+
+	if (nil == node.ToText()) || ("" != strings.TrimSpace(node.Value())) {
+		return false
+	}
+
+	for parent := node.Parent(); nil != parent; parent = parent.Parent() {
+		if elem := parent.ToElement(); nil != elem {
+			if space := elem.FindAttribute("xml:space"); nil != space {
+				return "preserve" != space.Value()
+			}
+		}
+	}
+	return true
+}
+
+// xsltInstructionName 返回节点作为XSLT指令的本地名,节点不是XSLT指令时返回false
+func xsltInstructionName(node XMLNode) (string, bool) {
+	if elem := node.ToElement(); nil != elem {
+		return xslName(elem)
+	}
+	return "", false
+}
+
+func (c *xsltCompiler) sequence(elem XMLElement) (xsltSequence, error) {
+	return c.sequenceFrom(elem.FirstChild())
+}
+
+// sequenceFrom 编译从first开始的所有兄弟节点
+func (c *xsltCompiler) sequenceFrom(first XMLNode) (xsltSequence, error) {
+	var seq xsltSequence
+	for node := first; nil != node; node = node.Next() {
+		if xsltIgnorable(node) {
+			continue
+		}
+
+		if nil != node.ToText() {
+			seq = append(seq, xsltText(node.Value()))
+			continue
+		}
+
+		inst, err := c.instruction(node.ToElement())
+		if nil != err {
+			return nil, err
+		}
+
+		if nil != inst {
+			seq = append(seq, inst)
+		}
+	}
+
+	return seq, nil
+}
+
+func (c *xsltCompiler) instruction(elem XMLElement) (xsltInstruction, error) {
+	name, ok := xslName(elem)
+	if !ok {
+		return c.literal(elem)
+	}
+
+	var err error
+	switch name {
+	case "apply-templates":
+		x := &xsltApplyTemplates{selectX: xsltChildNodes, mode: elem.Attribute("mode", "")}
+		if nil != elem.FindAttribute("select") {
+			if x.selectX, err = c.expr(elem, "select"); nil != err {
+				return nil, err
+			}
+		}
+		x.sorts, x.params, err = c.sortsAndParams(elem, false)
+		return x, err
+	case "call-template":
+		x := &xsltCallTemplate{}
+		if x.name, err = c.attribute(elem, "name"); nil != err {
+			return nil, err
+		}
+		_, x.params, err = c.sortsAndParams(elem, true)
+		return x, err
+	case "value-of":
+		x := &xsltValueOf{}
+		x.selectX, err = c.expr(elem, "select")
+		return x, err
+	case "for-each":
+		return c.forEach(elem)
+	case "if":
+		x := &xsltChoose{tests: make([]*XPath, 1), bodies: make([]xsltSequence, 1)}
+		if x.tests[0], err = c.expr(elem, "test"); nil != err {
+			return nil, err
+		}
+		x.bodies[0], err = c.sequence(elem)
+		return x, err
+	case "choose":
+		return c.choose(elem)
+	case "copy":
+		x := &xsltCopy{}
+		x.body, err = c.sequence(elem)
+		return x, err
+	case "copy-of":
+		x := &xsltCopyOf{}
+		x.selectX, err = c.expr(elem, "select")
+		return x, err
+	case "element", "attribute", "processing-instruction":
+		x := &xsltConstructor{kind: name}
+		source, err := c.attribute(elem, "name")
+		if nil != err {
+			return nil, err
+		}
+
+		if x.name, err = compileAVT(source); nil != err {
+			return nil, err
+		}
+		x.body, err = c.sequence(elem)
+		return x, err
+	case "comment", "message":
+		x := &xsltConstructor{kind: name, terminate: "yes" == elem.Attribute("terminate", "no")}
+		x.body, err = c.sequence(elem)
+		return x, err
+	case "text":
+		if nil != elem.FirstChildElement("") {
+			return nil, errors.New("text must contain only text:" + elem.Name())
+		}
+		return xsltText(XPathNode{Node: elem}.Value()), nil
+	case "variable":
+		return c.variable(elem)
+	case "fallback":
+		// 所有支持的指令都不需要fallback
+		return nil, nil
+	}
+
+	return nil, errors.New("Unsupported XSLT instruction:" + elem.Name())
+}
+
+// xsltChildNodes 是apply-templates缺省的select,即child::node()
+var xsltChildNodes = &XPath{source: "node()", expr: &xpathPath{steps: []*xpathStep{{axis: xpathAxisChild, test: xpathTestNode}}}}
+
+// sortsAndParams 编译apply-templates和call-template的子元素,它们只能是sort(call-template不能有sort)和with-param
+func (c *xsltCompiler) sortsAndParams(elem XMLElement, call bool) ([]*xsltSort, []*xsltVariable, error) {
+	var sorts []*xsltSort
+	var params []*xsltVariable
+	for node := elem.FirstChild(); nil != node; node = node.Next() {
+		if xsltIgnorable(node) {
+			continue
+		}
+
+		name, ok := xsltInstructionName(node)
+		switch {
+		case ok && ("with-param" == name):
+			param, err := c.variable(node.ToElement())
+			if nil != err {
+				return nil, nil, err
+			}
+			params = append(params, param)
+		case ok && ("sort" == name) && !call:
+			s, err := c.sort(node.ToElement())
+			if nil != err {
+				return nil, nil, err
+			}
+			sorts = append(sorts, s)
+		default:
+			return nil, nil, errors.New("Unexpected content of " + elem.Name())
+		}
+	}
+
+	return sorts, params, nil
+}
+
+func (c *xsltCompiler) sort(elem XMLElement) (*xsltSort, error) {
+	s := &xsltSort{}
+
+	var err error
+	if s.selectX, err = CompileXPath(elem.Attribute("select", ".")); nil != err {
+		return nil, err
+	}
+
+	if s.order, err = compileAVT(elem.Attribute("order", "ascending")); nil != err {
+		return nil, err
+	}
+
+	s.dataType, err = compileAVT(elem.Attribute("data-type", "text"))
+	return s, err
+}
+
+func (c *xsltCompiler) forEach(elem XMLElement) (xsltInstruction, error) {
+	x := &xsltForEach{}
+
+	var err error
+	if x.selectX, err = c.expr(elem, "select"); nil != err {
+		return nil, err
+	}
+
+	var node XMLNode
+	for node = elem.FirstChild(); nil != node; node = node.Next() {
+		if !xsltIgnorable(node) {
+			if name, ok := xsltInstructionName(node); !ok || ("sort" != name) {
+				break
+			}
+
+			s, err := c.sort(node.ToElement())
+			if nil != err {
+				return nil, err
+			}
+			x.sorts = append(x.sorts, s)
+		}
+	}
+
+	x.body, err = c.sequenceFrom(node)
+	return x, err
+}
+
+func (c *xsltCompiler) choose(elem XMLElement) (xsltInstruction, error) {
+	x := &xsltChoose{}
+	for node := elem.FirstChild(); nil != node; node = node.Next() {
+		if xsltIgnorable(node) {
+			continue
+		}
+
+		name, ok := xsltInstructionName(node)
+		switch {
+		case ok && ("when" == name) && (nil == x.otherwise):
+			test, err := c.expr(node.ToElement(), "test")
+			if nil != err {
+				return nil, err
+			}
+
+			body, err := c.sequence(node.ToElement())
+			if nil != err {
+				return nil, err
+			}
+			x.tests = append(x.tests, test)
+			x.bodies = append(x.bodies, body)
+		case ok && ("otherwise" == name) && (nil == x.otherwise):
+			body, err := c.sequence(node.ToElement())
+			if nil != err {
+				return nil, err
+			}
+			x.otherwise = append(xsltSequence{}, body...)
+		default:
+			return nil, errors.New("Unexpected content of " + elem.Name())
+		}
+	}
+
+	if 0 == len(x.tests) {
+		return nil, errors.New(elem.Name() + " must have at least one when")
+	}
+	return x, nil
+}
+
+// literal 编译文字结果元素,作用域中的名字空间声明除了XSLT名字空间和被排除的前缀之外都会被复制到结果中
+func (c *xsltCompiler) literal(elem XMLElement) (xsltInstruction, error) {
+	x := &xsltLiteralElement{name: elem.Name()}
+
+	excluded := make(map[string]bool)
+	declared := make(map[string]string)
+	for node := XMLNode(elem); nil != node; node = node.Parent() {
+		e := node.ToElement()
+		if nil == e {
+			continue
+		}
+
+		_, isXSL := xslName(e)
+		exclude := "xsl:exclude-result-prefixes"
+		if isXSL {
+			exclude = "exclude-result-prefixes"
+		}
+		for _, prefix := range strings.Fields(e.Attribute(exclude, "")) {
+			if "#default" == prefix {
+				prefix = ""
+			}
+			excluded[prefix] = true
+		}
+
+		e.ForeachAttribute(func(attribute XMLAttribute) int {
+			name := attribute.Name()
+			if ("xmlns" != name) && !strings.HasPrefix(name, "xmlns:") {
+				return 0
+			}
+
+			prefix := strings.TrimPrefix(strings.TrimPrefix(name, "xmlns"), ":")
+			if _, ok := declared[prefix]; !ok {
+				declared[prefix] = attribute.Value()
+			}
+			return 0
+		})
+	}
+
+	var prefixes []string
+	for prefix, uri := range declared {
+		if !excluded[prefix] && (xsltNamespace != uri) && ("" != uri) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		x.namespaces = append(x.namespaces, xsltNamespaceDecl{prefix: prefix, uri: declared[prefix]})
+	}
+
+	var err error
+	elem.ForeachAttribute(func(attribute XMLAttribute) int {
+		name := attribute.Name()
+		if ("xmlns" == name) || strings.HasPrefix(name, "xmlns:") {
+			return 0
+		}
+
+		if i := strings.IndexByte(name, ':'); (i >= 0) && (xsltNamespace == xsltLookupNamespace(elem, name[:i])) {
+			return 0
+		}
+
+		var value xsltAVT
+		if value, err = compileAVT(attribute.Value()); nil != err {
+			return 1
+		}
+		x.attributes = append(x.attributes, xsltAttributeTemplate{name: name, value: value})
+		return 0
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	x.body, err = c.sequence(elem)
+	return x, err
+}
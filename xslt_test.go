@@ -0,0 +1,282 @@
+package tinydom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const xsltTestDocument = `<?xml version="1.0"?>
+<library>
+	<book id="b1" lang="en" price="12.5"><title>Go</title><author>Alan</author><author>Brian</author></book>
+	<book id="b2" lang="zh" price="30"><title>XML</title><author>Wang</author></book>
+	<book id="b3" price="7.5"><title>Data</title></book>
+	<!--end-->
+</library>`
+
+func transformString(t *testing.T, stylesheet string, params map[string]interface{}) (string, error) {
+	sheet, err := LoadStylesheet(strings.NewReader(stylesheet), xsltTestResolver)
+	expect(t, "加载样式表", nil == err)
+	if nil != err {
+		return "", err
+	}
+
+	doc, err := LoadDocument(strings.NewReader(xsltTestDocument))
+	expect(t, "返回值检测", nil == err)
+
+	result, err := sheet.Transform(doc, params)
+	if nil != err {
+		return "", err
+	}
+
+	buf := bytes.NewBufferString("")
+	expect(t, "输出结果", nil == SaveDocument(result, buf, sheet.Output.PrintOptions()))
+	return buf.String(), nil
+}
+
+func xsltTestResolver(location string) (io.ReadCloser, error) {
+	switch location {
+	case "common.xsl":
+		return ioutil.NopCloser(strings.NewReader(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+			<xsl:template match="author">author:<xsl:value-of select="."/></xsl:template>
+			<xsl:template match="title"><h2><xsl:apply-templates/></h2></xsl:template>
+		</xsl:stylesheet>`)), nil
+	case "loop.xsl":
+		return ioutil.NopCloser(strings.NewReader(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+			<xsl:include href="loop.xsl"/>
+		</xsl:stylesheet>`)), nil
+	}
+	return nil, errors.New("not found:" + location)
+}
+
+func Test_XSLT_模板和内置模板(t *testing.T) {
+	out, err := transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:output omit-xml-declaration="yes"/>
+		<xsl:template match="/"><report><xsl:apply-templates select="library/book"/></report></xsl:template>
+		<xsl:template match="book">
+			<item id="{@id}" label="[{{{title}}}]"><xsl:apply-templates/></item>
+		</xsl:template>
+		<xsl:template match="book[@lang='zh']/author" priority="1"><zh/></xsl:template>
+		<xsl:template match="author">
+			<a><xsl:value-of select="position()"/>/<xsl:value-of select="last()"/></a>
+		</xsl:template>
+		<xsl:template match="book/author" priority="-0.1"><never/></xsl:template>
+		<xsl:template match="*" mode="other"><never/></xsl:template>
+	</xsl:stylesheet>`, nil)
+
+	exp := `<report><item id="b1" label="[{Go}]">Go<a>2/3</a><a>3/3</a></item><item id="b2" label="[{XML}]">XML<zh/></item><item id="b3" label="[{Data}]">Data</item></report>`
+	expect(t, "返回值检测", nil == err)
+	expect(t, "检查输出结果", exp == out)
+}
+
+func Test_XSLT_指令(t *testing.T) {
+	out, err := transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:param name="currency" select="'$'"/>
+		<xsl:variable name="count" select="count(//book)"/>
+		<xsl:template match="/library">
+			<books total="{$count}">
+				<xsl:for-each select="book">
+					<xsl:sort select="@price" data-type="number" order="descending"/>
+					<xsl:variable name="title" select="title"/>
+					<xsl:element name="{name()}-{position()}">
+						<xsl:attribute name="cost"><xsl:value-of select="$currency"/><xsl:value-of select="format-number(@price, '#,##0.00')"/></xsl:attribute>
+						<xsl:choose>
+							<xsl:when test="@lang = 'en'">english</xsl:when>
+							<xsl:when test="@lang">other</xsl:when>
+							<xsl:otherwise>unknown</xsl:otherwise>
+						</xsl:choose>
+						<xsl:if test="author"><xsl:text> by </xsl:text><xsl:value-of select="author[1]"/></xsl:if>
+						<xsl:copy-of select="$title"/>
+					</xsl:element>
+				</xsl:for-each>
+				<xsl:copy><xsl:copy-of select="@*"/></xsl:copy>
+				<xsl:comment>count=<xsl:value-of select="$count"/></xsl:comment>
+				<xsl:processing-instruction name="pi">a="1"</xsl:processing-instruction>
+			</books>
+		</xsl:template>
+	</xsl:stylesheet>`, map[string]interface{}{"currency": "¥"})
+
+	exp := `<?xml version="1.0"?><books total="3">` +
+		`<book-1 cost="¥30.00">other by Wang<title>XML</title></book-1>` +
+		`<book-2 cost="¥12.50">english by Alan<title>Go</title></book-2>` +
+		`<book-3 cost="¥7.50">unknown<title>Data</title></book-3>` +
+		`<library/><!--count=3--><?pi a="1"?></books>`
+	expect(t, "返回值检测", nil == err)
+	expect(t, "检查输出结果", exp == out)
+}
+
+func Test_XSLT_命名模板和参数(t *testing.T) {
+	out, err := transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:template match="/">
+			<list>
+				<xsl:call-template name="repeat">
+					<xsl:with-param name="n" select="3"/>
+				</xsl:call-template>
+				<xsl:apply-templates select="//book" mode="brief">
+					<xsl:sort select="title"/>
+					<xsl:with-param name="prefix">#</xsl:with-param>
+				</xsl:apply-templates>
+			</list>
+		</xsl:template>
+		<xsl:template name="repeat">
+			<xsl:param name="n"/>
+			<xsl:param name="text" select="'x'"/>
+			<xsl:if test="$n > 0">
+				<xsl:value-of select="$text"/>
+				<xsl:call-template name="repeat"><xsl:with-param name="n" select="$n - 1"/></xsl:call-template>
+			</xsl:if>
+		</xsl:template>
+		<xsl:template match="book" mode="brief">
+			<xsl:param name="prefix"/>
+			<b><xsl:value-of select="concat($prefix, title)"/></b>
+		</xsl:template>
+	</xsl:stylesheet>`, nil)
+
+	exp := `<?xml version="1.0"?><list>xxx<b>#Data</b><b>#Go</b><b>#XML</b></list>`
+	expect(t, "返回值检测", nil == err)
+	expect(t, "检查输出结果", exp == out)
+}
+
+func Test_XSLT_结果树片段和名字空间(t *testing.T) {
+	out, err := transformString(t, `<xsl:transform version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+			xmlns:h="http://www.w3.org/1999/xhtml" xmlns:ext="urn:ext" exclude-result-prefixes="ext">
+		<xsl:output indent="no" omit-xml-declaration="yes" doctype-system="about:legacy-compat"/>
+		<xsl:variable name="rows">
+			<row>1</row><row>2</row>
+		</xsl:variable>
+		<xsl:template match="/">
+			<h:html>
+				<h:p xml:space="preserve"> <xsl:value-of select="count($rows/row)"/> </h:p>
+				<xsl:copy-of select="$rows"/>
+				<xsl:apply-templates select="//book[1]/@id"/>
+				<h:p id="{generate-id(//book[1])}" same="{generate-id(//book[1]) = generate-id(/library/book[1])}"/>
+			</h:html>
+		</xsl:template>
+	</xsl:transform>`, nil)
+
+	exp := `<!DOCTYPE h:html SYSTEM "about:legacy-compat"><h:html xmlns:h="http://www.w3.org/1999/xhtml">` +
+		`<h:p xml:space="preserve"> 2 </h:p><row>1</row><row>2</row>b1<h:p id="id1" same="true"/></h:html>`
+	expect(t, "返回值检测", nil == err)
+	expect(t, "检查输出结果", exp == out)
+}
+
+func Test_XSLT_包含和导入(t *testing.T) {
+	out, err := transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:import href="common.xsl"/>
+		<xsl:template match="/"><r><xsl:apply-templates select="//book[1]/*"/></r></xsl:template>
+		<xsl:template match="author[2]" priority="-10">second</xsl:template>
+	</xsl:stylesheet>`, nil)
+
+	exp := `<?xml version="1.0"?><r><h2>Go</h2>author:Alansecond</r>`
+	expect(t, "导入的模板优先级更低", (nil == err) && (exp == out))
+
+	out, err = transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:include href="common.xsl"/>
+		<xsl:template match="/"><r><xsl:apply-templates select="//book[1]/*"/></r></xsl:template>
+		<xsl:template match="author[2]" priority="-10">second</xsl:template>
+	</xsl:stylesheet>`, nil)
+
+	exp = `<?xml version="1.0"?><r><h2>Go</h2>author:Alanauthor:Brian</r>`
+	expect(t, "包含的模板与当前样式表相同", (nil == err) && (exp == out))
+}
+
+func Test_XSLT_错误(t *testing.T) {
+	tester := func(body string) error {
+		_, err := LoadStylesheet(strings.NewReader(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">`+body+`</xsl:stylesheet>`), xsltTestResolver)
+		return err
+	}
+
+	expect(t, "合法的样式表", nil == tester(`<xsl:template match="a|b/c|@d"><xsl:value-of select="."/></xsl:template>`))
+	expect(t, "不是样式表", nil != func() error {
+		_, err := LoadStylesheet(strings.NewReader(`<stylesheet/>`), nil)
+		return err
+	}())
+	expect(t, "没有match和name", nil != tester(`<xsl:template/>`))
+	expect(t, "模式不合法", nil != tester(`<xsl:template match="1 + 2"/>`))
+	expect(t, "表达式不合法", nil != tester(`<xsl:template match="a"><xsl:value-of select="b["/></xsl:template>`))
+	expect(t, "属性值模板不合法", nil != tester(`<xsl:template match="a"><b c="{d"/></xsl:template>`))
+	expect(t, "不支持的指令", nil != tester(`<xsl:template match="a"><xsl:number/></xsl:template>`))
+	expect(t, "不支持的顶层元素", nil != tester(`<xsl:key name="k" match="a" use="b"/>`))
+	expect(t, "不支持的输出方法", nil != tester(`<xsl:output method="text"/>`))
+	expect(t, "choose中没有when", nil != tester(`<xsl:template match="a"><xsl:choose/></xsl:template>`))
+	expect(t, "循环包含", nil != tester(`<xsl:include href="loop.xsl"/>`))
+
+	run := func(template string) error {
+		_, err := transformString(t, `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">`+template+`</xsl:stylesheet>`, nil)
+		return err
+	}
+
+	expect(t, "正常的转换", nil == run(`<xsl:template match="/"><a/></xsl:template>`))
+	expect(t, "多个根元素", nil != run(`<xsl:template match="/"><a/><b/></xsl:template>`))
+	expect(t, "根元素之外的文本", nil != run(`<xsl:template match="/">text<a/></xsl:template>`))
+	expect(t, "子节点之后添加属性", nil != run(`<xsl:template match="/"><a><b/><xsl:attribute name="x">1</xsl:attribute></a></xsl:template>`))
+	expect(t, "元素名不合法", nil != run(`<xsl:template match="/"><xsl:element name="a b"/></xsl:template>`))
+	expect(t, "未定义的命名模板", nil != run(`<xsl:template match="/"><xsl:call-template name="x"/></xsl:template>`))
+	expect(t, "未定义的变量", nil != run(`<xsl:template match="/"><a><xsl:value-of select="$x"/></a></xsl:template>`))
+	expect(t, "无限递归", nil != run(`<xsl:template match="/" name="r"><xsl:call-template name="r"/></xsl:template>`))
+	expect(t, "终止转换的消息", nil != run(`<xsl:template match="/"><xsl:message terminate="yes">stop</xsl:message></xsl:template>`))
+}
+
+func Test_XSLT_消息和扩展函数(t *testing.T) {
+	sheet, err := LoadStylesheet(strings.NewReader(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:template match="/"><xsl:message>books: <xsl:value-of select="count(//book)"/></xsl:message><r><xsl:value-of select="ext:upper(//title)"/></r></xsl:template>
+	</xsl:stylesheet>`), nil)
+	expect(t, "加载样式表", nil == err)
+
+	var messages []string
+	sheet.OnMessage = func(message string) {
+		messages = append(messages, message)
+	}
+	sheet.Functions = map[string]XPathFunc{
+		"ext:upper": func(context XPathNode, args []interface{}) (interface{}, error) {
+			return strings.ToUpper(XPathString(args[0])), nil
+		},
+	}
+
+	doc, _ := LoadDocument(strings.NewReader(xsltTestDocument))
+	result, err := sheet.Transform(doc, nil)
+	expect(t, "返回值检测", nil == err)
+	expect(t, "扩展函数", "GO" == result.RootElement().Text())
+	expect(t, "消息", (1 == len(messages)) && ("books: 3" == messages[0]))
+	expect(t, "源文档不变", "b1" == doc.RootElement().FirstChildElement("book").Attribute("id", ""))
+}
+
+func Test_XSLT_格式化数字(t *testing.T) {
+	expect(t, "分组和小数", "1,234.50" == xsltFormatNumber(1234.5, "#,##0.00"))
+	expect(t, "最少整数位", "007" == xsltFormatNumber(7, "000"))
+	expect(t, "可选小数位", "0.1" == xsltFormatNumber(0.1, "0.##"))
+	expect(t, "负数", "-3" == xsltFormatNumber(-3, "0"))
+	expect(t, "负数子模式", "(3)" == xsltFormatNumber(-3, "0;(0)"))
+	expect(t, "百分比", "25%" == xsltFormatNumber(0.25, "0%"))
+	expect(t, "NaN", "NaN" == xsltFormatNumber(xpathNaN(), "0"))
+}
+
+func xpathNaN() float64 {
+	return XPathNumber("x")
+}
+
+func Test_XSLT_嵌套的相对位置(t *testing.T) {
+	files := map[string]string{
+		"lib/main.xsl": `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+			<xsl:include href="sub/root.xsl"/>
+		</xsl:stylesheet>`,
+		"lib/sub/root.xsl": `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+			<xsl:template match="/"><ok/></xsl:template>
+		</xsl:stylesheet>`,
+	}
+
+	sheet, err := LoadStylesheet(strings.NewReader(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+		<xsl:import href="lib/main.xsl"/>
+	</xsl:stylesheet>`), fileResolver(files))
+	expect(t, "相对于引用它的样式表查找", nil == err)
+	if nil != err {
+		return
+	}
+
+	doc, _ := LoadDocument(strings.NewReader(`<a/>`))
+	result, err := sheet.Transform(doc, nil)
+	expect(t, "使用嵌套包含的模板", (nil == err) && ("ok" == result.RootElement().Name()))
+}